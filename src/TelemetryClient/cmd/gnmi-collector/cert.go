@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+// runCert implements the cert subcommands:
+//
+//	gnmi-collector cert rotate [-config config.yaml] [-target name]
+//
+// rotate replaces the gNMI server certificate of every target with
+// tls.rotation configured, or of the named target only.
+func runCert(args []string) error {
+	if len(args) == 0 || args[0] != "rotate" {
+		return errors.New("usage: gnmi-collector cert rotate [-config config.yaml] [-target name]")
+	}
+	fs := flag.NewFlagSet("cert rotate", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	target := fs.String("target", "", "Rotate only this target (name or address:port)")
+	fs.Parse(args[1:])
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	rotated := 0
+	for _, tcfg := range cfg.TargetConfigs() {
+		if *target != "" && *target != tcfg.TargetLabel() && *target != tcfg.TargetAddr() {
+			continue
+		}
+		if tcfg.Target.TLS.Rotation == nil {
+			if *target != "" {
+				return fmt.Errorf("target %s has no tls.rotation configured", *target)
+			}
+			continue
+		}
+		if err := rotateTarget(tcfg); err != nil {
+			errs = append(errs, fmt.Errorf("target %s: %w", tcfg.TargetLabel(), err))
+			continue
+		}
+		rotated++
+	}
+	if rotated == 0 && len(errs) == 0 {
+		if *target != "" {
+			return fmt.Errorf("no target %s in %s", *target, *configPath)
+		}
+		return fmt.Errorf("no target in %s has tls.rotation configured", *configPath)
+	}
+	return errors.Join(errs...)
+}
+
+// rotateTarget rotates one target's server certificate.
+func rotateTarget(tcfg *config.Config) error {
+	log.Printf("Rotating server certificate of %s...", tcfg.TargetLabel())
+	client, err := gnmiclient.NewClient(tcfg)
+	if err != nil {
+		return fmt.Errorf("gNMI connect: %w", err)
+	}
+	defer client.Close()
+
+	cert, err := client.RotateCertificate(context.Background())
+	if cert == nil {
+		return err
+	}
+	fmt.Printf("%s: installed certificate %q (SHA-256 %s), valid until %s\n",
+		tcfg.TargetLabel(), tcfg.Target.TLS.Rotation.CertificateID, gnmiclient.CertFingerprint(cert), cert.NotAfter.Format(time.RFC3339))
+	return err
+}
@@ -5,27 +5,47 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
-	"strings"
 	"syscall"
 	"time"
 
 	"gnmi-collector/internal/azure"
 	"gnmi-collector/internal/collector"
 	"gnmi-collector/internal/config"
-	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/health"
+	"gnmi-collector/internal/prometheus"
+	"gnmi-collector/internal/spool"
 	"gnmi-collector/internal/transform"
 )
 
 var version = "dev"
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "cert":
+			run = runCert
+		case "secrets":
+			run = runSecrets
+		}
+		if run != nil {
+			log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+			if err := run(os.Args[2:]); err != nil {
+				log.Fatalf("FATAL: %v", err)
+			}
+			return
+		}
+	}
+
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
-	dryRun := flag.Bool("dry-run", false, "Fetch and transform but print to stdout instead of sending to Azure")
+	dryRun := flag.Bool("dry-run", false, "Fetch and transform but print to stdout instead of writing to the configured sinks")
 	once := flag.Bool("once", false, "Run a single collection cycle then exit")
 	dump := flag.String("dump", "", "Directory to save raw gNMI JSON responses")
-	output := flag.String("output", "", "Directory to write transformed JSON files (for external Azure sender)")
+	output := flag.String("output", "", "Directory to write transformed JSON files instead of the configured sinks (for external Azure sender)")
 	verbose := flag.Bool("verbose", false, "Print the exact JSON payload sent to Azure")
 	showVersion := flag.Bool("version", false, "Show version and exit")
 	flag.Parse()
@@ -37,97 +57,151 @@ func main() {
 
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
-	// Load config
-	cfg, err := config.Load(*configPath)
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatalf("FATAL: load config: %v", err)
-	}
-
-	// Validate path names against the transformer registry at startup.
-	if err := cfg.ValidatePathNames(transform.RegisteredNames()); err != nil {
-		log.Fatalf("FATAL: config validation: %v", err)
-	}
-
-	enabledPaths := 0
-	for _, p := range cfg.Paths {
-		if p.Enabled {
-			enabledPaths++
-		}
+		log.Fatalf("FATAL: %v", err)
 	}
-	log.Printf("Loaded config: target=%s, %d paths enabled, interval=%s",
-		cfg.TargetAddr(), enabledPaths, cfg.Collection.Interval)
+	targets := cfg.TargetConfigs()
 
-	// Validate gNMI credentials before dialing
-	gnmiUser, gnmiPass := cfg.ResolveCredentials()
-	if gnmiUser == "" || gnmiPass == "" {
-		log.Fatalf("FATAL: gNMI credentials not set — ensure required environment variables are configured")
-	}
-
-	// Connect gNMI
-	log.Printf("Connecting to gNMI server at %s...", cfg.TargetAddr())
-	client, err := gnmiclient.NewClient(cfg)
-	if err != nil {
-		log.Fatalf("FATAL: gNMI connect: %v", err)
-	}
-	defer client.Close()
-
-	// Verify connectivity with Capabilities
-	capCtx, capCancel := context.WithTimeout(context.Background(), cfg.Collection.Timeout)
-	caps, err := client.Capabilities(capCtx)
-	capCancel()
-	if err != nil {
-		log.Fatalf("FATAL: gNMI capabilities: %v", err)
-	}
-	log.Printf("Connected — gNMI version %s, %d models", caps.GetGNMIVersion(), len(caps.GetSupportedModels()))
-
-	// Discover and expand template paths (e.g., {network_instance}).
-	// This queries the device to find all VRFs/network-instances and
-	// creates concrete paths for each one.
-	expandedPaths, err := collector.DiscoverAndExpand(client, cfg.Paths)
-	if err != nil {
-		log.Fatalf("FATAL: path discovery: %v", err)
+	// Resolve output sinks. --dry-run and --output replace the sinks
+	// section for ad-hoc runs; otherwise the configured sinks apply
+	// (a single azure sink when the section is omitted).
+	sinks := append([]config.SinkConfig(nil), cfg.Sinks...)
+	switch {
+	case *dryRun:
+		sinks = []config.SinkConfig{{Type: "stdout"}}
+	case *output != "":
+		sinks = []config.SinkConfig{{Type: "directory", Dir: *output}}
 	}
-	cfg.Paths = expandedPaths
 
-	// Setup Azure logger (unless dry-run or output mode)
+	// Setup Azure logger if any sink needs it
 	var logger *azure.Logger
 	var wsID string
-	if !*dryRun && *output == "" {
+	if hasSink(sinks, "azure") {
 		var pk, sk string
-		wsID, pk, sk = cfg.ResolveAzureKeys()
+		wsID, pk, sk, err = cfg.ResolveAzureKeys()
+		if err != nil {
+			log.Fatalf("FATAL: %v", err)
+		}
 		if wsID == "" || pk == "" {
-			log.Printf("WARN: Azure credentials not set — running in dry-run mode")
+			log.Printf("WARN: Azure credentials not set — azure sink prints to stdout instead (dry-run)")
+			for i := range sinks {
+				if sinks[i].Type == "azure" {
+					sinks[i].Type = "stdout"
+				}
+			}
 			*dryRun = true
 		} else {
 			logger, err = azure.NewLogger(wsID, pk, sk, cfg.Azure.DeviceType)
 			if err != nil {
 				log.Fatalf("FATAL: Azure logger: %v", err)
 			}
+			// Pick up workspace key rollovers from the secret store.
+			logger.SetKeySource(func() (string, string, error) {
+				_, pk, sk, err := cfg.ResolveAzureKeys()
+				return pk, sk, err
+			})
 			if *verbose {
 				logger.SetVerbose(true)
 			}
 		}
 	}
 
-	// Log operating mode
-	switch {
-	case *dryRun:
-		log.Printf("Mode: dry-run (print to stdout, no Azure send)")
-	case *output != "":
-		log.Printf("Mode: file output → %s (for external Azure sender)", *output)
-	default:
-		displayID := wsID
-		if len(wsID) > 8 {
-			displayID = wsID[:8]
+	// Logs Ingestion API clients, one per logs_ingestion sink
+	ingestion := map[*config.LogsIngestionConfig]*azure.IngestionClient{}
+	for _, sc := range sinks {
+		if sc.Type != "logs_ingestion" {
+			continue
+		}
+		client, err := newIngestionClient(cfg, sc.LogsIngestion)
+		if err != nil {
+			log.Fatalf("FATAL: logs_ingestion sink: %v", err)
 		}
-		log.Printf("Mode: direct Azure POST (workspace %s...)", displayID)
+		ingestion[sc.LogsIngestion] = client
 	}
 
-	// Create collector
-	c := collector.New(cfg, client, logger, *dryRun, *dump, *output, *verbose)
+	// Durable retry queue for failed Azure uploads
+	var sp *spool.Spool
+	if logger != nil && cfg.Azure.Spool.Dir != "" {
+		sc := cfg.Azure.Spool
+		sp, err = spool.Open(sc.Dir, spool.Options{
+			MaxBytes:     sc.MaxBytes,
+			MaxAge:       sc.MaxAge,
+			SegmentBytes: sc.SegmentBytes,
+			DropPolicy:   sc.DropPolicy,
+		})
+		if err != nil {
+			log.Fatalf("FATAL: Azure spool: %v", err)
+		}
+		log.Printf("Spool: %s (%d batches queued)", sc.Dir, sp.Len())
+	}
+
+	// Self-monitoring counters, reported on /healthz, /readyz, /metrics
+	// and as periodic CollectorHealth_CL rows
+	stats := health.NewStats(cfg.Health.StaleAfter)
+	if sp != nil {
+		stats.SetSpool(sp)
+	}
+
+	// HTTP endpoints. The prometheus sink serves telemetry and internal
+	// metrics on its listener; health endpoints go there too unless
+	// health.listen names a separate address.
+	var metrics *prometheus.Store
+	var metricsAddr string
+	muxes := map[string]*http.ServeMux{}
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	for _, sc := range sinks {
+		if sc.Type == "prometheus" {
+			metrics = prometheus.NewStore(sc.ExpireAfter)
+			metricsAddr = sc.Listen
+			mux(metricsAddr).Handle("/metrics", prometheus.Handler(metrics, stats))
+		}
+	}
+	switch healthAddr := cfg.Health.Listen; {
+	case healthAddr != "" && healthAddr != metricsAddr:
+		m := mux(healthAddr)
+		m.HandleFunc("/healthz", stats.Healthz)
+		m.HandleFunc("/readyz", stats.Readyz)
+		m.Handle("/metrics", prometheus.Handler(stats))
+	case metricsAddr != "":
+		m := mux(metricsAddr)
+		m.HandleFunc("/healthz", stats.Healthz)
+		m.HandleFunc("/readyz", stats.Readyz)
+	}
+	var servers []*http.Server
+	for addr, m := range muxes {
+		srv, err := serveHTTP(addr, m)
+		if err != nil {
+			log.Fatalf("FATAL: HTTP listener: %v", err)
+		}
+		log.Printf("HTTP: listening on %s", addr)
+		servers = append(servers, srv)
+	}
+
+	// Log where rows will go
+	for _, sc := range sinks {
+		log.Printf("Sink: %s", describeSink(sc, wsID))
+	}
+
+	// One isolated collection loop per target
+	sup := collector.NewSupervisor(cfg, collector.Options{
+		Sinks:     sinks,
+		Logger:    logger,
+		Spool:     sp,
+		Metrics:   metrics,
+		Health:    stats,
+		Ingestion: ingestion,
+		DryRun:    *dryRun,
+		DumpDir:   *dump,
+	})
 
 	if *once {
-		if err := c.RunOnce(); err != nil {
+		if err := sup.RunOnce(context.Background()); err != nil {
 			log.Printf("Collection completed with errors: %v", err)
 			os.Exit(1)
 		}
@@ -138,9 +212,6 @@ func main() {
 	// Context cancellation alone cannot interrupt a Recv blocked on a
 	// half-open TCP connection; the keepalive timeout may take tens of
 	// seconds to fire. A hard deadline guarantees the process exits promptly.
-	//
-	// NOTE: Config changes require a full service restart. There is no
-	// hot-reload (SIGHUP) support yet — only SIGINT/SIGTERM are handled.
 	ctx, cancel := context.WithCancel(context.Background())
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -156,33 +227,170 @@ func main() {
 		})
 	}()
 
-	if strings.EqualFold(cfg.Collection.Mode, "subscribe") {
-		// Subscribe mode: persistent streaming connection
-		log.Printf("Starting subscribe stream. Press Ctrl+C to stop.")
-		if err := c.RunStream(ctx); err != nil {
-			log.Fatalf("FATAL: subscribe stream: %v", err)
+	// SIGHUP re-reads the config file and applies the difference to the
+	// running targets. A config that fails to load or validate is rejected
+	// and the running config stays in effect. Azure credentials and the
+	// output mode are process-wide and still require a restart.
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go func() {
+		for range hupCh {
+			log.Printf("Received SIGHUP, reloading %s", *configPath)
+			newCfg, err := loadConfig(*configPath)
+			if err == nil {
+				err = sup.Reload(newCfg)
+			}
+			if err != nil {
+				log.Printf("ERROR: config reload rejected, keeping running config: %v", err)
+			}
 		}
-	} else {
-		// Poll mode: periodic Get requests
-		ticker := time.NewTicker(cfg.Collection.Interval)
-		defer ticker.Stop()
+	}()
 
-		log.Printf("Starting poll loop (interval=%s). Press Ctrl+C to stop.", cfg.Collection.Interval)
+	if sp != nil {
+		go sp.Run(ctx, logger.Send, azure.IsRetryable)
+	}
 
-		// Run first collection immediately
-		if err := c.RunOnce(); err != nil {
-			log.Printf("Collection completed with errors: %v", err)
+	log.Printf("Starting %d target(s) in %s mode. Press Ctrl+C to stop.", len(targets), cfg.Collection.Mode)
+	err = sup.Run(ctx)
+	if sp != nil {
+		sp.Close()
+	}
+	for _, srv := range servers {
+		srv.Close()
+	}
+	if err != nil {
+		log.Fatalf("FATAL: %v", err)
+	}
+}
+
+// hasSink reports whether any sink has the given type.
+func hasSink(sinks []config.SinkConfig, typ string) bool {
+	for _, sc := range sinks {
+		if sc.Type == typ {
+			return true
 		}
+	}
+	return false
+}
 
-		for {
-			select {
-			case <-ticker.C:
-				if err := c.RunOnce(); err != nil {
-					log.Printf("Collection completed with errors: %v", err)
-				}
-			case <-ctx.Done():
-				return
+// describeSink renders a sink for the startup log.
+func describeSink(sc config.SinkConfig, wsID string) string {
+	var desc string
+	switch sc.Type {
+	case "stdout":
+		desc = "stdout (print to stdout, no Azure send)"
+	case "directory":
+		desc = fmt.Sprintf("directory → %s (for external Azure sender)", sc.Dir)
+	case "logs_ingestion":
+		desc = fmt.Sprintf("Azure Logs Ingestion API → %s", sc.LogsIngestion.Endpoint)
+	case "prometheus":
+		desc = fmt.Sprintf("Prometheus /metrics on %s", sc.Listen)
+	case "azure":
+		displayID := wsID
+		if len(wsID) > 8 {
+			displayID = wsID[:8]
+		}
+		desc = fmt.Sprintf("direct Azure POST (workspace %s...)", displayID)
+	default:
+		desc = sc.Type
+	}
+	if len(sc.Include) > 0 {
+		desc += fmt.Sprintf(", include %v", sc.Include)
+	}
+	if len(sc.Exclude) > 0 {
+		desc += fmt.Sprintf(", exclude %v", sc.Exclude)
+	}
+	return desc
+}
+
+// serveHTTP starts an HTTP listener for the collector's endpoints. The
+// address is bound before returning so a port conflict fails startup
+// instead of surfacing later in a goroutine.
+func serveHTTP(addr string, handler http.Handler) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("ERROR: HTTP listener %s: %v", addr, err)
+		}
+	}()
+	return srv, nil
+}
+
+// newIngestionClient creates the Logs Ingestion API client of a
+// logs_ingestion sink, authenticating with its service principal's
+// client secret or certificate. A client secret is looked up again for
+// every token so a rotated secret is picked up.
+func newIngestionClient(cfg *config.Config, lc *config.LogsIngestionConfig) (*azure.IngestionClient, error) {
+	tenantID, clientID, secret, err := cfg.ResolveIngestionCredentials(lc)
+	if err != nil {
+		return nil, err
+	}
+	if tenantID == "" || clientID == "" {
+		return nil, fmt.Errorf("tenant/client ID not set — ensure %s and %s are configured", lc.TenantIDEnv, lc.ClientIDEnv)
+	}
+
+	var tokens *azure.ClientCredential
+	if lc.CertificateFile != "" {
+		tokens, err = azure.NewClientCertificateCredential(lc.AuthorityHost, tenantID, clientID, lc.CertificateFile)
+	} else {
+		if secret == "" {
+			return nil, fmt.Errorf("client secret not set — ensure %s is configured", lc.ClientSecretEnv)
+		}
+		tokens, err = azure.NewClientSecretCredential(lc.AuthorityHost, tenantID, clientID, secret)
+		if err == nil {
+			tokens.SetSecretSource(func() (string, error) {
+				_, _, secret, err := cfg.ResolveIngestionCredentials(lc)
+				return secret, err
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	streams := make(map[string]azure.Stream, len(lc.Streams))
+	for table, st := range lc.Streams {
+		streams[table] = azure.Stream{DCR: st.DCRImmutableID, Name: st.Stream}
+	}
+	return azure.NewIngestionClient(lc.Endpoint, lc.DCRImmutableID, streams, tokens, cfg.Azure.DeviceType)
+}
+
+// loadConfig loads and validates the config file, checking the path
+// names against the transformer registry and the gNMI credentials of
+// every target. Used both at startup and on SIGHUP reload.
+func loadConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+
+	if err := cfg.ValidatePathNames(transform.RegisteredNames()); err != nil {
+		return nil, fmt.Errorf("config validation: %w", err)
+	}
+
+	for _, tcfg := range cfg.TargetConfigs() {
+		enabledPaths := 0
+		for _, p := range tcfg.Paths {
+			if p.Enabled {
+				enabledPaths++
 			}
 		}
+		log.Printf("Loaded config: target=%s, %d paths enabled, interval=%s",
+			tcfg.TargetLabel(), enabledPaths, tcfg.Collection.Interval)
+
+		// Validate gNMI credentials before dialing; with a client
+		// certificate the switch authenticates the collector by mTLS.
+		gnmiUser, gnmiPass, err := tcfg.ResolveCredentials()
+		if err != nil {
+			return nil, err
+		}
+		if (gnmiUser == "" || gnmiPass == "") && !tcfg.Target.TLS.MutualTLS() {
+			return nil, fmt.Errorf("gNMI credentials not set for target %s — ensure required environment variables are configured", tcfg.TargetLabel())
+		}
 	}
+	return cfg, nil
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gnmi-collector/internal/secrets"
+)
+
+// runSecrets implements the secrets subcommands:
+//
+//	gnmi-collector secrets encrypt -host-key FILE [-in secrets.json] [-out secrets.enc]
+//
+// encrypt turns a JSON object of secret names and values into a file
+// for the encrypted_file provider, readable only with the host key.
+func runSecrets(args []string) error {
+	if len(args) == 0 || args[0] != "encrypt" {
+		return errors.New("usage: gnmi-collector secrets encrypt -host-key FILE [-in secrets.json] [-out secrets.enc]")
+	}
+	fs := flag.NewFlagSet("secrets encrypt", flag.ExitOnError)
+	hostKeyFile := fs.String("host-key", "", "Host key file the secrets are encrypted with")
+	in := fs.String("in", "-", "JSON object of secret names and values (- for stdin)")
+	out := fs.String("out", "-", "Encrypted file to write (- for stdout)")
+	fs.Parse(args[1:])
+	if *hostKeyFile == "" {
+		return errors.New("secrets encrypt: -host-key is required")
+	}
+
+	hostKey, err := os.ReadFile(*hostKeyFile)
+	if err != nil {
+		return fmt.Errorf("reading host key: %w", err)
+	}
+	var plain []byte
+	if *in == "-" {
+		plain, err = io.ReadAll(os.Stdin)
+	} else {
+		plain, err = os.ReadFile(*in)
+	}
+	if err != nil {
+		return fmt.Errorf("reading secrets: %w", err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return fmt.Errorf("secrets must be a JSON object of strings: %w", err)
+	}
+
+	sealed, err := secrets.Encrypt(hostKey, plain)
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(sealed)
+		return err
+	}
+	return os.WriteFile(*out, sealed, 0600)
+}
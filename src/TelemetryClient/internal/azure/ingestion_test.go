@@ -0,0 +1,295 @@
+package azure
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEntra is an httptest stand-in for the Entra ID token endpoint.
+type fakeEntra struct {
+	mu        sync.Mutex
+	requests  int
+	expiresIn int
+	lastForm  map[string]string
+}
+
+func (f *fakeEntra) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/tenant-1/oauth2/v2.0/token" {
+		http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+	r.ParseForm()
+	f.mu.Lock()
+	f.requests++
+	n := f.requests
+	f.lastForm = map[string]string{}
+	for k := range r.PostForm {
+		f.lastForm[k] = r.PostForm.Get(k)
+	}
+	f.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": fmt.Sprintf("token-%d", n),
+		"expires_in":   f.expiresIn,
+	})
+}
+
+// fakeDCE is an httptest stand-in for a data collection endpoint.
+type fakeDCE struct {
+	mu       sync.Mutex
+	statuses []int // Responses to return in order; 204 once exhausted
+	calls    []dceCall
+}
+
+type dceCall struct {
+	path, auth string
+	rows       []map[string]interface{}
+}
+
+func (f *fakeDCE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var rows []map[string]interface{}
+	json.Unmarshal(body, &rows)
+
+	f.mu.Lock()
+	f.calls = append(f.calls, dceCall{path: r.URL.Path, auth: r.Header.Get("Authorization"), rows: rows})
+	status := http.StatusNoContent
+	if len(f.statuses) > 0 {
+		status, f.statuses = f.statuses[0], f.statuses[1:]
+	}
+	f.mu.Unlock()
+
+	if r.URL.Query().Get("api-version") != ingestionAPIVersion {
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+}
+
+func newTestIngestion(t *testing.T, entra *fakeEntra, dce *fakeDCE, streams map[string]Stream) *IngestionClient {
+	t.Helper()
+	entraSrv := httptest.NewServer(entra)
+	t.Cleanup(entraSrv.Close)
+	dceSrv := httptest.NewServer(dce)
+	t.Cleanup(dceSrv.Close)
+
+	cred, err := NewClientSecretCredential(entraSrv.URL, "tenant-1", "client-1", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewIngestionClient(dceSrv.URL, "dcr-default", streams, cred, "cisco-nx-os")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestIngestionClientSend(t *testing.T) {
+	entra := &fakeEntra{expiresIn: 3600}
+	dce := &fakeDCE{}
+	c := newTestIngestion(t, entra, dce, map[string]Stream{
+		"CiscoBgp_CL": {DCR: "dcr-bgp", Name: "Custom-Bgp"},
+	})
+
+	ctx := context.Background()
+	if err := c.Send(ctx, "CiscoInterfaceCounter_CL", []map[string]interface{}{{"interface_name": "Eth1/1"}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if err := c.Send(ctx, "CiscoBgp_CL", []map[string]interface{}{{"hostname": "tor-1", "peer": "10.0.0.1"}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if entra.requests != 1 {
+		t.Errorf("token requests = %d, want 1 (cached)", entra.requests)
+	}
+	if got := entra.lastForm["client_secret"]; got != "s3cret" {
+		t.Errorf("client_secret = %q", got)
+	}
+	if got := entra.lastForm["scope"]; got != MonitorScope {
+		t.Errorf("scope = %q, want %q", got, MonitorScope)
+	}
+
+	if len(dce.calls) != 2 {
+		t.Fatalf("ingestion calls = %d, want 2", len(dce.calls))
+	}
+	first, second := dce.calls[0], dce.calls[1]
+	if want := "/dataCollectionRules/dcr-default/streams/Custom-CiscoInterfaceCounter_CL"; first.path != want {
+		t.Errorf("default stream path = %s, want %s", first.path, want)
+	}
+	if want := "/dataCollectionRules/dcr-bgp/streams/Custom-Bgp"; second.path != want {
+		t.Errorf("mapped stream path = %s, want %s", second.path, want)
+	}
+	if first.auth != "Bearer token-1" {
+		t.Errorf("Authorization = %q, want Bearer token-1", first.auth)
+	}
+
+	row := first.rows[0]
+	if row["device_type"] != "cisco-nx-os" || row["hostname"] == nil || row["TimeGenerated"] == nil {
+		t.Errorf("row missing injected columns: %v", row)
+	}
+	if got := second.rows[0]["hostname"]; got != "tor-1" {
+		t.Errorf("existing hostname overwritten: %v", got)
+	}
+}
+
+func TestIngestionClientRefreshesToken(t *testing.T) {
+	entra := &fakeEntra{expiresIn: 3600}
+	c := newTestIngestion(t, entra, &fakeDCE{}, nil)
+	cred := c.tokens.(*ClientCredential)
+
+	now := time.Now()
+	cred.now = func() time.Time { return now }
+	rows := []map[string]interface{}{{"a": 1}}
+	c.Send(context.Background(), "T_CL", rows)
+
+	// Still valid 50 minutes later; inside the refresh skew at 56.
+	now = now.Add(50 * time.Minute)
+	c.Send(context.Background(), "T_CL", rows)
+	if entra.requests != 1 {
+		t.Errorf("token requests = %d, want 1 before expiry", entra.requests)
+	}
+	now = now.Add(6 * time.Minute)
+	c.Send(context.Background(), "T_CL", rows)
+	if entra.requests != 2 {
+		t.Errorf("token requests = %d, want 2 after refresh", entra.requests)
+	}
+}
+
+func TestIngestionClientRetriesUnauthorizedOnce(t *testing.T) {
+	entra := &fakeEntra{expiresIn: 3600}
+	dce := &fakeDCE{statuses: []int{http.StatusUnauthorized}}
+	c := newTestIngestion(t, entra, dce, nil)
+
+	if err := c.Send(context.Background(), "T_CL", []map[string]interface{}{{"a": 1}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if entra.requests != 2 || len(dce.calls) != 2 {
+		t.Errorf("token requests = %d, ingestion calls = %d, want 2 and 2", entra.requests, len(dce.calls))
+	}
+	if dce.calls[1].auth != "Bearer token-2" {
+		t.Errorf("retry used %q, want the fresh token", dce.calls[1].auth)
+	}
+}
+
+func TestIngestionClientRejectedPayload(t *testing.T) {
+	dce := &fakeDCE{statuses: []int{http.StatusBadRequest}}
+	c := newTestIngestion(t, &fakeEntra{expiresIn: 3600}, dce, nil)
+
+	err := c.Send(context.Background(), "T_CL", []map[string]interface{}{{"a": 1}})
+	if err == nil {
+		t.Fatal("expected error for 400 response")
+	}
+	if IsRetryable(err) {
+		t.Errorf("400 should not be retryable: %v", err)
+	}
+}
+
+func TestChunkEntries(t *testing.T) {
+	entries := make([]map[string]interface{}, 10)
+	for i := range entries {
+		entries[i] = map[string]interface{}{"v": strings.Repeat("x", 20)}
+	}
+	bodies, err := chunkEntries(entries, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, b := range bodies {
+		if len(b) > 100 {
+			t.Errorf("chunk of %d bytes exceeds limit", len(b))
+		}
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(b, &rows); err != nil {
+			t.Fatalf("chunk is not a JSON array: %v", err)
+		}
+		total += len(rows)
+	}
+	if total != 10 || len(bodies) < 2 {
+		t.Errorf("got %d rows in %d chunks, want 10 rows split across chunks", total, len(bodies))
+	}
+}
+
+func TestClientCertificateCredential(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gnmi-collector"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(t.TempDir(), "sp.pem")
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})...)
+	if err := os.WriteFile(certFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entra := &fakeEntra{expiresIn: 3600}
+	srv := httptest.NewServer(entra)
+	defer srv.Close()
+	cred, err := NewClientCertificateCredential(srv.URL, "tenant-1", "client-1", certFile)
+	if err != nil {
+		t.Fatalf("NewClientCertificateCredential() error = %v", err)
+	}
+	if _, err := cred.Token(context.Background()); err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+
+	if _, ok := entra.lastForm["client_secret"]; ok {
+		t.Error("certificate credential must not send a client secret")
+	}
+	parts := strings.Split(entra.lastForm["client_assertion"], ".")
+	if len(parts) != 3 {
+		t.Fatalf("client_assertion is not a JWT: %q", entra.lastForm["client_assertion"])
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("assertion signature does not verify: %v", err)
+	}
+
+	var header map[string]string
+	h, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(h, &header)
+	thumb := sha1.Sum(der)
+	if header["x5t"] != base64.RawURLEncoding.EncodeToString(thumb[:]) {
+		t.Errorf("x5t = %q, want the certificate's SHA-1 thumbprint", header["x5t"])
+	}
+
+	var claims map[string]interface{}
+	c, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(c, &claims)
+	if claims["aud"] != srv.URL+"/tenant-1/oauth2/v2.0/token" || claims["sub"] != "client-1" {
+		t.Errorf("claims = %v", claims)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -30,6 +31,7 @@ type Logger struct {
 	deviceType   string
 	httpClient   *http.Client
 	verbose      bool
+	keySource    func() (primaryKey, secondaryKey string, err error)
 }
 
 // NewLogger creates a Logger from the provided credentials.
@@ -60,9 +62,34 @@ func (l *Logger) SetVerbose(v bool) {
 	l.verbose = v
 }
 
+// SetKeySource makes the logger look up its shared keys before every
+// send, so a key rollover in the workspace is picked up without a
+// restart. The keys given to NewLogger are used while the source fails
+// or returns no primary key.
+func (l *Logger) SetKeySource(src func() (primaryKey, secondaryKey string, err error)) {
+	l.keySource = src
+}
+
+// sharedKeys returns the keys to sign the next send with.
+func (l *Logger) sharedKeys() (primaryKey, secondaryKey string) {
+	if l.keySource == nil {
+		return l.primaryKey, l.secondaryKey
+	}
+	pk, sk, err := l.keySource()
+	if err != nil || pk == "" {
+		if err != nil {
+			log.Printf("WARN: looking up Azure keys: %v — using the keys from startup", err)
+		}
+		return l.primaryKey, l.secondaryKey
+	}
+	return pk, sk
+}
+
 // Send posts a batch of JSON entries to a Log Analytics custom table.
 // Each entry should be a map with the telemetry data. The logger adds
-// hostname and device_type metadata automatically.
+// hostname and device_type metadata automatically unless the entry
+// already carries them (multi-target collectors stamp the switch
+// identity before sending).
 func (l *Logger) Send(tableName string, entries []map[string]interface{}) error {
 	if len(entries) == 0 {
 		return nil
@@ -70,8 +97,12 @@ func (l *Logger) Send(tableName string, entries []map[string]interface{}) error
 
 	// Inject metadata into each entry
 	for i := range entries {
-		entries[i]["hostname"] = l.hostname
-		entries[i]["device_type"] = l.deviceType
+		if _, ok := entries[i]["hostname"]; !ok {
+			entries[i]["hostname"] = l.hostname
+		}
+		if _, ok := entries[i]["device_type"]; !ok {
+			entries[i]["device_type"] = l.deviceType
+		}
 	}
 
 	body, err := json.Marshal(entries)
@@ -87,15 +118,16 @@ func (l *Logger) Send(tableName string, entries []map[string]interface{}) error
 	}
 
 	// Try primary key first
-	err = l.post(tableName, body, l.primaryKey)
+	primaryKey, secondaryKey := l.sharedKeys()
+	err = l.post(tableName, body, primaryKey)
 	if err == nil {
 		return nil
 	}
 
 	// Failover to secondary key
-	if l.secondaryKey != "" {
+	if secondaryKey != "" {
 		log.Printf("WARN: primary key failed for %s, trying secondary: %v", tableName, err)
-		return l.post(tableName, body, l.secondaryKey)
+		return l.post(tableName, body, secondaryKey)
 	}
 
 	return err
@@ -131,12 +163,43 @@ func (l *Logger) post(tableName string, body []byte, sharedKey string) error {
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("Azure returned %d for %s: %s", resp.StatusCode, tableName, string(respBody))
+		return &HTTPError{StatusCode: resp.StatusCode, Table: tableName, Body: string(respBody)}
 	}
 
 	return nil
 }
 
+// HTTPError is returned by Send when Azure answers with a non-200 status.
+type HTTPError struct {
+	StatusCode int
+	Table      string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("Azure returned %d for %s: %s", e.StatusCode, e.Table, e.Body)
+}
+
+// IsRetryable reports whether a failed Send may succeed later. Network
+// errors, throttling, timeouts and server errors are retryable, and so
+// are authorization failures, which clear once the key is fixed. Other
+// 4xx responses mean Azure rejected the payload itself.
+func IsRetryable(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return true
+	}
+	switch code := httpErr.StatusCode; {
+	case code >= 500:
+		return true
+	case code == http.StatusUnauthorized, code == http.StatusForbidden,
+		code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
 // buildSignature generates the HMAC-SHA256 authorization header value
 // matching the Azure Log Analytics Data Collector API specification.
 func buildSignature(date string, contentLength int, sharedKey, workspaceID string) (string, error) {
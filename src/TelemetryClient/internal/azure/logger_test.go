@@ -2,6 +2,8 @@ package azure
 
 import (
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -62,3 +64,42 @@ func TestNewLoggerValidation(t *testing.T) {
 		t.Errorf("workspaceID = %q, want ws", l.workspaceID)
 	}
 }
+
+func TestLoggerKeySource(t *testing.T) {
+	l, err := NewLogger("ws", "old-pk", "old-sk", "cisco")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pk, sk := l.sharedKeys(); pk != "old-pk" || sk != "old-sk" {
+		t.Errorf("keys without a source = %q/%q", pk, sk)
+	}
+
+	var srcErr error
+	l.SetKeySource(func() (string, string, error) { return "new-pk", "", srcErr })
+	if pk, sk := l.sharedKeys(); pk != "new-pk" || sk != "" {
+		t.Errorf("keys from the source = %q/%q, want new-pk and no secondary", pk, sk)
+	}
+	srcErr = errors.New("store unreachable")
+	if pk, _ := l.sharedKeys(); pk != "old-pk" {
+		t.Errorf("key with a failing source = %q, want the startup key", pk)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("dial tcp: connection refused"), true},
+		{&HTTPError{StatusCode: 503}, true},
+		{&HTTPError{StatusCode: 429}, true},
+		{&HTTPError{StatusCode: 403}, true},
+		{&HTTPError{StatusCode: 400}, false},
+		{fmt.Errorf("wrapped: %w", &HTTPError{StatusCode: 413}), false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
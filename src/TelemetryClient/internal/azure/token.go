@@ -0,0 +1,312 @@
+package azure
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultAuthorityHost is the Entra ID (Azure AD) login endpoint of
+	// the public cloud.
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+
+	// MonitorScope is the OAuth2 scope for the Logs Ingestion API.
+	MonitorScope = "https://monitor.azure.com/.default"
+
+	// KeyVaultScope is the OAuth2 scope for Azure Key Vault.
+	KeyVaultScope = "https://vault.azure.net/.default"
+
+	// tokenRefreshSkew renews a cached token this long before it expires
+	// so a request never goes out with a token that lapses in flight.
+	tokenRefreshSkew = 5 * time.Minute
+)
+
+// TokenSource returns a bearer token for the Logs Ingestion API.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// ClientCredential obtains tokens with the OAuth2 client-credentials
+// grant, authenticating the service principal with either a client
+// secret or a certificate (signed JWT client assertion). Tokens are
+// cached and refreshed shortly before they expire.
+type ClientCredential struct {
+	tokenURL   string
+	clientID   string
+	scope      string
+	secret     string
+	secretFunc func() (string, error) // Current secret; see SetSecretSource
+	cert       *x509.Certificate
+	key        *rsa.PrivateKey
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewClientSecretCredential creates a credential that authenticates
+// with a client secret. An empty authorityHost selects the public cloud.
+func NewClientSecretCredential(authorityHost, tenantID, clientID, secret string) (*ClientCredential, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("client secret is required")
+	}
+	c, err := newClientCredential(authorityHost, tenantID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	c.secret = secret
+	return c, nil
+}
+
+// NewClientCertificateCredential creates a credential that authenticates
+// with a certificate. certFile is a PEM file holding the certificate and
+// its unencrypted RSA private key (PKCS#1 or PKCS#8), as exported for
+// Entra ID app registrations.
+func NewClientCertificateCredential(authorityHost, tenantID, clientID, certFile string) (*ClientCredential, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client certificate: %w", err)
+	}
+	cert, key, err := parseCertificateAndKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+	c, err := newClientCredential(authorityHost, tenantID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	c.cert, c.key = cert, key
+	return c, nil
+}
+
+// SetScope requests tokens for scope instead of MonitorScope. Call it
+// before the first Token.
+func (c *ClientCredential) SetScope(scope string) {
+	c.mu.Lock()
+	c.scope = scope
+	c.token = ""
+	c.mu.Unlock()
+}
+
+// SetSecretSource makes the credential look up its client secret
+// whenever it requests a token, so a rotated secret is used without a
+// restart. The secret given to NewClientSecretCredential is used while
+// the source fails or returns "".
+func (c *ClientCredential) SetSecretSource(src func() (string, error)) {
+	c.mu.Lock()
+	c.secretFunc = src
+	c.mu.Unlock()
+}
+
+// clientSecret returns the secret for the next token request. Called
+// with c.mu held.
+func (c *ClientCredential) clientSecret() string {
+	if c.secretFunc == nil {
+		return c.secret
+	}
+	secret, err := c.secretFunc()
+	if err != nil {
+		log.Printf("WARN: looking up client secret: %v — using the secret from startup", err)
+	}
+	if secret == "" {
+		return c.secret
+	}
+	return secret
+}
+
+func newClientCredential(authorityHost, tenantID, clientID string) (*ClientCredential, error) {
+	if tenantID == "" {
+		return nil, fmt.Errorf("tenant ID is required")
+	}
+	if clientID == "" {
+		return nil, fmt.Errorf("client ID is required")
+	}
+	if authorityHost == "" {
+		authorityHost = DefaultAuthorityHost
+	}
+	return &ClientCredential{
+		tokenURL:   strings.TrimRight(authorityHost, "/") + "/" + url.PathEscape(tenantID) + "/oauth2/v2.0/token",
+		clientID:   clientID,
+		scope:      MonitorScope,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		now:        time.Now,
+	}, nil
+}
+
+// Token returns the cached token, requesting a new one when it is
+// missing or about to expire.
+func (c *ClientCredential) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && c.now().Before(c.expires.Add(-tokenRefreshSkew)) {
+		return c.token, nil
+	}
+
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {c.clientID},
+		"scope":      {c.scope},
+	}
+	if c.cert != nil {
+		assertion, err := c.clientAssertion()
+		if err != nil {
+			return "", err
+		}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", assertion)
+	} else {
+		form.Set("client_secret", c.clientSecret())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("creating token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return "", fmt.Errorf("decoding token response: %w", err)
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access_token")
+	}
+
+	c.token = tok.AccessToken
+	c.expires = c.now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// Invalidate drops the cached token so the next call fetches a new one.
+// Used after the API rejects a token with 401.
+func (c *ClientCredential) Invalidate() {
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+}
+
+// clientAssertion builds the RS256-signed JWT that proves possession of
+// the certificate's private key. The x5t header carries the SHA-1
+// thumbprint Entra ID uses to find the registered certificate.
+func (c *ClientCredential) clientAssertion() (string, error) {
+	thumb := sha1.Sum(c.cert.Raw)
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": base64.RawURLEncoding.EncodeToString(thumb[:]),
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := c.now()
+	claims := map[string]interface{}{
+		"aud": c.tokenURL,
+		"iss": c.clientID,
+		"sub": c.clientID,
+		"jti": hex.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, c.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("signing client assertion: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// parseCertificateAndKey extracts the first certificate and RSA private
+// key from PEM data.
+func parseCertificateAndKey(data []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	var cert *x509.Certificate
+	var key *rsa.PrivateKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "CERTIFICATE":
+			if cert != nil {
+				continue
+			}
+			c, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing certificate: %w", err)
+			}
+			cert = c
+		case "RSA PRIVATE KEY":
+			k, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing private key: %w", err)
+			}
+			key = k
+		case "PRIVATE KEY":
+			k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing private key: %w", err)
+			}
+			rsaKey, ok := k.(*rsa.PrivateKey)
+			if !ok {
+				return nil, nil, fmt.Errorf("private key is %T, only RSA is supported", k)
+			}
+			key = rsaKey
+		}
+	}
+	if cert == nil {
+		return nil, nil, fmt.Errorf("no CERTIFICATE block found")
+	}
+	if key == nil {
+		return nil, nil, fmt.Errorf("no private key found")
+	}
+	return cert, key, nil
+}
@@ -0,0 +1,243 @@
+package collector
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+// stateCache keeps the latest full state tree of every entity a
+// subscribe session has reported. Sample subscriptions suppress
+// redundant values, so after the initial sync only changed leaves
+// arrive; merging them into the cached tree lets transformers always
+// see the complete entity. Entities are keyed by subscribed YANG path
+// and keyed entity path (e.g. /interfaces/interface[name=Ethernet0]/state/counters).
+type stateCache struct {
+	mu    sync.Mutex
+	paths map[string]map[string]*cachedEntity
+}
+
+type cachedEntity struct {
+	value interface{}
+}
+
+func newStateCache() *stateCache {
+	return &stateCache{paths: map[string]map[string]*cachedEntity{}}
+}
+
+// reset drops all cached state. A new session starts with a full
+// initial dump, so nothing that went away while disconnected survives.
+func (sc *stateCache) reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.paths = map[string]map[string]*cachedEntity{}
+}
+
+// apply merges notifications routed to yangPath into the cache and
+// returns them with every update replaced by a copy of its entity's
+// merged state. Deletes remove whole entities, or single leaves inside
+// one, and are passed through unchanged for transform.Remover.
+func (sc *stateCache) apply(yangPath string, notifs []gnmiclient.Notification) []gnmiclient.Notification {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entities := sc.paths[yangPath]
+	if entities == nil {
+		entities = map[string]*cachedEntity{}
+		sc.paths[yangPath] = entities
+	}
+
+	out := make([]gnmiclient.Notification, 0, len(notifs))
+	for _, n := range notifs {
+		for _, d := range n.Deletes {
+			deleteFromEntities(entities, d)
+		}
+		if len(n.Updates) == 0 {
+			out = append(out, n)
+			continue
+		}
+		merged := gnmiclient.Notification{Timestamp: n.Timestamp, Origin: n.Origin, Target: n.Target, Deletes: n.Deletes}
+		for _, u := range n.Updates {
+			e := entities[u.Path]
+			if e == nil {
+				e = &cachedEntity{}
+				entities[u.Path] = e
+			}
+			e.value = mergeTree(e.value, u.Value)
+			merged.Updates = append(merged.Updates, gnmiclient.Update{Path: u.Path, Value: copyTree(e.value)})
+		}
+		out = append(out, merged)
+	}
+	return out
+}
+
+// snapshot returns every cached entity of yangPath as one notification
+// stamped with now, in the shape transformers get from a live update.
+func (sc *stateCache) snapshot(yangPath string, now time.Time) []gnmiclient.Notification {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entities := sc.paths[yangPath]
+	if len(entities) == 0 {
+		return nil
+	}
+	n := gnmiclient.Notification{Timestamp: now.UnixNano()}
+	for path, e := range entities {
+		n.Updates = append(n.Updates, gnmiclient.Update{Path: path, Value: copyTree(e.value)})
+	}
+	return []gnmiclient.Notification{n}
+}
+
+// deleteFromEntities applies one deleted path: entities at or below it
+// are dropped, and a path inside an entity removes that subtree only.
+func deleteFromEntities(entities map[string]*cachedEntity, deleted string) {
+	for path, e := range entities {
+		switch {
+		case path == deleted || strings.HasPrefix(path, deleted+"/"):
+			delete(entities, path)
+		case strings.HasPrefix(deleted, path+"/"):
+			e.value = deleteSubtree(e.value, splitKeyedPath(strings.TrimPrefix(deleted, path+"/")))
+		}
+	}
+}
+
+// deleteSubtree removes the element named by segments from tree. List
+// elements are matched by their key value, as in list[key=value].
+func deleteSubtree(tree interface{}, segments []string) interface{} {
+	if len(segments) == 0 {
+		return nil
+	}
+	m, ok := tree.(map[string]interface{})
+	if !ok {
+		return tree
+	}
+	name, keyVal := segments[0], ""
+	if i := strings.Index(name, "["); i != -1 {
+		if eq := strings.Index(name, "="); eq > i {
+			keyVal = strings.TrimSuffix(name[eq+1:], "]")
+		}
+		name = name[:i]
+	}
+
+	if keyVal == "" {
+		if len(segments) == 1 {
+			delete(m, name)
+		} else if child, ok := m[name]; ok {
+			m[name] = deleteSubtree(child, segments[1:])
+		}
+		return m
+	}
+
+	list, ok := m[name].([]interface{})
+	if !ok {
+		return m
+	}
+	kept := list[:0]
+	for _, item := range list {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok || getEntityName(itemMap) != keyVal {
+			kept = append(kept, item)
+			continue
+		}
+		if len(segments) > 1 {
+			kept = append(kept, deleteSubtree(itemMap, segments[1:]))
+		}
+	}
+	m[name] = kept
+	return m
+}
+
+// mergeTree merges src into dst: maps are merged key by key, list
+// elements are matched by their entity key (name, id or index) and
+// merged, and anything else is replaced by src.
+func mergeTree(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return copyTree(s)
+		}
+		for k, v := range s {
+			d[k] = mergeTree(d[k], v)
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok {
+			return copyTree(s)
+		}
+		index := map[string]int{}
+		for i, item := range d {
+			if m, ok := item.(map[string]interface{}); ok {
+				if name := getEntityName(m); name != "" {
+					index[name] = i
+				}
+			}
+		}
+		for _, item := range s {
+			m, ok := item.(map[string]interface{})
+			if !ok {
+				// Unkeyed list (e.g. a leaf-list): the update is the whole value.
+				return copyTree(s)
+			}
+			name := getEntityName(m)
+			if i, found := index[name]; found && name != "" {
+				d[i] = mergeTree(d[i], m)
+				continue
+			}
+			d = append(d, copyTree(m))
+		}
+		return d
+	default:
+		return src
+	}
+}
+
+// copyTree deep-copies the maps and lists of a decoded value so cached
+// state is never shared with rows handed to transformers.
+func copyTree(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = copyTree(val)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(t))
+		for i, val := range t {
+			l[i] = copyTree(val)
+		}
+		return l
+	default:
+		return v
+	}
+}
+
+// splitKeyedPath splits a path into segments, keeping list keys that
+// contain slashes (interface[name=Ethernet1/1]) in one piece.
+func splitKeyedPath(path string) []string {
+	var segments []string
+	depth, start := 0, 0
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				if i > start {
+					segments = append(segments, path[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(path) {
+		segments = append(segments, path[start:])
+	}
+	return segments
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+const countersPath = "/openconfig-interfaces:interfaces/interface/state/counters"
+
+func update(ts int64, path string, value interface{}) gnmiclient.Notification {
+	return gnmiclient.Notification{Timestamp: ts, Updates: []gnmiclient.Update{{Path: path, Value: value}}}
+}
+
+func TestStateCacheMergesSuppressedLeaves(t *testing.T) {
+	sc := newStateCache()
+	eth0 := "/interfaces/interface[name=Ethernet0]/state/counters"
+
+	sc.apply(countersPath, []gnmiclient.Notification{
+		update(1, eth0, map[string]interface{}{"in-octets": "100", "out-octets": "200", "in-errors": "0"}),
+	})
+	// Only the changed leaf arrives; the row must still be complete.
+	got := sc.apply(countersPath, []gnmiclient.Notification{
+		update(2, eth0, map[string]interface{}{"in-octets": "150"}),
+	})
+
+	want := map[string]interface{}{"in-octets": "150", "out-octets": "200", "in-errors": "0"}
+	if len(got) != 1 || got[0].Timestamp != 2 || !reflect.DeepEqual(got[0].Updates[0].Value, want) {
+		t.Fatalf("merged = %+v, want %v", got, want)
+	}
+
+	// The returned value is a copy: mutating it leaves the cache intact.
+	got[0].Updates[0].Value.(map[string]interface{})["in-octets"] = "x"
+	snap := sc.snapshot(countersPath, time.Unix(0, 99))
+	if snap[0].Updates[0].Value.(map[string]interface{})["in-octets"] != "150" {
+		t.Error("cache shares state with emitted notifications")
+	}
+}
+
+func TestStateCacheMergesListsByKey(t *testing.T) {
+	sc := newStateCache()
+	path := "/lldp/interfaces/interface[name=Ethernet0]/neighbors"
+	nbr := func(id, name string) map[string]interface{} {
+		return map[string]interface{}{"id": id, "state": map[string]interface{}{"system-name": name, "ttl": "120"}}
+	}
+
+	sc.apply("/lldp/interfaces/interface/neighbors", []gnmiclient.Notification{
+		update(1, path, map[string]interface{}{"neighbor": []interface{}{nbr("1", "spine1"), nbr("2", "spine2")}}),
+	})
+	got := sc.apply("/lldp/interfaces/interface/neighbors", []gnmiclient.Notification{
+		update(2, path, map[string]interface{}{"neighbor": []interface{}{
+			map[string]interface{}{"id": "2", "state": map[string]interface{}{"ttl": "90"}},
+		}}),
+	})
+
+	list := got[0].Updates[0].Value.(map[string]interface{})["neighbor"].([]interface{})
+	if len(list) != 2 {
+		t.Fatalf("neighbors = %v, want both kept", list)
+	}
+	second := list[1].(map[string]interface{})["state"].(map[string]interface{})
+	if second["ttl"] != "90" || second["system-name"] != "spine2" {
+		t.Errorf("neighbor 2 state = %v, want ttl updated and name kept", second)
+	}
+}
+
+func TestStateCacheDeletes(t *testing.T) {
+	sc := newStateCache()
+	yang := "/lldp/interfaces/interface/neighbors"
+	eth0 := "/lldp/interfaces/interface[name=Ethernet1/1]/neighbors"
+	eth1 := "/lldp/interfaces/interface[name=Ethernet1/2]/neighbors"
+	sc.apply(yang, []gnmiclient.Notification{
+		update(1, eth0, map[string]interface{}{"neighbor": []interface{}{
+			map[string]interface{}{"id": "1"}, map[string]interface{}{"id": "2"},
+		}}),
+		update(1, eth1, map[string]interface{}{"neighbor": []interface{}{map[string]interface{}{"id": "3"}}}),
+	})
+
+	// A delete inside an entity removes only that list element, and is
+	// passed on for the transformer's Removed rows.
+	del := gnmiclient.Notification{Timestamp: 2, Deletes: []string{eth0 + "/neighbor[id=1]"}}
+	if got := sc.apply(yang, []gnmiclient.Notification{del}); !reflect.DeepEqual(got, []gnmiclient.Notification{del}) {
+		t.Errorf("delete notification = %+v, want it passed through", got)
+	}
+	// A delete above an entity drops it.
+	sc.apply(yang, []gnmiclient.Notification{{Deletes: []string{"/lldp/interfaces/interface[name=Ethernet1/2]"}}})
+
+	snap := sc.snapshot(yang, time.Unix(0, 3))
+	if len(snap) != 1 || len(snap[0].Updates) != 1 || snap[0].Timestamp != 3 {
+		t.Fatalf("snapshot = %+v, want only %s", snap, eth0)
+	}
+	u := snap[0].Updates[0]
+	list := u.Value.(map[string]interface{})["neighbor"].([]interface{})
+	if u.Path != eth0 || len(list) != 1 || list[0].(map[string]interface{})["id"] != "2" {
+		t.Errorf("remaining entity = %s %v, want neighbor 2 only", u.Path, list)
+	}
+
+	sc.reset()
+	if sc.snapshot(yang, time.Now()) != nil {
+		t.Error("reset should drop all cached state")
+	}
+}
+
+func TestSplitKeyedPath(t *testing.T) {
+	got := splitKeyedPath("/interfaces/interface[name=Ethernet1/1]/state/counters")
+	want := []string{"interfaces", "interface[name=Ethernet1/1]", "state", "counters"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitKeyedPath = %q, want %q", got, want)
+	}
+}
+
+func TestDrillDownBelowSubscribedPathKeepsKeys(t *testing.T) {
+	notifs := []gnmiclient.Notification{
+		update(1, "/openconfig-interfaces:interfaces/interface[name=Ethernet1/1]/state/counters/in-octets", "42"),
+	}
+	got := drillDownToSubscribedPath(notifs, countersPath)
+	if len(got) != 1 {
+		t.Fatalf("got %d notifications, want 1", len(got))
+	}
+	u := got[0].Updates[0]
+	if u.Path != "/interfaces/interface[name=Ethernet1/1]/state/counters" {
+		t.Errorf("path = %q, want the keyed entity path", u.Path)
+	}
+	if !reflect.DeepEqual(u.Value, map[string]interface{}{"in-octets": "42"}) {
+		t.Errorf("value = %v", u.Value)
+	}
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+
+	"gnmi-collector/internal/config"
+)
+
+// nativeRoots maps the root element of vendor-native paths, which carry
+// no module prefix, to the model the switch advertises for them.
+var nativeRoots = map[string]string{
+	"System": "Cisco-NX-OS-device",
+}
+
+// switchModels is what a target's Capabilities response says about the
+// switch: the YANG models it supports and the device type they identify.
+type switchModels struct {
+	deviceType string          // Detected device type; empty when unrecognized
+	models     map[string]bool // Advertised model names; empty skips the model check
+}
+
+func newSwitchModels(caps *gpb.CapabilityResponse) *switchModels {
+	m := &switchModels{
+		deviceType: detectDeviceType(caps.GetSupportedModels()),
+		models:     make(map[string]bool, len(caps.GetSupportedModels())),
+	}
+	for _, md := range caps.GetSupportedModels() {
+		m.models[md.GetName()] = true
+	}
+	return m
+}
+
+// detectDeviceType identifies the switch OS from its supported models:
+// NX-OS advertises its native Cisco-NX-OS-device model and SONiC its
+// sonic-* models. It returns "" for any other switch.
+func detectDeviceType(models []*gpb.ModelData) string {
+	for _, md := range models {
+		name := md.GetName()
+		switch {
+		case strings.HasPrefix(name, "Cisco-NX-OS-"):
+			return "cisco-nx-os"
+		case strings.HasPrefix(name, "sonic-"):
+			return "sonic"
+		}
+	}
+	return ""
+}
+
+// resolve prepares a target config for this switch. A device_type of
+// auto is replaced by the detected one, whose built-in profile supplies
+// the paths and discovery settings when the config has no enabled paths
+// and the encoding when none is set. Enabled paths whose model the
+// switch does not advertise are then disabled with a warning. The
+// returned config is a copy; cfg is not modified.
+func (m *switchModels) resolve(cfg *config.Config, logger *log.Logger) (*config.Config, error) {
+	out := *cfg
+	if out.Azure.DeviceType == config.DeviceTypeAuto {
+		if m.deviceType == "" {
+			return nil, fmt.Errorf("device_type auto: the switch's capabilities match no known device type — set device_type explicitly")
+		}
+		profile, err := config.BuiltinProfile(m.deviceType)
+		if err != nil {
+			return nil, err
+		}
+		out.Azure.DeviceType = m.deviceType
+		if out.Collection.Encoding == "" {
+			out.Collection.Encoding = profile.Collection.Encoding
+		}
+		if enabledPaths(out.Paths) == 0 {
+			out.Paths = profile.Paths
+			out.Discovery = profile.Discovery
+			logger.Printf("INFO: detected device type %s — using its built-in profile (%d paths)", m.deviceType, len(out.Paths))
+		} else {
+			logger.Printf("INFO: detected device type %s", m.deviceType)
+		}
+	}
+
+	out.Paths = m.supportedPaths(out.Paths, logger)
+	if enabledPaths(out.Paths) == 0 {
+		return nil, fmt.Errorf("none of the enabled paths is supported by the switch")
+	}
+	return &out, nil
+}
+
+// supportedPaths returns a copy of paths with every enabled path whose
+// model is missing from the switch's supported models disabled. Paths
+// with no recognizable model, such as SONiC virtual DB paths, are kept.
+func (m *switchModels) supportedPaths(paths []config.PathConfig, logger *log.Logger) []config.PathConfig {
+	out := append([]config.PathConfig(nil), paths...)
+	if len(m.models) == 0 {
+		return out
+	}
+	for i := range out {
+		p := &out[i]
+		if !p.Enabled {
+			continue
+		}
+		if model := pathModel(*p); model != "" && !m.models[model] {
+			logger.Printf("WARN [%s]: switch does not support model %s — disabling path %s", p.LogLabel(), model, p.YANGPath)
+			p.Enabled = false
+		}
+	}
+	return out
+}
+
+// pathModel returns the YANG model a path belongs to: the module prefix
+// of its first element (/openconfig-platform:components → openconfig-platform)
+// or the model of a known native root. It returns "" when the path names
+// no model or addresses a gNMI target rather than the YANG tree.
+func pathModel(p config.PathConfig) string {
+	target, _, path := config.SplitPath(p.GNMIPath())
+	if target != "" {
+		return ""
+	}
+	first := strings.TrimPrefix(path, "/")
+	if i := strings.IndexAny(first, "/["); i >= 0 {
+		first = first[:i]
+	}
+	if i := strings.IndexByte(first, ':'); i >= 0 {
+		return first[:i]
+	}
+	return nativeRoots[first]
+}
+
+// enabledPaths counts the enabled paths.
+func enabledPaths(paths []config.PathConfig) int {
+	n := 0
+	for _, p := range paths {
+		if p.Enabled {
+			n++
+		}
+	}
+	return n
+}
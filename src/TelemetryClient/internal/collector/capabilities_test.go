@@ -0,0 +1,122 @@
+package collector
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+
+	"gnmi-collector/internal/config"
+)
+
+// loadCapabilities reads the NX-OS capabilities dump in testdata.
+func loadCapabilities(t *testing.T) *gpb.CapabilityResponse {
+	t.Helper()
+	data, err := os.ReadFile("../../testdata/capabilities.json")
+	if err != nil {
+		t.Fatalf("failed to read testdata/capabilities.json: %v", err)
+	}
+	var dump struct {
+		Version string           `json:"gnmi_version"`
+		Models  []*gpb.ModelData `json:"supported_models"`
+	}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("failed to parse testdata/capabilities.json: %v", err)
+	}
+	return &gpb.CapabilityResponse{GNMIVersion: dump.Version, SupportedModels: dump.Models}
+}
+
+func sonicCapabilities(models ...string) *gpb.CapabilityResponse {
+	caps := &gpb.CapabilityResponse{}
+	for _, name := range models {
+		caps.SupportedModels = append(caps.SupportedModels, &gpb.ModelData{Name: name, Organization: "SONiC"})
+	}
+	return caps
+}
+
+func TestDetectDeviceType(t *testing.T) {
+	if got := detectDeviceType(loadCapabilities(t).GetSupportedModels()); got != "cisco-nx-os" {
+		t.Errorf("NX-OS capabilities detected as %q", got)
+	}
+	if got := detectDeviceType(sonicCapabilities("openconfig-interfaces", "sonic-port").GetSupportedModels()); got != "sonic" {
+		t.Errorf("SONiC capabilities detected as %q", got)
+	}
+	if got := detectDeviceType(sonicCapabilities("openconfig-interfaces").GetSupportedModels()); got != "" {
+		t.Errorf("OpenConfig-only capabilities detected as %q, want none", got)
+	}
+}
+
+func TestPathModel(t *testing.T) {
+	tests := []struct {
+		path config.PathConfig
+		want string
+	}{
+		{config.PathConfig{YANGPath: "/openconfig-platform:components/component[name={component}]/state"}, "openconfig-platform"},
+		{config.PathConfig{YANGPath: "/openconfig-interfaces:interfaces"}, "openconfig-interfaces"},
+		{config.PathConfig{YANGPath: "/System/intf-items/phys-items"}, "Cisco-NX-OS-device"},
+		{config.PathConfig{YANGPath: "device:/System/mac-items"}, "Cisco-NX-OS-device"},
+		{config.PathConfig{YANGPath: "/interfaces/interface/state"}, ""},
+		{config.PathConfig{YANGPath: "/COUNTERS/Ethernet*", Target: "COUNTERS_DB"}, ""},
+	}
+	for _, tt := range tests {
+		if got := pathModel(tt.path); got != tt.want {
+			t.Errorf("pathModel(%s) = %q, want %q", tt.path.GNMIPath(), got, tt.want)
+		}
+	}
+}
+
+func TestResolveDisablesUnsupportedPaths(t *testing.T) {
+	cfg := &config.Config{
+		Azure: config.AzureConfig{DeviceType: "cisco-nx-os"},
+		Paths: []config.PathConfig{
+			{Name: "components", YANGPath: "/openconfig-platform:components", Enabled: true},
+			{Name: "bgp", YANGPath: "/openconfig-bgp:bgp", Enabled: true},
+			{Name: "native", YANGPath: "/System/mac-items", Enabled: true},
+		},
+	}
+	got, err := newSwitchModels(loadCapabilities(t)).resolve(cfg, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if !got.Paths[0].Enabled || got.Paths[1].Enabled || !got.Paths[2].Enabled {
+		t.Errorf("enabled = %v %v %v, want only the openconfig-bgp path disabled",
+			got.Paths[0].Enabled, got.Paths[1].Enabled, got.Paths[2].Enabled)
+	}
+	if !cfg.Paths[1].Enabled {
+		t.Error("resolve modified the caller's paths")
+	}
+
+	cfg.Paths = cfg.Paths[1:2]
+	if _, err := newSwitchModels(loadCapabilities(t)).resolve(cfg, log.New(io.Discard, "", 0)); err == nil {
+		t.Error("expected an error when no enabled path is supported")
+	}
+}
+
+func TestResolveAutoUsesBuiltinProfile(t *testing.T) {
+	cfg := &config.Config{Azure: config.AzureConfig{DeviceType: config.DeviceTypeAuto}}
+	models := newSwitchModels(sonicCapabilities(
+		"openconfig-interfaces", "openconfig-platform", "openconfig-system",
+		"sonic-platform", "sonic-device-metadata",
+	))
+	got, err := models.resolve(cfg, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	profile, _ := config.BuiltinProfile("sonic")
+	if got.Azure.DeviceType != "sonic" || got.Collection.Encoding != "JSON_IETF" || len(got.Paths) != len(profile.Paths) {
+		t.Errorf("resolved device_type %q, encoding %q, %d paths; want the %d-path sonic profile",
+			got.Azure.DeviceType, got.Collection.Encoding, len(got.Paths), len(profile.Paths))
+	}
+	for _, p := range got.Paths {
+		if p.Enabled && pathModel(p) == "openconfig-network-instance" {
+			t.Errorf("path %s enabled although the switch lacks its model", p.Name)
+		}
+	}
+
+	if _, err := newSwitchModels(sonicCapabilities("openconfig-interfaces")).resolve(cfg, log.New(io.Discard, "", 0)); err == nil {
+		t.Error("expected an error when auto cannot detect the device type")
+	}
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/sink"
+	"gnmi-collector/internal/transform"
+)
+
+const dataTypeCertFingerprintChange = "cert_fingerprint_change"
+
+// certChangeRows returns the audit row of a server certificate
+// fingerprint change, or none when change is nil.
+func certChangeRows(change *gnmiclient.FingerprintChange) []transform.CommonFields {
+	if change == nil {
+		return nil
+	}
+	action := "rejected"
+	if change.Accepted {
+		action = "accepted"
+	}
+	return []transform.CommonFields{transform.NewCommonFields(dataTypeCertFingerprintChange, map[string]interface{}{
+		"address":         change.Addr,
+		"old_fingerprint": change.OldFingerprint,
+		"new_fingerprint": change.NewFingerprint,
+		"subject":         change.Subject,
+		"issuer":          change.Issuer,
+		"policy":          change.Policy,
+		"action":          action,
+		"reason":          change.Reason,
+	}, 0)}
+}
+
+// rejectedCertChange returns the fingerprint change behind a connect
+// error the known_hosts policy caused, or nil.
+func rejectedCertChange(err error) *gnmiclient.FingerprintChange {
+	var rejected *gnmiclient.FingerprintChangeError
+	if errors.As(err, &rejected) {
+		return rejected.Change
+	}
+	return nil
+}
+
+// auditCertChange writes the audit row of a fingerprint change, if any,
+// to the target's TLS audit table.
+func (c *Collector) auditCertChange(ctx context.Context, change *gnmiclient.FingerprintChange) {
+	writeRows(ctx, c.out, c.cfg.Target.TLS.AuditTable, certChangeRows(change), c.log)
+}
+
+// writeRows sends rows to table, logging rather than returning failures.
+func writeRows(ctx context.Context, out sink.Sink, table string, rows []transform.CommonFields, logger *log.Logger) {
+	if out == nil || len(rows) == 0 {
+		return
+	}
+	switch err := out.Write(ctx, table, rows); {
+	case err == nil:
+	case errors.Is(err, sink.ErrDeferred):
+		logger.Printf("WARN: send %s: %v", table, err)
+	default:
+		logger.Printf("ERROR: send %s: %v", table, err)
+	}
+}
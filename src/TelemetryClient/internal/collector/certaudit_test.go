@@ -0,0 +1,33 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/transform"
+)
+
+func TestAuditCertChange(t *testing.T) {
+	cfg := &config.Config{Target: config.TargetConfig{TLS: config.TLSConfig{AuditTable: "CollectorEvent_CL"}}}
+	out := &rowSink{rows: map[string][]transform.CommonFields{}}
+	c := New(cfg, nil, out, "", false)
+
+	change := &gnmiclient.FingerprintChange{
+		Addr: "10.0.0.1:50051", OldFingerprint: "aa", NewFingerprint: "bb",
+		Policy: "accept-if-signed-by", Accepted: false, Reason: "not signed by /ca.pem",
+	}
+	c.auditCertChange(context.Background(), nil)
+	c.auditCertChange(context.Background(), rejectedCertChange(fmt.Errorf("gNMI connect: %w", &gnmiclient.FingerprintChangeError{Change: change})))
+
+	rows := out.rows["CollectorEvent_CL"]
+	if len(rows) != 1 || rows[0].DataType != dataTypeCertFingerprintChange {
+		t.Fatalf("rows = %+v, want one fingerprint change row", rows)
+	}
+	msg := rows[0].Message.(map[string]interface{})
+	if msg["action"] != "rejected" || msg["old_fingerprint"] != "aa" || msg["new_fingerprint"] != "bb" {
+		t.Errorf("row = %v", msg)
+	}
+}
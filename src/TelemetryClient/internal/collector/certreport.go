@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/transform"
+)
+
+const dataTypeGNMICertificate = "gnmi_certificate"
+
+// reportCertificate inspects the certificate the switch presented on the
+// current connection, logs expiry and strength warnings and writes a
+// row to the certificate table. A connection that has not completed its
+// TLS handshake yet is completed with a Capabilities call first.
+func (c *Collector) reportCertificate(ctx context.Context) {
+	tlsCfg := c.cfg.Target.TLS
+	if !tlsCfg.Enabled || c.client == nil {
+		return
+	}
+	cert := c.client.PeerCertificate()
+	if cert == nil {
+		capCtx, cancel := context.WithTimeout(ctx, c.cfg.Collection.Timeout)
+		_, err := c.client.Capabilities(capCtx)
+		cancel()
+		if cert = c.client.PeerCertificate(); cert == nil {
+			c.log.Printf("WARN: no server certificate to inspect: %v", err)
+			return
+		}
+	}
+
+	info := gnmiclient.InspectCert(cert, time.Now())
+	warnAt := expiryWarning(info.DaysToExpiry, tlsCfg.ExpiryWarnDays)
+	logCertWarnings(c.log, c.cfg.TargetAddr(), info, warnAt)
+	writeRows(ctx, c.out, tlsCfg.CertTable, []transform.CommonFields{certificateRow(c.cfg.TargetAddr(), info, warnAt)}, c.log)
+}
+
+// expiryWarning returns the smallest warning threshold the remaining
+// days fall within, or 0 when expiry is further away than all of them.
+func expiryWarning(days int, thresholds []int) int {
+	warnAt := 0
+	for _, t := range thresholds {
+		if days <= t && (warnAt == 0 || t < warnAt) {
+			warnAt = t
+		}
+	}
+	return warnAt
+}
+
+func logCertWarnings(logger *log.Logger, addr string, info gnmiclient.CertInfo, warnAt int) {
+	notAfter := info.NotAfter.Format(time.RFC3339)
+	switch {
+	case info.DaysToExpiry < 0:
+		logger.Printf("ERROR: server certificate of %s expired on %s", addr, notAfter)
+	case warnAt > 0:
+		logger.Printf("WARN: server certificate of %s expires in %d days on %s (within %d days)", addr, info.DaysToExpiry, notAfter, warnAt)
+	}
+	if info.WeakKey {
+		logger.Printf("WARN: server certificate of %s has a weak %d-bit %s key", addr, info.KeyBits, info.KeyType)
+	}
+	if info.SHA1Signature {
+		logger.Printf("WARN: server certificate of %s has a weak %s signature", addr, info.SignatureAlgorithm)
+	}
+}
+
+// certificateRow is the certificate table row for one inspection.
+func certificateRow(addr string, info gnmiclient.CertInfo, warnAt int) transform.CommonFields {
+	return transform.NewCommonFields(dataTypeGNMICertificate, map[string]interface{}{
+		"address":             addr,
+		"subject":             info.Subject,
+		"issuer":              info.Issuer,
+		"sans":                strings.Join(info.SANs, ", "),
+		"serial":              info.Serial,
+		"fingerprint":         info.Fingerprint,
+		"key_type":            info.KeyType,
+		"key_bits":            info.KeyBits,
+		"signature_algorithm": info.SignatureAlgorithm,
+		"not_before":          info.NotBefore.UTC().Format(time.RFC3339),
+		"not_after":           info.NotAfter.UTC().Format(time.RFC3339),
+		"days_to_expiry":      info.DaysToExpiry,
+		"expiry_warning_days": warnAt,
+		"self_signed":         info.SelfSigned,
+		"weak_key":            info.WeakKey,
+		"sha1_signature":      info.SHA1Signature,
+	}, 0)
+}
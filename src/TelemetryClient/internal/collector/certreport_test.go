@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+func TestExpiryWarning(t *testing.T) {
+	thresholds := []int{30, 14, 7}
+	tests := []struct {
+		days int
+		want int
+	}{
+		{90, 0},
+		{31, 0},
+		{30, 30},
+		{20, 30},
+		{14, 14},
+		{8, 14},
+		{3, 7},
+		{-2, 7},
+	}
+	for _, tt := range tests {
+		if got := expiryWarning(tt.days, thresholds); got != tt.want {
+			t.Errorf("expiryWarning(%d) = %d, want %d", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestCertificateRowAndWarnings(t *testing.T) {
+	info := gnmiclient.CertInfo{
+		Subject:            "CN=leaf1",
+		SANs:               []string{"leaf1.example.net", "10.0.0.1"},
+		KeyType:            "RSA",
+		KeyBits:            1024,
+		SignatureAlgorithm: "SHA1-RSA",
+		NotAfter:           time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC),
+		DaysToExpiry:       5,
+		WeakKey:            true,
+		SHA1Signature:      true,
+	}
+	row := certificateRow("10.0.0.1:50051", info, 7)
+	msg := row.Message.(map[string]interface{})
+	if row.DataType != dataTypeGNMICertificate || msg["sans"] != "leaf1.example.net, 10.0.0.1" ||
+		msg["not_after"] != "2026-03-10T00:00:00Z" || msg["expiry_warning_days"] != 7 || msg["weak_key"] != true {
+		t.Errorf("row = %s %v", row.DataType, msg)
+	}
+
+	var buf bytes.Buffer
+	logCertWarnings(log.New(&buf, "", 0), "10.0.0.1:50051", info, 7)
+	for _, want := range []string{"expires in 5 days", "within 7 days", "weak 1024-bit RSA key", "weak SHA1-RSA signature"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log %q missing %q", buf.String(), want)
+		}
+	}
+
+	buf.Reset()
+	info.DaysToExpiry, info.WeakKey, info.SHA1Signature = -1, false, false
+	logCertWarnings(log.New(&buf, "", 0), "10.0.0.1:50051", info, 7)
+	if !strings.HasPrefix(buf.String(), "ERROR: ") || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("expired log = %q", buf.String())
+	}
+}
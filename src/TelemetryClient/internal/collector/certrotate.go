@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"crypto/x509"
+	"time"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/transform"
+)
+
+const dataTypeCertRotation = "cert_rotation"
+
+// rotateCertificates is the scheduled mode of certificate rotation: at
+// start and every check_interval it rotates the switch's server
+// certificate once it is within renew_before_days of expiry. tcfg is a
+// snapshot of the target's config, and each check dials its own
+// connection rather than sharing the collection loop's client, which is
+// replaced on reconnect. Runs until ctx ends.
+func (c *Collector) rotateCertificates(ctx context.Context, tcfg *config.Config) {
+	ticker := time.NewTicker(tcfg.Target.TLS.Rotation.CheckInterval)
+	defer ticker.Stop()
+	for {
+		c.rotateIfExpiring(ctx, tcfg)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rotateIfExpiring rotates the server certificate when it is due and
+// records the outcome in the TLS audit table.
+func (c *Collector) rotateIfExpiring(ctx context.Context, tcfg *config.Config) {
+	rc := tcfg.Target.TLS.Rotation
+	client, err := gnmiclient.NewClient(tcfg)
+	if err != nil {
+		c.log.Printf("WARN: certificate rotation check: %v", err)
+		return
+	}
+	defer client.Close()
+
+	capCtx, cancel := context.WithTimeout(ctx, tcfg.Collection.Timeout)
+	_, err = client.Capabilities(capCtx)
+	cancel()
+	old := client.PeerCertificate()
+	if old == nil {
+		c.log.Printf("WARN: certificate rotation check: no server certificate: %v", err)
+		return
+	}
+	days := gnmiclient.InspectCert(old, time.Now()).DaysToExpiry
+	if days > rc.RenewBeforeDays {
+		return
+	}
+
+	c.log.Printf("INFO: server certificate expires in %d days, rotating certificate %q", days, rc.CertificateID)
+	cert, err := client.RotateCertificate(ctx)
+	switch {
+	case cert == nil:
+		c.log.Printf("ERROR: certificate rotation failed: %v", err)
+	case err != nil:
+		c.log.Printf("ERROR: certificate rotated but not pinned: %v", err)
+	}
+	writeRows(ctx, c.out, tcfg.Target.TLS.AuditTable, []transform.CommonFields{rotationRow(tcfg, old, cert, err)}, c.log)
+}
+
+// rotationRow is the audit row of one rotation attempt. cert is nil
+// when the switch kept its old certificate.
+func rotationRow(tcfg *config.Config, old, cert *x509.Certificate, err error) transform.CommonFields {
+	rc := tcfg.Target.TLS.Rotation
+	keySource := "switch"
+	if rc.KeyFile != "" {
+		keySource = "pushed"
+	}
+	row := map[string]interface{}{
+		"address":         tcfg.TargetAddr(),
+		"certificate_id":  rc.CertificateID,
+		"key_source":      keySource,
+		"old_fingerprint": gnmiclient.CertFingerprint(old),
+		"action":          "rotated",
+	}
+	if cert != nil {
+		row["new_fingerprint"] = gnmiclient.CertFingerprint(cert)
+		row["not_after"] = cert.NotAfter.UTC().Format(time.RFC3339)
+	} else {
+		row["action"] = "failed"
+	}
+	if err != nil {
+		row["reason"] = err.Error()
+	}
+	return transform.NewCommonFields(dataTypeCertRotation, row, 0)
+}
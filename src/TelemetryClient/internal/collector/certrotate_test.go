@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/transform"
+)
+
+func TestRotationRow(t *testing.T) {
+	tcfg := &config.Config{Target: config.TargetConfig{Address: "10.0.0.1", Port: 50051, TLS: config.TLSConfig{
+		Rotation: &config.CertRotationConfig{CertificateID: "gnmi"},
+	}}}
+	old := &x509.Certificate{Raw: []byte("old")}
+	cert := &x509.Certificate{Raw: []byte("new"), NotAfter: time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	row := rotationRow(tcfg, old, cert, nil)
+	msg := row.Message.(map[string]interface{})
+	if row.DataType != dataTypeCertRotation || msg["action"] != "rotated" || msg["key_source"] != "switch" ||
+		msg["not_after"] != "2027-01-01T00:00:00Z" || msg["new_fingerprint"] == msg["old_fingerprint"] {
+		t.Errorf("rotated row = %v", msg)
+	}
+	if _, ok := msg["reason"]; ok {
+		t.Errorf("rotated row has a reason: %v", msg)
+	}
+
+	tcfg.Target.TLS.Rotation.KeyFile = "/etc/gnmi/switch-key.pem"
+	msg = rotationRow(tcfg, old, nil, errors.New("switch still serves the old certificate")).Message.(map[string]interface{})
+	if msg["action"] != "failed" || msg["key_source"] != "pushed" || msg["reason"] == nil || msg["new_fingerprint"] != nil {
+		t.Errorf("failed row = %v", msg)
+	}
+}
+
+// rotatingServer is a TLS server standing in for a switch whose
+// certificate can be replaced while it runs.
+type rotatingServer struct {
+	mu   sync.Mutex
+	cert tls.Certificate
+}
+
+func (s *rotatingServer) serve(cert tls.Certificate) {
+	s.mu.Lock()
+	s.cert = cert
+	s.mu.Unlock()
+}
+
+// start accepts connections until the test ends and returns the port.
+func (s *rotatingServer) start(t *testing.T) int {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		NextProtos: []string{"h2"},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return &s.cert, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// switchCert returns a self-signed server certificate for 127.0.0.1.
+func switchCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestRecoverCertErrorAfterRotation(t *testing.T) {
+	srv := &rotatingServer{}
+	old, _ := switchCert(t)
+	srv.serve(old)
+	cfg := &config.Config{
+		Target: config.TargetConfig{Address: "127.0.0.1", Port: srv.start(t), TLS: config.TLSConfig{
+			Enabled:           true,
+			CAFile:            filepath.Join(t.TempDir(), "switch.pem"),
+			FingerprintPolicy: gnmiclient.PolicyStrict,
+			AuditTable:        "CollectorEvent_CL",
+		}},
+		Collection: config.CollectionConfig{Timeout: 2 * time.Second},
+	}
+	client, err := gnmiclient.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	out := &rowSink{rows: map[string][]transform.CommonFields{}}
+	c := New(cfg, client, out, "", false)
+	defer c.Close()
+
+	// A rotation installs the new certificate and pins it in ca_file.
+	rotated, cert := switchCert(t)
+	srv.serve(rotated)
+	if err := gnmiclient.SaveCertPEM(cert, cfg.Target.TLS.CAFile); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyErr := errors.New("transport: authentication handshake failed: tls: failed to verify certificate: x509: certificate signed by unknown authority")
+	if !c.recoverCertError(context.Background(), verifyErr) {
+		t.Fatal("recoverCertError did not reconnect with the rotated certificate")
+	}
+	if got := c.client.PinnedFingerprint(); got != gnmiclient.CertFingerprint(cert) {
+		t.Errorf("client pins %s, want the rotated certificate", got)
+	}
+	if rows := out.rows["CollectorEvent_CL"]; len(rows) != 0 {
+		t.Errorf("audit rows = %+v, want no fingerprint change for the collector's own rotation", rows)
+	}
+}
@@ -1,56 +1,76 @@
 package collector
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
-	"gnmi-collector/internal/azure"
 	"gnmi-collector/internal/config"
 	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/health"
+	"gnmi-collector/internal/rates"
+	"gnmi-collector/internal/sink"
 	"gnmi-collector/internal/transform"
 )
 
 // Collector orchestrates the gNMI data collection, transformation, and
-// Azure upload cycle.
+// delivery cycle. Where rows end up is decided by its Sink.
 type Collector struct {
 	cfg          *config.Config
 	client       *gnmiclient.Client
-	logger       *azure.Logger
+	out          sink.Sink
 	transformers map[string]transform.Transformer
-	dryRun       bool
-	dumpDir      string
-	outputDir    string // Write transformed JSON files for external sender
-	verbose      bool
+	dryRun       bool                // Log raw notification structure for debugging
+	dumpDir      string              // Save raw gNMI responses
+	log          *log.Logger         // Tags lines with the target name when one is configured
+	updates      chan *config.Config // Reloaded configs, applied by the collection loop
+	templates    *config.Config      // Config with the unexpanded discovery templates of c.cfg.Paths
+	discovered   []config.PathConfig // Last expansion of templates; nil means c.cfg.Paths
+	rediscovery  chan struct{}       // Requests to re-run discovery, handled by the collection loop
+	models       *switchModels       // Models the switch advertised on connect; nil skips reload checks
+	stats        *health.Target      // Self-monitoring counters; nil disables them
+	rates        *rates.Tracker      // Counter delta/rate stage; nil disables it
 }
 
 // New creates a Collector with all registered transformers.
 // Transformers self-register via init() in their source files, so adding
 // a new vendor's transformers only requires creating new files — no
 // changes to this function needed.
-func New(cfg *config.Config, client *gnmiclient.Client, logger *azure.Logger, dryRun bool, dumpDir, outputDir string, verbose ...bool) *Collector {
-	v := false
-	if len(verbose) > 0 {
-		v = verbose[0]
-	}
-
+func New(cfg *config.Config, client *gnmiclient.Client, out sink.Sink, dumpDir string, dryRun bool) *Collector {
 	transformers := transform.BuildMap()
 
 	return &Collector{
 		cfg:          cfg,
 		client:       client,
-		logger:       logger,
+		out:          out,
 		transformers: transformers,
 		dryRun:       dryRun,
 		dumpDir:      dumpDir,
-		outputDir:    outputDir,
-		verbose:      v,
+		log:          newTargetLog(cfg),
+		updates:      make(chan *config.Config, 1),
+		templates:    cfg,
+		rediscovery:  make(chan struct{}, 1),
 	}
 }
 
+// Close releases the collector's gNMI connection and sinks.
+func (c *Collector) Close() error {
+	var errs []error
+	if c.out != nil {
+		errs = append(errs, c.out.Close())
+	}
+	if c.client != nil {
+		errs = append(errs, c.client.Close())
+	}
+	return errors.Join(errs...)
+}
+
 // ReplaceClient closes the existing gNMI client and replaces it with the
 // given one. This is used by the subscribe loop to reconnect with fresh
 // TLS credentials after a certificate rotation.
@@ -62,86 +82,259 @@ func (c *Collector) ReplaceClient(newClient *gnmiclient.Client) {
 }
 
 // RunOnce executes a single collection cycle for all enabled paths.
-// Entries targeting the same table with the same data_type are merged
-// into a single row (e.g., CPU + memory → one system_resources entry).
-func (c *Collector) RunOnce() error {
+func (c *Collector) RunOnce(ctx context.Context) error {
+	var enabled []config.PathConfig
+	for _, pathCfg := range c.cfg.Paths {
+		if pathCfg.Enabled {
+			enabled = append(enabled, pathCfg)
+		}
+	}
+	return c.collect(ctx, enabled)
+}
+
+// collect fetches the given paths and writes their rows to the sinks.
+// Up to collection.max_concurrency paths are fetched at once, and the
+// whole fetch phase is bounded by collection.cycle_timeout; paths still
+// waiting when it expires count as failures. Entries targeting the same
+// table with the same data_type are merged into a single row (e.g.,
+// CPU + memory → one system_resources entry).
+func (c *Collector) collect(ctx context.Context, enabled []config.PathConfig) error {
 	successCount := 0
 	failureCount := 0
 	start := time.Now()
 
-	// Collect all entries first, grouped by table
+	// Results are stored by path index so the merge below sees entries
+	// in config order regardless of which fetch finished first.
+	type result struct {
+		entries []transform.CommonFields
+		err     error
+	}
+	results := make([]result, len(enabled))
+
+	cycleCtx, cancel := context.WithTimeout(ctx, c.cfg.Collection.CycleTimeout)
+	defer cancel()
+
+	workers := min(max(c.cfg.Collection.MaxConcurrency, 1), len(enabled))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := cycleCtx.Err(); err != nil {
+					results[i].err = fmt.Errorf("not started before the cycle deadline: %w", err)
+					continue
+				}
+				results[i].entries, results[i].err = c.fetchAndTransform(cycleCtx, enabled[i])
+			}
+		}()
+	}
+	for i := range enabled {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// Group the collected entries by table
 	type tableEntry struct {
 		table   string
 		entries []transform.CommonFields
 	}
 	collected := map[string]*tableEntry{}
+	var tables []string
 
-	for _, pathCfg := range c.cfg.Paths {
-		if !pathCfg.Enabled {
-			continue
-		}
-
-		entries, err := c.fetchAndTransform(pathCfg)
+	for i, pathCfg := range enabled {
+		entries, err := results[i].entries, results[i].err
 		if err != nil {
-			log.Printf("ERROR [%s]: %v", pathCfg.LogLabel(), err)
+			c.log.Printf("ERROR [%s]: %v", pathCfg.LogLabel(), err)
+			c.stats.SetPathStatus(pathCfg.LogLabel(), health.PathFailed)
 			failureCount++
 			continue
 		}
+		c.stats.SetPathStatus(pathCfg.LogLabel(), health.PathPolled)
 		successCount++
 
 		if len(entries) == 0 {
 			continue
 		}
+		c.stats.Entries(pathCfg.LogLabel(), len(entries))
 
 		te, ok := collected[pathCfg.Table]
 		if !ok {
 			te = &tableEntry{table: pathCfg.Table}
 			collected[pathCfg.Table] = te
+			tables = append(tables, pathCfg.Table)
 		}
 		te.entries = append(te.entries, entries...)
 	}
 
 	// Merge entries with the same (table, data_type) into single rows,
 	// combining their message maps. This merges CPU + memory into one row.
+	var all []transform.CommonFields
 	for _, te := range collected {
 		te.entries = mergeByDataType(te.entries)
+		all = append(all, te.entries...)
+	}
+	c.applyRates(all)
+
+	// Now write all merged entries to the sinks
+	for _, table := range tables {
+		te := collected[table]
+		c.stats.Batch(te.table, len(te.entries))
+		switch err := c.out.Write(ctx, te.table, te.entries); {
+		case err == nil:
+			c.log.Printf("Sent %d entries to %s", len(te.entries), te.table)
+		case errors.Is(err, sink.ErrDeferred):
+			c.log.Printf("WARN: send %s: %v", te.table, err)
+		default:
+			c.log.Printf("ERROR: send %s: %v", te.table, err)
+		}
 	}
 
-	// Now send/print all merged entries
-	for _, te := range collected {
-		if c.dryRun {
-			for _, e := range te.entries {
-				data, _ := json.MarshalIndent(e, "", "  ")
-				fmt.Printf("[%s] %s\n", te.table, string(data))
-			}
-			continue
+	elapsed := time.Since(start)
+	c.log.Printf("Collection complete: %d success, %d failures in %s", successCount, failureCount, elapsed)
+
+	if failureCount > 0 {
+		return fmt.Errorf("%d/%d paths failed", failureCount, successCount+failureCount)
+	}
+	return nil
+}
+
+// RunPoll polls every enabled path immediately and then again each
+// time its sample_interval elapses, until ctx is cancelled. Paths that
+// come due together are collected in one cycle, so rows sharing a table
+// are still sent as one batch. Per-path failures are logged and do not
+// stop the loop. Paths that come due while the previous cycle is still
+// running are skipped rather than queued. Reloaded configs delivered via
+// Update, and rediscovered paths, take effect between cycles.
+func (c *Collector) RunPoll(ctx context.Context) {
+	sched := newPollSchedule(c.cfg.Paths, time.Now())
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	c.log.Printf("Starting poll loop (intervals: %s, max_concurrency=%d)", sched.describe(), c.cfg.Collection.MaxConcurrency)
+
+	var (
+		done       chan struct{} // Non-nil while a cycle is running
+		pending    *config.Config
+		rediscover bool
+	)
+	defer func() {
+		if done != nil {
+			<-done
 		}
-		if c.outputDir != "" {
-			if err := c.writeTransformed(te.table, te.entries); err != nil {
-				log.Printf("ERROR: write %s: %v", te.table, err)
-			}
-			continue
+	}()
+	rearm := func() {
+		if next, ok := sched.nextDue(); ok {
+			timer.Reset(time.Until(next))
+		} else {
+			timer.Stop()
 		}
-		if c.logger != nil {
-			batch := make([]map[string]interface{}, 0, len(te.entries))
-			for _, e := range te.entries {
-				batch = append(batch, flattenEntry(e))
+	}
+	reload := func(ncfg *config.Config) {
+		if c.applyPollReload(ncfg) {
+			sched.sync(c.cfg.Paths, time.Now())
+			rearm()
+		}
+	}
+	applyDiscovery := func() {
+		if paths := c.rediscover(ctx); paths != nil {
+			c.cfg.Paths = paths
+			sched.sync(c.cfg.Paths, time.Now())
+			rearm()
+		}
+	}
+
+	for {
+		select {
+		case now := <-timer.C:
+			paths := sched.due(now)
+			rearm()
+			if len(paths) == 0 {
+				continue
+			}
+			if done != nil {
+				c.log.Printf("WARN: previous collection cycle still running, skipping %d due paths", len(paths))
+				continue
+			}
+			done = make(chan struct{})
+			go func(done chan struct{}) {
+				defer close(done)
+				if err := c.collect(ctx, paths); err != nil {
+					c.log.Printf("Collection completed with errors: %v", err)
+				}
+			}(done)
+		case <-done:
+			done = nil
+			if pending != nil {
+				reload(pending)
+				pending = nil
+			}
+			if rediscover {
+				applyDiscovery()
+				rediscover = false
+			}
+		case ncfg := <-c.updates:
+			if done != nil {
+				// The running cycle reads c.cfg; apply once it finishes.
+				pending = ncfg
+				continue
 			}
-			if err := c.logger.Send(te.table, batch); err != nil {
-				log.Printf("ERROR: send %s: %v", te.table, err)
-			} else {
-				log.Printf("Sent %d entries to %s", len(batch), te.table)
+			reload(ncfg)
+		case <-c.rediscovery:
+			if done != nil {
+				rediscover = true
+				continue
 			}
+			applyDiscovery()
+		case <-ctx.Done():
+			return
 		}
 	}
+}
 
-	elapsed := time.Since(start)
-	log.Printf("Collection complete: %d success, %d failures in %s", successCount, failureCount, elapsed)
+// applyPollReload switches the poll loop to a reloaded config's paths
+// and collection settings. It reports false when the reload is rejected.
+func (c *Collector) applyPollReload(ncfg *config.Config) bool {
+	paths, ok := c.expandReload(ncfg)
+	if !ok {
+		return false
+	}
+	summary := describePathChanges(c.cfg.Paths, paths)
+	c.cfg.Paths = paths
+	c.templates, c.discovered = ncfg, paths
+	summary += c.applyCollectionSettings(ncfg)
+	c.log.Printf("Config reloaded: %s", summary)
+	return true
+}
 
-	if failureCount > 0 {
-		return fmt.Errorf("%d/%d paths failed", failureCount, successCount+failureCount)
+// collectionChanged reports whether a reloaded config changes the
+// collection settings applied by applyCollectionSettings.
+func (c *Collector) collectionChanged(ncfg *config.Config) bool {
+	return ncfg.Collection.Interval != c.cfg.Collection.Interval ||
+		ncfg.Collection.MaxConcurrency != c.cfg.Collection.MaxConcurrency ||
+		ncfg.Collection.CycleTimeout != c.cfg.Collection.CycleTimeout
+}
+
+// applyCollectionSettings adopts a reloaded config's collection
+// interval, max_concurrency and cycle_timeout, and describes the
+// changes for the reload log line. No poll cycle may be running.
+func (c *Collector) applyCollectionSettings(ncfg *config.Config) string {
+	var summary string
+	if ncfg.Collection.Interval != c.cfg.Collection.Interval {
+		c.cfg.Collection.Interval = ncfg.Collection.Interval
+		summary += fmt.Sprintf(", interval=%s", c.cfg.Collection.Interval)
 	}
-	return nil
+	if ncfg.Collection.MaxConcurrency != c.cfg.Collection.MaxConcurrency {
+		c.cfg.Collection.MaxConcurrency = ncfg.Collection.MaxConcurrency
+		summary += fmt.Sprintf(", max_concurrency=%d", c.cfg.Collection.MaxConcurrency)
+	}
+	if ncfg.Collection.CycleTimeout != c.cfg.Collection.CycleTimeout {
+		c.cfg.Collection.CycleTimeout = ncfg.Collection.CycleTimeout
+		summary += fmt.Sprintf(", cycle_timeout=%s", c.cfg.Collection.CycleTimeout)
+	}
+	return summary
 }
 
 // mergeByDataType merges entries with the same DataType into a single entry
@@ -230,14 +423,18 @@ func mapsOverlap(group []transform.CommonFields) bool {
 // If a Get request returns empty values (common on SONiC for list paths),
 // it automatically falls back to Subscribe ONCE mode which retrieves the
 // full current state via the subscription mechanism.
-func (c *Collector) fetchAndTransform(pathCfg config.PathConfig) ([]transform.CommonFields, error) {
+func (c *Collector) fetchAndTransform(ctx context.Context, pathCfg config.PathConfig) ([]transform.CommonFields, error) {
 	// Fetch gNMI data
-	notifications, err := c.client.GetWithTimeout(pathCfg.YANGPath)
+	start := time.Now()
+	getCtx, cancel := context.WithTimeout(ctx, c.cfg.Collection.Timeout)
+	notifications, err := c.client.Get(getCtx, pathCfg.GNMIPath())
+	cancel()
+	c.stats.ObservePath(pathCfg.LogLabel(), "get", time.Since(start), err)
 	if err != nil {
 		// Some devices (e.g., SONiC) return errors for Get on list paths
 		// that lack specific entity keys. Fall back to Subscribe ONCE.
-		log.Printf("INFO [%s]: Get failed (%v), trying Subscribe ONCE fallback", pathCfg.LogLabel(), err)
-		subNotifs, subErr := c.client.SubscribeOnceWithTimeout(pathCfg.YANGPath)
+		c.log.Printf("INFO [%s]: Get failed (%v), trying Subscribe ONCE fallback", pathCfg.LogLabel(), err)
+		subNotifs, subErr := c.subscribeOnceFallback(ctx, pathCfg)
 		if subErr != nil {
 			// Both Get and Subscribe ONCE failed — return the original Get error
 			return nil, fmt.Errorf("gNMI Get: %w", err)
@@ -254,10 +451,10 @@ func (c *Collector) fetchAndTransform(pathCfg config.PathConfig) ([]transform.Co
 	// (e.g., SONiC returns {} for bulk list queries), try Subscribe ONCE
 	// which retrieves the full current state via the subscription mechanism.
 	if len(notifications) > 0 && !gnmiclient.HasNonEmptyValues(notifications) {
-		log.Printf("INFO [%s]: Get returned empty values, falling back to Subscribe ONCE", pathCfg.LogLabel())
-		subNotifs, subErr := c.client.SubscribeOnceWithTimeout(pathCfg.YANGPath)
+		c.log.Printf("INFO [%s]: Get returned empty values, falling back to Subscribe ONCE", pathCfg.LogLabel())
+		subNotifs, subErr := c.subscribeOnceFallback(ctx, pathCfg)
 		if subErr != nil {
-			log.Printf("WARN [%s]: Subscribe ONCE fallback failed: %v", pathCfg.LogLabel(), subErr)
+			c.log.Printf("WARN [%s]: Subscribe ONCE fallback failed: %v", pathCfg.LogLabel(), subErr)
 			// Continue with the original (empty) Get notifications
 		} else if len(subNotifs) > 0 {
 			notifications = subNotifs
@@ -265,14 +462,14 @@ func (c *Collector) fetchAndTransform(pathCfg config.PathConfig) ([]transform.Co
 	}
 
 	if len(notifications) == 0 {
-		log.Printf("WARN [%s]: no notifications returned", pathCfg.LogLabel())
+		c.log.Printf("WARN [%s]: no notifications returned", pathCfg.LogLabel())
 		return nil, nil
 	}
 
 	// Dump raw data if requested
 	if c.dumpDir != "" {
 		if err := c.dumpRaw(pathCfg.LogLabel(), notifications); err != nil {
-			log.Printf("WARN [%s]: dump failed: %v", pathCfg.LogLabel(), err)
+			c.log.Printf("WARN [%s]: dump failed: %v", pathCfg.LogLabel(), err)
 		}
 	}
 
@@ -280,14 +477,14 @@ func (c *Collector) fetchAndTransform(pathCfg config.PathConfig) ([]transform.Co
 	if c.dryRun {
 		for i, n := range notifications {
 			for j, u := range n.Updates {
-				log.Printf("DEBUG [%s] notif[%d].update[%d] path=%s value_type=%T",
+				c.log.Printf("DEBUG [%s] notif[%d].update[%d] path=%s value_type=%T",
 					pathCfg.LogLabel(), i, j, u.Path, u.Value)
 				if m, ok := u.Value.(map[string]interface{}); ok {
 					keys := make([]string, 0, len(m))
 					for k := range m {
 						keys = append(keys, k)
 					}
-					log.Printf("DEBUG [%s]   map keys (%d): %v", pathCfg.LogLabel(), len(keys), keys)
+					c.log.Printf("DEBUG [%s]   map keys (%d): %v", pathCfg.LogLabel(), len(keys), keys)
 				}
 			}
 		}
@@ -305,13 +502,37 @@ func (c *Collector) fetchAndTransform(pathCfg config.PathConfig) ([]transform.Co
 	}
 
 	if len(entries) == 0 {
-		log.Printf("WARN [%s]: transformer produced no entries", pathCfg.LogLabel())
+		c.log.Printf("WARN [%s]: transformer produced no entries", pathCfg.LogLabel())
 		return nil, nil
 	}
 
 	return entries, nil
 }
 
+// applyRates runs the counter delta/rate stage over rows about to be
+// written and persists its state.
+func (c *Collector) applyRates(entries []transform.CommonFields) {
+	if c.rates == nil {
+		return
+	}
+	c.rates.Apply(entries)
+	if err := c.rates.Save(); err != nil {
+		c.log.Printf("WARN: %v", err)
+	}
+}
+
+// subscribeOnceFallback re-fetches a path with Subscribe ONCE after its
+// Get failed or came back empty.
+func (c *Collector) subscribeOnceFallback(ctx context.Context, pathCfg config.PathConfig) ([]gnmiclient.Notification, error) {
+	c.stats.Fallback(pathCfg.LogLabel())
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Collection.Timeout)
+	defer cancel()
+	notifications, err := c.client.SubscribeOnce(ctx, pathCfg.GNMIPath())
+	c.stats.ObservePath(pathCfg.LogLabel(), "subscribe_once", time.Since(start), err)
+	return notifications, err
+}
+
 func (c *Collector) dumpRaw(name string, notifications []gnmiclient.Notification) error {
 	if err := os.MkdirAll(c.dumpDir, 0755); err != nil {
 		return err
@@ -323,45 +544,3 @@ func (c *Collector) dumpRaw(name string, notifications []gnmiclient.Notification
 	path := filepath.Join(c.dumpDir, name+".json")
 	return os.WriteFile(path, data, 0644)
 }
-
-// writeTransformed writes transformed entries as a JSON array to a file named
-// <table>.json in the output directory. These files can be sent to Azure by
-// the existing azure-logger script from the default VRF.
-func (c *Collector) writeTransformed(table string, entries []transform.CommonFields) error {
-	if err := os.MkdirAll(c.outputDir, 0755); err != nil {
-		return err
-	}
-
-	batch := make([]map[string]interface{}, 0, len(entries))
-	for _, e := range entries {
-		batch = append(batch, flattenEntry(e))
-	}
-
-	data, err := json.Marshal(batch)
-	if err != nil {
-		return fmt.Errorf("marshaling transformed data: %w", err)
-	}
-
-	path := filepath.Join(c.outputDir, table+".json")
-	return os.WriteFile(path, data, 0644)
-}
-
-// flattenEntry converts a CommonFields into a flat map suitable for
-// Azure Log Analytics ingestion. The Message map fields are promoted
-// to the top level so that LA does not prefix them with "message_".
-func flattenEntry(e transform.CommonFields) map[string]interface{} {
-	flat := map[string]interface{}{
-		"data_type": e.DataType,
-		"timestamp": e.Timestamp,
-		"date":      e.Date,
-	}
-	if msg, ok := e.Message.(map[string]interface{}); ok {
-		for k, v := range msg {
-			flat[k] = v
-		}
-	} else if e.Message != nil {
-		flat["message"] = e.Message
-	}
-	return flat
-}
-
@@ -1,8 +1,14 @@
 package collector
 
 import (
-	"gnmi-collector/internal/transform"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"gnmi-collector/internal/config"
+	"gnmi-collector/internal/transform"
 )
 
 func TestMergeByDataType(t *testing.T) {
@@ -22,3 +28,94 @@ func TestMergeByDataType(t *testing.T) {
 		t.Errorf("second group data_type = %q, want bgp_summary", merged[1].DataType)
 	}
 }
+
+func TestSupervisorTargetDir(t *testing.T) {
+	single := NewSupervisor(&config.Config{Target: config.TargetConfig{Address: "10.0.0.1", Port: 1}}, Options{})
+	if got := single.targetDir("/out", single.targets[0]); got != "/out" {
+		t.Errorf("single-target dir = %q, want /out", got)
+	}
+
+	multi := NewSupervisor(&config.Config{Targets: []config.TargetConfig{
+		{Name: "tor-1", Address: "10.0.0.1", Port: 1},
+		{Name: "tor-2", Address: "10.0.0.2", Port: 1},
+	}}, Options{})
+	if got := multi.targetDir("/out", multi.targets[1]); got != filepath.Join("/out", "tor-2") {
+		t.Errorf("multi-target dir = %q, want /out/tor-2", got)
+	}
+	if got := multi.targetDir("", multi.targets[1]); got != "" {
+		t.Errorf("unset dir should stay empty, got %q", got)
+	}
+}
+
+func TestSupervisorNewSinkUsesTargetDir(t *testing.T) {
+	dir := t.TempDir()
+	sup := NewSupervisor(&config.Config{Targets: []config.TargetConfig{
+		{Name: "tor-1", Address: "10.0.0.1", Port: 1},
+	}}, Options{Sinks: []config.SinkConfig{{Type: "directory", Dir: dir}}})
+
+	out, err := sup.newSink(sup.targets[0], nil)
+	if err != nil {
+		t.Fatalf("newSink() error = %v", err)
+	}
+	rows := []transform.CommonFields{{DataType: "x", Message: map[string]interface{}{"a": 1}}}
+	if err := out.Write(context.Background(), "T_CL", rows); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tor-1", "T_CL.json")); err != nil {
+		t.Errorf("expected per-target output file: %v", err)
+	}
+
+	// An unnamed target is identified by its address, not the collector host.
+	single := NewSupervisor(&config.Config{Target: config.TargetConfig{Address: "10.0.0.1", Port: 1}},
+		Options{Sinks: []config.SinkConfig{{Type: "directory", Dir: dir}}})
+	out, err = single.newSink(single.targets[0], nil)
+	if err != nil {
+		t.Fatalf("newSink() error = %v", err)
+	}
+	if err := out.Write(context.Background(), "U_CL", rows); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "U_CL.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written []map[string]interface{}
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != 1 || written[0]["hostname"] != "10.0.0.1:1" {
+		t.Errorf("rows = %v, want hostname 10.0.0.1:1", written)
+	}
+
+	azureOnly := NewSupervisor(&config.Config{Target: config.TargetConfig{Address: "10.0.0.1", Port: 1}},
+		Options{Sinks: []config.SinkConfig{{Type: "azure"}}})
+	if _, err := azureOnly.newSink(azureOnly.targets[0], nil); err == nil {
+		t.Error("azure sink without a logger should fail")
+	}
+}
+
+func TestSupervisorTrackerOutlivesSessions(t *testing.T) {
+	cfg := &config.Config{
+		Targets: []config.TargetConfig{{Name: "tor-1", Address: "10.0.0.1", Port: 1}},
+		Rates:   config.RatesConfig{Enabled: true},
+	}
+	sup := NewSupervisor(cfg, Options{})
+	tcfg := sup.targets[0]
+	tlog := newTargetLog(tcfg)
+
+	first := sup.tracker(tcfg, tlog)
+	if first == nil || sup.tracker(tcfg, tlog) != first {
+		t.Fatal("reconnecting with the same config should reuse the tracker")
+	}
+
+	changed := *tcfg
+	changed.Rates.DataTypes = []string{"interface_counters"}
+	if sup.tracker(&changed, tlog) == first {
+		t.Error("a changed rates config should start a new tracker")
+	}
+
+	changed.Rates.Enabled = false
+	if sup.tracker(&changed, tlog) != nil {
+		t.Error("disabled rates should yield no tracker")
+	}
+}
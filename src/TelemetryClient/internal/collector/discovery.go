@@ -3,60 +3,122 @@ package collector
 import (
 	"fmt"
 	"log"
+	"math"
+	"regexp"
 	"strings"
 
 	"gnmi-collector/internal/config"
 	gnmiclient "gnmi-collector/internal/gnmi"
 )
 
-// discoveryPlaceholder is the template token used in YANG paths that should
-// be expanded at startup via gNMI discovery.
-const discoveryPlaceholder = "{network_instance}"
-
-// discoveryBasePath is the OpenConfig path queried to discover all
-// network-instance names on the device.
-const discoveryBasePath = "/openconfig-network-instance:network-instances/network-instance"
-
-// DiscoverAndExpand resolves template placeholders in config paths by
-// querying the device for the available network-instance names.
+// DiscoverAndExpand resolves the {variable} templates in config paths
+// against the device. Each variable used by an enabled path (see
+// config.DiscoveryConfig) is resolved once to the key values found on
+// the switch, and every templated path is expanded into one concrete
+// path per combination of values, up to discovery.max_paths per path.
 //
-// Paths containing {network_instance} are expanded into one concrete path
-// per discovered instance. For BGP paths the expansion also validates that
-// the BGP container actually exists on each instance, skipping those where
-// it does not to avoid "zero neighbors" false positives.
+// BGP paths are also checked for the BGP container on each concrete
+// network-instance, skipping those where it does not exist to avoid
+// "zero neighbors" false positives.
 //
 // Paths without templates are passed through unchanged.
-func DiscoverAndExpand(client *gnmiclient.Client, paths []config.PathConfig) ([]config.PathConfig, error) {
+func DiscoverAndExpand(client *gnmiclient.Client, discovery config.DiscoveryConfig, paths []config.PathConfig) ([]config.PathConfig, error) {
 	// Quick check: do any enabled paths actually use templates?
-	hasTemplates := false
+	var used []string
+	seen := map[string]bool{}
 	for _, p := range paths {
-		if p.Enabled && strings.Contains(p.YANGPath, discoveryPlaceholder) {
-			hasTemplates = true
-			break
+		if !p.Enabled {
+			continue
+		}
+		for _, v := range config.TemplateVariables(p.YANGPath) {
+			if !seen[v] {
+				seen[v] = true
+				used = append(used, v)
+			}
 		}
 	}
-	if !hasTemplates {
+	if len(used) == 0 {
 		return paths, nil
 	}
 
-	// Discover network-instance names from the device.
-	names, err := discoverNetworkInstances(client)
+	values := make(map[string][]string, len(used))
+	for _, name := range used {
+		def, ok := discovery.Variable(name)
+		if !ok {
+			return nil, fmt.Errorf("template variable {%s} is not declared under discovery.variables", name)
+		}
+		vals, err := discoverValues(client, name, def)
+		if err != nil {
+			return nil, fmt.Errorf("%s discovery: %w", name, err)
+		}
+		values[name] = vals
+	}
+
+	expanded := expandTemplates(paths, values, discovery.MaxPaths, func(yangPath string) (bool, error) {
+		return probePath(client, yangPath)
+	})
+
+	// Fail if any unresolved templates remain (defensive).
+	for _, p := range expanded {
+		if p.Enabled && len(config.TemplateVariables(p.YANGPath)) > 0 {
+			return nil, fmt.Errorf("path %q still contains unresolved template: %s", p.Name, p.YANGPath)
+		}
+	}
+
+	return expanded, nil
+}
+
+// discoverValues lists the values of one template variable: the key of
+// every entry of the list at def.Path, narrowed by the filter and probe.
+// A list with no entries at all is an error; one whose entries are all
+// filtered out is not.
+func discoverValues(client *gnmiclient.Client, name string, def config.DiscoveryVariable) ([]string, error) {
+	found, err := discoverListKeys(client, def.Path, def.Key)
 	if err != nil {
-		return nil, fmt.Errorf("network-instance discovery: %w", err)
+		return nil, err
 	}
-	if len(names) == 0 {
-		return nil, fmt.Errorf("network-instance discovery returned zero instances — check device configuration")
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%s returned no entries — check device configuration", def.Path)
 	}
-	log.Printf("INFO Discovery: found %d network-instance(s): %v", len(names), names)
 
-	// Expand templates.
-	var expanded []config.PathConfig
-	for _, p := range paths {
-		if !strings.Contains(p.YANGPath, discoveryPlaceholder) {
-			expanded = append(expanded, p)
+	var filter *regexp.Regexp
+	if def.Filter != "" {
+		if filter, err = regexp.Compile(def.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+
+	var values []string
+	for _, v := range found {
+		if filter != nil && !filter.MatchString(v) {
 			continue
 		}
-		if !p.Enabled {
+		if def.Probe != "" {
+			probe := strings.ReplaceAll(def.Probe, "{"+name+"}", v)
+			exists, probeErr := probePath(client, probe)
+			if probeErr != nil {
+				log.Printf("WARN Discovery: could not probe %s %q: %v", name, v, probeErr)
+				continue
+			}
+			if !exists {
+				continue
+			}
+		}
+		values = append(values, v)
+	}
+	log.Printf("INFO Discovery: found %d %s value(s) of %d listed: %v", len(values), name, len(found), values)
+	return values, nil
+}
+
+// expandTemplates substitutes every combination of variable values into
+// the enabled templated paths, keeping at most maxPaths (0 = no limit)
+// concrete paths per template. probe checks a BGP container before a
+// BGP path is kept.
+func expandTemplates(paths []config.PathConfig, values map[string][]string, maxPaths int, probe func(string) (bool, error)) []config.PathConfig {
+	var expanded []config.PathConfig
+	for _, p := range paths {
+		vars := config.TemplateVariables(p.YANGPath)
+		if !p.Enabled || len(vars) == 0 {
 			expanded = append(expanded, p)
 			continue
 		}
@@ -64,22 +126,32 @@ func DiscoverAndExpand(client *gnmiclient.Client, paths []config.PathConfig) ([]
 		// Determine if this is a BGP path that needs container validation.
 		isBGPPath := strings.Contains(p.YANGPath, "/bgp/")
 
+		if n := combinationCount(vars, values); maxPaths > 0 && n > maxPaths {
+			log.Printf("WARN Discovery: path %q expands to %d concrete paths — keeping the first %d (discovery.max_paths)", p.Name, n, maxPaths)
+		}
+		combos := combinations(vars, values, maxPaths)
+
 		expandedCount := 0
-		for _, ni := range names {
-			concretePath := strings.ReplaceAll(p.YANGPath, discoveryPlaceholder, ni)
+		for _, combo := range combos {
+			concretePath := p.YANGPath
+			labels := make([]string, len(vars))
+			for i, v := range vars {
+				concretePath = strings.ReplaceAll(concretePath, "{"+v+"}", combo[i])
+				labels[i] = v + "=" + combo[i]
+			}
+			label := strings.Join(labels, ",")
 
 			// For BGP paths, verify the BGP container exists on this
 			// network-instance to avoid silent empty responses.
 			if isBGPPath {
-				bgpBase := buildBGPProbeBase(concretePath)
-				if bgpBase != "" {
-					exists, probeErr := probePath(client, bgpBase)
+				if bgpBase := buildBGPProbeBase(concretePath); bgpBase != "" {
+					exists, probeErr := probe(bgpBase)
 					if probeErr != nil {
-						log.Printf("WARN Discovery: could not probe BGP on network-instance %q: %v", ni, probeErr)
+						log.Printf("WARN Discovery: could not probe BGP for %s: %v", label, probeErr)
 						continue
 					}
 					if !exists {
-						log.Printf("INFO Discovery: skipping network-instance %q for path %q — BGP not configured", ni, p.Name)
+						log.Printf("INFO Discovery: skipping %s for path %q — BGP not configured", label, p.Name)
 						continue
 					}
 				}
@@ -88,84 +160,143 @@ func DiscoverAndExpand(client *gnmiclient.Client, paths []config.PathConfig) ([]
 			clone := p
 			clone.YANGPath = concretePath
 			// Attach a resolved label for logging/debugging.
-			clone.ResolvedLabel = fmt.Sprintf("%s[ni=%s]", p.Name, ni)
+			clone.ResolvedLabel = fmt.Sprintf("%s[%s]", p.Name, label)
 			expanded = append(expanded, clone)
 			expandedCount++
 		}
 
 		if expandedCount == 0 {
-			log.Printf("WARN Discovery: path %q expanded to zero instances — BGP may not be configured on any network-instance", p.Name)
+			log.Printf("WARN Discovery: path %q expanded to zero concrete paths", p.Name)
 		} else {
 			log.Printf("INFO Discovery: expanded %q into %d concrete path(s)", p.Name, expandedCount)
 		}
 	}
+	return expanded
+}
 
-	// Fail if any unresolved templates remain (defensive).
-	for _, p := range expanded {
-		if strings.Contains(p.YANGPath, "{") && strings.Contains(p.YANGPath, "}") {
-			return nil, fmt.Errorf("path %q still contains unresolved template: %s", p.Name, p.YANGPath)
+// combinations returns the assignments of values to vars, varying the
+// last variable fastest, and stops after the first limit of them
+// (0 = no limit) so a large product is never built.
+func combinations(vars []string, values map[string][]string, limit int) [][]string {
+	for _, v := range vars {
+		if len(values[v]) == 0 {
+			return nil
 		}
 	}
+	var combos [][]string
+	idx := make([]int, len(vars))
+	for limit <= 0 || len(combos) < limit {
+		combo := make([]string, len(vars))
+		for i, v := range vars {
+			combo[i] = values[v][idx[i]]
+		}
+		combos = append(combos, combo)
 
-	return expanded, nil
+		// Advance to the next assignment, last variable first.
+		i := len(vars) - 1
+		for ; i >= 0; i-- {
+			if idx[i]++; idx[i] < len(values[vars[i]]) {
+				break
+			}
+			idx[i] = 0
+		}
+		if i < 0 {
+			break
+		}
+	}
+	return combos
+}
+
+// combinationCount returns how many assignments combinations would
+// produce without a limit, saturating at math.MaxInt.
+func combinationCount(vars []string, values map[string][]string) int {
+	n := 1
+	for _, v := range vars {
+		k := len(values[v])
+		if k == 0 {
+			return 0
+		}
+		if n > math.MaxInt/k {
+			return math.MaxInt
+		}
+		n *= k
+	}
+	return n
 }
 
-// discoverNetworkInstances queries the device for all network-instance
-// names using Get with SubscribeOnce fallback (same strategy as normal
-// collection — SONiC returns empty for bulk Get on list paths).
-func discoverNetworkInstances(client *gnmiclient.Client) ([]string, error) {
-	notifs, err := client.GetWithTimeout(discoveryBasePath)
+// discoverListKeys queries a list path and returns the values of key
+// for each entry, using Get with SubscribeOnce fallback (same strategy
+// as normal collection — SONiC returns empty for bulk Get on list paths).
+func discoverListKeys(client *gnmiclient.Client, listPath, key string) ([]string, error) {
+	notifs, err := client.GetWithTimeout(listPath)
 	if err != nil {
-		log.Printf("INFO Discovery: Get on %s failed (%v), trying Subscribe ONCE", discoveryBasePath, err)
-		notifs, err = client.SubscribeOnceWithTimeout(discoveryBasePath)
+		log.Printf("INFO Discovery: Get on %s failed (%v), trying Subscribe ONCE", listPath, err)
+		notifs, err = client.SubscribeOnceWithTimeout(listPath)
 		if err != nil {
-			return nil, fmt.Errorf("Get and Subscribe ONCE both failed for %s: %w", discoveryBasePath, err)
+			return nil, fmt.Errorf("Get and Subscribe ONCE both failed for %s: %w", listPath, err)
 		}
 	}
 
 	// Fallback if Get returned empty values
 	if len(notifs) > 0 && !gnmiclient.HasNonEmptyValues(notifs) {
 		log.Printf("INFO Discovery: Get returned empty values, trying Subscribe ONCE")
-		subNotifs, subErr := client.SubscribeOnceWithTimeout(discoveryBasePath)
+		subNotifs, subErr := client.SubscribeOnceWithTimeout(listPath)
 		if subErr == nil && len(subNotifs) > 0 {
 			notifs = subNotifs
 		}
 	}
 
-	// Extract network-instance names from update paths.
-	// The response paths look like:
-	//   /network-instances/network-instance[name=default]/...
+	return extractListKeys(notifs, listElement(listPath), key), nil
+}
+
+// listElement returns the name of the last element of a list path,
+// without keys or module prefix: "/openconfig-platform:components/component"
+// → "component".
+func listElement(listPath string) string {
+	elem := listPath[strings.LastIndex(listPath, "/")+1:]
+	if i := strings.IndexByte(elem, '['); i >= 0 {
+		elem = elem[:i]
+	}
+	if i := strings.IndexByte(elem, ':'); i >= 0 {
+		elem = elem[i+1:]
+	}
+	return elem
+}
+
+// extractListKeys collects the distinct key values of a list from the
+// update paths, e.g. /components/component[name=Ethernet0]/...; when
+// the paths carry no keys it falls back to the "key" field of the maps
+// (or arrays of maps) returned for the list.
+func extractListKeys(notifs []gnmiclient.Notification, element, key string) []string {
 	seen := make(map[string]bool)
 	var names []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
 	for _, n := range notifs {
 		for _, u := range n.Updates {
-			name := extractKeyFromPath(u.Path, "network-instance", "name")
-			if name != "" && !seen[name] {
-				seen[name] = true
-				names = append(names, name)
-			}
+			add(extractKeyFromPath(u.Path, element, key))
 		}
 	}
 
 	// Also check the notification path itself for top-level maps that
-	// contain a "name" field (some devices return a flat list).
+	// contain the key field (some devices return a flat list).
 	if len(names) == 0 {
 		for _, n := range notifs {
 			for _, u := range n.Updates {
 				if m, ok := u.Value.(map[string]interface{}); ok {
-					if name, ok := m["name"].(string); ok && name != "" && !seen[name] {
-						seen[name] = true
-						names = append(names, name)
-					}
+					name, _ := m[key].(string)
+					add(name)
 				}
 				// Array of instances
 				if arr, ok := u.Value.([]interface{}); ok {
 					for _, item := range arr {
 						if m, ok := item.(map[string]interface{}); ok {
-							if name, ok := m["name"].(string); ok && name != "" && !seen[name] {
-								seen[name] = true
-								names = append(names, name)
-							}
+							name, _ := m[key].(string)
+							add(name)
 						}
 					}
 				}
@@ -173,7 +304,7 @@ func discoverNetworkInstances(client *gnmiclient.Client) ([]string, error) {
 		}
 	}
 
-	return names, nil
+	return names
 }
 
 // extractKeyFromPath extracts a YANG list key value from a gNMI path string.
@@ -1,9 +1,13 @@
 package collector
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
 )
 
 func TestExtractKeyFromPath(t *testing.T) {
@@ -113,7 +117,7 @@ func TestDiscoverAndExpandNoTemplates(t *testing.T) {
 	}
 
 	// nil client is fine — no discovery should happen.
-	result, err := DiscoverAndExpand(nil, paths)
+	result, err := DiscoverAndExpand(nil, config.DiscoveryConfig{}, paths)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -135,7 +139,7 @@ func TestDiscoverAndExpandDisabledTemplate(t *testing.T) {
 		{Name: "system-state", YANGPath: "/system/state", Table: "T2", Enabled: true},
 	}
 
-	result, err := DiscoverAndExpand(nil, paths)
+	result, err := DiscoverAndExpand(nil, config.DiscoveryConfig{}, paths)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -147,3 +151,126 @@ func TestDiscoverAndExpandDisabledTemplate(t *testing.T) {
 		t.Errorf("disabled path changed: got %q, want %q", result[0].YANGPath, paths[0].YANGPath)
 	}
 }
+
+func TestExpandTemplatesCombinations(t *testing.T) {
+	paths := []config.PathConfig{
+		{Name: "dom", YANGPath: "/components/component[name={component}]/transceiver/physical-channels", Enabled: true},
+		{Name: "vrf-intf", YANGPath: "/ni/network-instance[name={vrf}]/interfaces/interface[id={interface}]", Enabled: true},
+		{Name: "system-state", YANGPath: "/system/state", Enabled: true},
+	}
+	values := map[string][]string{
+		"component": {"Ethernet0", "Ethernet4"},
+		"vrf":       {"default", "Vrf_red"},
+		"interface": {"Ethernet0", "Ethernet4"},
+	}
+
+	got := expandTemplates(paths, values, 0, nil)
+	var yangPaths []string
+	for _, p := range got {
+		yangPaths = append(yangPaths, p.YANGPath)
+	}
+	want := []string{
+		"/components/component[name=Ethernet0]/transceiver/physical-channels",
+		"/components/component[name=Ethernet4]/transceiver/physical-channels",
+		"/ni/network-instance[name=default]/interfaces/interface[id=Ethernet0]",
+		"/ni/network-instance[name=default]/interfaces/interface[id=Ethernet4]",
+		"/ni/network-instance[name=Vrf_red]/interfaces/interface[id=Ethernet0]",
+		"/ni/network-instance[name=Vrf_red]/interfaces/interface[id=Ethernet4]",
+		"/system/state",
+	}
+	if !reflect.DeepEqual(yangPaths, want) {
+		t.Errorf("expanded paths = %v, want %v", yangPaths, want)
+	}
+	if got[2].ResolvedLabel != "vrf-intf[vrf=default,interface=Ethernet0]" {
+		t.Errorf("ResolvedLabel = %q", got[2].ResolvedLabel)
+	}
+}
+
+func TestExpandTemplatesCap(t *testing.T) {
+	paths := []config.PathConfig{{Name: "dom", YANGPath: "/c/component[name={component}]", Enabled: true}}
+	values := map[string][]string{"component": {"a", "b", "c"}}
+	if got := expandTemplates(paths, values, 2, nil); len(got) != 2 {
+		t.Errorf("expanded %d paths, want the cap of 2", len(got))
+	}
+}
+
+func TestExpandTemplatesCapLargeProduct(t *testing.T) {
+	values := map[string][]string{}
+	for _, v := range []string{"vrf", "interface", "component", "subinterface"} {
+		for i := range 1000 {
+			values[v] = append(values[v], fmt.Sprintf("%s%d", v, i))
+		}
+	}
+	paths := []config.PathConfig{{
+		Name:     "big",
+		YANGPath: "/ni[name={vrf}]/if[name={interface}]/c[name={component}]/sub[index={subinterface}]",
+		Enabled:  true,
+	}}
+	// 10^12 combinations: building them before the cap would not finish.
+	got := expandTemplates(paths, values, 3, nil)
+	var yangPaths []string
+	for _, p := range got {
+		yangPaths = append(yangPaths, p.YANGPath)
+	}
+	want := []string{
+		"/ni[name=vrf0]/if[name=interface0]/c[name=component0]/sub[index=subinterface0]",
+		"/ni[name=vrf0]/if[name=interface0]/c[name=component0]/sub[index=subinterface1]",
+		"/ni[name=vrf0]/if[name=interface0]/c[name=component0]/sub[index=subinterface2]",
+	}
+	if !reflect.DeepEqual(yangPaths, want) {
+		t.Errorf("expanded paths = %v, want %v", yangPaths, want)
+	}
+	if n := combinationCount([]string{"vrf", "interface", "component", "subinterface"}, values); n != 1_000_000_000_000 {
+		t.Errorf("combinationCount = %d", n)
+	}
+}
+
+func TestExpandTemplatesBGPProbe(t *testing.T) {
+	paths := []config.PathConfig{{
+		Name:     "bgp-neighbors",
+		YANGPath: "/network-instances/network-instance[name={network_instance}]/protocols/protocol[identifier=BGP][name=bgp]/bgp/neighbors",
+		Enabled:  true,
+	}}
+	values := map[string][]string{"network_instance": {"default", "mgmt"}}
+	probe := func(path string) (bool, error) {
+		return strings.Contains(path, "[name=default]"), nil
+	}
+	got := expandTemplates(paths, values, 0, probe)
+	if len(got) != 1 || !strings.Contains(got[0].YANGPath, "[name=default]") {
+		t.Errorf("expanded = %v, want only the default instance", got)
+	}
+}
+
+func TestExtractListKeys(t *testing.T) {
+	fromPaths := []gnmiclient.Notification{{Updates: []gnmiclient.Update{
+		{Path: "/components/component[name=Ethernet0]/state", Value: map[string]interface{}{}},
+		{Path: "/components/component[name=Ethernet0]/transceiver", Value: map[string]interface{}{}},
+		{Path: "/components/component[name=PSU 1]/state", Value: map[string]interface{}{}},
+	}}}
+	if got := extractListKeys(fromPaths, "component", "name"); !reflect.DeepEqual(got, []string{"Ethernet0", "PSU 1"}) {
+		t.Errorf("keys from paths = %v", got)
+	}
+
+	fromValues := []gnmiclient.Notification{{Updates: []gnmiclient.Update{
+		{Path: "/interfaces", Value: []interface{}{
+			map[string]interface{}{"ifname": "Ethernet0"},
+			map[string]interface{}{"ifname": "Ethernet4"},
+		}},
+	}}}
+	if got := extractListKeys(fromValues, "interface", "ifname"); !reflect.DeepEqual(got, []string{"Ethernet0", "Ethernet4"}) {
+		t.Errorf("keys from values = %v", got)
+	}
+}
+
+func TestListElement(t *testing.T) {
+	tests := map[string]string{
+		"/openconfig-platform:components/component":                       "component",
+		"/openconfig-network-instance:network-instances/network-instance": "network-instance",
+		"/interfaces/interface[name=Ethernet0]":                           "interface",
+	}
+	for in, want := range tests {
+		if got := listElement(in); got != want {
+			t.Errorf("listElement(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
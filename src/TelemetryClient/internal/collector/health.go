@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gnmi-collector/internal/sink"
+	"gnmi-collector/internal/transform"
+)
+
+const dataTypeCollectorHealth = "collector_health"
+
+// reportHealth writes the target's self-monitoring stats to the sinks
+// as a CollectorHealth_CL row every report interval, so fleet health
+// lands in Log Analytics next to the telemetry. Runs until ctx ends.
+func (c *Collector) reportHealth(ctx context.Context) {
+	ticker := time.NewTicker(c.cfg.Health.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			table := c.cfg.Health.ReportTable
+			row := transform.NewCommonFields(dataTypeCollectorHealth, c.stats.Report(), 0)
+			switch err := c.out.Write(ctx, table, []transform.CommonFields{row}); {
+			case err == nil:
+			case errors.Is(err, sink.ErrDeferred):
+				c.log.Printf("WARN: send %s: %v", table, err)
+			default:
+				c.log.Printf("ERROR: send %s: %v", table, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
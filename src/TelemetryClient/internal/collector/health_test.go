@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/config"
+	"gnmi-collector/internal/health"
+	"gnmi-collector/internal/transform"
+)
+
+// rowSink collects written rows by table.
+type rowSink struct {
+	mu   sync.Mutex
+	rows map[string][]transform.CommonFields
+}
+
+func (s *rowSink) Write(_ context.Context, table string, rows []transform.CommonFields) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rows[table] = append(s.rows[table], rows...)
+	return nil
+}
+
+func (s *rowSink) Close() error { return nil }
+
+func TestReportHealthWritesRows(t *testing.T) {
+	cfg := &config.Config{Health: config.HealthConfig{ReportInterval: 10 * time.Millisecond, ReportTable: "CollectorHealth_CL"}}
+	out := &rowSink{rows: map[string][]transform.CommonFields{}}
+	c := New(cfg, nil, out, "", false)
+	c.stats = health.NewStats(0).Target("tor-1")
+	c.stats.Entries("interface-counters", 48)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.reportHealth(ctx)
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	rows := out.rows["CollectorHealth_CL"]
+	if len(rows) == 0 {
+		t.Fatal("no health rows written")
+	}
+	msg := rows[0].Message.(map[string]interface{})
+	if rows[0].DataType != "collector_health" || msg["target"] != "tor-1" || msg["ready"] != true {
+		t.Errorf("health row = %+v", rows[0])
+	}
+}
+
+func TestPathHealthPerExpandedPath(t *testing.T) {
+	paths := []config.PathConfig{
+		{Name: "arp-table", YANGPath: "/vrf[name=red]/arp", Table: "T", Enabled: true, ResolvedLabel: "arp-table[vrf=red]"},
+		{Name: "arp-table", YANGPath: "/vrf[name=blue]/arp", Table: "T", Enabled: true, ResolvedLabel: "arp-table[vrf=blue]"},
+	}
+	cfg := &config.Config{Collection: config.CollectionConfig{Mode: "subscribe"}, Paths: paths}
+	c := New(cfg, nil, nil, "", false)
+	c.stats = health.NewStats(0).Target("tor-1")
+	sub, err := c.buildSubscription(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.markStreaming(sub.subs[:1], sub.lookup)
+	c.stats.SetPathStatus(paths[1].LogLabel(), health.PathFailed)
+
+	reported := c.stats.Report()["paths"].(map[string]interface{})
+	for label, want := range map[string]string{"arp-table[vrf=red]": health.PathStreaming, "arp-table[vrf=blue]": health.PathFailed} {
+		ps, ok := reported[label].(map[string]interface{})
+		if !ok || ps["status"] != want {
+			t.Errorf("path %s = %v, want status %s", label, reported[label], want)
+		}
+	}
+}
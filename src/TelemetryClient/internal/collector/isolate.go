@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/health"
+)
+
+// errProbeAccepted ends a probe stream at its first response.
+var errProbeAccepted = errors.New("subscription accepted")
+
+// probeFunc subscribes to a set of paths just long enough to learn
+// whether the switch accepts them, returning nil if it does.
+type probeFunc func(ctx context.Context, subs []gnmiclient.SubscriptionPath) error
+
+// probeSubscription opens a throwaway stream for subs and closes it on
+// the first response. A switch that stays silent until
+// collection.timeout has not rejected the request either, so that also
+// counts as accepted.
+func (c *Collector) probeSubscription(ctx context.Context, subs []gnmiclient.SubscriptionPath) error {
+	probeCtx, cancel := context.WithTimeout(ctx, c.cfg.Collection.Timeout)
+	defer cancel()
+	err := c.client.Subscribe(probeCtx, subs, func(*gpb.SubscribeResponse) error {
+		return errProbeAccepted
+	})
+	if errors.Is(err, errProbeAccepted) || (probeCtx.Err() != nil && ctx.Err() == nil) {
+		return nil
+	}
+	return err
+}
+
+// bisectRejected finds the subscriptions the switch refuses, given that
+// it rejected subs as a whole with InvalidArgument. Each half is probed
+// on its own and rejected halves are split further, so k bad paths out
+// of n cost about 2k·log2(n) probes. It returns no paths when every half
+// is accepted alone, i.e. only the combination is refused. Errors other
+// than InvalidArgument abort the search.
+func bisectRejected(ctx context.Context, subs []gnmiclient.SubscriptionPath, probe probeFunc) ([]gnmiclient.SubscriptionPath, error) {
+	if len(subs) <= 1 {
+		return subs, nil
+	}
+	var rejected []gnmiclient.SubscriptionPath
+	mid := len(subs) / 2
+	for _, half := range [][]gnmiclient.SubscriptionPath{subs[:mid], subs[mid:]} {
+		err := probe(ctx, half)
+		if err == nil {
+			continue
+		}
+		if !isPermanentSubscribeError(err) {
+			return nil, err
+		}
+		found, err := bisectRejected(ctx, half, probe)
+		if err != nil {
+			return nil, err
+		}
+		rejected = append(rejected, found...)
+	}
+	return rejected, nil
+}
+
+// splitRejected divides a subscription into the entries to stream and
+// the paths to poll: those configured for polling and those whose
+// subscription the switch rejected.
+func (s *subscription) splitRejected(rejected map[gnmiclient.SubscriptionPath]bool) ([]gnmiclient.SubscriptionPath, []config.PathConfig) {
+	var stream []gnmiclient.SubscriptionPath
+	rejectedKeys := map[string]bool{}
+	for _, sp := range s.subs {
+		if rejected[sp] {
+			rejectedKeys[pathKey(config.PathConfig{Name: sp.Name, YANGPath: sp.YANGPath})] = true
+			continue
+		}
+		stream = append(stream, sp)
+	}
+	polled := append([]config.PathConfig(nil), s.polled...)
+	for _, p := range s.paths {
+		if p.Enabled && rejectedKeys[pathKey(p)] {
+			polled = append(polled, p)
+		}
+	}
+	return stream, polled
+}
+
+// startPolling polls paths on their sample_interval in the background
+// until the returned stop function is called, which waits for a cycle
+// in progress to finish.
+func (c *Collector) startPolling(ctx context.Context, paths []config.PathConfig) (stop func()) {
+	if len(paths) == 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.pollPaths(ctx, paths)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// pollPaths is the poll loop of subscribe-mode paths the switch would
+// not stream. Cycles run one at a time; a path that came due during a
+// long cycle is rescheduled rather than run twice.
+func (c *Collector) pollPaths(ctx context.Context, paths []config.PathConfig) {
+	sched := newPollSchedule(paths, time.Now())
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case now := <-timer.C:
+			if due := sched.due(now); len(due) > 0 {
+				if err := c.collect(ctx, due); err != nil {
+					c.log.Printf("Fallback poll completed with errors: %v", err)
+				}
+			}
+			if next, ok := sched.nextDue(); ok {
+				timer.Reset(time.Until(next))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// markStreaming records the subscribed paths as streaming.
+func (c *Collector) markStreaming(subs []gnmiclient.SubscriptionPath, lookup map[string]pathMapping) {
+	for _, sp := range subs {
+		c.stats.SetPathStatus(pathLabel(lookup, sp), health.PathStreaming)
+	}
+}
+
+// pruneRejected forgets rejected entries that are no longer part of the
+// subscription, so a path whose mode or interval was changed by a reload
+// is offered to the stream again.
+func pruneRejected(rejected map[gnmiclient.SubscriptionPath]bool, subs []gnmiclient.SubscriptionPath) {
+	keep := map[gnmiclient.SubscriptionPath]bool{}
+	for _, sp := range subs {
+		keep[sp] = true
+	}
+	for sp := range rejected {
+		if !keep[sp] {
+			delete(rejected, sp)
+		}
+	}
+}
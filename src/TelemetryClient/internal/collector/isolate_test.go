@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+func subsNamed(names ...string) []gnmiclient.SubscriptionPath {
+	subs := make([]gnmiclient.SubscriptionPath, len(names))
+	for i, n := range names {
+		subs[i] = gnmiclient.SubscriptionPath{Name: n, YANGPath: "/" + n, Mode: "sample", SampleInterval: time.Minute}
+	}
+	return subs
+}
+
+// rejectingProbe refuses any set that contains one of the bad paths.
+func rejectingProbe(calls *int, bad ...string) probeFunc {
+	return func(_ context.Context, subs []gnmiclient.SubscriptionPath) error {
+		*calls++
+		for _, sp := range subs {
+			for _, b := range bad {
+				if sp.Name == b {
+					return status.Errorf(codes.InvalidArgument, "on_change not supported for %s", sp.YANGPath)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func TestBisectRejected(t *testing.T) {
+	var calls int
+	subs := subsNamed("a", "b", "c", "d", "e", "f", "g", "h")
+	got, err := bisectRejected(context.Background(), subs, rejectingProbe(&calls, "c", "h"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := subsNamed("c", "h"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rejected = %v, want %v", got, want)
+	}
+	if calls > 12 {
+		t.Errorf("%d probes for 2 bad paths out of 8, want at most 12", calls)
+	}
+}
+
+func TestBisectRejectedOnlyCombination(t *testing.T) {
+	// Every half is accepted alone: nothing can be blamed.
+	var calls int
+	got, err := bisectRejected(context.Background(), subsNamed("a", "b"), rejectingProbe(&calls))
+	if err != nil || len(got) != 0 {
+		t.Errorf("rejected = %v, %v; want none", got, err)
+	}
+}
+
+func TestBisectRejectedStopsOnOtherErrors(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "connection reset")
+	probe := func(context.Context, []gnmiclient.SubscriptionPath) error { return unavailable }
+	if _, err := bisectRejected(context.Background(), subsNamed("a", "b", "c"), probe); !errors.Is(err, unavailable) {
+		t.Errorf("err = %v, want the probe error", err)
+	}
+}
+
+func TestSplitRejected(t *testing.T) {
+	subs := subsNamed("counters", "lldp", "bgp")
+	sub := &subscription{subs: subs}
+	for _, sp := range subs {
+		sub.paths = append(sub.paths, config.PathConfig{Name: sp.Name, YANGPath: sp.YANGPath, Enabled: true})
+	}
+	rejected := map[gnmiclient.SubscriptionPath]bool{subs[1]: true}
+
+	stream, polled := sub.splitRejected(rejected)
+	if !reflect.DeepEqual(stream, []gnmiclient.SubscriptionPath{subs[0], subs[2]}) {
+		t.Errorf("stream = %v", stream)
+	}
+	if len(polled) != 1 || polled[0].Name != "lldp" {
+		t.Errorf("polled = %v, want lldp", polled)
+	}
+
+	// A reload that changes the rejected path's mode offers it again.
+	changed := subs[1]
+	changed.Mode = "on_change"
+	pruneRejected(rejected, []gnmiclient.SubscriptionPath{subs[0], changed, subs[2]})
+	if len(rejected) != 0 {
+		t.Errorf("rejected = %v, want the changed path forgotten", rejected)
+	}
+}
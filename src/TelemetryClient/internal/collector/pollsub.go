@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/health"
+)
+
+// RunSubscribePoll collects over one long-lived gNMI POLL subscription
+// (collection.mode subscribe_poll). Every collection.interval it asks
+// the switch for the current state of all subscribed paths; the answer
+// goes through the same normalization, drill-down and transform
+// pipeline as a stream and is flushed when the poll's sync_response
+// arrives. Paths set to collection: poll are fetched with Get alongside.
+// Reconnects, reloads and rediscovery are handled as in RunStream. If
+// the switch rejects the POLL subscription, the target falls back to
+// RunPoll.
+// Blocks until ctx is cancelled.
+func (c *Collector) RunSubscribePoll(ctx context.Context) error {
+	sub, err := c.buildSubscription(c.cfg.Paths)
+	if err != nil {
+		return err
+	}
+
+	c.log.Printf("Subscribe-poll mode: %d paths, polled every %s", len(sub.subs), c.cfg.Collection.Interval)
+	if len(sub.polled) > 0 {
+		c.log.Printf("Polling %d paths with Get alongside the subscription", len(sub.polled))
+	}
+
+	batches := &tableBatches{m: map[string]*tableBatch{}}
+
+	// Reconnect loop
+	delay := initialReconnectDelay
+	for {
+		sessCtx, sessCancel := context.WithCancel(ctx)
+		watch := c.watchReloads(sessCtx, sessCancel, sub, nil)
+		var (
+			healthy bool
+			err     error
+		)
+		if len(sub.subs) > 0 {
+			healthy, err = c.pollSubscription(sessCtx, sub, c.cfg.Collection.Interval, batches)
+		} else {
+			// Every path is fetched with Get; wait for a reload or shutdown.
+			<-sessCtx.Done()
+		}
+		sessCancel()
+		<-watch.done
+		sub = watch.current
+
+		// Rows of a poll cut short by the session ending are not held
+		// back until the next sync_response.
+		c.flushAll(context.WithoutCancel(ctx), batches)
+
+		if ctx.Err() != nil {
+			c.log.Printf("Poll subscription stopped (context cancelled)")
+			return nil
+		}
+
+		if next := watch.next; next != nil {
+			summary := describePathChanges(sub.paths, next.paths)
+			if watch.cfg != nil {
+				summary += c.applyCollectionSettings(watch.cfg)
+			}
+			c.log.Printf("%s: %s — resubscribing with %d paths", watch.reason, summary, len(next.subs))
+			sub = next
+			c.cfg.Paths = sub.paths
+			delay = initialReconnectDelay
+			continue
+		}
+
+		if isPermanentSubscribeError(err) {
+			c.log.Printf("WARN: switch rejected the POLL subscription: %v — falling back to Get polling", err)
+			c.RunPoll(ctx)
+			return nil
+		}
+
+		c.stats.Reconnect()
+		c.requestRediscovery()
+		if c.recoverCertError(ctx, err) {
+			delay = initialReconnectDelay
+			continue
+		}
+		if healthy {
+			delay = initialReconnectDelay
+		}
+
+		c.log.Printf("Poll subscription error: %v — reconnecting in %s", err, delay)
+		select {
+		case <-time.After(delay):
+			delay = min(delay*2, maxReconnectDelay)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// pollSubscription runs one POLL subscription session, polling right
+// away and then every interval. A poll still unanswered when the next
+// one is due is not queued twice. The batches are held from each poll
+// until its sync_response, so a large answer is flushed as one set. The
+// boolean reports whether any poll was answered.
+func (c *Collector) pollSubscription(ctx context.Context, sub *subscription, interval time.Duration, batches *tableBatches) (bool, error) {
+	defer batches.release()
+	polls := make(chan struct{}, 1)
+	queuePoll(polls, batches)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				queuePoll(polls, batches)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	answered := 0
+	err := c.client.SubscribePoll(ctx, sub.subs, polls, func(resp *gpb.SubscribeResponse) error {
+		if resp.GetSyncResponse() {
+			answered++
+			for _, sp := range sub.subs {
+				c.stats.SetPathStatus(pathLabel(sub.lookup, sp), health.PathPolled)
+			}
+			batches.release()
+			c.log.Printf("Poll complete: flushing %d entries", batches.pending())
+			c.flushAll(ctx, batches)
+			return nil
+		}
+
+		notifications, err := gnmiclient.DecodeSubscribeResponseWithPrefix(resp)
+		if err != nil {
+			c.log.Printf("WARN: decode poll response: %v", err)
+			return nil
+		}
+		if len(notifications) > 0 {
+			// Each poll returns the full state, so there is nothing to
+			// merge into a cache.
+			c.route(ctx, notifications, sub.subs, sub.lookup, batches, nil)
+		}
+		return nil
+	})
+	return answered > 0, err
+}
+
+// queuePoll holds the batches for the next poll's answer and queues the
+// poll unless one is still waiting to be sent. A hold already running
+// for an unanswered poll is left as is, so maxSnapshotHold still bounds
+// it.
+func queuePoll(polls chan<- struct{}, batches *tableBatches) {
+	if held, _ := batches.held(); !held {
+		batches.hold()
+	}
+	select {
+	case polls <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,112 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"gnmi-collector/internal/config"
+	"gnmi-collector/internal/transform"
+)
+
+const dataTypeDiscoveryChange = "discovery_change"
+
+// requestRediscovery asks the collection loop to re-run discovery. A
+// request still waiting to be handled is not queued twice.
+func (c *Collector) requestRediscovery() {
+	select {
+	case c.rediscovery <- struct{}{}:
+	default:
+	}
+}
+
+// rediscoverEvery requests a rediscovery every interval until ctx ends.
+func (c *Collector) rediscoverEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.requestRediscovery()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rediscover expands the running config's templates against the switch
+// again. It logs and writes an event row per path added or removed since
+// the previous expansion, so a change is reported once even while the
+// new set is not applied yet. It returns the new path set when it
+// differs from the running one, and nil when it does not or discovery
+// failed. Only called from the collection loop, which owns c.cfg.Paths.
+func (c *Collector) rediscover(ctx context.Context) []config.PathConfig {
+	paths, err := DiscoverAndExpand(c.client, c.templates.Discovery, c.templates.Paths)
+	if err != nil {
+		c.log.Printf("WARN: rediscovery failed, keeping running paths: %v", err)
+		return nil
+	}
+	previous := c.discovered
+	if previous == nil {
+		previous = c.cfg.Paths
+	}
+	c.discovered = paths
+	c.writeDiscoveryEvents(ctx, previous, paths)
+	if added, removed := discoveryChanges(c.cfg.Paths, paths); len(added) == 0 && len(removed) == 0 {
+		return nil
+	}
+	return paths
+}
+
+// writeDiscoveryEvents logs and writes an event row per path added or
+// removed between two expansions.
+func (c *Collector) writeDiscoveryEvents(ctx context.Context, oldPaths, newPaths []config.PathConfig) {
+	added, removed := discoveryChanges(oldPaths, newPaths)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+
+	rows := make([]transform.CommonFields, 0, len(added)+len(removed))
+	event := func(kind string, p config.PathConfig) {
+		c.log.Printf("INFO [%s]: discovery %s %s", p.LogLabel(), kind, p.YANGPath)
+		rows = append(rows, transform.NewCommonFields(dataTypeDiscoveryChange, map[string]interface{}{
+			"event":     kind,
+			"path_name": p.Name,
+			"label":     p.LogLabel(),
+			"yang_path": p.GNMIPath(),
+			"table":     p.Table,
+		}, 0))
+	}
+	for _, p := range added {
+		event("path_added", p)
+	}
+	for _, p := range removed {
+		event("path_removed", p)
+	}
+	writeRows(ctx, c.out, c.cfg.Discovery.EventTable, rows, c.log)
+}
+
+// discoveryChanges lists the enabled paths present in only one of the
+// two path sets.
+func discoveryChanges(oldPaths, newPaths []config.PathConfig) (added, removed []config.PathConfig) {
+	enabled := func(paths []config.PathConfig) map[string]bool {
+		keys := map[string]bool{}
+		for _, p := range paths {
+			if p.Enabled {
+				keys[pathKey(p)] = true
+			}
+		}
+		return keys
+	}
+	before, after := enabled(oldPaths), enabled(newPaths)
+	for _, p := range newPaths {
+		if p.Enabled && !before[pathKey(p)] {
+			added = append(added, p)
+		}
+	}
+	for _, p := range oldPaths {
+		if p.Enabled && !after[pathKey(p)] {
+			removed = append(removed, p)
+		}
+	}
+	return added, removed
+}
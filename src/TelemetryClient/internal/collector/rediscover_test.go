@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"gnmi-collector/internal/config"
+	"gnmi-collector/internal/transform"
+)
+
+func TestDiscoveryChanges(t *testing.T) {
+	oldPaths := []config.PathConfig{
+		{Name: "bgp-global", YANGPath: "/ni[name=default]/bgp", Enabled: true},
+		{Name: "bgp-global", YANGPath: "/ni[name=Vrf_old]/bgp", Enabled: true},
+		{Name: "system-state", YANGPath: "/system/state", Enabled: true},
+	}
+	newPaths := []config.PathConfig{
+		{Name: "bgp-global", YANGPath: "/ni[name=default]/bgp", Enabled: true},
+		{Name: "bgp-global", YANGPath: "/ni[name=Vrf_tenant]/bgp", Enabled: true},
+		{Name: "system-state", YANGPath: "/system/state", Enabled: true},
+	}
+	added, removed := discoveryChanges(oldPaths, newPaths)
+	if len(added) != 1 || added[0].YANGPath != "/ni[name=Vrf_tenant]/bgp" {
+		t.Errorf("added = %v, want the tenant VRF", added)
+	}
+	if len(removed) != 1 || removed[0].YANGPath != "/ni[name=Vrf_old]/bgp" {
+		t.Errorf("removed = %v, want the old VRF", removed)
+	}
+	if added, removed := discoveryChanges(oldPaths, oldPaths); added != nil || removed != nil {
+		t.Errorf("unchanged paths reported %v added, %v removed", added, removed)
+	}
+}
+
+func TestRediscoverWritesEvents(t *testing.T) {
+	out := &rowSink{rows: map[string][]transform.CommonFields{}}
+	running := &config.Config{
+		Discovery: config.DiscoveryConfig{EventTable: "CollectorEvent_CL"},
+		Paths: []config.PathConfig{
+			{Name: "system-state", YANGPath: "/system/state", Table: "T", Enabled: true},
+			{Name: "bgp-global", YANGPath: "/ni[name=Vrf_old]/bgp", Table: "T", Enabled: true},
+		},
+	}
+	c := New(running, nil, out, "", false)
+	// The templates no longer produce the VRF path.
+	c.templates = &config.Config{Paths: running.Paths[:1]}
+
+	paths := c.rediscover(context.Background())
+	if len(paths) != 1 {
+		t.Fatalf("rediscover() = %v, want the path set without the VRF", paths)
+	}
+	rows := out.rows["CollectorEvent_CL"]
+	if len(rows) != 1 || rows[0].DataType != dataTypeDiscoveryChange {
+		t.Fatalf("event rows = %v, want one discovery change", rows)
+	}
+	if msg := rows[0].Message.(map[string]interface{}); msg["event"] != "path_removed" || msg["yang_path"] != "/ni[name=Vrf_old]/bgp" {
+		t.Errorf("event = %v", msg)
+	}
+
+	// Until the new set is applied it is offered again, without
+	// reporting the change a second time.
+	if got := c.rediscover(context.Background()); len(got) != 1 {
+		t.Errorf("rediscover() before the change was applied = %v, want it offered again", got)
+	}
+	if rows := out.rows["CollectorEvent_CL"]; len(rows) != 1 {
+		t.Errorf("event rows = %v, want the change reported once", rows)
+	}
+
+	c.cfg.Paths = paths
+	if got := c.rediscover(context.Background()); got != nil {
+		t.Errorf("rediscover() with nothing changed = %v, want nil", got)
+	}
+	if rows := out.rows["CollectorEvent_CL"]; len(rows) != 1 {
+		t.Errorf("event rows = %v, want no new event", rows)
+	}
+}
+
+func TestRequestRediscoveryCoalesces(t *testing.T) {
+	c := New(&config.Config{}, nil, nil, "", false)
+	c.requestRediscovery()
+	c.requestRediscovery()
+	<-c.rediscovery
+	select {
+	case <-c.rediscovery:
+		t.Error("a second pending request should have been dropped")
+	default:
+	}
+}
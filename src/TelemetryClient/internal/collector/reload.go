@@ -0,0 +1,162 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+// Update hands a reloaded configuration to a running collector. The
+// collector re-runs discovery against its own connection and applies the
+// new path set and interval from inside its collection loop, so there is
+// no concurrent access to its state. An update that has not been picked
+// up yet is superseded by a newer one. The config is first resolved
+// against the models the switch advertised on connect.
+func (c *Collector) Update(cfg *config.Config) {
+	if c.models != nil {
+		resolved, err := c.models.resolve(cfg, c.log)
+		if err != nil {
+			c.log.Printf("WARN: config reload rejected, keeping running paths: %v", err)
+			return
+		}
+		cfg = resolved
+	}
+	select {
+	case <-c.updates:
+	default:
+	}
+	c.updates <- cfg
+}
+
+// expandReload resolves the discovery templates of a reloaded config
+// against the live switch. On failure the reload is rejected and the
+// running paths stay in effect.
+func (c *Collector) expandReload(cfg *config.Config) ([]config.PathConfig, bool) {
+	expanded, err := DiscoverAndExpand(c.client, cfg.Discovery, cfg.Paths)
+	if err != nil {
+		c.log.Printf("WARN: config reload rejected, keeping running paths: path discovery: %v", err)
+		return nil, false
+	}
+	return expanded, true
+}
+
+// subscription is the resolved subscribe request for one stream session,
+// plus the enabled paths configured to be polled alongside the stream.
+type subscription struct {
+	paths  []config.PathConfig
+	subs   []gnmiclient.SubscriptionPath
+	lookup map[string]pathMapping
+	polled []config.PathConfig
+}
+
+// buildSubscription turns the enabled paths into subscription entries
+// and the YANG path → transformer lookup used to route updates. Paths
+// with collection "poll" are set aside for the poll scheduler.
+func (c *Collector) buildSubscription(paths []config.PathConfig) (*subscription, error) {
+	s := &subscription{paths: paths, lookup: map[string]pathMapping{}}
+	for _, p := range paths {
+		if !p.Enabled {
+			continue
+		}
+		t, ok := c.transformers[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("no transformer for %q", p.Name)
+		}
+		if c.cfg.PathCollection(p) == "poll" {
+			s.polled = append(s.polled, p)
+			continue
+		}
+
+		if len(s.subs) > 0 && p.Target != s.subs[0].Target {
+			return nil, fmt.Errorf("paths %q and %q use different gNMI targets and cannot share a subscription; set collection: poll on one of them",
+				s.subs[0].Name, p.Name)
+		}
+		s.subs = append(s.subs, gnmiclient.SubscriptionPath{
+			YANGPath:          p.YANGPath,
+			Origin:            p.Origin,
+			Target:            p.Target,
+			Mode:              p.Mode,
+			SampleInterval:    p.SampleInterval,
+			HeartbeatInterval: p.HeartbeatInterval,
+			Name:              p.Name,
+			Table:             p.Table,
+		})
+		s.lookup[p.YANGPath] = pathMapping{
+			name:        p.Name,
+			label:       p.LogLabel(),
+			table:       p.Table,
+			transformer: t,
+		}
+	}
+	if len(s.subs) == 0 && len(s.polled) == 0 {
+		return nil, fmt.Errorf("no paths enabled for subscription")
+	}
+	return s, nil
+}
+
+// sameSubscriptions reports whether two subscription sets would produce
+// the same Subscribe request, ignoring order.
+func sameSubscriptions(a, b []gnmiclient.SubscriptionPath) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	byPath := make(map[string]gnmiclient.SubscriptionPath, len(a))
+	for _, sp := range a {
+		byPath[sp.YANGPath] = sp
+	}
+	for _, sp := range b {
+		if old, ok := byPath[sp.YANGPath]; !ok || old != sp {
+			return false
+		}
+	}
+	return true
+}
+
+// pathKey identifies a path across reloads. Discovery expands one
+// template into several paths that share a name, so the YANG path is
+// part of the key.
+func pathKey(p config.PathConfig) string { return p.Name + "|" + p.YANGPath }
+
+// describePathChanges summarizes the difference between two enabled path
+// sets for the reload log line, e.g. "+2 -1 ~1 paths".
+func describePathChanges(oldPaths, newPaths []config.PathConfig) string {
+	before := map[string]config.PathConfig{}
+	for _, p := range oldPaths {
+		if p.Enabled {
+			before[pathKey(p)] = p
+		}
+	}
+
+	var added, changed int
+	for _, p := range newPaths {
+		if !p.Enabled {
+			continue
+		}
+		old, ok := before[pathKey(p)]
+		switch {
+		case !ok:
+			added++
+		case old != p:
+			changed++
+		}
+		delete(before, pathKey(p))
+	}
+	removed := len(before)
+
+	if added+removed+changed == 0 {
+		return "paths unchanged"
+	}
+	var parts []string
+	if added > 0 {
+		parts = append(parts, fmt.Sprintf("+%d", added))
+	}
+	if removed > 0 {
+		parts = append(parts, fmt.Sprintf("-%d", removed))
+	}
+	if changed > 0 {
+		parts = append(parts, fmt.Sprintf("~%d", changed))
+	}
+	return strings.Join(parts, " ") + " paths"
+}
@@ -0,0 +1,217 @@
+package collector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+)
+
+func TestSameSubscriptions(t *testing.T) {
+	a := []gnmiclient.SubscriptionPath{
+		{YANGPath: "/a", Mode: "sample", SampleInterval: 30 * time.Second, Name: "x", Table: "T"},
+		{YANGPath: "/b", Mode: "on_change", Name: "y", Table: "T"},
+	}
+	reordered := []gnmiclient.SubscriptionPath{a[1], a[0]}
+	if !sameSubscriptions(a, reordered) {
+		t.Error("reordered set should be the same subscription")
+	}
+
+	changed := []gnmiclient.SubscriptionPath{a[0], a[1]}
+	changed[0].SampleInterval = time.Minute
+	if sameSubscriptions(a, changed) {
+		t.Error("changed sample interval should be a different subscription")
+	}
+	if sameSubscriptions(a, a[:1]) {
+		t.Error("removed path should be a different subscription")
+	}
+}
+
+func TestBuildSubscriptionHybrid(t *testing.T) {
+	cfg := &config.Config{
+		Collection: config.CollectionConfig{Mode: "subscribe"},
+		Paths: []config.PathConfig{
+			{Name: "arp-table", YANGPath: "/arp", Table: "T", Enabled: true},
+			{Name: "bgp-neighbors", YANGPath: "/bgp", Table: "T", Enabled: true, Collection: "poll"},
+			{Name: "bgp-global", YANGPath: "/global", Table: "T", Enabled: false, Collection: "poll"},
+		},
+	}
+	c := New(cfg, nil, nil, "", false)
+	sub, err := c.buildSubscription(cfg.Paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sub.subs) != 1 || sub.subs[0].Name != "arp-table" {
+		t.Errorf("subs = %v, want arp-table only", sub.subs)
+	}
+	if len(sub.polled) != 1 || sub.polled[0].Name != "bgp-neighbors" {
+		t.Errorf("polled = %v, want bgp-neighbors only", sub.polled)
+	}
+	if _, ok := sub.lookup["/bgp"]; ok {
+		t.Error("polled path should not be routed from the stream")
+	}
+}
+
+func TestBuildSubscriptionSingleTarget(t *testing.T) {
+	cfg := &config.Config{Collection: config.CollectionConfig{Mode: "subscribe"}}
+	c := New(cfg, nil, nil, "", false)
+	_, err := c.buildSubscription([]config.PathConfig{
+		{Name: "arp-table", YANGPath: "/arp", Table: "T", Enabled: true},
+		{Name: "bgp-neighbors", YANGPath: "/COUNTERS/Ethernet*", Target: "COUNTERS_DB", Table: "T", Enabled: true},
+	})
+	if err == nil {
+		t.Error("paths with different targets should not share a subscription")
+	}
+}
+
+func TestDescribePathChanges(t *testing.T) {
+	oldPaths := []config.PathConfig{
+		{Name: "a", YANGPath: "/a", Enabled: true},
+		{Name: "b", YANGPath: "/b", Enabled: true},
+		{Name: "c", YANGPath: "/c", Enabled: true, SampleInterval: time.Minute},
+	}
+	newPaths := []config.PathConfig{
+		{Name: "a", YANGPath: "/a", Enabled: true},
+		{Name: "b", YANGPath: "/b", Enabled: false},
+		{Name: "c", YANGPath: "/c", Enabled: true, SampleInterval: 30 * time.Second},
+		{Name: "d", YANGPath: "/d", Enabled: true},
+	}
+	if got, want := describePathChanges(oldPaths, newPaths), "+1 -1 ~1 paths"; got != want {
+		t.Errorf("describePathChanges() = %q, want %q", got, want)
+	}
+	if got, want := describePathChanges(oldPaths, oldPaths), "paths unchanged"; got != want {
+		t.Errorf("describePathChanges() = %q, want %q", got, want)
+	}
+}
+
+func TestCollectorUpdateSupersedesPending(t *testing.T) {
+	c := New(&config.Config{}, nil, nil, "", false)
+	first := &config.Config{}
+	second := &config.Config{}
+	c.Update(first)
+	c.Update(second)
+	if got := <-c.updates; got != second {
+		t.Error("pending update should be replaced by the newer one")
+	}
+}
+
+func TestWatchReloadsRestartsOnlyPoller(t *testing.T) {
+	stream := config.PathConfig{Name: "arp-table", YANGPath: "/arp", Table: "T", Enabled: true}
+	polled := config.PathConfig{Name: "bgp-neighbors", YANGPath: "/bgp", Table: "T", Enabled: true, Collection: "poll", SampleInterval: time.Hour}
+	cfg := &config.Config{
+		Target:     config.TargetConfig{Address: "127.0.0.1", Port: 1},
+		Collection: config.CollectionConfig{Mode: "subscribe", MaxConcurrency: 1},
+		Paths:      []config.PathConfig{stream, polled},
+	}
+	// Nothing listens at the target; polls fail without blocking.
+	client, err := gnmiclient.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	c := New(cfg, client, nil, "", false)
+
+	// reload hands a config to a running watcher and returns it once the
+	// reload has been handled.
+	reload := func(paths ...config.PathConfig) *reloadWatch {
+		t.Helper()
+		sub, err := c.buildSubscription(c.cfg.Paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		w := c.watchReloads(ctx, cancel, sub, nil)
+		ncfg := *cfg
+		ncfg.Collection.MaxConcurrency = 4
+		ncfg.Paths = paths
+		c.Update(&ncfg)
+		for len(c.updates) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		// The watcher finishes a reload it has received before it sees
+		// the cancellation.
+		cancel()
+		<-w.done
+		return w
+	}
+
+	polled.SampleInterval = 2 * time.Hour
+	w := reload(stream, polled)
+	if w.next != nil {
+		t.Fatal("a poll-only change should leave the stream running")
+	}
+	if len(w.current.polled) != 1 || w.current.polled[0].SampleInterval != 2*time.Hour {
+		t.Errorf("current polled = %v, want the reloaded poll path", w.current.polled)
+	}
+	if c.cfg.Paths[1].SampleInterval != 2*time.Hour || c.cfg.Collection.MaxConcurrency != 4 {
+		t.Errorf("collector config not updated: paths %v, max_concurrency %d", c.cfg.Paths, c.cfg.Collection.MaxConcurrency)
+	}
+
+	stream.Mode = "on_change"
+	if w := reload(stream, polled); w.next == nil || w.reason != "Config reloaded" {
+		t.Error("a changed subscription set should resubscribe")
+	}
+}
+
+func TestSupervisorApplyReload(t *testing.T) {
+	paths := []config.PathConfig{{Name: "a", YANGPath: "/a", Enabled: true}}
+	oldCfg := &config.Config{
+		Targets: []config.TargetConfig{
+			{Name: "tor-1", Address: "10.0.0.1", Port: 50051},
+			{Name: "tor-2", Address: "10.0.0.2", Port: 50051},
+			{Name: "tor-4", Address: "10.0.0.4", Port: 50051},
+		},
+		Collection: config.CollectionConfig{Mode: "poll", Interval: time.Minute},
+		Paths:      paths,
+	}
+	sup := NewSupervisor(oldCfg, Options{})
+
+	cancelled := map[string]bool{}
+	runners := map[string]*runner{}
+	for _, tcfg := range sup.targets {
+		label := tcfg.TargetLabel()
+		runners[label] = &runner{label: label, cfg: tcfg, cancel: func() { cancelled[label] = true }}
+	}
+	var started []string
+	start := func(tcfg *config.Config) {
+		started = append(started, tcfg.TargetLabel())
+		runners[tcfg.TargetLabel()] = &runner{label: tcfg.TargetLabel(), cfg: tcfg, cancel: func() {}}
+	}
+
+	newCfg := &config.Config{
+		Targets: []config.TargetConfig{
+			{Name: "tor-1", Address: "10.0.0.1", Port: 50051},
+			{Name: "tor-2", Address: "10.0.0.22", Port: 50051},
+			{Name: "tor-3", Address: "10.0.0.3", Port: 50051},
+		},
+		Collection: config.CollectionConfig{Mode: "poll", Interval: 30 * time.Second},
+		Paths:      paths,
+	}
+	if err := sup.apply(newCfg, runners, start); err != nil {
+		t.Fatalf("apply() error = %v", err)
+	}
+
+	if len(started) != 2 || started[0] != "tor-2" || started[1] != "tor-3" {
+		t.Errorf("started = %v, want [tor-2 tor-3]", started)
+	}
+	if cancelled["tor-1"] {
+		t.Error("tor-1 only changed its interval and should not be restarted")
+	}
+	if got := runners["tor-1"].config().Collection.Interval; got != 30*time.Second {
+		t.Errorf("tor-1 interval = %s, want 30s", got)
+	}
+	if !cancelled["tor-2"] || !cancelled["tor-4"] {
+		t.Errorf("cancelled = %v, want tor-2 and tor-4", cancelled)
+	}
+	if _, ok := runners["tor-4"]; ok {
+		t.Error("removed target tor-4 should no longer be tracked")
+	}
+
+	single := &config.Config{Target: config.TargetConfig{Address: "10.0.0.1", Port: 50051}, Paths: paths}
+	if err := sup.apply(single, runners, start); err == nil {
+		t.Error("switching from targets to target should be rejected")
+	}
+}
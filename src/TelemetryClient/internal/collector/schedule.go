@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gnmi-collector/internal/config"
+)
+
+// pollSchedule tracks when each enabled path is next due in poll mode.
+// Every path runs on its own sample_interval; paths that start together
+// with equal (or multiple) intervals stay aligned, so they keep coming
+// due in the same cycle.
+type pollSchedule struct {
+	entries map[string]*pollEntry
+	order   []string // Config order, so due paths are collected in it
+}
+
+type pollEntry struct {
+	path config.PathConfig
+	next time.Time
+}
+
+// newPollSchedule makes every enabled path due at now.
+func newPollSchedule(paths []config.PathConfig, now time.Time) *pollSchedule {
+	s := &pollSchedule{entries: map[string]*pollEntry{}}
+	s.sync(paths, now)
+	return s
+}
+
+// sync replaces the scheduled path set after a reload. Unchanged paths
+// keep their next due time, new paths are due at now, and a path whose
+// interval shrank is brought forward so it is not late by the old one.
+func (s *pollSchedule) sync(paths []config.PathConfig, now time.Time) {
+	entries := make(map[string]*pollEntry, len(paths))
+	s.order = s.order[:0]
+	for _, p := range paths {
+		if !p.Enabled {
+			continue
+		}
+		key := pathKey(p)
+		e, ok := s.entries[key]
+		switch {
+		case !ok:
+			e = &pollEntry{next: now}
+		case e.next.After(now.Add(p.SampleInterval)):
+			e.next = now.Add(p.SampleInterval)
+		}
+		e.path = p
+		entries[key] = e
+		s.order = append(s.order, key)
+	}
+	s.entries = entries
+}
+
+// due returns the paths whose next run is at or before now and moves
+// each of them one interval ahead. A path that fell more than an interval
+// behind is rescheduled from now instead of being run repeatedly.
+func (s *pollSchedule) due(now time.Time) []config.PathConfig {
+	var paths []config.PathConfig
+	for _, key := range s.order {
+		e := s.entries[key]
+		if e.next.After(now) {
+			continue
+		}
+		paths = append(paths, e.path)
+		e.next = e.next.Add(e.path.SampleInterval)
+		if !e.next.After(now) {
+			e.next = now.Add(e.path.SampleInterval)
+		}
+	}
+	return paths
+}
+
+// nextDue returns the earliest next run time, or false when no path is
+// scheduled.
+func (s *pollSchedule) nextDue() (time.Time, bool) {
+	var next time.Time
+	for _, e := range s.entries {
+		if next.IsZero() || e.next.Before(next) {
+			next = e.next
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// describe summarizes the intervals for the startup log, e.g.
+// "1m0s x5, 15m0s x2".
+func (s *pollSchedule) describe() string {
+	counts := map[time.Duration]int{}
+	for _, e := range s.entries {
+		counts[e.path.SampleInterval]++
+	}
+	intervals := make([]time.Duration, 0, len(counts))
+	for d := range counts {
+		intervals = append(intervals, d)
+	}
+	slices.Sort(intervals)
+	parts := make([]string, len(intervals))
+	for i, d := range intervals {
+		parts[i] = fmt.Sprintf("%s x%d", d, counts[d])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/config"
+)
+
+func schedPath(name, table string, interval time.Duration) config.PathConfig {
+	return config.PathConfig{Name: name, YANGPath: "/" + name, Table: table, Enabled: true, SampleInterval: interval}
+}
+
+func dueNames(paths []config.PathConfig) []string {
+	var names []string
+	for _, p := range paths {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+func TestPollScheduleDue(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	paths := []config.PathConfig{
+		schedPath("interface-counters", "InterfaceCounter_CL", time.Minute),
+		schedPath("interface-status", "InterfaceStatus_CL", time.Minute),
+		schedPath("inventory", "Inventory_CL", 15*time.Minute),
+		schedPath("version", "Version_CL", time.Hour),
+		{Name: "disabled", YANGPath: "/disabled", Enabled: false},
+	}
+	s := newPollSchedule(paths, t0)
+
+	if got := dueNames(s.due(t0)); len(got) != 4 {
+		t.Fatalf("first cycle = %v, want every enabled path", got)
+	}
+	if next, _ := s.nextDue(); !next.Equal(t0.Add(time.Minute)) {
+		t.Errorf("next due = %v, want t0+1m", next)
+	}
+	if got := dueNames(s.due(t0.Add(30 * time.Second))); len(got) != 0 {
+		t.Errorf("nothing should be due at 30s, got %v", got)
+	}
+
+	// Paths on a shared interval come due together; the timer firing a
+	// little late does not shift them out of step.
+	got := dueNames(s.due(t0.Add(time.Minute + 20*time.Millisecond)))
+	if len(got) != 2 || got[0] != "interface-counters" || got[1] != "interface-status" {
+		t.Errorf("1m cycle = %v", got)
+	}
+	if next, _ := s.nextDue(); !next.Equal(t0.Add(2 * time.Minute)) {
+		t.Errorf("next due = %v, want t0+2m", next)
+	}
+
+	for m := 2; m < 15; m++ {
+		s.due(t0.Add(time.Duration(m) * time.Minute))
+	}
+	if got := dueNames(s.due(t0.Add(15 * time.Minute))); len(got) != 3 || got[2] != "inventory" {
+		t.Errorf("15m cycle = %v, want the 1m paths and inventory", got)
+	}
+}
+
+func TestPollScheduleFallsBehind(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newPollSchedule([]config.PathConfig{schedPath("a", "A_CL", time.Minute)}, t0)
+	s.due(t0)
+
+	late := t0.Add(5*time.Minute + 10*time.Second)
+	if got := s.due(late); len(got) != 1 {
+		t.Fatalf("late cycle = %v", got)
+	}
+	if next, _ := s.nextDue(); !next.Equal(late.Add(time.Minute)) {
+		t.Errorf("next due = %v, want one interval after the late run", next)
+	}
+}
+
+func TestPollScheduleSync(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newPollSchedule([]config.PathConfig{
+		schedPath("a", "A_CL", time.Hour),
+		schedPath("b", "B_CL", time.Hour),
+	}, t0)
+	s.due(t0)
+
+	now := t0.Add(10 * time.Minute)
+	s.sync([]config.PathConfig{
+		schedPath("a", "A_CL", time.Hour),      // Unchanged: stays due at t0+1h
+		schedPath("b", "B_CL", 5*time.Minute),  // Shortened: due within 5m
+		schedPath("c", "C_CL", 30*time.Minute), // New: due now
+	}, now)
+
+	want := map[string]time.Time{
+		pathKey(schedPath("a", "", 0)): t0.Add(time.Hour),
+		pathKey(schedPath("b", "", 0)): now.Add(5 * time.Minute),
+		pathKey(schedPath("c", "", 0)): now,
+	}
+	if len(s.entries) != len(want) {
+		t.Fatalf("entries = %d, want %d", len(s.entries), len(want))
+	}
+	for key, next := range want {
+		if e := s.entries[key]; e == nil || !e.next.Equal(next) {
+			t.Errorf("%s next = %v, want %v", key, e, next)
+		}
+	}
+	if got := dueNames(s.due(now)); len(got) != 1 || got[0] != "c" {
+		t.Errorf("due after reload = %v, want [c]", got)
+	}
+}
@@ -2,15 +2,18 @@ package collector
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"gnmi-collector/internal/config"
 	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/sink"
 	"gnmi-collector/internal/transform"
 
 	gpb "github.com/openconfig/gnmi/proto/gnmi"
@@ -23,6 +26,10 @@ const (
 	defaultBatchSize     = 200
 	maxReconnectDelay    = 2 * time.Minute
 	initialReconnectDelay = 2 * time.Second
+
+	// maxSnapshotHold bounds how long the initial snapshot is held back
+	// waiting for sync_response, for servers that never send one.
+	maxSnapshotHold = 5 * time.Minute
 )
 
 // tableBatch accumulates entries for a single Azure table.
@@ -52,53 +59,113 @@ func (b *tableBatch) size() int {
 	return len(b.entries)
 }
 
+// tableBatches holds one batch per Azure table. Tables are added lazily
+// so a reload that subscribes new paths doesn't race the flush goroutine.
+//
+// While a session's initial snapshot is still arriving the batches are
+// held: nothing is flushed until sync_response marks the snapshot
+// complete, so the first dump lands as one consistent set.
+type tableBatches struct {
+	mu        sync.Mutex
+	m         map[string]*tableBatch
+	heldSince time.Time // Zero when not holding
+}
+
+// hold starts holding back flushes for a new session's snapshot.
+func (bs *tableBatches) hold() {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	bs.heldSince = time.Now()
+}
+
+// release stops holding and reports whether a hold was active.
+func (bs *tableBatches) release() bool {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	held := !bs.heldSince.IsZero()
+	bs.heldSince = time.Time{}
+	return held
+}
+
+// held reports whether flushes are being held. A hold older than
+// maxSnapshotHold is dropped; expired reports that it just was.
+func (bs *tableBatches) held() (held, expired bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.heldSince.IsZero() {
+		return false, false
+	}
+	if time.Since(bs.heldSince) > maxSnapshotHold {
+		bs.heldSince = time.Time{}
+		return false, true
+	}
+	return true, false
+}
+
+// pending returns the number of entries waiting in all batches.
+func (bs *tableBatches) pending() int {
+	n := 0
+	for _, b := range bs.all() {
+		n += b.size()
+	}
+	return n
+}
+
+func (bs *tableBatches) get(table string) *tableBatch {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	b, ok := bs.m[table]
+	if !ok {
+		b = &tableBatch{table: table}
+		bs.m[table] = b
+	}
+	return b
+}
+
+func (bs *tableBatches) all() []*tableBatch {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	out := make([]*tableBatch, 0, len(bs.m))
+	for _, b := range bs.m {
+		out = append(out, b)
+	}
+	return out
+}
+
 // RunStream starts the subscribe-mode streaming collector. It opens a
 // persistent gNMI Subscribe stream, routes updates to the correct
 // transformer, batches results, and flushes to Azure periodically.
 // It reconnects automatically on stream failure with exponential backoff.
-// Blocks until ctx is cancelled.
+// A reloaded config (see Update) or rediscovered paths rebuild the
+// stream only when the subscription set actually changed. Discovery is
+// re-run after every reconnect. Paths the switch refuses to stream
+// are polled on their sample_interval instead. Blocks until ctx is
+// cancelled.
 func (c *Collector) RunStream(ctx context.Context) error {
-	// Build subscription paths and path→config lookup
-	var subPaths []gnmiclient.SubscriptionPath
-	pathLookup := map[string]pathMapping{}
-
-	for _, p := range c.cfg.Paths {
-		if !p.Enabled {
-			continue
-		}
-		subPaths = append(subPaths, gnmiclient.SubscriptionPath{
-			YANGPath:          p.YANGPath,
-			Mode:              p.Mode,
-			SampleInterval:    p.SampleInterval,
-			HeartbeatInterval: p.HeartbeatInterval,
-			Name:              p.Name,
-			Table:             p.Table,
-		})
-
-		t, ok := c.transformers[p.Name]
-		if !ok {
-			return fmt.Errorf("no transformer for %q", p.Name)
-		}
-		pathLookup[p.YANGPath] = pathMapping{
-			name:        p.Name,
-			table:       p.Table,
-			transformer: t,
-		}
+	sub, err := c.buildSubscription(c.cfg.Paths)
+	if err != nil {
+		return err
 	}
 
-	if len(subPaths) == 0 {
-		return fmt.Errorf("no paths enabled for subscription")
+	c.log.Printf("Subscribe mode: %d paths, flush every %s or %d entries",
+		len(sub.subs), defaultFlushInterval, defaultBatchSize)
+	if len(sub.polled) > 0 {
+		c.log.Printf("Polling %d paths alongside the stream", len(sub.polled))
 	}
 
-	log.Printf("Subscribe mode: %d paths, flush every %s or %d entries",
-		len(subPaths), defaultFlushInterval, defaultBatchSize)
+	batches := &tableBatches{m: map[string]*tableBatch{}}
+	cache := newStateCache()
 
-	// Batches keyed by table name
-	batches := map[string]*tableBatch{}
-	for _, sp := range subPaths {
-		if _, ok := batches[sp.Table]; !ok {
-			batches[sp.Table] = &tableBatch{table: sp.Table}
-		}
+	// current is the subscription of the running session, read by the
+	// snapshot ticker.
+	var current atomic.Pointer[subscription]
+	current.Store(sub)
+	var snapshots <-chan time.Time
+	if iv := c.cfg.Collection.SnapshotInterval; iv > 0 {
+		t := time.NewTicker(iv)
+		defer t.Stop()
+		snapshots = t.C
+		c.log.Printf("Full snapshot of every entity every %s", iv)
 	}
 
 	// Periodic flush goroutine — uses streamCtx so we can signal it on
@@ -114,73 +181,139 @@ func (c *Collector) RunStream(ctx context.Context) error {
 		for {
 			select {
 			case <-ticker.C:
-				c.flushAll(batches)
+				held, expired := batches.held()
+				if held {
+					continue
+				}
+				if expired {
+					c.log.Printf("WARN: no sync_response after %s — flushing the initial snapshot as is", maxSnapshotHold)
+				}
+				c.flushAll(streamCtx, batches)
+			case <-snapshots:
+				if held, _ := batches.held(); held {
+					continue
+				}
+				c.emitSnapshot(streamCtx, current.Load(), cache, batches)
 			case <-streamCtx.Done():
 				// Final flush on shutdown
-				c.flushAll(batches)
+				c.flushAll(context.WithoutCancel(streamCtx), batches)
 				return
 			}
 		}
 	}()
 
+	// previous is the last subscription the switch accepted, kept after a
+	// reload until the new one proves healthy so a subscription the switch
+	// rejects, and whose bad paths cannot be isolated, can be rolled back
+	// instead of stopping the target.
+	var previous *subscription
+
+	// rejected holds the subscription entries the switch refused. Their
+	// paths are polled for the rest of the run, or until a reload changes
+	// them, while the other paths keep streaming.
+	rejected := map[gnmiclient.SubscriptionPath]bool{}
+
 	// Reconnect loop
 	delay := initialReconnectDelay
 	for {
-		healthy, err := c.subscribeOnce(streamCtx, subPaths, pathLookup, batches)
+		streamSubs, _ := sub.splitRejected(rejected)
+		sessCtx, sessCancel := context.WithCancel(streamCtx)
+		watch := c.watchReloads(sessCtx, sessCancel, sub, rejected)
+		current.Store(sub)
+		var (
+			healthy bool
+			err     error
+		)
+		if len(streamSubs) > 0 {
+			c.markStreaming(streamSubs, sub.lookup)
+			healthy, err = c.subscribeOnce(sessCtx, streamSubs, sub.lookup, batches, cache)
+		} else {
+			// Every path is polled; wait for a reload or shutdown.
+			<-sessCtx.Done()
+		}
+		sessCancel()
+		<-watch.done
+		// Reloads that left the stream running may have changed the
+		// polled paths.
+		sub = watch.current
 		if ctx.Err() != nil {
 			// Context cancelled — graceful shutdown
 			streamCancel()
 			<-flushDone
-			log.Printf("Subscribe stream stopped (context cancelled)")
+			c.log.Printf("Subscribe stream stopped (context cancelled)")
 			return nil
 		}
 
-		// Detect permanent errors that will never succeed on retry.
+		if healthy {
+			previous = nil
+		}
+
+		// The subscription set changed on reload or rediscovery:
+		// resubscribe right away.
+		if next := watch.next; next != nil {
+			summary := describePathChanges(sub.paths, next.paths)
+			if watch.cfg != nil {
+				summary += c.applyCollectionSettings(watch.cfg)
+			}
+			c.log.Printf("%s: %s — resubscribing with %d paths", watch.reason, summary, len(next.subs))
+			if previous == nil {
+				previous = sub
+			}
+			sub = next
+			c.cfg.Paths = sub.paths
+			pruneRejected(rejected, sub.subs)
+			delay = initialReconnectDelay
+			continue
+		}
+
 		// gRPC InvalidArgument means the switch rejected the subscription
 		// request itself (e.g., on_change not supported for a path, invalid
-		// sample interval). These are configuration errors that need human
-		// intervention — retrying is pointless.
+		// sample interval). Retrying the same request is pointless, so
+		// find the paths it refuses and poll those instead.
 		if isPermanentSubscribeError(err) {
-			streamCancel()
-			<-flushDone
-			return fmt.Errorf("subscribe configuration error (will not retry): %w", err)
-		}
-
-		// Self-heal on TLS certificate verification failures.
-		// When TLS is enabled, a cert rotation on the switch causes
-		// verification to fail. We re-fetch the cert and create a fresh client.
-		if gnmiclient.IsCertVerificationError(err) && c.cfg.Target.TLS.Enabled {
-			log.Printf("WARN: TLS certificate verification failed — attempting cert re-fetch from %s", c.cfg.TargetAddr())
-			if c.cfg.Target.TLS.CAFile != "" {
-				// Persistent mode: re-fetch and save to ca_file
-				pool, refetchErr := gnmiclient.RefetchAndSave(c.cfg.TargetAddr(), c.cfg.Target.TLS.CAFile)
-				if refetchErr != nil {
-					log.Printf("WARN: cert re-fetch failed: %v — will retry with normal backoff", refetchErr)
-				} else if pool != nil {
-					newClient, dialErr := gnmiclient.NewClient(c.cfg)
-					if dialErr != nil {
-						log.Printf("ERROR: reconnect with new cert failed: %v", dialErr)
-					} else {
-						c.ReplaceClient(newClient)
-						log.Printf("Reconnected with updated server certificate")
-						delay = initialReconnectDelay
-						continue // skip backoff — we already have a fresh connection
-					}
-				}
-			} else {
-				// In-memory TOFU mode: just re-create the client (TOFU will re-probe)
-				newClient, dialErr := gnmiclient.NewClient(c.cfg)
-				if dialErr != nil {
-					log.Printf("ERROR: reconnect with TOFU re-probe failed: %v", dialErr)
-				} else {
-					c.ReplaceClient(newClient)
-					log.Printf("Reconnected with fresh TOFU certificate")
-					delay = initialReconnectDelay
-					continue
+			found, probeErr := bisectRejected(streamCtx, streamSubs, c.probeSubscription)
+			switch {
+			case ctx.Err() != nil:
+				streamCancel()
+				<-flushDone
+				return nil
+			case probeErr != nil:
+				// The probes themselves failed (e.g. the connection
+				// dropped): retry the whole set after the usual backoff.
+				c.log.Printf("WARN: could not isolate the rejected subscription paths: %v", probeErr)
+			case len(found) > 0:
+				for _, sp := range found {
+					rejected[sp] = true
+					c.log.Printf("WARN [%s]: switch rejected the subscription to %s — polling it every %s instead",
+						sp.Name, sp.YANGPath, sp.SampleInterval)
 				}
+				delay = initialReconnectDelay
+				continue
+			case previous != nil:
+				// Every path is accepted on its own; only the reloaded
+				// combination is refused.
+				c.log.Printf("WARN: switch rejected the reloaded subscription: %v — reverting to the previous path set", err)
+				sub, previous = previous, nil
+				c.cfg.Paths = sub.paths
+				pruneRejected(rejected, sub.subs)
+				continue
+			default:
+				streamCancel()
+				<-flushDone
+				return fmt.Errorf("subscribe configuration error (will not retry): %w", err)
 			}
 		}
 
+		c.stats.Reconnect()
+		// Whatever was added on the switch while the stream was down
+		// is picked up by the next session.
+		c.requestRediscovery()
+
+		if c.recoverCertError(ctx, err) {
+			delay = initialReconnectDelay
+			continue // skip backoff — we already have a fresh connection
+		}
+
 		// If the session was healthy (received updates), reset backoff
 		// so a long-running stream that disconnects once doesn't wait
 		// at the backoff ceiling.
@@ -188,7 +321,7 @@ func (c *Collector) RunStream(ctx context.Context) error {
 			delay = initialReconnectDelay
 		}
 
-		log.Printf("Subscribe stream error: %v — reconnecting in %s", err, delay)
+		c.log.Printf("Subscribe stream error: %v — reconnecting in %s", err, delay)
 		select {
 		case <-time.After(delay):
 			delay = delay * 2
@@ -203,12 +336,216 @@ func (c *Collector) RunStream(ctx context.Context) error {
 	}
 }
 
+// recoverCertError self-heals on TLS certificate verification failures.
+// When TLS is enabled, a cert rotation on the switch causes verification
+// to fail. We re-fetch the cert and create a fresh client, and report
+// whether the collector now has one. The new cert is only trusted if
+// the fingerprint policy accepts it, and every change is audited.
+func (c *Collector) recoverCertError(ctx context.Context, err error) bool {
+	if !gnmiclient.IsCertVerificationError(err) || !c.cfg.Target.TLS.Enabled {
+		return false
+	}
+	c.log.Printf("WARN: TLS certificate verification failed — attempting cert re-fetch from %s", c.cfg.TargetAddr())
+	if caFile := c.cfg.Target.TLS.CAFile; caFile != "" {
+		if pinned := gnmiclient.CAFileFingerprint(caFile); pinned != "" && pinned != c.client.PinnedFingerprint() {
+			// ca_file was re-pinned since this client connected, by a
+			// certificate rotation or the operator: trust it as written.
+			newClient, dialErr := gnmiclient.NewClient(c.cfg)
+			if dialErr != nil {
+				c.log.Printf("ERROR: reconnect with re-pinned cert failed: %v", dialErr)
+				return false
+			}
+			c.ReplaceClient(newClient)
+			c.reportCertificate(ctx)
+			c.log.Printf("Reconnected with the server certificate re-pinned in %s", caFile)
+			return true
+		}
+		// Persistent mode: re-fetch and save to ca_file
+		clientCerts, certErr := gnmiclient.ClientCertificates(c.cfg)
+		if certErr != nil {
+			c.log.Printf("WARN: cert re-fetch failed: %v — will retry with normal backoff", certErr)
+			return false
+		}
+		pool, change, refetchErr := gnmiclient.RefetchAndSave(c.cfg.TargetAddr(), c.cfg.Target.TLS, clientCerts)
+		c.auditCertChange(ctx, change)
+		if refetchErr != nil {
+			c.log.Printf("WARN: cert re-fetch failed: %v — will retry with normal backoff", refetchErr)
+			return false
+		}
+		if pool == nil {
+			return false
+		}
+		newClient, dialErr := gnmiclient.NewClient(c.cfg)
+		if dialErr != nil {
+			c.log.Printf("ERROR: reconnect with new cert failed: %v", dialErr)
+			return false
+		}
+		c.ReplaceClient(newClient)
+		c.reportCertificate(ctx)
+		c.log.Printf("Reconnected with updated server certificate")
+		return true
+	}
+
+	if c.cfg.Target.TLS.KnownHosts != "" {
+		// Persistent TOFU: NewClient applies the fingerprint policy.
+		newClient, dialErr := gnmiclient.NewClient(c.cfg)
+		if dialErr != nil {
+			c.auditCertChange(ctx, rejectedCertChange(dialErr))
+			c.log.Printf("ERROR: reconnect after cert verification failure: %v", dialErr)
+			return false
+		}
+		c.auditCertChange(ctx, newClient.CertChange())
+		c.ReplaceClient(newClient)
+		c.reportCertificate(ctx)
+		c.log.Printf("Reconnected with server certificate checked against %s", c.cfg.Target.TLS.KnownHosts)
+		return true
+	}
+
+	// In-memory TOFU mode: check the presented cert against the one
+	// trusted so far before re-creating the client (TOFU will re-probe).
+	clientCerts, certErr := gnmiclient.ClientCertificates(c.cfg)
+	if certErr != nil {
+		c.log.Printf("WARN: cert re-fetch failed: %v — will retry with normal backoff", certErr)
+		return false
+	}
+	trusted := c.client.PinnedFingerprint()
+	_, change, checkErr := gnmiclient.CheckServerCert(c.cfg.TargetAddr(), trusted, c.cfg.Target.TLS, clientCerts)
+	c.auditCertChange(ctx, change)
+	if checkErr != nil {
+		c.log.Printf("ERROR: reconnect after cert verification failure: %v", checkErr)
+		return false
+	}
+	if change != nil {
+		trusted = change.NewFingerprint
+	}
+	newClient, dialErr := gnmiclient.NewClient(c.cfg)
+	if dialErr != nil {
+		c.log.Printf("ERROR: reconnect with TOFU re-probe failed: %v", dialErr)
+		return false
+	}
+	if fp := newClient.PinnedFingerprint(); fp != trusted {
+		// The cert changed again between the check and the re-probe.
+		newClient.Close()
+		c.log.Printf("ERROR: server certificate changed to SHA-256 %s while reconnecting — not trusted", fp)
+		return false
+	}
+	c.ReplaceClient(newClient)
+	c.reportCertificate(ctx)
+	c.log.Printf("Reconnected with fresh TOFU certificate")
+	return true
+}
+
+// reloadWatch tracks config reloads received during one subscribe
+// session. Its fields may only be read after done is closed.
+type reloadWatch struct {
+	// current is the session's subscription, updated by reloads that
+	// left the subscription set as it was.
+	current *subscription
+	// next is the subscription to resubscribe with, and cfg the
+	// reloaded config whose collection settings apply with it (nil
+	// after rediscovery).
+	next   *subscription
+	cfg    *config.Config
+	reason string // "Config reloaded" or "Discovery changed", for the resubscribe log line
+	done   chan struct{}
+}
+
+// watchReloads applies reloaded configs and rediscovered paths while a
+// subscribe session is running, and polls the paths the stream does
+// not carry — those set aside by current plus the rejected entries —
+// until the session ends. A change that leaves the subscription set as
+// it is leaves the stream alone and only restarts the poller, if the
+// polled paths or collection settings changed. Otherwise the new
+// subscription is recorded and the session is cancelled so the caller
+// can resubscribe.
+func (c *Collector) watchReloads(ctx context.Context, cancel context.CancelFunc, current *subscription, rejected map[gnmiclient.SubscriptionPath]bool) *reloadWatch {
+	w := &reloadWatch{current: current, done: make(chan struct{})}
+	_, polled := current.splitRejected(rejected)
+	stopPolling := c.startPolling(ctx, polled)
+
+	// keepStream switches to sub, whose subscription set is the running
+	// one, and describes what changed for the reload log line.
+	keepStream := func(sub *subscription, ncfg *config.Config) string {
+		summary := describePathChanges(w.current.paths, sub.paths)
+		_, nextPolled := sub.splitRejected(rejected)
+		if !reflect.DeepEqual(polled, nextPolled) || (ncfg != nil && c.collectionChanged(ncfg)) {
+			// The poller reads the collection settings; stop it first.
+			stopPolling()
+			if ncfg != nil {
+				summary += c.applyCollectionSettings(ncfg)
+			}
+			polled = nextPolled
+			stopPolling = c.startPolling(ctx, polled)
+		}
+		c.cfg.Paths = sub.paths
+		w.current = sub
+		return summary
+	}
+
+	go func() {
+		defer close(w.done)
+		defer func() { stopPolling() }()
+		for {
+			select {
+			case ncfg := <-c.updates:
+				paths, ok := c.expandReload(ncfg)
+				if !ok {
+					continue
+				}
+				sub, err := c.buildSubscription(paths)
+				if err != nil {
+					c.log.Printf("WARN: config reload rejected, keeping running paths: %v", err)
+					continue
+				}
+				c.templates, c.discovered = ncfg, paths
+				if sameSubscriptions(w.current.subs, sub.subs) {
+					c.log.Printf("Config reloaded: %s, subscription set unchanged, stream left running", keepStream(sub, ncfg))
+					continue
+				}
+				w.next, w.cfg, w.reason = sub, ncfg, "Config reloaded"
+				cancel()
+				return
+			case <-c.rediscovery:
+				paths := c.rediscover(ctx)
+				if paths == nil {
+					continue
+				}
+				sub, err := c.buildSubscription(paths)
+				if err != nil {
+					c.log.Printf("WARN: rediscovered paths not applied: %v", err)
+					continue
+				}
+				if sameSubscriptions(w.current.subs, sub.subs) {
+					keepStream(sub, nil)
+					continue
+				}
+				w.next, w.reason = sub, "Discovery changed"
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return w
+}
+
 type pathMapping struct {
 	name        string
+	label       string // LogLabel; tells discovery-expanded copies of a template apart
 	table       string
 	transformer transform.Transformer
 }
 
+// pathLabel returns the label path health is recorded under for a
+// subscription entry.
+func pathLabel(lookup map[string]pathMapping, sp gnmiclient.SubscriptionPath) string {
+	if pm, ok := lookup[sp.YANGPath]; ok && pm.label != "" {
+		return pm.label
+	}
+	return sp.Name
+}
+
 // isPermanentSubscribeError returns true if the error indicates a
 // configuration problem that will never succeed on retry. The switch
 // rejects these subscriptions outright (e.g., on_change not supported
@@ -224,63 +561,182 @@ func (c *Collector) subscribeOnce(
 	ctx context.Context,
 	subPaths []gnmiclient.SubscriptionPath,
 	pathLookup map[string]pathMapping,
-	batches map[string]*tableBatch,
+	batches *tableBatches,
+	cache *stateCache,
 ) (healthy bool, err error) {
 	updateCount := 0
 
+	// The session's initial dump rebuilds the cache from scratch.
+	cache.reset()
+
+	// Hold the initial snapshot until sync_response; a session that ends
+	// before it arrives leaves what it got to the periodic flush.
+	batches.hold()
+	defer batches.release()
+
 	err = c.client.Subscribe(ctx, subPaths, func(resp *gpb.SubscribeResponse) error {
+		if resp.GetSyncResponse() {
+			if batches.release() {
+				c.log.Printf("Initial snapshot complete: flushing %d entries", batches.pending())
+				c.flushAll(ctx, batches)
+			}
+			return nil
+		}
+
 		// Decode WITH prefix preservation so entity keys (e.g.,
 		// [name=Ethernet0]) are included in the full update paths.
 		notifications, err := gnmiclient.DecodeSubscribeResponseWithPrefix(resp)
 		if err != nil {
-			log.Printf("WARN: decode subscribe response: %v", err)
+			c.log.Printf("WARN: decode subscribe response: %v", err)
 			return nil // Don't kill stream on decode errors
 		}
 		if len(notifications) == 0 {
-			return nil // Sync response, no data
+			return nil
 		}
 
-		// Normalize leaf-level scalar updates into nested tree maps.
-		// Subscribe responses send individual leaf values, but
-		// transformers expect nested maps (same as Get responses).
-		notifications = gnmiclient.NormalizeSubscribeNotifications(notifications)
+		updateCount += c.route(ctx, notifications, subPaths, pathLookup, batches, cache)
+		return nil
+	})
+	return updateCount > 0, err
+}
 
-		// Route notifications to the correct transformer based on path prefix.
-		// Use drillDown to navigate nested subscribe-stream data to the
-		// subscribed path level that transformers expect.
-		for _, sp := range subPaths {
-			matching := drillDownToSubscribedPath(notifications, sp.YANGPath)
-			if len(matching) == 0 {
-				continue
-			}
+// route normalizes decoded subscribe notifications, hands each
+// subscribed path its part to the path's transformer and batches the
+// rows. A nil cache transforms the notifications as they arrived. It
+// returns the number of paths that produced rows.
+func (c *Collector) route(
+	ctx context.Context,
+	notifications []gnmiclient.Notification,
+	subPaths []gnmiclient.SubscriptionPath,
+	pathLookup map[string]pathMapping,
+	batches *tableBatches,
+	cache *stateCache,
+) int {
+	// Normalize leaf-level scalar updates into nested tree maps.
+	// Subscribe responses send individual leaf values, but
+	// transformers expect nested maps (same as Get responses).
+	notifications = gnmiclient.NormalizeSubscribeNotifications(notifications)
 
-			pm, ok := pathLookup[sp.YANGPath]
-			if !ok {
-				continue
-			}
+	// Route notifications to the correct transformer based on path prefix.
+	// Use drillDown to navigate nested subscribe-stream data to the
+	// subscribed path level that transformers expect.
+	routed := 0
+	for _, sp := range subPaths {
+		matching := drillDownToSubscribedPath(forOriginAndTarget(notifications, sp), sp.YANGPath)
+		if len(matching) == 0 {
+			continue
+		}
 
-			entries, err := pm.transformer.Transform(matching)
-			if err != nil {
-				log.Printf("WARN [%s]: transform: %v", sp.Name, err)
-				continue
-			}
-			if len(entries) == 0 {
-				continue
-			}
+		pm, ok := pathLookup[sp.YANGPath]
+		if !ok {
+			continue
+		}
+		label := pathLabel(pathLookup, sp)
 
-			batch := batches[sp.Table]
-			batch.add(entries)
-			updateCount++
+		// Transform the full cached entity, not just the leaves
+		// that changed.
+		if cache != nil {
+			matching = cache.apply(sp.YANGPath, matching)
+		}
 
-			// Flush if batch is large enough
-			if batch.size() >= defaultBatchSize {
-				c.flushBatch(batch)
-			}
+		entries, err := pm.transformer.Transform(matching)
+		if err != nil {
+			c.log.Printf("WARN [%s]: transform: %v", label, err)
+			continue
+		}
+		entries = append(entries, c.removedEntries(label, pm.transformer, matching)...)
+		if len(entries) == 0 {
+			continue
+		}
+
+		c.stats.Entries(label, len(entries))
+		batch := batches.get(sp.Table)
+		batch.add(entries)
+		routed++
+
+		// Flush if batch is large enough, unless the initial
+		// snapshot is still being collected
+		if held, _ := batches.held(); !held && batch.size() >= defaultBatchSize {
+			c.flushBatch(ctx, batch)
 		}
+	}
+	return routed
+}
 
+// forOriginAndTarget drops notifications whose prefix names another
+// origin or target than the subscription's. Either side leaving one
+// empty matches any value.
+func forOriginAndTarget(notifs []gnmiclient.Notification, sp gnmiclient.SubscriptionPath) []gnmiclient.Notification {
+	var out []gnmiclient.Notification
+	for _, n := range notifs {
+		if n.Origin != "" && sp.Origin != "" && n.Origin != sp.Origin {
+			continue
+		}
+		if n.Target != "" && sp.Target != "" && n.Target != sp.Target {
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// emitSnapshot re-emits every cached entity of the current subscription
+// and flushes, so each entity has a recent row even when nothing about
+// it changed. Snapshot rows repeat cached values stamped with the
+// collector's clock, so they bypass the rates stage: only live updates
+// are counter samples.
+func (c *Collector) emitSnapshot(ctx context.Context, sub *subscription, cache *stateCache, batches *tableBatches) {
+	// Pending live rows go first, through the rates stage as usual.
+	c.flushAll(ctx, batches)
+
+	now := time.Now()
+	total := 0
+	tables := map[string][]transform.CommonFields{}
+	for _, sp := range sub.subs {
+		pm, ok := sub.lookup[sp.YANGPath]
+		if !ok {
+			continue
+		}
+		notifs := cache.snapshot(sp.YANGPath, now)
+		if len(notifs) == 0 {
+			continue
+		}
+		entries, err := pm.transformer.Transform(notifs)
+		if err != nil {
+			c.log.Printf("WARN [%s]: snapshot transform: %v", pm.label, err)
+			continue
+		}
+		tables[sp.Table] = append(tables[sp.Table], entries...)
+		total += len(entries)
+	}
+	c.log.Printf("Snapshot: re-emitting %d entries", total)
+	for table, entries := range tables {
+		c.writeEntries(ctx, table, entries, false)
+	}
+}
+
+// removedEntries turns the delete notifications routed to a path into
+// "removed" rows, when its transformer supports them.
+func (c *Collector) removedEntries(name string, t transform.Transformer, notifs []gnmiclient.Notification) []transform.CommonFields {
+	var deletes []gnmiclient.Notification
+	for _, n := range notifs {
+		if len(n.Deletes) > 0 {
+			deletes = append(deletes, n)
+		}
+	}
+	if len(deletes) == 0 {
 		return nil
-	})
-	return updateCount > 0, err
+	}
+	r, ok := t.(transform.Remover)
+	if !ok {
+		return nil
+	}
+	entries, err := r.Removed(deletes)
+	if err != nil {
+		c.log.Printf("WARN [%s]: removed: %v", name, err)
+		return nil
+	}
+	return entries
 }
 
 // filterNotificationsForPath returns notifications whose update paths
@@ -344,6 +800,16 @@ func drillDownToSubscribedPath(notifs []gnmiclient.Notification, yangPath string
 
 	var result []gnmiclient.Notification
 	for _, n := range notifs {
+		for _, d := range n.Deletes {
+			if path, ok := deleteAtSubscribedPath(d, cleanYang); ok {
+				result = append(result, gnmiclient.Notification{
+					Timestamp: n.Timestamp,
+					Origin:    n.Origin,
+					Target:    n.Target,
+					Deletes:   []string{path},
+				})
+			}
+		}
 		for _, u := range n.Updates {
 			cleanUpdatePath := stripPathModulePrefixes(u.Path)
 
@@ -358,6 +824,8 @@ func drillDownToSubscribedPath(notifs []gnmiclient.Notification, yangPath string
 			if cleanUpdatePathNoKeys == cleanYang {
 				result = append(result, gnmiclient.Notification{
 					Timestamp: n.Timestamp,
+					Origin:    n.Origin,
+					Target:    n.Target,
 					Updates:   []gnmiclient.Update{u},
 				})
 				continue
@@ -367,13 +835,19 @@ func drillDownToSubscribedPath(notifs []gnmiclient.Notification, yangPath string
 			// segments so transformers see the same structure as poll mode.
 			// E.g., subscribe sends path=/system/memory/state, value={physical:X}
 			// but transformer expects path=/system/memory, value={state:{physical:X}}
+			// The update path is cut back to the subscribed depth with its
+			// list keys kept, so the entity stays identifiable.
 			if strings.HasPrefix(cleanUpdatePathNoKeys, cleanYang+"/") {
 				remaining := strings.TrimPrefix(cleanUpdatePathNoKeys, cleanYang+"/")
 				wrapped := wrapValueInPath(u.Value, remaining)
+				segments := splitKeyedPath(cleanUpdatePath)
+				entity := "/" + strings.Join(segments[:len(splitKeyedPath(cleanYang))], "/")
 				result = append(result, gnmiclient.Notification{
 					Timestamp: n.Timestamp,
+					Origin:    n.Origin,
+					Target:    n.Target,
 					Updates: []gnmiclient.Update{{
-						Path:  yangPath,
+						Path:  entity,
 						Value: wrapped,
 					}},
 				})
@@ -398,6 +872,8 @@ func drillDownToSubscribedPath(notifs []gnmiclient.Notification, yangPath string
 			for _, d := range drilled {
 				result = append(result, gnmiclient.Notification{
 					Timestamp: n.Timestamp,
+					Origin:    n.Origin,
+					Target:    n.Target,
 					Updates:   []gnmiclient.Update{d},
 				})
 			}
@@ -406,6 +882,24 @@ func drillDownToSubscribedPath(notifs []gnmiclient.Notification, yangPath string
 	return result
 }
 
+// deleteAtSubscribedPath routes a deleted path to a subscription. A
+// delete at or below the subscribed path is passed on as is. A delete
+// above it (a whole interface or neighbor removed) is extended with the
+// rest of the subscribed path, so transformers see the same keyed path
+// shape as for updates.
+func deleteAtSubscribedPath(deletePath, cleanYang string) (string, bool) {
+	clean := stripPathModulePrefixes(deletePath)
+	noKeys := stripKeySelectors(clean)
+	yangNoKeys := stripKeySelectors(cleanYang)
+	switch {
+	case noKeys == yangNoKeys || strings.HasPrefix(noKeys, yangNoKeys+"/"):
+		return clean, true
+	case strings.HasPrefix(yangNoKeys, noKeys+"/"):
+		return clean + "/" + strings.TrimPrefix(yangNoKeys, noKeys+"/"), true
+	}
+	return "", false
+}
+
 // drillIntoMap navigates into a nested map following path segments.
 // When a segment resolves to a list ([]interface{}), it iterates each
 // element and continues drilling, creating separate Updates per entity.
@@ -501,14 +995,21 @@ func wrapValueInPath(value interface{}, relativePath string) interface{} {
 	return current
 }
 
-func (c *Collector) flushAll(batches map[string]*tableBatch) {
-	for _, batch := range batches {
-		c.flushBatch(batch)
+// flushAll writes every pending batch. The final flush on shutdown runs
+// after ctx is cancelled, so callers pass a context detached from it.
+func (c *Collector) flushAll(ctx context.Context, batches *tableBatches) {
+	for _, batch := range batches.all() {
+		c.flushBatch(ctx, batch)
 	}
 }
 
-func (c *Collector) flushBatch(batch *tableBatch) {
-	entries := batch.drain()
+func (c *Collector) flushBatch(ctx context.Context, batch *tableBatch) {
+	c.writeEntries(ctx, batch.table, batch.drain(), true)
+}
+
+// writeEntries writes entries to table, running the rates stage over
+// them when rated is set.
+func (c *Collector) writeEntries(ctx context.Context, table string, entries []transform.CommonFields, rated bool) {
 	if len(entries) == 0 {
 		return
 	}
@@ -516,28 +1017,17 @@ func (c *Collector) flushBatch(batch *tableBatch) {
 	// Merge complementary entries (e.g. CPU + memory → single system row),
 	// same as poll mode does in RunOnce.
 	entries = mergeByDataType(entries)
-
-	if c.dryRun {
-		for _, e := range entries {
-			data, _ := json.MarshalIndent(e, "", "  ")
-			fmt.Printf("[%s] %s\n", batch.table, string(data))
-		}
-		return
+	if rated {
+		c.applyRates(entries)
 	}
 
-	if c.logger == nil {
-		log.Printf("WARN: cannot flush %d entries for %s — no Azure logger", len(entries), batch.table)
-		return
-	}
-
-	maps := make([]map[string]interface{}, 0, len(entries))
-	for _, e := range entries {
-		maps = append(maps, flattenEntry(e))
-	}
-
-	if err := c.logger.Send(batch.table, maps); err != nil {
-		log.Printf("ERROR: flush %d entries to %s: %v", len(entries), batch.table, err)
-	} else {
-		log.Printf("Flushed %d entries to %s", len(entries), batch.table)
+	c.stats.Batch(table, len(entries))
+	switch err := c.out.Write(ctx, table, entries); {
+	case err == nil:
+		c.log.Printf("Flushed %d entries to %s", len(entries), table)
+	case errors.Is(err, sink.ErrDeferred):
+		c.log.Printf("WARN: flush %d entries to %s: %v", len(entries), table, err)
+	default:
+		c.log.Printf("ERROR: flush %d entries to %s: %v", len(entries), table, err)
 	}
 }
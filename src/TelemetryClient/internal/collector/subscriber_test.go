@@ -1,10 +1,16 @@
 package collector
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
+	"gnmi-collector/internal/config"
 	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/rates"
+	"gnmi-collector/internal/transform"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -255,3 +261,130 @@ func TestIsPermanentSubscribeError(t *testing.T) {
 		})
 	}
 }
+
+func TestDrillDownToSubscribedPath_Deletes(t *testing.T) {
+	notifs := []gnmiclient.Notification{{
+		Timestamp: 5,
+		Deletes: []string{
+			"/openconfig-lldp:lldp/interfaces/interface[name=Ethernet1/1]/neighbors/neighbor[id=7]",
+			"/lldp/interfaces/interface[name=Ethernet2]",
+			"/system/state/hostname",
+		},
+	}}
+
+	got := drillDownToSubscribedPath(notifs, "/openconfig-lldp:lldp/interfaces/interface/neighbors")
+	want := []string{
+		"/lldp/interfaces/interface[name=Ethernet1/1]/neighbors/neighbor[id=7]",
+		"/lldp/interfaces/interface[name=Ethernet2]/neighbors",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d notifications, want %d: %+v", len(got), len(want), got)
+	}
+	for i, n := range got {
+		if len(n.Updates) != 0 || len(n.Deletes) != 1 || n.Deletes[0] != want[i] || n.Timestamp != 5 {
+			t.Errorf("notification %d = %+v, want delete %s", i, n, want[i])
+		}
+	}
+}
+
+func TestTableBatchesHold(t *testing.T) {
+	bs := &tableBatches{m: map[string]*tableBatch{}}
+	bs.get("A_CL").add(make([]transform.CommonFields, 3))
+	bs.get("B_CL").add(make([]transform.CommonFields, 2))
+	if bs.pending() != 5 {
+		t.Errorf("pending = %d, want 5", bs.pending())
+	}
+
+	if held, _ := bs.held(); held {
+		t.Fatal("batches should not be held before a session starts")
+	}
+	bs.hold()
+	if held, _ := bs.held(); !held {
+		t.Fatal("batches should be held until sync_response")
+	}
+	if !bs.release() || bs.release() {
+		t.Error("release should report the hold exactly once")
+	}
+
+	bs.hold()
+	bs.heldSince = bs.heldSince.Add(-maxSnapshotHold - time.Second)
+	if held, expired := bs.held(); held || !expired {
+		t.Errorf("stale hold: held=%v expired=%v, want released as expired", held, expired)
+	}
+}
+
+func TestQueuePollHoldsBatches(t *testing.T) {
+	bs := &tableBatches{m: map[string]*tableBatch{}}
+	polls := make(chan struct{}, 1)
+	queuePoll(polls, bs)
+	if held, _ := bs.held(); !held || len(polls) != 1 {
+		t.Fatalf("after queuePoll: held=%v queued=%d, want a held poll", held, len(polls))
+	}
+	since := bs.heldSince
+	queuePoll(polls, bs)
+	if len(polls) != 1 || !bs.heldSince.Equal(since) {
+		t.Error("a poll still waiting should be neither queued twice nor extend the hold")
+	}
+	if !bs.release() {
+		t.Error("sync_response should release the poll's hold")
+	}
+}
+
+func TestForOriginAndTarget(t *testing.T) {
+	notifs := []gnmiclient.Notification{
+		{Timestamp: 1, Target: "COUNTERS_DB"},
+		{Timestamp: 2, Target: "APPL_DB"},
+		{Timestamp: 3},
+		{Timestamp: 4, Origin: "openconfig"},
+	}
+	got := forOriginAndTarget(notifs, gnmiclient.SubscriptionPath{Target: "COUNTERS_DB", Origin: "device"})
+	var ts []int64
+	for _, n := range got {
+		ts = append(ts, n.Timestamp)
+	}
+	if !reflect.DeepEqual(ts, []int64{1, 3}) {
+		t.Errorf("kept notifications %v, want 1 and 3", ts)
+	}
+}
+
+func TestSnapshotRowsSkipRates(t *testing.T) {
+	paths := []config.PathConfig{{
+		Name: "interface-counters", YANGPath: "/openconfig-interfaces:interfaces/interface/state/counters",
+		Table: "InterfaceCounter_CL", Enabled: true,
+	}}
+	cfg := &config.Config{Collection: config.CollectionConfig{Mode: "subscribe", SnapshotInterval: time.Minute}, Paths: paths}
+	out := &rowSink{rows: map[string][]transform.CommonFields{}}
+	c := New(cfg, nil, out, "", false)
+	c.rates, _ = rates.NewTracker("", nil)
+	sub, err := c.buildSubscription(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := newStateCache()
+	batches := &tableBatches{m: map[string]*tableBatch{}}
+	sample := func(at time.Time, inOctets int) {
+		t.Helper()
+		n := update(at.UnixNano(), "/interfaces/interface[name=Ethernet0]/state/counters",
+			map[string]interface{}{"in-octets": fmt.Sprint(inOctets), "out-octets": "0"})
+		c.route(context.Background(), []gnmiclient.Notification{n}, sub.subs, sub.lookup, batches, cache)
+		c.flushAll(context.Background(), batches)
+	}
+
+	// Samples 60s apart on the device clock, with a snapshot 55s after
+	// the first on the collector's clock.
+	t0 := time.Now().Add(-55 * time.Second)
+	sample(t0, 1000)
+	c.emitSnapshot(context.Background(), sub, cache, batches)
+	sample(t0.Add(time.Minute), 1000+60*1000)
+
+	rows := out.rows["InterfaceCounter_CL"]
+	if len(rows) != 3 {
+		t.Fatalf("rows = %d, want sample, snapshot, sample", len(rows))
+	}
+	if _, ok := rows[1].Message.(map[string]interface{})["in_octets_per_sec"]; ok {
+		t.Errorf("snapshot row has a rate: %v", rows[1].Message)
+	}
+	if rate := rows[2].Message.(map[string]interface{})["in_octets_per_sec"]; rate != 1000.0 {
+		t.Errorf("in_octets_per_sec after a snapshot = %v, want 1000 over the full sample interval", rate)
+	}
+}
@@ -0,0 +1,538 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"gnmi-collector/internal/azure"
+	"gnmi-collector/internal/config"
+	gnmiclient "gnmi-collector/internal/gnmi"
+	"gnmi-collector/internal/health"
+	"gnmi-collector/internal/prometheus"
+	"gnmi-collector/internal/rates"
+	"gnmi-collector/internal/sink"
+	"gnmi-collector/internal/spool"
+)
+
+// Options holds the process-wide output settings shared by the
+// Collector of every target.
+type Options struct {
+	Sinks   []config.SinkConfig // Resolved sinks (config plus --dry-run/--output overrides)
+	Logger  *azure.Logger       // Shared by azure sinks; nil when none is configured
+	Spool   *spool.Spool        // Retry queue for azure sinks; nil when disabled
+	Metrics *prometheus.Store   // Served on /metrics; nil without a prometheus sink
+	Health  *health.Stats       // Self-monitoring counters; nil disables them
+	DryRun  bool                // Log raw notification structure
+	DumpDir string
+
+	// Ingestion holds the clients of logs_ingestion sinks, keyed by
+	// their config and shared so all targets use one token cache.
+	Ingestion map[*config.LogsIngestionConfig]*azure.IngestionClient
+}
+
+// Supervisor runs one isolated collection loop per configured target.
+// Each target gets its own gNMI client, Collector and reconnect/backoff
+// state, so an unreachable or misbehaving switch never stalls the others.
+type Supervisor struct {
+	cfg     *config.Config
+	targets []*config.Config
+	multi   bool
+	opts    Options
+	reloads chan reloadRequest
+	stopped chan struct{}
+
+	ratesMu sync.Mutex
+	rates   map[string]rateTracker // By target label
+}
+
+type rateTracker struct {
+	cfg     config.RatesConfig
+	tracker *rates.Tracker
+}
+
+// NewSupervisor creates a Supervisor for every target in cfg. A
+// single-target config yields a supervisor with exactly one loop that
+// behaves like the classic one-switch collector.
+func NewSupervisor(cfg *config.Config, opts Options) *Supervisor {
+	return &Supervisor{
+		cfg:     cfg,
+		targets: cfg.TargetConfigs(),
+		multi:   len(cfg.Targets) > 0,
+		opts:    opts,
+		reloads: make(chan reloadRequest),
+		stopped: make(chan struct{}),
+		rates:   map[string]rateTracker{},
+	}
+}
+
+type reloadRequest struct {
+	cfg   *config.Config
+	reply chan error
+}
+
+// runner is the handle Run keeps for one target's collection loop.
+type runner struct {
+	label  string
+	cancel context.CancelFunc
+	err    error // Set by the loop before it reports its exit
+
+	mu      sync.Mutex
+	cfg     *config.Config // Latest target config, picked up on every (re)connect
+	current *Collector     // Collector of the active session, nil while reconnecting
+}
+
+// config returns the target config the next connection should use.
+func (r *runner) config() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// update records a reloaded target config and forwards it to the active
+// session, if any.
+func (r *runner) update(cfg *config.Config) {
+	r.mu.Lock()
+	r.cfg = cfg
+	c := r.current
+	r.mu.Unlock()
+	if c != nil {
+		c.Update(cfg)
+	}
+}
+
+// attach registers the collector of a new session. If a reload arrived
+// while the session was being set up with an older config, the collector
+// is handed the newer one straight away.
+func (r *runner) attach(c *Collector, used *config.Config) {
+	r.mu.Lock()
+	r.current = c
+	latest := r.cfg
+	r.mu.Unlock()
+	if c != nil && latest != used {
+		c.Update(latest)
+	}
+}
+
+// Run starts a collection loop per target and blocks until ctx is
+// cancelled or every target has stopped. Transient failures (switch
+// unreachable, TLS probe or discovery errors) are retried per target
+// with exponential backoff; only permanent errors stop a target. The
+// returned error joins the permanent errors of all stopped targets.
+// While Run is active, Reload applies configuration changes.
+func (s *Supervisor) Run(ctx context.Context) error {
+	defer close(s.stopped)
+
+	runners := map[string]*runner{}
+	exited := make(chan *runner)
+	live := 0
+	start := func(tcfg *config.Config) {
+		rctx, cancel := context.WithCancel(ctx)
+		r := &runner{label: tcfg.TargetLabel(), cancel: cancel, cfg: tcfg}
+		runners[r.label] = r
+		s.opts.Health.Target(r.label)
+		live++
+		go func() {
+			r.err = s.runTarget(rctx, r)
+			cancel()
+			exited <- r
+		}()
+	}
+	for _, tcfg := range s.targets {
+		start(tcfg)
+	}
+
+	var errs []error
+	for {
+		select {
+		case req := <-s.reloads:
+			req.reply <- s.apply(req.cfg, runners, start)
+		case r := <-exited:
+			live--
+			if runners[r.label] != r {
+				continue // replaced or removed by a reload
+			}
+			delete(runners, r.label)
+			errs = append(errs, r.err)
+			if len(runners) == 0 {
+				for ; live > 0; live-- {
+					<-exited
+				}
+				return errors.Join(errs...)
+			}
+		case <-ctx.Done():
+			for ; live > 0; live-- {
+				<-exited
+			}
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// Reload applies cfg to the running targets: targets are added, removed
+// or restarted when their connection settings changed, and path or
+// interval changes are handed to the running collectors, which re-run
+// discovery before applying them. The caller is expected to have
+// validated cfg (config.Load and ValidatePathNames); Reload only rejects
+// changes that cannot be applied without a restart.
+func (s *Supervisor) Reload(cfg *config.Config) error {
+	req := reloadRequest{cfg: cfg, reply: make(chan error, 1)}
+	select {
+	case s.reloads <- req:
+		return <-req.reply
+	case <-s.stopped:
+		return fmt.Errorf("supervisor is not running")
+	}
+}
+
+// apply diffs cfg against the running targets. It runs on the Run
+// goroutine, which owns runners.
+func (s *Supervisor) apply(cfg *config.Config, runners map[string]*runner, start func(*config.Config)) error {
+	if multi := len(cfg.Targets) > 0; multi != s.multi {
+		return fmt.Errorf("switching between target and targets requires a restart")
+	}
+	if cfg.Azure.WorkspaceIDEnv != s.cfg.Azure.WorkspaceIDEnv ||
+		cfg.Azure.PrimaryKeyEnv != s.cfg.Azure.PrimaryKeyEnv ||
+		cfg.Azure.SecondaryKeyEnv != s.cfg.Azure.SecondaryKeyEnv {
+		log.Printf("WARN: azure workspace settings changed — they take effect on the next restart")
+	}
+	if !reflect.DeepEqual(cfg.Sinks, s.cfg.Sinks) || cfg.Azure.Spool != s.cfg.Azure.Spool {
+		log.Printf("WARN: sinks or spool settings changed — they take effect on the next restart")
+	}
+	if cfg.Health != s.cfg.Health {
+		log.Printf("WARN: health settings changed — they take effect on the next restart")
+	}
+
+	next := cfg.TargetConfigs()
+	seen := map[string]bool{}
+	for _, tcfg := range next {
+		label := tcfg.TargetLabel()
+		seen[label] = true
+		r, ok := runners[label]
+		switch {
+		case !ok:
+			log.Printf("Reload: adding target %s", label)
+			start(tcfg)
+		case needsRestart(r.config(), tcfg):
+			log.Printf("Reload: connection settings of target %s changed — restarting it", label)
+			r.cancel()
+			start(tcfg)
+		case pathsChanged(r.config(), tcfg):
+			log.Printf("Reload: updating paths of target %s", label)
+			r.update(tcfg)
+		}
+	}
+	for label, r := range runners {
+		if !seen[label] {
+			log.Printf("Reload: removing target %s", label)
+			r.cancel()
+			delete(runners, label)
+			s.opts.Health.Remove(label)
+		}
+	}
+
+	s.cfg = cfg
+	return nil
+}
+
+// needsRestart reports whether moving a target from old to new requires
+// a fresh connection rather than an in-place update.
+func needsRestart(old, new *config.Config) bool {
+	return !reflect.DeepEqual(old.Target, new.Target) ||
+		old.Collection.Mode != new.Collection.Mode ||
+		old.Streams() != new.Streams() ||
+		// A POLL subscription polls on the interval it was started with.
+		(strings.EqualFold(new.Collection.Mode, "subscribe_poll") && old.Collection.Interval != new.Collection.Interval) ||
+		old.Collection.Encoding != new.Collection.Encoding ||
+		old.Collection.Timeout != new.Collection.Timeout ||
+		old.Collection.SnapshotInterval != new.Collection.SnapshotInterval ||
+		old.Discovery.Interval != new.Discovery.Interval ||
+		old.Azure.DeviceType != new.Azure.DeviceType ||
+		!reflect.DeepEqual(old.Rates, new.Rates)
+}
+
+// pathsChanged reports whether a running collector must be updated.
+func pathsChanged(old, new *config.Config) bool {
+	return !reflect.DeepEqual(old.Paths, new.Paths) ||
+		!reflect.DeepEqual(old.Discovery, new.Discovery) ||
+		old.Collection.Interval != new.Collection.Interval ||
+		old.Collection.MaxConcurrency != new.Collection.MaxConcurrency ||
+		old.Collection.CycleTimeout != new.Collection.CycleTimeout
+}
+
+// RunOnce connects to every target concurrently, runs a single
+// collection cycle on each and returns the joined per-target errors.
+func (s *Supervisor) RunOnce(ctx context.Context) error {
+	errs := make([]error, len(s.targets))
+	var wg sync.WaitGroup
+	for i, tcfg := range s.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := s.connect(ctx, tcfg, newTargetLog(tcfg))
+			if err != nil {
+				errs[i] = fmt.Errorf("target %s: %w", tcfg.TargetLabel(), err)
+				return
+			}
+			defer c.Close()
+			if err := c.RunOnce(ctx); err != nil {
+				errs[i] = fmt.Errorf("target %s: %w", tcfg.TargetLabel(), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// runTarget owns the lifecycle of one target: connect, collect until
+// the session ends, and reconnect with backoff. Every connect uses the
+// latest reloaded config. Returns nil on shutdown or the error that
+// permanently stopped the target.
+func (s *Supervisor) runTarget(ctx context.Context, r *runner) error {
+	tlog := newTargetLog(r.config())
+	delay := initialReconnectDelay
+	for {
+		tcfg := r.config()
+		c, err := s.connect(ctx, tcfg, tlog)
+		if err == nil {
+			delay = initialReconnectDelay
+			r.attach(c, tcfg)
+			err = s.collect(ctx, c)
+			r.attach(nil, nil)
+			c.Close()
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				tlog.Printf("ERROR: collection stopped: %v", err)
+				return fmt.Errorf("target %s: %w", tcfg.TargetLabel(), err)
+			}
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		s.opts.Health.Target(r.label).Reconnect()
+		tlog.Printf("ERROR: %v — retrying in %s", err, delay)
+		select {
+		case <-time.After(delay):
+			delay = delay * 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// connect dials the target, checks its paths against the models it
+// advertises in Capabilities and expands discovery templates, returning
+// a ready Collector. The template paths in tcfg are left untouched so
+// every reconnect re-runs detection and discovery.
+func (s *Supervisor) connect(ctx context.Context, tcfg *config.Config, tlog *log.Logger) (*Collector, error) {
+	tlog.Printf("Connecting to gNMI server at %s...", tcfg.TargetAddr())
+	client, err := gnmiclient.NewClient(tcfg)
+	if err != nil {
+		if change := rejectedCertChange(err); change != nil {
+			s.auditRejectedCert(ctx, tcfg, change, tlog)
+		}
+		return nil, fmt.Errorf("gNMI connect: %w", err)
+	}
+
+	capCtx, capCancel := context.WithTimeout(ctx, tcfg.Collection.Timeout)
+	caps, err := client.Capabilities(capCtx)
+	capCancel()
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("gNMI capabilities: %w", err)
+	}
+	tlog.Printf("Connected — gNMI version %s, %d models", caps.GetGNMIVersion(), len(caps.GetSupportedModels()))
+
+	// Pick the built-in profile for device_type auto and drop paths
+	// whose model the switch does not support.
+	models := newSwitchModels(caps)
+	resolved, err := models.resolve(tcfg, tlog)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	// Discover and expand template paths (e.g., {network_instance}, {component}).
+	expanded, err := DiscoverAndExpand(client, resolved.Discovery, resolved.Paths)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("path discovery: %w", err)
+	}
+	session := *resolved
+	session.Paths = expanded
+
+	stats := s.opts.Health.Target(tcfg.TargetLabel())
+	out, err := s.newSink(resolved, stats)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	c := New(&session, client, out, s.targetDir(s.opts.DumpDir, tcfg), s.opts.DryRun)
+	c.templates = resolved
+	c.models = models
+	c.auditCertChange(ctx, client.CertChange())
+	c.reportCertificate(ctx)
+	c.stats = stats
+	c.rates = s.tracker(tcfg, tlog)
+	return c, nil
+}
+
+// auditRejectedCert records a server certificate change the known_hosts
+// policy rejected. No session exists yet, so the row is written through
+// a sink set up just for it.
+func (s *Supervisor) auditRejectedCert(ctx context.Context, tcfg *config.Config, change *gnmiclient.FingerprintChange, tlog *log.Logger) {
+	out, err := s.newSink(tcfg, s.opts.Health.Target(tcfg.TargetLabel()))
+	if err != nil {
+		tlog.Printf("WARN: cannot record rejected certificate change: %v", err)
+		return
+	}
+	defer out.Close()
+	writeRows(ctx, out, tcfg.Target.TLS.AuditTable, certChangeRows(change), tlog)
+}
+
+// tracker returns the target's counter rate tracker, or nil when rates
+// are disabled. Trackers outlive sessions so a reconnect does not lose
+// the previous samples; a changed rates config starts a fresh one.
+func (s *Supervisor) tracker(tcfg *config.Config, tlog *log.Logger) *rates.Tracker {
+	if !tcfg.Rates.Enabled {
+		return nil
+	}
+	s.ratesMu.Lock()
+	defer s.ratesMu.Unlock()
+
+	label := tcfg.TargetLabel()
+	if rt, ok := s.rates[label]; ok && reflect.DeepEqual(rt.cfg, tcfg.Rates) {
+		return rt.tracker
+	}
+	var path string
+	if tcfg.Rates.StateDir != "" {
+		path = filepath.Join(s.targetDir(tcfg.Rates.StateDir, tcfg), "rates.json")
+	}
+	t, err := rates.NewTracker(path, tcfg.Rates.DataTypes)
+	if err != nil {
+		tlog.Printf("WARN: %v — keeping counter rates in memory only", err)
+		t, _ = rates.NewTracker("", tcfg.Rates.DataTypes)
+	}
+	s.rates[label] = rateTracker{cfg: tcfg.Rates, tracker: t}
+	return t
+}
+
+// newSink builds the target's view of the configured sinks: rows are
+// stamped with the target identity — its name, or its address when it
+// has none — including a detected device type, and directory sinks
+// write into the target's own subdirectory.
+func (s *Supervisor) newSink(tcfg *config.Config, stats *health.Target) (sink.Sink, error) {
+	env := sink.Env{
+		Logger:    s.opts.Logger,
+		Spool:     s.opts.Spool,
+		Metrics:   s.opts.Metrics,
+		Stats:     stats,
+		Ingestion: s.opts.Ingestion,
+	}
+	env.Identity = sink.Identity{Hostname: tcfg.TargetLabel(), DeviceType: tcfg.Azure.DeviceType}
+
+	sinks := make([]sink.Sink, 0, len(s.opts.Sinks))
+	for _, sc := range s.opts.Sinks {
+		if sc.Type == "directory" {
+			sc.Dir = s.targetDir(sc.Dir, tcfg)
+		}
+		out, err := sink.New(sc, env)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, out)
+	}
+	return sink.Multi(sinks...), nil
+}
+
+// collect runs the configured collection mode until ctx is cancelled.
+// A non-nil error means the target cannot make progress without human
+// intervention (e.g., the switch rejected the subscription).
+func (s *Supervisor) collect(ctx context.Context, c *Collector) error {
+	if c.stats != nil && !c.cfg.Health.DisableReport {
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.reportHealth(rctx)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if iv := c.cfg.Discovery.Interval; iv > 0 {
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.rediscoverEvery(rctx, iv)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if rc := c.cfg.Target.TLS.Rotation; rc != nil && rc.CheckInterval > 0 {
+		tcfg := *c.cfg
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.rotateCertificates(rctx, &tcfg)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+
+	if strings.EqualFold(c.cfg.Collection.Mode, "subscribe_poll") {
+		c.log.Printf("Starting POLL subscription")
+		return c.RunSubscribePoll(ctx)
+	}
+	// Paths set to collection: poll are polled by RunStream alongside the
+	// stream; without any subscribed path the target is polled only.
+	if c.cfg.Streams() {
+		c.log.Printf("Starting subscribe stream")
+		return c.RunStream(ctx)
+	}
+	c.RunPoll(ctx)
+	return nil
+}
+
+// targetDir gives each target its own subdirectory of dir in
+// multi-target mode so per-table files from different switches don't
+// overwrite each other.
+func (s *Supervisor) targetDir(dir string, tcfg *config.Config) string {
+	if dir == "" || !s.multi {
+		return dir
+	}
+	return filepath.Join(dir, tcfg.Target.Name)
+}
+
+// newTargetLog returns a logger that tags every line with the target
+// name when one is configured, and is identical to the standard logger
+// otherwise.
+func newTargetLog(cfg *config.Config) *log.Logger {
+	prefix := ""
+	if cfg.Target.Name != "" {
+		prefix = "[" + cfg.Target.Name + "] "
+	}
+	return log.New(log.Writer(), prefix, log.Flags()|log.Lmsgprefix)
+}
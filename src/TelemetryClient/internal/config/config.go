@@ -2,29 +2,127 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	"gnmi-collector/internal/secrets"
+
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Target     TargetConfig     `yaml:"target"`
-	Collection CollectionConfig `yaml:"collection"`
-	Azure      AzureConfig      `yaml:"azure"`
-	Paths      []PathConfig     `yaml:"paths"`
+	Target     TargetConfig            `yaml:"target"`
+	Targets    []TargetConfig          `yaml:"targets,omitempty"` // Multi-target mode; mutually exclusive with target
+	Collection CollectionConfig        `yaml:"collection"`
+	Azure      AzureConfig             `yaml:"azure"`
+	Paths      []PathConfig            `yaml:"paths"`
+	Profiles   map[string][]PathConfig `yaml:"profiles,omitempty"` // Named path sets referenced by targets[].profile
+	Sinks      []SinkConfig            `yaml:"sinks,omitempty"`    // Output destinations; defaults to a single azure sink
+	Health     HealthConfig            `yaml:"health,omitempty"`
+	Rates      RatesConfig             `yaml:"rates,omitempty"`
+	Discovery  DiscoveryConfig         `yaml:"discovery,omitempty"`
+	Secrets    SecretsConfig           `yaml:"secrets,omitempty"` // Where credentials are read from; default the environment
+
+	provider secrets.CredentialProvider // Built from Secrets by validate
 }
 
 type TargetConfig struct {
-	Address     string        `yaml:"address"`
-	Port        int           `yaml:"port"`
-	TLS         TLSConfig     `yaml:"tls"`
-	Credentials CredConfig    `yaml:"credentials"`
+	Name        string     `yaml:"name,omitempty"` // Identity stamped on every row; defaults to address in multi-target mode
+	Address     string     `yaml:"address"`
+	Port        int        `yaml:"port"`
+	TLS         TLSConfig  `yaml:"tls"`
+	Credentials CredConfig `yaml:"credentials"`
+	DeviceType  string     `yaml:"device_type,omitempty"` // Overrides azure.device_type for this target; "auto" detects it
+	Profile     string     `yaml:"profile,omitempty"`     // Key under profiles:; empty uses the top-level paths
 }
 
 type TLSConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	CAFile  string `yaml:"ca_file,omitempty"` // Optional: pin a specific CA cert file. When empty, TOFU is used.
+
+	// KnownHosts records the server certificate fingerprint of each
+	// target address on first use and verifies it on every connect.
+	// FingerprintPolicy decides what happens when the certificate pinned
+	// in known_hosts, ca_file or in memory changes.
+	KnownHosts        string `yaml:"known_hosts,omitempty"`
+	FingerprintPolicy string `yaml:"fingerprint_policy,omitempty"` // strict (default), warn or accept-if-signed-by
+	SigningCAFile     string `yaml:"signing_ca_file,omitempty"`    // CA bundle for accept-if-signed-by
+	AuditTable        string `yaml:"audit_table,omitempty"`        // Fingerprint change and rotation rows; default CollectorEvent_CL
+
+	// Client certificate authentication (mTLS). With a client cert,
+	// credentials are optional. An encrypted PKCS#8 key is decrypted
+	// with the password read from ClientKeyPasswordEnv.
+	ClientCertFile       string   `yaml:"client_cert_file,omitempty"`
+	ClientKeyFile        string   `yaml:"client_key_file,omitempty"`
+	ClientKeyPasswordEnv string   `yaml:"client_key_password_env,omitempty"`
+	ServerName           string   `yaml:"server_name,omitempty"`   // Overrides the name the server cert is verified against
+	MinVersion           string   `yaml:"min_version,omitempty"`   // "1.2" (default) or "1.3"
+	CipherSuites         []string `yaml:"cipher_suites,omitempty"` // TLS 1.2 suites by Go name; default Go's secure set
+
+	// The server certificate is inspected on every connection and
+	// written to CertTable; expiry is logged as a warning once it is
+	// within each of ExpiryWarnDays days.
+	CertTable      string `yaml:"cert_table,omitempty"`       // Default GnmiCertificate_CL
+	ExpiryWarnDays []int  `yaml:"expiry_warn_days,omitempty"` // Default 30, 14, 7
+
+	// Rotation replaces the server certificate through gNOI certificate
+	// management; nil disables it.
+	Rotation *CertRotationConfig `yaml:"rotation,omitempty"`
+}
+
+// validate checks the TLS settings of the target named by field and
+// fills their defaults.
+func (t *TLSConfig) validate(field string) error {
+	if err := t.validateClient(field); err != nil {
+		return err
+	}
+	if t.CertTable == "" {
+		t.CertTable = "GnmiCertificate_CL"
+	}
+	if t.AuditTable == "" {
+		t.AuditTable = "CollectorEvent_CL"
+	}
+	if t.ExpiryWarnDays == nil {
+		t.ExpiryWarnDays = []int{30, 14, 7}
+	}
+	for _, d := range t.ExpiryWarnDays {
+		if d <= 0 {
+			return fmt.Errorf("%s.expiry_warn_days must be positive", field)
+		}
+	}
+	if t.Rotation != nil {
+		if !t.Enabled {
+			return fmt.Errorf("%s.rotation requires enabled: true", field)
+		}
+		// The rotated certificate must stay trusted across reconnects and
+		// by a running collector when `cert rotate` installs it.
+		if t.CAFile == "" && t.KnownHosts == "" {
+			return fmt.Errorf("%s.rotation requires ca_file or known_hosts to pin the rotated certificate", field)
+		}
+		if err := t.Rotation.validate(field + ".rotation"); err != nil {
+			return err
+		}
+	}
+	if t.KnownHosts != "" && t.CAFile != "" {
+		return fmt.Errorf("%s.known_hosts and ca_file are mutually exclusive", field)
+	}
+	switch t.FingerprintPolicy {
+	case "":
+		t.FingerprintPolicy = "strict"
+	case "strict", "warn":
+	case "accept-if-signed-by":
+		if t.SigningCAFile == "" {
+			return fmt.Errorf("%s.fingerprint_policy accept-if-signed-by requires signing_ca_file", field)
+		}
+	default:
+		return fmt.Errorf("%s.fingerprint_policy must be strict, warn or accept-if-signed-by", field)
+	}
+	return nil
 }
 
 type CredConfig struct {
@@ -33,17 +131,183 @@ type CredConfig struct {
 }
 
 type CollectionConfig struct {
-	Mode     string        `yaml:"mode"`
-	Interval time.Duration `yaml:"interval"`
-	Timeout  time.Duration `yaml:"timeout"`
-	Encoding string        `yaml:"encoding"`
+	Mode             string        `yaml:"mode"` // "poll" (default), "subscribe" or "subscribe_poll"
+	Interval         time.Duration `yaml:"interval"`
+	Timeout          time.Duration `yaml:"timeout"`
+	Encoding         string        `yaml:"encoding"`
+	MaxConcurrency   int           `yaml:"max_concurrency,omitempty"`   // Paths fetched at once in poll mode; default 4
+	CycleTimeout     time.Duration `yaml:"cycle_timeout,omitempty"`     // Deadline for one poll cycle's fetches; default the interval
+	SnapshotInterval time.Duration `yaml:"snapshot_interval,omitempty"` // Subscribe mode: re-emit every cached entity this often; 0 disables
 }
 
 type AzureConfig struct {
-	WorkspaceIDEnv  string `yaml:"workspace_id_env"`
-	PrimaryKeyEnv   string `yaml:"primary_key_env"`
-	SecondaryKeyEnv string `yaml:"secondary_key_env"`
-	DeviceType      string `yaml:"device_type"`
+	WorkspaceIDEnv  string      `yaml:"workspace_id_env"`
+	PrimaryKeyEnv   string      `yaml:"primary_key_env"`
+	SecondaryKeyEnv string      `yaml:"secondary_key_env"`
+	DeviceType      string      `yaml:"device_type"`     // cisco-nx-os, sonic or auto (detected from the switch's capabilities)
+	Spool           SpoolConfig `yaml:"spool,omitempty"` // Disk queue for failed uploads; disabled when dir is empty
+}
+
+// HealthConfig configures the collector's self-monitoring: the /healthz,
+// /readyz and internal /metrics endpoints and the periodic health row
+// written to the sinks alongside the telemetry.
+type HealthConfig struct {
+	Listen         string        `yaml:"listen,omitempty"`          // Default: the prometheus sink's listener, if any
+	StaleAfter     time.Duration `yaml:"stale_after,omitempty"`     // /readyz fails past this; default 3x collection.interval
+	ReportInterval time.Duration `yaml:"report_interval,omitempty"` // Default 5m
+	ReportTable    string        `yaml:"report_table,omitempty"`    // Default CollectorHealth_CL
+	DisableReport  bool          `yaml:"disable_report,omitempty"`
+}
+
+// SpoolConfig bounds the on-disk queue that failed Azure uploads are
+// kept in until the workspace is reachable again. When the spool is
+// full, drop_policy "oldest" evicts the oldest batches to make room and
+// "newest" rejects incoming batches instead.
+type SpoolConfig struct {
+	Dir          string        `yaml:"dir"`
+	MaxBytes     int64         `yaml:"max_bytes,omitempty"`     // Default 256 MiB
+	MaxAge       time.Duration `yaml:"max_age,omitempty"`       // Default 24h; older batches are dropped unsent
+	SegmentBytes int64         `yaml:"segment_bytes,omitempty"` // Default 8 MiB
+	DropPolicy   string        `yaml:"drop_policy,omitempty"`   // "oldest" (default) or "newest"
+}
+
+// SinkConfig describes one output destination. Include and Exclude hold
+// table name patterns in path.Match syntax (e.g. "Cisco*"); an empty
+// include list accepts every table, and exclude wins over include.
+type SinkConfig struct {
+	Type          string               `yaml:"type"`          // "azure", "logs_ingestion", "directory", "prometheus" or "stdout"
+	Dir           string               `yaml:"dir,omitempty"` // Output directory for the directory sink
+	LogsIngestion *LogsIngestionConfig `yaml:"logs_ingestion,omitempty"`
+	Include       []string             `yaml:"include,omitempty"`
+	Exclude       []string             `yaml:"exclude,omitempty"`
+
+	// Prometheus sink: the /metrics listen address (default ":9273") and
+	// how long a series survives without an update. Zero keeps series
+	// until restart, which suits on_change paths that rarely report.
+	Listen      string        `yaml:"listen,omitempty"`
+	ExpireAfter time.Duration `yaml:"expire_after,omitempty"`
+}
+
+// LogsIngestionConfig configures the logs_ingestion sink, which sends
+// rows through the Azure Monitor Logs Ingestion API: a data collection
+// endpoint (DCE), a data collection rule (DCR) and a service principal
+// that obtains Entra ID tokens with a client secret or a certificate.
+type LogsIngestionConfig struct {
+	Endpoint        string                  `yaml:"endpoint"`                   // DCE logs ingestion URL
+	DCRImmutableID  string                  `yaml:"dcr_immutable_id,omitempty"` // Default DCR for every table
+	TenantIDEnv     string                  `yaml:"tenant_id_env"`
+	ClientIDEnv     string                  `yaml:"client_id_env"`
+	ClientSecretEnv string                  `yaml:"client_secret_env,omitempty"`
+	CertificateFile string                  `yaml:"certificate_file,omitempty"` // PEM certificate + RSA key, instead of a secret
+	AuthorityHost   string                  `yaml:"authority_host,omitempty"`   // Default https://login.microsoftonline.com
+	Streams         map[string]StreamConfig `yaml:"streams,omitempty"`          // Table → stream; default "Custom-<table>"
+}
+
+// StreamConfig maps one table to a DCR stream.
+type StreamConfig struct {
+	Stream         string `yaml:"stream"`
+	DCRImmutableID string `yaml:"dcr_immutable_id,omitempty"` // Overrides the sink's default DCR
+}
+
+// RatesConfig enables the counter processing stage, which adds per-interval
+// *_delta and *_per_sec fields (and bps/utilization for interfaces) to
+// rows carrying cumulative counters.
+type RatesConfig struct {
+	Enabled   bool     `yaml:"enabled"`
+	StateDir  string   `yaml:"state_dir,omitempty"`  // Persists the last samples across restarts; memory only when empty
+	DataTypes []string `yaml:"data_types,omitempty"` // Default: interface_counters, interface_error_counters
+}
+
+// DiscoveryConfig declares the template variables that may appear in
+// yang_path, e.g. {component} in components/component[name={component}].
+// At connect time each variable used by an enabled path is resolved to
+// the list of key values found on the switch, and the path is expanded
+// into one concrete path per combination of values. Discovery is re-run
+// after a stream reconnects and, with an interval set, periodically;
+// paths are then added or removed as the switch changes, and every
+// change is written as a row to event_table.
+type DiscoveryConfig struct {
+	MaxPaths   int                          `yaml:"max_paths,omitempty"`   // Concrete paths one template may expand to; default 256
+	Interval   time.Duration                `yaml:"interval,omitempty"`    // Re-run discovery this often; 0 disables periodic runs
+	EventTable string                       `yaml:"event_table,omitempty"` // Default CollectorEvent_CL
+	Variables  map[string]DiscoveryVariable `yaml:"variables,omitempty"`
+}
+
+// DiscoveryVariable describes how the values of one template variable
+// are found: the list at Path is queried and the Key of every entry is
+// collected. Values not matching Filter are dropped, and when Probe is
+// set, so are values for which the probe path (with the variable filled
+// in) returns no data.
+type DiscoveryVariable struct {
+	Path   string `yaml:"path"`             // List queried for values, e.g. /openconfig-platform:components/component
+	Key    string `yaml:"key,omitempty"`    // Key of the list's last element; default "name"
+	Filter string `yaml:"filter,omitempty"` // Regular expression values must match
+	Probe  string `yaml:"probe,omitempty"`  // Path template that must return data for a value to be kept
+}
+
+// builtinDiscoveryVariables are available without being declared.
+var builtinDiscoveryVariables = map[string]DiscoveryVariable{
+	"network_instance": {Path: "/openconfig-network-instance:network-instances/network-instance", Key: "name"},
+}
+
+// templateVar matches a {variable} token in a yang_path.
+var templateVar = regexp.MustCompile(`\{([a-z][a-z0-9_]*)\}`)
+
+// TemplateVariables returns the discovery variables used in yangPath, in
+// order of first appearance.
+func TemplateVariables(yangPath string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range templateVar.FindAllStringSubmatch(yangPath, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Variable returns the definition of a template variable, falling back
+// to the built-in ones such as network_instance.
+func (d DiscoveryConfig) Variable(name string) (DiscoveryVariable, bool) {
+	if v, ok := d.Variables[name]; ok {
+		return v, true
+	}
+	v, ok := builtinDiscoveryVariables[name]
+	return v, ok
+}
+
+func (d *DiscoveryConfig) validate() error {
+	if d.MaxPaths < 0 {
+		return fmt.Errorf("discovery.max_paths must not be negative")
+	}
+	if d.MaxPaths == 0 {
+		d.MaxPaths = 256
+	}
+	if d.Interval < 0 {
+		return fmt.Errorf("discovery.interval must not be negative")
+	}
+	if d.EventTable == "" {
+		d.EventTable = "CollectorEvent_CL"
+	}
+	for name, v := range d.Variables {
+		if !templateVar.MatchString("{" + name + "}") {
+			return fmt.Errorf("discovery variable %q: names are lowercase letters, digits and underscores", name)
+		}
+		if v.Path == "" {
+			return fmt.Errorf("discovery variable %q: path is required", name)
+		}
+		if v.Key == "" {
+			v.Key = "name"
+		}
+		if v.Filter != "" {
+			if _, err := regexp.Compile(v.Filter); err != nil {
+				return fmt.Errorf("discovery variable %q: invalid filter: %w", name, err)
+			}
+		}
+		d.Variables[name] = v
+	}
+	return nil
 }
 
 type PathConfig struct {
@@ -51,8 +315,11 @@ type PathConfig struct {
 	YANGPath          string        `yaml:"yang_path"`
 	Table             string        `yaml:"table"`
 	Enabled           bool          `yaml:"enabled"`
+	Collection        string        `yaml:"collection,omitempty"`         // "subscribe" or "poll"; default collection.mode
+	Origin            string        `yaml:"origin,omitempty"`             // gNMI path origin, e.g. "device" for NX-OS native paths
+	Target            string        `yaml:"target,omitempty"`             // gNMI target, e.g. "COUNTERS_DB" for SONiC virtual DB paths
 	Mode              string        `yaml:"mode,omitempty"`               // "sample" or "on_change" (subscribe); ignored in poll mode
-	SampleInterval    time.Duration `yaml:"sample_interval,omitempty"`    // For sample mode subscriptions
+	SampleInterval    time.Duration `yaml:"sample_interval,omitempty"`    // Sample mode interval; also this path's interval in poll mode
 	HeartbeatInterval time.Duration `yaml:"heartbeat_interval,omitempty"` // Override server-side liveness interval (default: 2m for on_change)
 	ResolvedLabel     string        `yaml:"-"`                            // Set by discovery; used for logging instead of Name when non-empty
 }
@@ -77,11 +344,18 @@ func Parse(data []byte) (*Config, error) {
 }
 
 func (c *Config) validate() error {
-	if c.Target.Address == "" {
-		return fmt.Errorf("target.address is required")
-	}
-	if c.Target.Port <= 0 || c.Target.Port > 65535 {
-		return fmt.Errorf("target.port must be 1-65535")
+	if len(c.Targets) == 0 {
+		if c.Target.Address == "" {
+			return fmt.Errorf("target.address is required")
+		}
+		if c.Target.Port <= 0 || c.Target.Port > 65535 {
+			return fmt.Errorf("target.port must be 1-65535")
+		}
+		if err := c.Target.TLS.validate("target.tls"); err != nil {
+			return err
+		}
+	} else if c.Target.Address != "" {
+		return fmt.Errorf("target and targets are mutually exclusive — move the single target into the targets list")
 	}
 	if c.Collection.Interval <= 0 {
 		c.Collection.Interval = 5 * time.Minute
@@ -89,14 +363,50 @@ func (c *Config) validate() error {
 	if c.Collection.Timeout <= 0 {
 		c.Collection.Timeout = 30 * time.Second
 	}
-	if c.Collection.Encoding == "" {
+	// With device_type auto the encoding is left to the detected profile.
+	if c.Collection.Encoding == "" && !c.detectsDeviceType() {
 		c.Collection.Encoding = "JSON"
 	}
-	if c.Collection.Mode == "" {
+	switch strings.ToLower(c.Collection.Mode) {
+	case "":
 		c.Collection.Mode = "poll"
+	case "poll", "subscribe", "subscribe_poll":
+	default:
+		return fmt.Errorf("collection.mode must be poll, subscribe or subscribe_poll")
+	}
+	if c.Collection.MaxConcurrency < 0 {
+		return fmt.Errorf("collection.max_concurrency must not be negative")
+	}
+	if c.Collection.MaxConcurrency == 0 {
+		c.Collection.MaxConcurrency = 4
+	}
+	if c.Collection.CycleTimeout <= 0 {
+		c.Collection.CycleTimeout = c.Collection.Interval
+	}
+	if err := c.validateSinks(); err != nil {
+		return err
+	}
+	if err := c.Discovery.validate(); err != nil {
+		return err
 	}
-	if c.Azure.DeviceType == "" {
-		return fmt.Errorf("azure.device_type is required (supported: cisco-nx-os, sonic)")
+	if c.Health.StaleAfter <= 0 {
+		c.Health.StaleAfter = 3 * c.Collection.Interval
+	}
+	if c.Health.ReportInterval <= 0 {
+		c.Health.ReportInterval = 5 * time.Minute
+	}
+	if c.Health.ReportTable == "" {
+		c.Health.ReportTable = "CollectorHealth_CL"
+	}
+	provider, err := c.Secrets.newProvider()
+	if err != nil {
+		return err
+	}
+	c.provider = provider
+	switch c.Azure.Spool.DropPolicy {
+	case "", "oldest", "newest":
+	default:
+		return fmt.Errorf("azure.spool.drop_policy must be oldest or newest")
 	}
 
 	// TLS: when enabled, TOFU is used by default (fetch server cert on
@@ -104,28 +414,250 @@ func (c *Config) validate() error {
 	// be provided to pin a specific certificate.
 	// No additional config is required — TLS "just works" with TOFU.
 
+	if len(c.Targets) == 0 {
+		if c.Azure.DeviceType == "" {
+			return fmt.Errorf("azure.device_type is required (supported: cisco-nx-os, sonic, auto)")
+		}
+		enabledCount, err := c.validatePaths(c.Paths)
+		if err != nil {
+			return err
+		}
+		// Without paths of its own, an auto target uses the built-in
+		// profile of the detected device type.
+		if enabledCount == 0 && c.Azure.DeviceType != DeviceTypeAuto {
+			return fmt.Errorf("at least one path must be enabled")
+		}
+		return nil
+	}
+	return c.validateTargets()
+}
+
+// detectsDeviceType reports whether any target has device_type auto.
+func (c *Config) detectsDeviceType() bool {
+	if c.Azure.DeviceType == DeviceTypeAuto {
+		return true
+	}
+	for _, t := range c.Targets {
+		if t.DeviceType == DeviceTypeAuto {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTargets checks the targets list and the path profiles it
+// references, filling per-target defaults (name, device_type).
+func (c *Config) validateTargets() error {
+	topEnabled, err := c.validatePaths(c.Paths)
+	if err != nil {
+		return err
+	}
+	profileEnabled := make(map[string]int, len(c.Profiles))
+	for name, paths := range c.Profiles {
+		n, err := c.validatePaths(paths)
+		if err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
+		}
+		profileEnabled[name] = n
+	}
+
+	names := make(map[string]bool, len(c.Targets))
+	caFiles := make(map[string]string, len(c.Targets))
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if t.Address == "" {
+			return fmt.Errorf("targets[%d].address is required", i)
+		}
+		if t.Port <= 0 || t.Port > 65535 {
+			return fmt.Errorf("targets[%d].port must be 1-65535", i)
+		}
+		if err := t.TLS.validate(fmt.Sprintf("targets[%d].tls", i)); err != nil {
+			return err
+		}
+		if t.Name == "" {
+			// Same as TargetLabel, so two targets on one host differ.
+			t.Name = net.JoinHostPort(t.Address, strconv.Itoa(t.Port))
+		}
+		if names[t.Name] {
+			return fmt.Errorf("targets[%d]: duplicate target name %q", i, t.Name)
+		}
+		names[t.Name] = true
+
+		if t.DeviceType == "" {
+			t.DeviceType = c.Azure.DeviceType
+		}
+		if t.DeviceType == "" {
+			return fmt.Errorf("target %q: device_type is required (set targets[].device_type or azure.device_type)", t.Name)
+		}
+
+		enabled := topEnabled
+		if t.Profile != "" {
+			n, ok := profileEnabled[t.Profile]
+			if !ok {
+				return fmt.Errorf("target %q references unknown profile %q", t.Name, t.Profile)
+			}
+			enabled = n
+		}
+		if enabled == 0 && t.DeviceType != DeviceTypeAuto {
+			return fmt.Errorf("target %q: at least one path must be enabled", t.Name)
+		}
+
+		// A persisted TOFU cert is per switch; two targets writing the
+		// same ca_file would overwrite each other's pinned certificate.
+		if ca := t.TLS.CAFile; ca != "" {
+			if other, dup := caFiles[ca]; dup {
+				return fmt.Errorf("targets %q and %q share tls.ca_file %s", other, t.Name, ca)
+			}
+			caFiles[ca] = t.Name
+		}
+	}
+	return nil
+}
+
+// validateSinks checks the sinks section, defaulting to a single azure
+// sink (the collector's original behaviour) when it is omitted.
+func (c *Config) validateSinks() error {
+	if len(c.Sinks) == 0 {
+		c.Sinks = []SinkConfig{{Type: "azure"}}
+		return nil
+	}
+	prometheusSinks := 0
+	for i, s := range c.Sinks {
+		switch s.Type {
+		case "azure", "stdout":
+		case "prometheus":
+			if prometheusSinks++; prometheusSinks > 1 {
+				return fmt.Errorf("sinks[%d]: only one prometheus sink is supported", i)
+			}
+			if s.Listen == "" {
+				c.Sinks[i].Listen = ":9273"
+			}
+			if s.ExpireAfter < 0 {
+				return fmt.Errorf("sinks[%d]: expire_after must not be negative", i)
+			}
+		case "directory":
+			if s.Dir == "" {
+				return fmt.Errorf("sinks[%d]: directory sink requires dir", i)
+			}
+		case "logs_ingestion":
+			if err := s.LogsIngestion.validate(); err != nil {
+				return fmt.Errorf("sinks[%d]: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("sinks[%d]: unknown sink type %q (supported: azure, logs_ingestion, directory, prometheus, stdout)", i, s.Type)
+		}
+		for _, pattern := range append(append([]string{}, s.Include...), s.Exclude...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("sinks[%d]: invalid table pattern %q: %w", i, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *LogsIngestionConfig) validate() error {
+	switch {
+	case l == nil:
+		return fmt.Errorf("logs_ingestion sink requires a logs_ingestion section")
+	case l.Endpoint == "":
+		return fmt.Errorf("logs_ingestion.endpoint is required")
+	case l.TenantIDEnv == "" || l.ClientIDEnv == "":
+		return fmt.Errorf("logs_ingestion.tenant_id_env and client_id_env are required")
+	case (l.ClientSecretEnv == "") == (l.CertificateFile == ""):
+		return fmt.Errorf("logs_ingestion needs exactly one of client_secret_env or certificate_file")
+	case l.DCRImmutableID == "" && len(l.Streams) == 0:
+		return fmt.Errorf("logs_ingestion.dcr_immutable_id is required")
+	}
+	for table, st := range l.Streams {
+		if st.Stream == "" {
+			return fmt.Errorf("logs_ingestion.streams[%s].stream is required", table)
+		}
+		if st.DCRImmutableID == "" && l.DCRImmutableID == "" {
+			return fmt.Errorf("logs_ingestion.streams[%s] has no dcr_immutable_id", table)
+		}
+	}
+	return nil
+}
+
+// validatePaths checks a path list and fills per-path defaults in place.
+// Returns the number of enabled paths.
+func (c *Config) validatePaths(paths []PathConfig) (int, error) {
 	enabledCount := 0
-	for i, p := range c.Paths {
+	for i, p := range paths {
 		if p.Enabled {
 			if p.YANGPath == "" {
-				return fmt.Errorf("path %q has empty yang_path", p.Name)
+				return 0, fmt.Errorf("path %q has empty yang_path", p.Name)
 			}
 			if p.Table == "" {
-				return fmt.Errorf("path %q has empty table", p.Name)
+				return 0, fmt.Errorf("path %q has empty table", p.Name)
+			}
+			target, origin, yangPath := SplitPath(p.YANGPath)
+			if target != "" && p.Target != "" && target != p.Target {
+				return 0, fmt.Errorf("path %q: target %q in yang_path conflicts with target %q", p.Name, target, p.Target)
+			}
+			if origin != "" && p.Origin != "" && origin != p.Origin {
+				return 0, fmt.Errorf("path %q: origin %q in yang_path conflicts with origin %q", p.Name, origin, p.Origin)
+			}
+			if target != "" {
+				paths[i].Target = target
+			}
+			if origin != "" {
+				paths[i].Origin = origin
+			}
+			paths[i].YANGPath = yangPath
+			for _, v := range TemplateVariables(yangPath) {
+				if _, ok := c.Discovery.Variable(v); !ok {
+					return 0, fmt.Errorf("path %q: template variable {%s} is not declared under discovery.variables", p.Name, v)
+				}
+			}
+			switch strings.ToLower(p.Collection) {
+			case "":
+				paths[i].Collection = c.defaultPathCollection()
+			case "subscribe", "poll":
+				paths[i].Collection = strings.ToLower(p.Collection)
+			default:
+				return 0, fmt.Errorf("path %q: collection must be subscribe or poll", p.Name)
 			}
 			if p.Mode == "" {
-				c.Paths[i].Mode = "sample"
+				paths[i].Mode = "sample"
 			}
 			if p.SampleInterval <= 0 {
-				c.Paths[i].SampleInterval = c.Collection.Interval
+				paths[i].SampleInterval = c.Collection.Interval
 			}
 			enabledCount++
 		}
 	}
-	if enabledCount == 0 {
-		return fmt.Errorf("at least one path must be enabled")
+	return enabledCount, nil
+}
+
+// defaultPathCollection is how paths without a collection setting are
+// collected: by subscription in the subscribe modes, by polling otherwise.
+func (c *Config) defaultPathCollection() string {
+	switch strings.ToLower(c.Collection.Mode) {
+	case "subscribe", "subscribe_poll":
+		return "subscribe"
 	}
-	return nil
+	return "poll"
+}
+
+// PathCollection returns how p is collected, "subscribe" or "poll".
+func (c *Config) PathCollection(p PathConfig) string {
+	if p.Collection == "" {
+		return c.defaultPathCollection()
+	}
+	return p.Collection
+}
+
+// Streams reports whether any enabled path is collected by subscription,
+// i.e. whether the target needs a subscribe stream. Its other paths are
+// polled alongside the stream.
+func (c *Config) Streams() bool {
+	for _, p := range c.Paths {
+		if p.Enabled && c.PathCollection(p) == "subscribe" {
+			return true
+		}
+	}
+	return false
 }
 
 // ValidatePathNames checks that every enabled path references a known
@@ -136,20 +668,66 @@ func (c *Config) ValidatePathNames(validNames []string) error {
 	for _, n := range validNames {
 		valid[n] = struct{}{}
 	}
-	for _, p := range c.Paths {
-		if !p.Enabled {
-			continue
+	check := func(paths []PathConfig) error {
+		for _, p := range paths {
+			if !p.Enabled {
+				continue
+			}
+			if _, ok := valid[p.Name]; !ok {
+				return fmt.Errorf("path %q has no registered transformer (check the name in config; valid names: %v)", p.Name, validNames)
+			}
 		}
-		if _, ok := valid[p.Name]; !ok {
-			return fmt.Errorf("path %q has no registered transformer (check the name in config; valid names: %v)", p.Name, validNames)
+		return nil
+	}
+	if err := check(c.Paths); err != nil {
+		return err
+	}
+	for name, paths := range c.Profiles {
+		if err := check(paths); err != nil {
+			return fmt.Errorf("profile %q: %w", name, err)
 		}
 	}
 	return nil
 }
 
+// TargetConfigs returns one self-contained Config per collection target.
+// A single-target config returns itself. In multi-target mode each
+// returned Config has Target, Azure.DeviceType and Paths resolved for
+// that target, so it can be handed to gnmi.NewClient and collector.New
+// exactly like a single-target config.
+func (c *Config) TargetConfigs() []*Config {
+	if len(c.Targets) == 0 {
+		return []*Config{c}
+	}
+	out := make([]*Config, 0, len(c.Targets))
+	for _, t := range c.Targets {
+		paths := c.Paths
+		if t.Profile != "" {
+			paths = c.Profiles[t.Profile]
+		}
+		tc := *c
+		tc.Target = t
+		tc.Targets = nil
+		tc.Profiles = nil
+		tc.Azure.DeviceType = t.DeviceType
+		tc.Paths = append([]PathConfig(nil), paths...)
+		out = append(out, &tc)
+	}
+	return out
+}
+
 // TargetAddr returns the target address in host:port format.
 func (c *Config) TargetAddr() string {
-	return fmt.Sprintf("%s:%d", c.Target.Address, c.Target.Port)
+	return net.JoinHostPort(c.Target.Address, strconv.Itoa(c.Target.Port))
+}
+
+// TargetLabel returns a display name for the target: its configured
+// name if set, otherwise the host:port address.
+func (c *Config) TargetLabel() string {
+	if c.Target.Name != "" {
+		return c.Target.Name
+	}
+	return c.TargetAddr()
 }
 
 // LogLabel returns a display name for log messages: ResolvedLabel if set
@@ -161,29 +739,33 @@ func (p *PathConfig) LogLabel() string {
 	return p.Name
 }
 
-// ResolveCredentials reads username and password from the environment variables
-// specified in the config. Returns ("", "") if env vars are not set.
-func (c *Config) ResolveCredentials() (username, password string) {
-	if c.Target.Credentials.UsernameEnv != "" {
-		username = os.Getenv(c.Target.Credentials.UsernameEnv)
+// GNMIPath returns the path with its target and origin in the
+// "target@origin:/path" form the gNMI client parses.
+func (p *PathConfig) GNMIPath() string {
+	path := p.YANGPath
+	if p.Origin != "" {
+		path = p.Origin + ":" + path
 	}
-	if c.Target.Credentials.PasswordEnv != "" {
-		password = os.Getenv(c.Target.Credentials.PasswordEnv)
+	if p.Target != "" {
+		path = p.Target + "@" + path
 	}
-	return
+	return path
 }
 
-// ResolveAzureKeys reads workspace ID and keys from environment variables.
-func (c *Config) ResolveAzureKeys() (workspaceID, primaryKey, secondaryKey string) {
-	if c.Azure.WorkspaceIDEnv != "" {
-		workspaceID = os.Getenv(c.Azure.WorkspaceIDEnv)
+// SplitPath splits a path written as "target@origin:/path" into its
+// parts; target and origin are optional. An origin is only recognized
+// when followed by ":/", so a module prefix on the first element
+// (/openconfig-interfaces:interfaces) is left alone. The returned path
+// always starts with "/".
+func SplitPath(s string) (target, origin, path string) {
+	if i := strings.Index(s, "@"); i > 0 && !strings.ContainsAny(s[:i], "/:[") {
+		target, s = s[:i], s[i+1:]
 	}
-	if c.Azure.PrimaryKeyEnv != "" {
-		primaryKey = os.Getenv(c.Azure.PrimaryKeyEnv)
+	if i := strings.Index(s, ":/"); i > 0 && !strings.ContainsAny(s[:i], "/[") {
+		origin, s = s[:i], s[i+1:]
 	}
-	if c.Azure.SecondaryKeyEnv != "" {
-		secondaryKey = os.Getenv(c.Azure.SecondaryKeyEnv)
+	if !strings.HasPrefix(s, "/") {
+		s = "/" + s
 	}
-	return
+	return target, origin, s
 }
-
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"crypto/tls"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -97,6 +99,54 @@ paths:
 	if cfg.Collection.Mode != "poll" {
 		t.Errorf("default mode = %q, want poll", cfg.Collection.Mode)
 	}
+	if cfg.Collection.MaxConcurrency != 4 {
+		t.Errorf("default max_concurrency = %d, want 4", cfg.Collection.MaxConcurrency)
+	}
+	if cfg.Collection.CycleTimeout != cfg.Collection.Interval {
+		t.Errorf("default cycle_timeout = %v, want the interval", cfg.Collection.CycleTimeout)
+	}
+	if cfg.Paths[0].Collection != "poll" || cfg.Streams() {
+		t.Errorf("path collection = %q, want poll by default", cfg.Paths[0].Collection)
+	}
+}
+
+func TestParsePathCollection(t *testing.T) {
+	cfg, err := Parse([]byte(`
+target:
+  address: 10.0.0.1
+  port: 50051
+collection:
+  mode: subscribe
+azure:
+  device_type: sonic
+paths:
+  - name: interface-counters
+    yang_path: /interfaces/interface/state/counters
+    table: T
+    enabled: true
+  - name: temperature
+    yang_path: /sonic-platform:sonic-platform
+    table: T
+    enabled: true
+    collection: Poll
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := cfg.Paths[0].Collection; got != "subscribe" {
+		t.Errorf("default collection = %q, want the global subscribe mode", got)
+	}
+	if got := cfg.Paths[1].Collection; got != "poll" {
+		t.Errorf("collection = %q, want poll", got)
+	}
+	if !cfg.Streams() {
+		t.Error("config with a subscribed path should stream")
+	}
+
+	cfg.Collection.Mode = "subscribe_poll"
+	if got := cfg.PathCollection(PathConfig{}); got != "subscribe" {
+		t.Errorf("subscribe_poll default collection = %q, want subscribe", got)
+	}
 }
 
 func TestTLSValidation(t *testing.T) {
@@ -192,6 +242,70 @@ target:
   port: 50051
 azure:
   device_type: cisco-nx-os
+paths:
+  - name: test
+    yang_path: /test
+    table: T
+    enabled: true`},
+		{"negative max_concurrency", `
+target:
+  address: 127.0.0.1
+  port: 50051
+collection:
+  max_concurrency: -1
+azure:
+  device_type: cisco-nx-os
+paths:
+  - name: test
+    yang_path: /test
+    table: T
+    enabled: true`},
+		{"unknown collection mode", `
+target:
+  address: 127.0.0.1
+  port: 50051
+collection:
+  mode: stream
+azure:
+  device_type: cisco-nx-os
+paths:
+  - name: test
+    yang_path: /test
+    table: T
+    enabled: true`},
+		{"conflicting path target", `
+target:
+  address: 127.0.0.1
+  port: 50051
+azure:
+  device_type: sonic
+paths:
+  - name: test
+    yang_path: COUNTERS_DB@/COUNTERS/Ethernet*
+    target: APPL_DB
+    table: T
+    enabled: true`},
+		{"unknown path collection", `
+target:
+  address: 127.0.0.1
+  port: 50051
+azure:
+  device_type: cisco-nx-os
+paths:
+  - name: test
+    yang_path: /test
+    table: T
+    enabled: true
+    collection: stream`},
+		{"unknown spool drop policy", `
+target:
+  address: 127.0.0.1
+  port: 50051
+azure:
+  device_type: cisco-nx-os
+  spool:
+    dir: /var/spool/gnmi-collector
+    drop_policy: random
 paths:
   - name: test
     yang_path: /test
@@ -240,6 +354,46 @@ paths:
   - name: test
     yang_path: /test
     table: ""
+    enabled: true`},
+		{"undeclared template variable", `
+target:
+  address: 127.0.0.1
+  port: 50051
+azure:
+  device_type: sonic
+paths:
+  - name: test
+    yang_path: /components/component[name={component}]/transceiver
+    table: T
+    enabled: true`},
+		{"negative discovery interval", `
+target:
+  address: 127.0.0.1
+  port: 50051
+azure:
+  device_type: sonic
+discovery:
+  interval: -1m
+paths:
+  - name: test
+    yang_path: /test
+    table: T
+    enabled: true`},
+		{"invalid discovery filter", `
+target:
+  address: 127.0.0.1
+  port: 50051
+azure:
+  device_type: sonic
+discovery:
+  variables:
+    component:
+      path: /components/component
+      filter: "Ethernet("
+paths:
+  - name: test
+    yang_path: /test
+    table: T
     enabled: true`},
 	}
 
@@ -253,6 +407,99 @@ paths:
 	}
 }
 
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		in, target, origin, path string
+	}{
+		{"/openconfig-interfaces:interfaces/interface", "", "", "/openconfig-interfaces:interfaces/interface"},
+		{"device:/System/intf-items", "", "device", "/System/intf-items"},
+		{"COUNTERS_DB@COUNTERS/Ethernet*", "COUNTERS_DB", "", "/COUNTERS/Ethernet*"},
+		{"COUNTERS_DB@sonic-db:/COUNTERS/Ethernet*", "COUNTERS_DB", "sonic-db", "/COUNTERS/Ethernet*"},
+		{"/lldp/interfaces/interface[name=a@b]/neighbors", "", "", "/lldp/interfaces/interface[name=a@b]/neighbors"},
+	}
+	for _, tt := range tests {
+		target, origin, path := SplitPath(tt.in)
+		if target != tt.target || origin != tt.origin || path != tt.path {
+			t.Errorf("SplitPath(%q) = %q, %q, %q; want %q, %q, %q", tt.in, target, origin, path, tt.target, tt.origin, tt.path)
+		}
+	}
+}
+
+func TestParsePathOriginAndTarget(t *testing.T) {
+	cfg, err := Parse([]byte(`
+target:
+  address: 10.0.0.1
+  port: 50051
+azure:
+  device_type: sonic
+paths:
+  - name: counters-db
+    yang_path: COUNTERS_DB@COUNTERS/Ethernet*
+    table: T
+    enabled: true
+  - name: nx-transceiver
+    yang_path: /System/intf-items
+    origin: device
+    table: T
+    enabled: true
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := cfg.Paths[0]
+	if p.Target != "COUNTERS_DB" || p.YANGPath != "/COUNTERS/Ethernet*" {
+		t.Errorf("path = %+v, want the target split off", p)
+	}
+	if got := cfg.Paths[1].GNMIPath(); got != "device:/System/intf-items" {
+		t.Errorf("GNMIPath() = %q", got)
+	}
+	if got := p.GNMIPath(); got != "COUNTERS_DB@/COUNTERS/Ethernet*" {
+		t.Errorf("GNMIPath() = %q", got)
+	}
+}
+
+func TestParseDiscovery(t *testing.T) {
+	cfg, err := Parse([]byte(`
+target:
+  address: 10.0.0.1
+  port: 8080
+azure:
+  device_type: sonic
+discovery:
+  variables:
+    component:
+      path: /openconfig-platform:components/component
+      filter: ^Ethernet
+paths:
+  - name: transceiver-channel
+    yang_path: /openconfig-platform:components/component[name={component}]/transceiver/physical-channels
+    table: T
+    enabled: true
+  - name: bgp-global
+    yang_path: /network-instances/network-instance[name={network_instance}]/protocols/protocol[identifier=BGP][name=bgp]/bgp/global
+    table: T
+    enabled: true
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Discovery.MaxPaths != 256 {
+		t.Errorf("MaxPaths = %d, want default 256", cfg.Discovery.MaxPaths)
+	}
+	if cfg.Discovery.Interval != 0 || cfg.Discovery.EventTable != "CollectorEvent_CL" {
+		t.Errorf("Discovery = %+v, want no periodic runs and the default event table", cfg.Discovery)
+	}
+	if v, _ := cfg.Discovery.Variable("component"); v.Key != "name" {
+		t.Errorf("component key = %q, want default name", v.Key)
+	}
+	if _, ok := cfg.Discovery.Variable("network_instance"); !ok {
+		t.Error("network_instance should be available without being declared")
+	}
+	if got := TemplateVariables("/a[x={vrf}]/b[y={interface}]/c[z={vrf}]"); strings.Join(got, ",") != "vrf,interface" {
+		t.Errorf("TemplateVariables = %v", got)
+	}
+}
+
 func TestResolveCredentials(t *testing.T) {
 	os.Setenv("TEST_USER", "admin")
 	os.Setenv("TEST_PASS", "secret123")
@@ -267,7 +514,10 @@ func TestResolveCredentials(t *testing.T) {
 			},
 		},
 	}
-	user, pass := cfg.ResolveCredentials()
+	user, pass, err := cfg.ResolveCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if user != "admin" {
 		t.Errorf("username = %q, want admin", user)
 	}
@@ -291,7 +541,10 @@ func TestResolveAzureKeys(t *testing.T) {
 			SecondaryKeyEnv: "TEST_SK",
 		},
 	}
-	ws, pk, sk := cfg.ResolveAzureKeys()
+	ws, pk, sk, err := cfg.ResolveAzureKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
 	if ws != "ws-123" {
 		t.Errorf("workspace = %q, want ws-123", ws)
 	}
@@ -334,3 +587,567 @@ func TestValidatePathNames(t *testing.T) {
 		t.Errorf("error should mention bad name, got: %v", err)
 	}
 }
+
+func TestParseMultiTarget(t *testing.T) {
+	yaml := []byte(`
+targets:
+  - name: tor-1
+    address: 10.0.0.1
+    port: 50051
+    credentials:
+      username_env: TOR1_USER
+      password_env: TOR1_PASS
+  - address: 10.0.0.2
+    port: 8080
+    device_type: sonic
+    profile: sonic
+azure:
+  device_type: cisco-nx-os
+paths:
+  - name: interface-counters
+    yang_path: /interfaces/interface/state/counters
+    table: InterfaceCounter_CL
+    enabled: true
+profiles:
+  sonic:
+    - name: system-state
+      yang_path: /openconfig-system:system/state
+      table: SystemUptime_CL
+      enabled: true
+`)
+	cfg, err := Parse(yaml)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	targets := cfg.TargetConfigs()
+	if len(targets) != 2 {
+		t.Fatalf("target configs = %d, want 2", len(targets))
+	}
+
+	tor1 := targets[0]
+	if tor1.Target.Name != "tor-1" || tor1.TargetAddr() != "10.0.0.1:50051" {
+		t.Errorf("target[0] = %s (%s), want tor-1 (10.0.0.1:50051)", tor1.Target.Name, tor1.TargetAddr())
+	}
+	if tor1.Azure.DeviceType != "cisco-nx-os" {
+		t.Errorf("target[0] device_type = %q, want inherited cisco-nx-os", tor1.Azure.DeviceType)
+	}
+	if len(tor1.Paths) != 1 || tor1.Paths[0].Name != "interface-counters" {
+		t.Errorf("target[0] paths = %+v, want top-level paths", tor1.Paths)
+	}
+	if tor1.Target.Credentials.UsernameEnv != "TOR1_USER" {
+		t.Errorf("target[0] username_env = %q, want TOR1_USER", tor1.Target.Credentials.UsernameEnv)
+	}
+
+	sonic := targets[1]
+	if sonic.Target.Name != "10.0.0.2:8080" || sonic.TargetLabel() != sonic.Target.Name {
+		t.Errorf("target[1] name = %q, want default 10.0.0.2:8080", sonic.Target.Name)
+	}
+	if sonic.Azure.DeviceType != "sonic" {
+		t.Errorf("target[1] device_type = %q, want sonic", sonic.Azure.DeviceType)
+	}
+	if len(sonic.Paths) != 1 || sonic.Paths[0].Name != "system-state" {
+		t.Fatalf("target[1] paths = %+v, want sonic profile", sonic.Paths)
+	}
+	if sonic.Paths[0].SampleInterval != 5*time.Minute {
+		t.Errorf("profile path sample_interval = %v, want default 5m", sonic.Paths[0].SampleInterval)
+	}
+	if len(sonic.Targets) != 0 {
+		t.Error("per-target config should not carry the targets list")
+	}
+
+	// Mutating one target's paths must not leak into another's.
+	tor1.Paths[0].YANGPath = "/changed"
+	if cfg.Paths[0].YANGPath == "/changed" {
+		t.Error("TargetConfigs should copy the path list")
+	}
+}
+
+func TestTargetConfigsSingleTarget(t *testing.T) {
+	cfg := &Config{Target: TargetConfig{Address: "10.0.0.1", Port: 50051}}
+	targets := cfg.TargetConfigs()
+	if len(targets) != 1 || targets[0] != cfg {
+		t.Fatalf("single-target config should return itself, got %v", targets)
+	}
+	if cfg.TargetLabel() != "10.0.0.1:50051" {
+		t.Errorf("TargetLabel() = %q, want 10.0.0.1:50051", cfg.TargetLabel())
+	}
+}
+
+func TestParseUnnamedTargetsOnOneHost(t *testing.T) {
+	cfg, err := Parse([]byte(`
+targets:
+  - {address: 127.0.0.1, port: 50051}
+  - {address: 127.0.0.1, port: 50052}
+azure:
+  device_type: sonic
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, tc := range cfg.TargetConfigs() {
+		if tc.Target.Name != tc.TargetAddr() {
+			t.Errorf("target[%d] name = %q, want its address %s", i, tc.Target.Name, tc.TargetAddr())
+		}
+	}
+}
+
+func TestParseInvalidMultiTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{"target and targets", `
+target:
+  address: 10.0.0.9
+  port: 50051
+targets:
+  - address: 10.0.0.1
+    port: 50051
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, "mutually exclusive"},
+		{"duplicate name", `
+targets:
+  - {name: sw, address: 10.0.0.1, port: 50051}
+  - {name: sw, address: 10.0.0.2, port: 50051}
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, "duplicate target name"},
+		{"duplicate address", `
+targets:
+  - {address: 10.0.0.1, port: 50051}
+  - {address: 10.0.0.1, port: 50051}
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, `duplicate target name "10.0.0.1:50051"`},
+		{"unknown profile", `
+targets:
+  - {address: 10.0.0.1, port: 50051, profile: missing}
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, "unknown profile"},
+		{"missing device_type", `
+targets:
+  - {address: 10.0.0.1, port: 50051}
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, "device_type is required"},
+		{"no enabled paths for target", `
+targets:
+  - {address: 10.0.0.1, port: 50051}
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: false}`, "at least one path"},
+		{"shared ca_file", `
+targets:
+  - {address: 10.0.0.1, port: 50051, tls: {enabled: true, ca_file: /etc/gnmi/sw.pem}}
+  - {address: 10.0.0.2, port: 50051, tls: {enabled: true, ca_file: /etc/gnmi/sw.pem}}
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, "share tls.ca_file"},
+		{"bad port", `
+targets:
+  - {address: 10.0.0.1, port: 0}
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`, "targets[0].port"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.yaml))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePathNamesChecksProfiles(t *testing.T) {
+	cfg := &Config{
+		Paths: []PathConfig{{Name: "interface-counters", Enabled: true}},
+		Profiles: map[string][]PathConfig{
+			"sonic": {{Name: "sonic-typo", Enabled: true}},
+		},
+	}
+	err := cfg.ValidatePathNames([]string{"interface-counters"})
+	if err == nil || !strings.Contains(err.Error(), "sonic-typo") {
+		t.Errorf("expected error naming the unknown profile path, got %v", err)
+	}
+}
+
+func TestParseSinks(t *testing.T) {
+	base := `
+target:
+  address: 10.0.0.1
+  port: 50051
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}
+`
+	cfg, err := Parse([]byte(base))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(cfg.Sinks) != 1 || cfg.Sinks[0].Type != "azure" {
+		t.Errorf("default sinks = %+v, want a single azure sink", cfg.Sinks)
+	}
+
+	cfg, err = Parse([]byte(base + `
+sinks:
+  - type: azure
+    exclude: ["*Debug*"]
+  - type: directory
+    dir: /var/lib/gnmi-collector/out
+    include: [CiscoInterfaceCounter_CL]
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(cfg.Sinks) != 2 {
+		t.Fatalf("got %d sinks, want 2", len(cfg.Sinks))
+	}
+	if cfg.Sinks[1].Dir != "/var/lib/gnmi-collector/out" || cfg.Sinks[1].Include[0] != "CiscoInterfaceCounter_CL" {
+		t.Errorf("directory sink = %+v", cfg.Sinks[1])
+	}
+
+	cfg, err = Parse([]byte(base + "sinks:\n  - type: prometheus\n    expire_after: 15m\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.Sinks[0].Listen != ":9273" || cfg.Sinks[0].ExpireAfter != 15*time.Minute {
+		t.Errorf("prometheus sink = %+v, want default listen and 15m expiry", cfg.Sinks[0])
+	}
+
+	cfg, err = Parse([]byte(base + `
+sinks:
+  - type: logs_ingestion
+    logs_ingestion:
+      endpoint: https://dce.eastus-1.ingest.monitor.azure.com
+      dcr_immutable_id: dcr-0123
+      tenant_id_env: AZURE_TENANT_ID
+      client_id_env: AZURE_CLIENT_ID
+      certificate_file: /etc/gnmi-collector/sp.pem
+      streams:
+        CiscoBgp_CL: {stream: Custom-Bgp, dcr_immutable_id: dcr-4567}
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if li := cfg.Sinks[0].LogsIngestion; li == nil || li.Streams["CiscoBgp_CL"].DCRImmutableID != "dcr-4567" {
+		t.Errorf("logs_ingestion sink = %+v", cfg.Sinks[0])
+	}
+
+	for _, tt := range []struct {
+		name, sinks, wantErr string
+	}{
+		{"unknown type", "sinks:\n  - type: kafka\n", "unknown sink type"},
+		{"directory without dir", "sinks:\n  - type: directory\n", "requires dir"},
+		{"bad pattern", "sinks:\n  - type: stdout\n    include: [\"[\"]\n", "invalid table pattern"},
+		{"two prometheus sinks", "sinks:\n  - type: prometheus\n  - type: prometheus\n    listen: :9000\n", "only one prometheus sink"},
+		{"logs_ingestion without section", "sinks:\n  - type: logs_ingestion\n", "requires a logs_ingestion section"},
+		{"logs_ingestion secret and cert", `sinks:
+  - type: logs_ingestion
+    logs_ingestion:
+      endpoint: https://dce.ingest.monitor.azure.com
+      dcr_immutable_id: dcr-1
+      tenant_id_env: T
+      client_id_env: C
+      client_secret_env: S
+      certificate_file: /etc/sp.pem
+`, "exactly one of"},
+		{"logs_ingestion stream without dcr", `sinks:
+  - type: logs_ingestion
+    logs_ingestion:
+      endpoint: https://dce.ingest.monitor.azure.com
+      tenant_id_env: T
+      client_id_env: C
+      client_secret_env: S
+      streams:
+        T: {stream: Custom-T}
+`, "has no dcr_immutable_id"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(base + tt.sinks))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHealthDefaults(t *testing.T) {
+	cfg, err := Parse([]byte(`
+target:
+  address: 10.0.0.1
+  port: 50051
+collection:
+  interval: 2m
+azure:
+  device_type: cisco-nx-os
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	h := cfg.Health
+	if h.StaleAfter != 6*time.Minute || h.ReportInterval != 5*time.Minute || h.ReportTable != "CollectorHealth_CL" {
+		t.Errorf("health defaults = %+v", h)
+	}
+}
+
+func TestParseAutoDeviceType(t *testing.T) {
+	cfg, err := Parse([]byte(`
+target:
+  address: 10.0.0.1
+  port: 8080
+azure:
+  device_type: auto
+`))
+	if err != nil {
+		t.Fatalf("auto without paths should use the built-in profile: %v", err)
+	}
+	if cfg.Collection.Encoding != "" {
+		t.Errorf("Encoding = %q, want it left to the detected profile", cfg.Collection.Encoding)
+	}
+
+	_, err = Parse([]byte(`
+targets:
+  - address: 10.0.0.1
+    port: 8080
+    device_type: auto
+  - address: 10.0.0.2
+    port: 8080
+    device_type: sonic
+`))
+	if err == nil || !strings.Contains(err.Error(), "at least one path") {
+		t.Errorf("err = %v, want the non-auto target rejected for having no paths", err)
+	}
+}
+
+func TestBuiltinProfiles(t *testing.T) {
+	for deviceType, encoding := range map[string]string{"cisco-nx-os": "JSON", "sonic": "JSON_IETF"} {
+		profile, err := BuiltinProfile(deviceType)
+		if err != nil {
+			t.Errorf("%s: %v", deviceType, err)
+			continue
+		}
+		if len(profile.Paths) == 0 || profile.Azure.DeviceType != deviceType || profile.Collection.Encoding != encoding {
+			t.Errorf("%s profile: %d paths, device_type %q, encoding %q", deviceType, len(profile.Paths), profile.Azure.DeviceType, profile.Collection.Encoding)
+		}
+	}
+	if _, err := BuiltinProfile("junos"); err == nil {
+		t.Error("expected an error for a device type without a profile")
+	}
+}
+
+func TestParseKnownHosts(t *testing.T) {
+	base := `
+target:
+  address: 10.0.0.1
+  port: 50051
+  tls:
+    enabled: true
+%s
+azure:
+  device_type: sonic
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, "    known_hosts: /var/lib/gnmi-collector/known_hosts")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tls := cfg.Target.TLS; tls.FingerprintPolicy != "strict" || tls.AuditTable != "CollectorEvent_CL" {
+		t.Errorf("TLS = %+v, want the strict policy and default audit table", tls)
+	}
+	// The policy also guards a ca_file or in-memory pin.
+	for _, tls := range []string{"    ca_file: /ca.pem", ""} {
+		cfg, err := Parse([]byte(fmt.Sprintf(base, tls)))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tls, err)
+		}
+		if cfg.Target.TLS.FingerprintPolicy != "strict" {
+			t.Errorf("%q: fingerprint_policy = %q, want strict", tls, cfg.Target.TLS.FingerprintPolicy)
+		}
+	}
+	if _, err := Parse([]byte(fmt.Sprintf(base, "    ca_file: /ca.pem\n    fingerprint_policy: warn"))); err != nil {
+		t.Errorf("fingerprint_policy with ca_file: %v", err)
+	}
+
+	tests := []struct {
+		tls     string
+		wantErr string
+	}{
+		{"    known_hosts: /kh\n    ca_file: /ca.pem", "mutually exclusive"},
+		{"    known_hosts: /kh\n    fingerprint_policy: accept-if-signed-by", "requires signing_ca_file"},
+		{"    known_hosts: /kh\n    fingerprint_policy: trust", "must be strict, warn or accept-if-signed-by"},
+		{"    ca_file: /ca.pem\n    fingerprint_policy: accept-if-signed-by", "requires signing_ca_file"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(fmt.Sprintf(base, tt.tls)))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: err = %v, want %q", tt.tls, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseClientTLS(t *testing.T) {
+	base := `
+target:
+  address: 10.0.0.1
+  port: 50051
+  tls:
+%s
+azure:
+  device_type: sonic
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, `    enabled: true
+    client_cert_file: /etc/gnmi/client.pem
+    client_key_file: /etc/gnmi/client-key.pem
+    min_version: "1.3"
+    cipher_suites: [TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256]`)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Target.TLS.MutualTLS() || cfg.Target.TLS.MinTLSVersion() != tls.VersionTLS13 {
+		t.Errorf("TLS = %+v, want mTLS with TLS 1.3", cfg.Target.TLS)
+	}
+	if cfg.Target.TLS.CertTable != "GnmiCertificate_CL" || len(cfg.Target.TLS.ExpiryWarnDays) != 3 {
+		t.Errorf("cert_table %q expiry_warn_days %v, want the defaults", cfg.Target.TLS.CertTable, cfg.Target.TLS.ExpiryWarnDays)
+	}
+
+	tests := []struct {
+		tls     string
+		wantErr string
+	}{
+		{"    enabled: true\n    client_cert_file: /c.pem", "must be set together"},
+		{"    enabled: true\n    min_version: \"1.1\"", "min_version must be 1.2 or 1.3"},
+		{"    enabled: true\n    cipher_suites: [TLS_RSA_WITH_RC4_128_SHA]", "insecure cipher suite"},
+		{"    enabled: false\n    client_cert_file: /c.pem\n    client_key_file: /k.pem", "require enabled: true"},
+		{"    enabled: true\n    expiry_warn_days: [30, 0]", "expiry_warn_days must be positive"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(fmt.Sprintf(base, tt.tls)))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: err = %v, want %q", tt.tls, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseCertRotation(t *testing.T) {
+	base := `
+target:
+  address: 10.0.0.1
+  port: 50051
+  tls:
+    enabled: true
+    ca_file: /etc/gnmi/switch.pem
+    rotation:
+%s
+azure:
+  device_type: sonic
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, `      signing_ca_cert: /etc/gnmi/ca.pem
+      signing_ca_key: /etc/gnmi/ca-key.pem
+      certificate_id: gnmi_cert
+      check_interval: 24h`)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rc := cfg.Target.TLS.Rotation
+	if rc.MinKeySize != 2048 || rc.Validity != 365*24*time.Hour || rc.RenewBeforeDays != 30 || rc.CheckInterval != 24*time.Hour {
+		t.Errorf("rotation = %+v, want the defaults", rc)
+	}
+	if cfg.Target.TLS.AuditTable != "CollectorEvent_CL" {
+		t.Errorf("audit_table = %q", cfg.Target.TLS.AuditTable)
+	}
+
+	tests := []struct {
+		rotation string
+		wantErr  string
+	}{
+		{"      certificate_id: gnmi_cert", "signing_ca_cert and signing_ca_key are required"},
+		{"      signing_ca_cert: /c.pem\n      signing_ca_key: /k.pem", "certificate_id is required"},
+		{"      signing_ca_cert: /c.pem\n      signing_ca_key: /k.pem\n      certificate_id: x\n      min_key_size: 1024", "min_key_size must be at least 2048"},
+		{"      signing_ca_cert: /c.pem\n      signing_ca_key: /k.pem\n      certificate_id: x\n      validity: 1h", "validity must be at least 24h"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(fmt.Sprintf(base, tt.rotation)))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%q: err = %v, want %q", tt.rotation, err, tt.wantErr)
+		}
+	}
+
+	// In-memory TOFU would keep trusting the replaced certificate.
+	inMemory := strings.Replace(base, "    ca_file: /etc/gnmi/switch.pem\n", "", 1)
+	_, err = Parse([]byte(fmt.Sprintf(inMemory, "      signing_ca_cert: /c.pem\n      signing_ca_key: /k.pem\n      certificate_id: x")))
+	if err == nil || !strings.Contains(err.Error(), "requires ca_file or known_hosts") {
+		t.Errorf("rotation without a persistent pin: err = %v", err)
+	}
+}
+
+func TestParseSecretsProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/GNMI_USER", []byte("admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir+"/GNMI_PASS", []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	base := `
+target:
+  address: 10.0.0.1
+  port: 50051
+  credentials:
+    username_env: GNMI_USER
+    password_env: GNMI_PASS
+secrets:
+%s
+azure:
+  device_type: sonic
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`
+	cfg, err := Parse([]byte(fmt.Sprintf(base, "  provider: file\n  dir: "+dir)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	user, pass, err := cfg.ResolveCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "admin" || pass != "s3cret" {
+		t.Errorf("credentials = %q/%q, want admin/s3cret from the files", user, pass)
+	}
+
+	for _, tt := range []struct {
+		secrets string
+		wantErr string
+	}{
+		{"  provider: vault", `unknown provider "vault"`},
+		{"  provider: file", "file provider requires dir"},
+		{"  provider: encrypted_file\n  file: /etc/gnmi/secrets.enc", "requires file and host_key_file"},
+		{"  provider: http\n  url: https://vault\n  token_env: T\n  certificate_file: /sp.pem", "mutually exclusive"},
+		{"  provider: http\n  url: https://vault\n  certificate_file: /sp.pem\n  tenant_id_env: UNSET_TENANT\n  client_id_env: UNSET_CLIENT", "requires tenant_id_env and client_id_env"},
+	} {
+		_, err := Parse([]byte(fmt.Sprintf(base, tt.secrets)))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("secrets %q: error = %v, want %q", tt.secrets, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"fmt"
+
+	gnmicollector "gnmi-collector"
+)
+
+// DeviceTypeAuto is the device_type that has the collector detect the
+// device type from the switch's gNMI capabilities.
+const DeviceTypeAuto = "auto"
+
+// builtinProfiles maps each detectable device type to its embedded
+// example config.
+var builtinProfiles = map[string][]byte{
+	"cisco-nx-os": gnmicollector.CiscoNXOSProfile,
+	"sonic":       gnmicollector.SONiCProfile,
+}
+
+// BuiltinProfile returns the paths, discovery settings and encoding of
+// the example config shipped for deviceType.
+func BuiltinProfile(deviceType string) (*Config, error) {
+	data, ok := builtinProfiles[deviceType]
+	if !ok {
+		return nil, fmt.Errorf("no built-in profile for device type %q", deviceType)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("built-in %s profile: %w", deviceType, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// CertRotationConfig rotates the switch's gNMI server certificate
+// through gNOI cert.CertificateManagement, signing it with a local CA.
+// The switch generates the key and CSR unless KeyFile names a key to
+// push instead. `gnmi-collector cert rotate` rotates on demand; with
+// CheckInterval set the collector also rotates once the certificate is
+// within RenewBeforeDays of expiry.
+type CertRotationConfig struct {
+	SigningCACert   string        `yaml:"signing_ca_cert"`
+	SigningCAKey    string        `yaml:"signing_ca_key"`              // Unencrypted PEM key of the signing CA
+	CertificateID   string        `yaml:"certificate_id"`              // gNOI ID of the gNMI server's certificate
+	KeyFile         string        `yaml:"key_file,omitempty"`          // Pre-generated key to push instead of a CSR on the switch
+	CommonName      string        `yaml:"common_name,omitempty"`       // Default the target address
+	MinKeySize      int           `yaml:"min_key_size,omitempty"`      // RSA key size requested in the CSR; default 2048
+	Validity        time.Duration `yaml:"validity,omitempty"`          // Default 8760h (one year)
+	CheckInterval   time.Duration `yaml:"check_interval,omitempty"`    // Scheduled mode: check expiry this often; 0 disables
+	RenewBeforeDays int           `yaml:"renew_before_days,omitempty"` // Scheduled mode: rotate within this many days of expiry; default 30
+}
+
+// validate checks the rotation settings named by field and fills their
+// defaults.
+func (r *CertRotationConfig) validate(field string) error {
+	if r.SigningCACert == "" || r.SigningCAKey == "" {
+		return fmt.Errorf("%s.signing_ca_cert and signing_ca_key are required", field)
+	}
+	if r.CertificateID == "" {
+		return fmt.Errorf("%s.certificate_id is required", field)
+	}
+	if r.MinKeySize == 0 {
+		r.MinKeySize = 2048
+	}
+	if r.MinKeySize < 2048 {
+		return fmt.Errorf("%s.min_key_size must be at least 2048", field)
+	}
+	if r.Validity == 0 {
+		r.Validity = 365 * 24 * time.Hour
+	}
+	if r.Validity < 24*time.Hour {
+		return fmt.Errorf("%s.validity must be at least 24h", field)
+	}
+	if r.CheckInterval < 0 {
+		return fmt.Errorf("%s.check_interval must not be negative", field)
+	}
+	if r.RenewBeforeDays == 0 {
+		r.RenewBeforeDays = 30
+	}
+	if r.RenewBeforeDays < 0 {
+		return fmt.Errorf("%s.renew_before_days must be positive", field)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gnmi-collector/internal/azure"
+	"gnmi-collector/internal/secrets"
+)
+
+// SecretsConfig selects the store the credentials are read from. The
+// *_env settings (credentials.username_env, azure.primary_key_env, ...)
+// name the secrets: environment variables with the default env
+// provider, file names for file and systemd, keys of the encrypted
+// file, or secret names at the http endpoint. Secrets from the other
+// providers are re-read every RefreshInterval, so rotated credentials
+// are picked up without a restart. The http endpoint's bearer token is
+// re-read from TokenEnv on every request, or obtained for Key Vault
+// with a service principal certificate and renewed before it expires.
+type SecretsConfig struct {
+	Provider        string        `yaml:"provider,omitempty"`         // env (default), file, systemd, encrypted_file or http
+	Dir             string        `yaml:"dir,omitempty"`              // file: one file per secret, mode 0600
+	File            string        `yaml:"file,omitempty"`             // encrypted_file: written by `gnmi-collector secrets encrypt`
+	HostKeyFile     string        `yaml:"host_key_file,omitempty"`    // encrypted_file: key the file is encrypted with
+	URL             string        `yaml:"url,omitempty"`              // http: Key Vault style endpoint, e.g. https://myvault.vault.azure.net
+	TokenEnv        string        `yaml:"token_env,omitempty"`        // http: environment variable holding a bearer token
+	TenantIDEnv     string        `yaml:"tenant_id_env,omitempty"`    // http: environment variable holding the tenant ID for certificate_file
+	ClientIDEnv     string        `yaml:"client_id_env,omitempty"`    // http: environment variable holding the client ID for certificate_file
+	CertificateFile string        `yaml:"certificate_file,omitempty"` // http: PEM certificate + RSA key, instead of token_env
+	AuthorityHost   string        `yaml:"authority_host,omitempty"`   // Default https://login.microsoftonline.com
+	RefreshInterval time.Duration `yaml:"refresh_interval,omitempty"` // Default 5m
+}
+
+// newProvider builds the configured credential provider.
+func (s SecretsConfig) newProvider() (secrets.CredentialProvider, error) {
+	opts := secrets.Options{
+		Provider:        s.Provider,
+		Dir:             s.Dir,
+		File:            s.File,
+		HostKeyFile:     s.HostKeyFile,
+		URL:             s.URL,
+		RefreshInterval: s.RefreshInterval,
+	}
+	switch {
+	case s.CertificateFile != "" && s.TokenEnv != "":
+		return nil, fmt.Errorf("secrets: token_env and certificate_file are mutually exclusive")
+	case s.CertificateFile != "":
+		// The service principal cannot come from the store it unlocks,
+		// so its IDs are always read from the environment.
+		tenantID, clientID := os.Getenv(s.TenantIDEnv), os.Getenv(s.ClientIDEnv)
+		if tenantID == "" || clientID == "" {
+			return nil, fmt.Errorf("secrets: certificate_file requires tenant_id_env and client_id_env to be set")
+		}
+		cred, err := azure.NewClientCertificateCredential(s.AuthorityHost, tenantID, clientID, s.CertificateFile)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: %w", err)
+		}
+		cred.SetScope(azure.KeyVaultScope)
+		opts.Tokens = cred
+	case s.TokenEnv != "":
+		opts.Tokens = secrets.EnvToken(s.TokenEnv)
+	}
+	p, err := secrets.New(opts)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: %w", err)
+	}
+	return p, nil
+}
+
+// credentials returns the provider secrets are read from; a Config
+// that was not parsed reads the environment.
+func (c *Config) credentials() secrets.CredentialProvider {
+	if c.provider == nil {
+		return secrets.Env{}
+	}
+	return c.provider
+}
+
+// resolveSecrets looks up each named secret; an empty name resolves
+// to "".
+func (c *Config) resolveSecrets(names ...string) ([]string, error) {
+	values := make([]string, len(names))
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		v, err := c.credentials().Get(name)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// ResolveCredentials looks up the gNMI username and password. Unset
+// secrets resolve to "".
+func (c *Config) ResolveCredentials() (username, password string, err error) {
+	v, err := c.resolveSecrets(c.Target.Credentials.UsernameEnv, c.Target.Credentials.PasswordEnv)
+	if err != nil {
+		return "", "", fmt.Errorf("gNMI credentials: %w", err)
+	}
+	return v[0], v[1], nil
+}
+
+// ResolveAzureKeys looks up the workspace ID and shared keys.
+func (c *Config) ResolveAzureKeys() (workspaceID, primaryKey, secondaryKey string, err error) {
+	v, err := c.resolveSecrets(c.Azure.WorkspaceIDEnv, c.Azure.PrimaryKeyEnv, c.Azure.SecondaryKeyEnv)
+	if err != nil {
+		return "", "", "", fmt.Errorf("Azure keys: %w", err)
+	}
+	return v[0], v[1], v[2], nil
+}
+
+// ResolveIngestionCredentials looks up a logs_ingestion sink's tenant
+// ID, client ID and (when configured) client secret.
+func (c *Config) ResolveIngestionCredentials(l *LogsIngestionConfig) (tenantID, clientID, secret string, err error) {
+	v, err := c.resolveSecrets(l.TenantIDEnv, l.ClientIDEnv, l.ClientSecretEnv)
+	if err != nil {
+		return "", "", "", fmt.Errorf("logs_ingestion credentials: %w", err)
+	}
+	return v[0], v[1], v[2], nil
+}
+
+// ResolveClientKeyPassword looks up the password of the target's
+// encrypted client key; "" when none is configured.
+func (c *Config) ResolveClientKeyPassword() (string, error) {
+	v, err := c.resolveSecrets(c.Target.TLS.ClientKeyPasswordEnv)
+	if err != nil {
+		return "", fmt.Errorf("client key password: %w", err)
+	}
+	return v[0], nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+// tlsVersions maps min_version values to crypto/tls versions.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// validateClient checks the client certificate, server name, version
+// and cipher settings of the target named by field.
+func (t *TLSConfig) validateClient(field string) error {
+	if (t.ClientCertFile == "") != (t.ClientKeyFile == "") {
+		return fmt.Errorf("%s.client_cert_file and client_key_file must be set together", field)
+	}
+	if t.ClientKeyPasswordEnv != "" && t.ClientKeyFile == "" {
+		return fmt.Errorf("%s.client_key_password_env requires client_key_file", field)
+	}
+	if t.MinVersion != "" {
+		if _, ok := tlsVersions[t.MinVersion]; !ok {
+			return fmt.Errorf("%s.min_version must be 1.2 or 1.3", field)
+		}
+	}
+	if _, err := t.CipherSuiteIDs(); err != nil {
+		return fmt.Errorf("%s.cipher_suites: %w", field, err)
+	}
+	if !t.Enabled && (t.MutualTLS() || t.ServerName != "" || t.MinVersion != "" || len(t.CipherSuites) > 0) {
+		return fmt.Errorf("%s: client certificate and TLS settings require enabled: true", field)
+	}
+	return nil
+}
+
+// MutualTLS reports whether the collector authenticates to the switch
+// with a client certificate.
+func (t TLSConfig) MutualTLS() bool {
+	return t.ClientCertFile != ""
+}
+
+// MinTLSVersion returns the configured minimum TLS version, or 0 for
+// the crypto/tls default.
+func (t TLSConfig) MinTLSVersion() uint16 {
+	return tlsVersions[t.MinVersion]
+}
+
+// CipherSuiteIDs resolves the configured cipher suite names. Only the
+// suites crypto/tls considers secure are accepted; nil means the
+// default set.
+func (t TLSConfig) CipherSuiteIDs() ([]uint16, error) {
+	if len(t.CipherSuites) == 0 {
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+	ids := make([]uint16, 0, len(t.CipherSuites))
+	for _, name := range t.CipherSuites {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,109 @@
+package gnmi
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// peerCert holds the leaf certificate the server presented on the most
+// recent TLS handshake of a client's connection.
+type peerCert struct {
+	mu   sync.Mutex
+	cert *x509.Certificate
+}
+
+func (p *peerCert) set(cert *x509.Certificate) {
+	p.mu.Lock()
+	p.cert = cert
+	p.mu.Unlock()
+}
+
+func (p *peerCert) get() *x509.Certificate {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cert
+}
+
+// CertInfo summarizes a certificate for inventory and expiry tracking.
+type CertInfo struct {
+	Subject            string
+	Issuer             string
+	SANs               []string // DNS names, IP addresses, URIs and emails
+	Serial             string
+	Fingerprint        string // SHA-256, as CertFingerprint
+	KeyType            string // RSA, ECDSA, Ed25519 or DSA
+	KeyBits            int
+	SignatureAlgorithm string
+	NotBefore          time.Time
+	NotAfter           time.Time
+	DaysToExpiry       int // Whole days left; negative once expired
+	SelfSigned         bool
+	WeakKey            bool // RSA below 2048 bits, ECDSA below 256, or DSA
+	SHA1Signature      bool // Signed with SHA-1 (or MD5)
+}
+
+// InspectCert describes cert as of now.
+func InspectCert(cert *x509.Certificate, now time.Time) CertInfo {
+	info := CertInfo{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		Serial:             cert.SerialNumber.String(),
+		Fingerprint:        CertFingerprint(cert),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		NotBefore:          cert.NotBefore,
+		NotAfter:           cert.NotAfter,
+		DaysToExpiry:       int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+		SelfSigned:         isSelfSigned(cert),
+	}
+	info.SANs = append(info.SANs, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	for _, u := range cert.URIs {
+		info.SANs = append(info.SANs, u.String())
+	}
+	info.SANs = append(info.SANs, cert.EmailAddresses...)
+
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		info.KeyType, info.KeyBits = "RSA", key.N.BitLen()
+		info.WeakKey = info.KeyBits < 2048
+	case *ecdsa.PublicKey:
+		info.KeyType, info.KeyBits = "ECDSA", key.Curve.Params().BitSize
+		info.WeakKey = info.KeyBits < 256
+	case ed25519.PublicKey:
+		info.KeyType, info.KeyBits = "Ed25519", 256
+	default:
+		// DSA is deprecated for TLS altogether.
+		info.KeyType = cert.PublicKeyAlgorithm.String()
+		info.WeakKey = cert.PublicKeyAlgorithm == x509.DSA
+	}
+
+	switch cert.SignatureAlgorithm {
+	case x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1, x509.MD5WithRSA, x509.MD2WithRSA:
+		info.SHA1Signature = true
+	}
+	return info
+}
+
+// isSelfSigned reports whether cert is its own issuer and carries a
+// valid signature by its own key.
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+	err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	// crypto/x509 refuses to check SHA-1 signatures at all.
+	var insecure x509.InsecureAlgorithmError
+	return err == nil || errors.As(err, &insecure)
+}
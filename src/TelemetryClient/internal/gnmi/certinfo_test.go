@@ -0,0 +1,64 @@
+package gnmi
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestInspectCert(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "leaf1"},
+		DNSNames:     []string{"leaf1.example.net"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.1")},
+		NotBefore:    now.AddDate(0, -1, 0),
+		NotAfter:     now.Add(13*24*time.Hour + time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	info := InspectCert(cert, now)
+	if info.Subject != "CN=leaf1" || info.Serial != "42" || info.Fingerprint != CertFingerprint(cert) {
+		t.Errorf("subject %q serial %q fingerprint %q", info.Subject, info.Serial, info.Fingerprint)
+	}
+	if len(info.SANs) != 2 || info.SANs[0] != "leaf1.example.net" || info.SANs[1] != "10.0.0.1" {
+		t.Errorf("SANs = %v", info.SANs)
+	}
+	if info.KeyType != "RSA" || info.KeyBits != 1024 || !info.WeakKey {
+		t.Errorf("key = %s %d weak=%v, want a weak 1024-bit RSA key", info.KeyType, info.KeyBits, info.WeakKey)
+	}
+	if info.DaysToExpiry != 13 || !info.SelfSigned || info.SHA1Signature {
+		t.Errorf("days %d self-signed %v sha1 %v", info.DaysToExpiry, info.SelfSigned, info.SHA1Signature)
+	}
+
+	if got := InspectCert(cert, now.AddDate(0, 1, 0)).DaysToExpiry; got >= 0 {
+		t.Errorf("DaysToExpiry after expiry = %d, want negative", got)
+	}
+}
+
+func TestInspectCertIssued(t *testing.T) {
+	ca := newTestCA(t)
+	leaf, _ := x509.ParseCertificate(ca.issue(t).Certificate[0])
+
+	info := InspectCert(leaf, time.Now())
+	if info.SelfSigned || info.WeakKey || info.KeyType != "ECDSA" || info.KeyBits != 256 {
+		t.Errorf("info = %+v, want a CA-issued ECDSA P-256 certificate", info)
+	}
+	if info.Issuer != "CN=test-ca" {
+		t.Errorf("Issuer = %q", info.Issuer)
+	}
+}
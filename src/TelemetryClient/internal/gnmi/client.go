@@ -3,10 +3,13 @@ package gnmi
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"gnmi-collector/internal/config"
@@ -23,7 +26,10 @@ import (
 // a list of path-keyed updates containing decoded JSON values.
 type Notification struct {
 	Timestamp int64    `json:"timestamp"`
+	Origin    string   `json:"origin,omitempty"` // Prefix origin, e.g. "openconfig" or "device"
+	Target    string   `json:"target,omitempty"` // Prefix target, e.g. "COUNTERS_DB"
 	Updates   []Update `json:"updates"`
+	Deletes   []string `json:"deletes,omitempty"` // Paths removed on the device (subscribe mode)
 }
 
 // Update represents a single gNMI update with its path and decoded JSON value.
@@ -35,17 +41,24 @@ type Update struct {
 // Client wraps a gNMI gRPC connection with credential injection and
 // convenience methods for Get requests.
 type Client struct {
-	cfg      *config.Config
-	conn     *grpc.ClientConn
-	gnmi     gpb.GNMIClient
-	username string
-	password string
+	cfg        *config.Config
+	conn       *grpc.ClientConn
+	gnmi       gpb.GNMIClient
+	certChange *FingerprintChange // Accepted known_hosts fingerprint change, if any
+	pinnedFP   string             // Fingerprint pinned from ca_file or by in-memory TOFU
+	peer       *peerCert          // Server certificate of the latest TLS handshake
+
+	authMu       sync.Mutex
+	lastUsername string // Credentials of the last successful lookup
+	lastPassword string
+	authFailing  bool // The last lookup failed; logged once until it recovers
 }
 
 // NewClient creates a new gNMI client and establishes a gRPC connection.
+// With a client certificate configured the switch authenticates the
+// collector by mTLS and username/password metadata is only sent when
+// credentials are also set.
 func NewClient(cfg *config.Config) (*Client, error) {
-	username, password := cfg.ResolveCredentials()
-
 	opts := []grpc.DialOption{
 		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(64 * 1024 * 1024)),
 		grpc.WithKeepaliveParams(keepalive.ClientParameters{
@@ -55,27 +68,59 @@ func NewClient(cfg *config.Config) (*Client, error) {
 		}),
 	}
 
+	var certChange *FingerprintChange
+	var pinnedFP string
+	peer := &peerCert{}
 	if cfg.Target.TLS.Enabled {
-		tlsCfg := &tls.Config{}
+		tlsCfg := &tls.Config{
+			// Runs after verification; records the cert for inventory.
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				if len(cs.PeerCertificates) > 0 {
+					peer.set(cs.PeerCertificates[0])
+				}
+				return nil
+			},
+		}
+		clientCerts, err := ClientCertificates(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("TLS client certificate: %w", err)
+		}
 
 		if cfg.Target.TLS.CAFile != "" {
 			// Explicit CA file: load or TOFU-fetch+persist the pinned cert.
-			pool, err := BootstrapCert(cfg.TargetAddr(), cfg.Target.TLS.CAFile)
+			pool, err := BootstrapCert(cfg.TargetAddr(), cfg.Target.TLS.CAFile, clientCerts)
 			if err != nil {
 				return nil, fmt.Errorf("TLS cert setup: %w", err)
 			}
 			if pool != nil {
 				tlsCfg.RootCAs = pool
 			}
+			pinnedFP = CAFileFingerprint(cfg.Target.TLS.CAFile)
 			log.Printf("TLS: using pinned CA from %s", cfg.Target.TLS.CAFile)
+		} else if cfg.Target.TLS.KnownHosts != "" {
+			// Persistent TOFU: trust the fingerprint recorded in known_hosts.
+			pool, serverName, change, err := KnownHostsCertPool(cfg.TargetAddr(), cfg.Target.TLS, clientCerts)
+			if err != nil {
+				return nil, fmt.Errorf("TLS known_hosts: %w", err)
+			}
+			tlsCfg.RootCAs = pool
+			tlsCfg.ServerName = serverName
+			certChange = change
 		} else {
 			// Default: in-memory TOFU — fetch server cert, trust it for this session.
-			pool, serverName, err := TOFUCertPool(cfg.TargetAddr())
+			pool, serverName, fp, err := TOFUCertPool(cfg.TargetAddr(), clientCerts)
 			if err != nil {
 				return nil, fmt.Errorf("TLS TOFU bootstrap: %w", err)
 			}
 			tlsCfg.RootCAs = pool
 			tlsCfg.ServerName = serverName
+			pinnedFP = fp
+		}
+		if err := applyTLSSettings(tlsCfg, cfg.Target.TLS, clientCerts); err != nil {
+			return nil, err
+		}
+		if len(clientCerts) > 0 {
+			log.Printf("TLS: authenticating with client certificate %s", cfg.Target.TLS.ClientCertFile)
 		}
 
 		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsCfg)))
@@ -92,14 +137,35 @@ func NewClient(cfg *config.Config) (*Client, error) {
 	}
 
 	return &Client{
-		cfg:      cfg,
-		conn:     conn,
-		gnmi:     gpb.NewGNMIClient(conn),
-		username: username,
-		password: password,
+		cfg:        cfg,
+		conn:       conn,
+		gnmi:       gpb.NewGNMIClient(conn),
+		certChange: certChange,
+		pinnedFP:   pinnedFP,
+		peer:       peer,
 	}, nil
 }
 
+// PeerCertificate returns the certificate the server presented on the
+// latest TLS handshake, or nil before the first one (connections are
+// dialed lazily) and without TLS.
+func (c *Client) PeerCertificate() *x509.Certificate {
+	return c.peer.get()
+}
+
+// PinnedFingerprint returns the SHA-256 fingerprint of the certificate
+// the client trusts from ca_file or by in-memory TOFU, or "" when
+// known_hosts pins it.
+func (c *Client) PinnedFingerprint() string {
+	return c.pinnedFP
+}
+
+// CertChange returns the server certificate fingerprint change accepted
+// while connecting, or nil when the certificate matched known_hosts.
+func (c *Client) CertChange() *FingerprintChange {
+	return c.certChange
+}
+
 // Close closes the underlying gRPC connection.
 func (c *Client) Close() error {
 	if c.conn != nil {
@@ -108,10 +174,36 @@ func (c *Client) Close() error {
 	return nil
 }
 
-// authContext returns a context with gNMI username/password metadata attached.
+// authContext returns a context with gNMI username/password metadata
+// attached. The credentials are looked up on every call so a rotated
+// password is used without reconnecting; when the lookup fails the last
+// credentials that resolved are sent. A failing lookup is logged when
+// it starts failing and when it recovers, not on every call.
 func (c *Client) authContext(ctx context.Context) context.Context {
-	if c.username != "" || c.password != "" {
-		md := metadata.Pairs("username", c.username, "password", c.password)
+	username, password, err := c.cfg.ResolveCredentials()
+	c.authMu.Lock()
+	switch {
+	case err == nil:
+		if c.authFailing {
+			log.Printf("INFO: gNMI credentials resolve again")
+		}
+		c.authFailing = false
+		c.lastUsername, c.lastPassword = username, password
+	case c.lastUsername != "" || c.lastPassword != "":
+		username, password = c.lastUsername, c.lastPassword
+		if !c.authFailing {
+			log.Printf("WARN: %v — sending the last credentials that resolved until the lookup recovers", err)
+		}
+		c.authFailing = true
+	default:
+		if !c.authFailing {
+			log.Printf("WARN: %v — sending no credentials until the lookup recovers", err)
+		}
+		c.authFailing = true
+	}
+	c.authMu.Unlock()
+	if username != "" || password != "" {
+		md := metadata.Pairs("username", username, "password", password)
 		return metadata.NewOutgoingContext(ctx, md)
 	}
 	return ctx
@@ -136,6 +228,7 @@ func (c *Client) Get(ctx context.Context, yangPath string) ([]Notification, erro
 	encoding := resolveEncoding(c.cfg.Collection.Encoding)
 
 	req := &gpb.GetRequest{
+		Prefix:   targetPrefix(pathElems),
 		Path:     []*gpb.Path{pathElems},
 		Type:     gpb.GetRequest_STATE,
 		Encoding: encoding,
@@ -146,7 +239,16 @@ func (c *Client) Get(ctx context.Context, yangPath string) ([]Notification, erro
 		return nil, fmt.Errorf("gNMI Get %q: %w", yangPath, err)
 	}
 
-	return decodeNotifications(resp)
+	notifs, err := decodeNotifications(resp)
+	if err != nil {
+		return nil, err
+	}
+	if encoding == gpb.Encoding_PROTO {
+		// PROTO answers with one scalar per leaf; rebuild the subtree
+		// JSON would have returned for each instance of the path.
+		notifs = groupLeafUpdates(notifs, len(pathElems.GetElem()))
+	}
+	return notifs, nil
 }
 
 // GetWithTimeout performs a Get with the configured timeout.
@@ -178,6 +280,7 @@ func (c *Client) SubscribeOnce(ctx context.Context, yangPath string) ([]Notifica
 	req := &gpb.SubscribeRequest{
 		Request: &gpb.SubscribeRequest_Subscribe{
 			Subscribe: &gpb.SubscriptionList{
+				Prefix: targetPrefix(pathElems),
 				Subscription: []*gpb.Subscription{
 					{
 						Path: pathElems,
@@ -236,6 +339,8 @@ func (c *Client) SubscribeOnceWithTimeout(yangPath string) ([]Notification, erro
 // SubscriptionPath defines a single path to subscribe to.
 type SubscriptionPath struct {
 	YANGPath          string
+	Origin            string // Optional gNMI path origin
+	Target            string // Optional gNMI target; must be the same for every path of one subscription
 	Mode              string // "sample" or "on_change"
 	SampleInterval    time.Duration
 	HeartbeatInterval time.Duration
@@ -249,17 +354,94 @@ type SubscriptionPath struct {
 func (c *Client) Subscribe(ctx context.Context, paths []SubscriptionPath, handler func(*gpb.SubscribeResponse) error) error {
 	ctx = c.authContext(ctx)
 
+	req, err := c.subscribeRequest(paths, gpb.SubscriptionList_STREAM)
+	if err != nil {
+		return err
+	}
+
+	stream, err := c.gnmi.Subscribe(ctx)
+	if err != nil {
+		return fmt.Errorf("opening subscribe stream: %w", err)
+	}
+
+	if err := stream.Send(req); err != nil {
+		return fmt.Errorf("sending subscribe request: %w", err)
+	}
+
+	return receive(stream, handler)
+}
+
+// SubscribePoll opens a POLL mode subscription for paths and sends a
+// Poll request each time a value arrives on polls. The switch answers
+// every poll with the current state of all paths, terminated by a
+// sync_response; handler is called for each response. Per-path mode and
+// intervals do not apply to POLL subscriptions and are ignored. Blocks
+// until the stream errors or ctx is cancelled.
+func (c *Client) SubscribePoll(ctx context.Context, paths []SubscriptionPath, polls <-chan struct{}, handler func(*gpb.SubscribeResponse) error) error {
+	ctx, cancel := context.WithCancel(c.authContext(ctx))
+	defer cancel()
+
+	req, err := c.subscribeRequest(paths, gpb.SubscriptionList_POLL)
+	if err != nil {
+		return err
+	}
+
+	stream, err := c.gnmi.Subscribe(ctx)
+	if err != nil {
+		return fmt.Errorf("opening subscribe stream: %w", err)
+	}
+
+	if err := stream.Send(req); err != nil {
+		return fmt.Errorf("sending subscribe request: %w", err)
+	}
+
+	// A failed Send also breaks Recv, which reports the error.
+	go func() {
+		poll := &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Poll{Poll: &gpb.Poll{}}}
+		for {
+			select {
+			case <-polls:
+				if err := stream.Send(poll); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return receive(stream, handler)
+}
+
+// subscribeRequest builds the SubscribeRequest for paths in the given
+// list mode. Sample and on_change settings only apply to STREAM lists.
+func (c *Client) subscribeRequest(paths []SubscriptionPath, mode gpb.SubscriptionList_Mode) (*gpb.SubscribeRequest, error) {
 	subs := make([]*gpb.Subscription, 0, len(paths))
-	for _, p := range paths {
+	var prefix *gpb.Path
+	for i, p := range paths {
 		pathElems, err := parsePath(p.YANGPath)
 		if err != nil {
-			return fmt.Errorf("parsing YANG path %q: %w", p.YANGPath, err)
+			return nil, fmt.Errorf("parsing YANG path %q: %w", p.YANGPath, err)
+		}
+		if p.Origin != "" {
+			pathElems.Origin = p.Origin
+		}
+		// The target applies to the whole list, through its prefix.
+		if p.Target != paths[0].Target {
+			return nil, fmt.Errorf("paths %q and %q use different targets and cannot share a subscription", paths[0].YANGPath, p.YANGPath)
+		}
+		if i == 0 && p.Target != "" {
+			prefix = &gpb.Path{Target: p.Target}
 		}
 
 		sub := &gpb.Subscription{
 			Path: pathElems,
 		}
 
+		if mode != gpb.SubscriptionList_STREAM {
+			subs = append(subs, sub)
+			continue
+		}
 		if strings.EqualFold(p.Mode, "on_change") {
 			sub.Mode = gpb.SubscriptionMode_ON_CHANGE
 			// Default heartbeat for on_change: server-side liveness signal
@@ -285,25 +467,20 @@ func (c *Client) Subscribe(ctx context.Context, paths []SubscriptionPath, handle
 
 	encoding := resolveEncoding(c.cfg.Collection.Encoding)
 
-	req := &gpb.SubscribeRequest{
+	return &gpb.SubscribeRequest{
 		Request: &gpb.SubscribeRequest_Subscribe{
 			Subscribe: &gpb.SubscriptionList{
+				Prefix:       prefix,
 				Subscription: subs,
-				Mode:         gpb.SubscriptionList_STREAM,
+				Mode:         mode,
 				Encoding:     encoding,
 			},
 		},
-	}
-
-	stream, err := c.gnmi.Subscribe(ctx)
-	if err != nil {
-		return fmt.Errorf("opening subscribe stream: %w", err)
-	}
-
-	if err := stream.Send(req); err != nil {
-		return fmt.Errorf("sending subscribe request: %w", err)
-	}
+	}, nil
+}
 
+// receive passes every response on stream to handler until either fails.
+func receive(stream gpb.GNMI_SubscribeClient, handler func(*gpb.SubscribeResponse) error) error {
 	for {
 		resp, err := stream.Recv()
 		if err != nil {
@@ -324,6 +501,8 @@ func DecodeSubscribeResponse(resp *gpb.SubscribeResponse) ([]Notification, error
 	case *gpb.SubscribeResponse_Update:
 		notif := Notification{
 			Timestamp: r.Update.GetTimestamp(),
+			Origin:    r.Update.GetPrefix().GetOrigin(),
+			Target:    r.Update.GetPrefix().GetTarget(),
 		}
 		for _, u := range r.Update.GetUpdate() {
 			update := Update{
@@ -339,6 +518,9 @@ func DecodeSubscribeResponse(resp *gpb.SubscribeResponse) ([]Notification, error
 			}
 			notif.Updates = append(notif.Updates, update)
 		}
+		for _, d := range r.Update.GetDelete() {
+			notif.Deletes = append(notif.Deletes, pathToString(d))
+		}
 		return []Notification{notif}, nil
 	case *gpb.SubscribeResponse_SyncResponse:
 		// Sync indicates initial dump is complete; no data to process
@@ -368,6 +550,8 @@ func parsePath(path string) (*gpb.Path, error) {
 		return nil, fmt.Errorf("empty path")
 	}
 
+	target, origin, path := config.SplitPath(path)
+
 	// Remove leading slash
 	path = strings.TrimPrefix(path, "/")
 
@@ -402,7 +586,18 @@ func parsePath(path string) (*gpb.Path, error) {
 		elems = append(elems, elem)
 	}
 
-	return &gpb.Path{Elem: elems}, nil
+	return &gpb.Path{Origin: origin, Target: target, Elem: elems}, nil
+}
+
+// targetPrefix moves the target of a parsed path into a request prefix,
+// where gNMI servers look for it. It returns nil for a path without one.
+func targetPrefix(p *gpb.Path) *gpb.Path {
+	if p.GetTarget() == "" {
+		return nil
+	}
+	prefix := &gpb.Path{Target: p.Target}
+	p.Target = ""
+	return prefix
 }
 
 // parseKeys extracts key-value pairs from "[key1=val1][key2=val2]".
@@ -430,11 +625,14 @@ func decodeNotifications(resp *gpb.GetResponse) ([]Notification, error) {
 	for _, n := range resp.GetNotification() {
 		notif := Notification{
 			Timestamp: n.GetTimestamp(),
+			Origin:    n.GetPrefix().GetOrigin(),
+			Target:    n.GetPrefix().GetTarget(),
 		}
+		prefix := pathToString(n.GetPrefix())
 
 		for _, u := range n.GetUpdate() {
 			update := Update{
-				Path: pathToString(u.GetPath()),
+				Path: joinPaths(prefix, pathToString(u.GetPath())),
 			}
 
 			val := u.GetVal()
@@ -493,9 +691,22 @@ func decodeTypedValue(val *gpb.TypedValue) (interface{}, error) {
 	case *gpb.TypedValue_BoolVal:
 		return v.BoolVal, nil
 	case *gpb.TypedValue_FloatVal:
-		return v.FloatVal, nil
+		return float32To64(v.FloatVal), nil
+	case *gpb.TypedValue_DoubleVal:
+		return v.DoubleVal, nil
+	case *gpb.TypedValue_DecimalVal:
+		return decodeDecimal(v.DecimalVal)
+	case *gpb.TypedValue_AsciiVal:
+		return v.AsciiVal, nil
+	case *gpb.TypedValue_LeaflistVal:
+		return decodeLeaflist(v.LeaflistVal)
+	case *gpb.TypedValue_AnyVal:
+		return decodeAny(v.AnyVal), nil
 	case *gpb.TypedValue_BytesVal:
 		return v.BytesVal, nil
+	case *gpb.TypedValue_ProtoBytes:
+		// Serialized protobuf without a message type to decode it with.
+		return v.ProtoBytes, nil
 	default:
 		return nil, fmt.Errorf("unsupported TypedValue type: %T", v)
 	}
@@ -532,8 +743,9 @@ func stripModulePrefixes(v interface{}) interface{} {
 }
 
 // decodeSubscribeResponseWithPrefix decodes a single SubscribeResponse,
-// preserving the notification prefix path. Returns nil for SyncResponse
-// (which signals end of ONCE stream).
+// preserving the notification prefix path. Deleted paths are joined with
+// the prefix the same way. Returns nil for SyncResponse (which signals
+// end of ONCE stream).
 func decodeSubscribeResponseWithPrefix(resp *gpb.SubscribeResponse) *Notification {
 	r, ok := resp.GetResponse().(*gpb.SubscribeResponse_Update)
 	if !ok {
@@ -544,6 +756,8 @@ func decodeSubscribeResponseWithPrefix(resp *gpb.SubscribeResponse) *Notificatio
 
 	notif := &Notification{
 		Timestamp: r.Update.GetTimestamp(),
+		Origin:    r.Update.GetPrefix().GetOrigin(),
+		Target:    r.Update.GetPrefix().GetTarget(),
 	}
 
 	for _, u := range r.Update.GetUpdate() {
@@ -561,6 +775,9 @@ func decodeSubscribeResponseWithPrefix(resp *gpb.SubscribeResponse) *Notificatio
 		}
 		notif.Updates = append(notif.Updates, update)
 	}
+	for _, d := range r.Update.GetDelete() {
+		notif.Deletes = append(notif.Deletes, joinPaths(prefix, pathToString(d)))
+	}
 
 	return notif
 }
@@ -596,6 +813,11 @@ func joinPaths(prefix, relative string) string {
 func NormalizeSubscribeNotifications(notifs []Notification) []Notification {
 	var result []Notification
 	for _, n := range notifs {
+		// Deletes carry no values to reshape; pass them on separately.
+		if len(n.Deletes) > 0 {
+			result = append(result, Notification{Timestamp: n.Timestamp, Origin: n.Origin, Target: n.Target, Deletes: n.Deletes})
+			n.Deletes = nil
+		}
 		if len(n.Updates) == 0 {
 			continue
 		}
@@ -617,6 +839,8 @@ func NormalizeSubscribeNotifications(notifs []Notification) []Notification {
 			entityPath := commonPathPrefix(n.Updates)
 			result = append(result, Notification{
 				Timestamp: n.Timestamp,
+				Origin:    n.Origin,
+				Target:    n.Target,
 				Updates: []Update{{
 					Path:  entityPath,
 					Value: tree,
@@ -888,8 +1112,14 @@ func pathToString(p *gpb.Path) string {
 	var parts []string
 	for _, elem := range p.GetElem() {
 		s := elem.GetName()
-		for k, v := range elem.GetKey() {
-			s += fmt.Sprintf("[%s=%s]", k, v)
+		// Sorted so that multi-key entries always render the same way.
+		keys := make([]string, 0, len(elem.GetKey()))
+		for k := range elem.GetKey() {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s += fmt.Sprintf("[%s=%s]", k, elem.GetKey()[k])
 		}
 		parts = append(parts, s)
 	}
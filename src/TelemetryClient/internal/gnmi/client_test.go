@@ -1,11 +1,20 @@
 package gnmi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc/metadata"
+
+	"gnmi-collector/internal/config"
 )
 
 func TestParsePath(t *testing.T) {
@@ -775,4 +784,146 @@ func TestParseListKeySelector(t *testing.T) {
 				tc.input, gotK, gotV, tc.wantKey, tc.wantValue)
 		}
 	}
-}
\ No newline at end of file
+}
+func TestDecodeSubscribeResponseWithPrefix_Deletes(t *testing.T) {
+	prefix := &gpb.Path{Elem: []*gpb.PathElem{
+		{Name: "lldp"}, {Name: "interfaces"},
+		{Name: "interface", Key: map[string]string{"name": "Ethernet1/1"}},
+		{Name: "neighbors"},
+	}}
+	del := &gpb.Path{Elem: []*gpb.PathElem{{Name: "neighbor", Key: map[string]string{"id": "7"}}}}
+	resp := &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: &gpb.Notification{
+		Timestamp: 42,
+		Prefix:    prefix,
+		Delete:    []*gpb.Path{del},
+	}}}
+
+	notifs, err := DecodeSubscribeResponseWithPrefix(resp)
+	if err != nil || len(notifs) != 1 {
+		t.Fatalf("decode = %v, %v", notifs, err)
+	}
+	want := []string{"/lldp/interfaces/interface[name=Ethernet1/1]/neighbors/neighbor[id=7]"}
+	if !reflect.DeepEqual(notifs[0].Deletes, want) {
+		t.Errorf("deletes = %v, want %v", notifs[0].Deletes, want)
+	}
+
+	normalized := NormalizeSubscribeNotifications(notifs)
+	if len(normalized) != 1 || !reflect.DeepEqual(normalized[0].Deletes, want) || normalized[0].Timestamp != 42 {
+		t.Errorf("normalized = %+v, want the delete passed through", normalized)
+	}
+}
+
+func TestParsePathOriginAndTarget(t *testing.T) {
+	path, err := parsePath("COUNTERS_DB@/COUNTERS/Ethernet*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Target != "COUNTERS_DB" || path.Origin != "" || len(path.Elem) != 2 || path.Elem[1].Name != "Ethernet*" {
+		t.Errorf("path = %v", path)
+	}
+
+	path, err = parsePath("device:/System/intf-items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Origin != "device" || path.Elem[0].Name != "System" {
+		t.Errorf("path = %v", path)
+	}
+
+	prefix := targetPrefix(path)
+	if prefix != nil {
+		t.Errorf("prefix = %v, want nil without a target", prefix)
+	}
+}
+
+func TestSubscribeRequestTarget(t *testing.T) {
+	c := &Client{cfg: &config.Config{}}
+	req, err := c.subscribeRequest([]SubscriptionPath{
+		{YANGPath: "/COUNTERS/Ethernet*", Target: "COUNTERS_DB"},
+		{YANGPath: "/COUNTERS/PortChannel*", Target: "COUNTERS_DB"},
+	}, gpb.SubscriptionList_STREAM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := req.GetSubscribe()
+	if list.GetPrefix().GetTarget() != "COUNTERS_DB" || list.GetSubscription()[0].GetPath().GetTarget() != "" {
+		t.Errorf("target should be set on the list prefix only: %v", list)
+	}
+
+	_, err = c.subscribeRequest([]SubscriptionPath{
+		{YANGPath: "/COUNTERS/Ethernet*", Target: "COUNTERS_DB"},
+		{YANGPath: "/interfaces"},
+	}, gpb.SubscriptionList_STREAM)
+	if err == nil {
+		t.Error("mixed targets should be rejected")
+	}
+}
+
+func TestDecodeKeepsOriginAndTarget(t *testing.T) {
+	resp := &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: &gpb.Notification{
+		Prefix: &gpb.Path{Target: "COUNTERS_DB", Elem: []*gpb.PathElem{{Name: "COUNTERS"}}},
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "Ethernet0"}}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonVal{JsonVal: []byte(`{"SAI_PORT_STAT_IF_IN_ERRORS":"0"}`)}},
+		}},
+	}}}
+	notifs, err := DecodeSubscribeResponseWithPrefix(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifs = NormalizeSubscribeNotifications(notifs)
+	if len(notifs) != 1 || notifs[0].Target != "COUNTERS_DB" || notifs[0].Updates[0].Path != "/COUNTERS/Ethernet0" {
+		t.Errorf("notifications = %+v", notifs)
+	}
+}
+
+func TestAuthContextKeepsLastCredentials(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"GNMI_USER": 0600, "GNMI_PASS": 0600, "OPEN_PASS": 0644} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg, err := config.Parse([]byte(`
+target:
+  address: 10.0.0.1
+  port: 50051
+  credentials:
+    username_env: GNMI_USER
+    password_env: GNMI_PASS
+secrets:
+  provider: file
+  dir: ` + dir + `
+azure:
+  device_type: sonic
+paths:
+  - {name: test, yang_path: /test, table: T, enabled: true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{cfg: cfg}
+
+	sent := func() metadata.MD {
+		md, _ := metadata.FromOutgoingContext(c.authContext(context.Background()))
+		return md
+	}
+	if md := sent(); md.Get("password") == nil || md.Get("password")[0] != "GNMI_PASS" {
+		t.Fatalf("metadata = %v, want the resolved credentials", md)
+	}
+	// A secret the store refuses to read fails the lookup.
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	cfg.Target.Credentials.PasswordEnv = "OPEN_PASS"
+	for range 3 {
+		if md := sent(); md.Get("username") == nil || md.Get("username")[0] != "GNMI_USER" || md.Get("password")[0] != "GNMI_PASS" {
+			t.Errorf("metadata after a failed lookup = %v, want the last credentials that resolved", md)
+		}
+	}
+	cfg.Target.Credentials.PasswordEnv = "GNMI_PASS"
+	sent()
+	sent()
+	if warns, infos := strings.Count(logged.String(), "WARN:"), strings.Count(logged.String(), "INFO:"); warns != 1 || infos != 1 {
+		t.Errorf("logged %d warnings and %d recoveries, want one of each:\n%s", warns, infos, logged.String())
+	}
+}
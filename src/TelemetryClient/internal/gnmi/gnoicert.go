@@ -0,0 +1,280 @@
+package gnmi
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The generated gNOI bindings are not a dependency of this module, so
+// the messages of gnoi.certificate.CertificateManagement/Rotate are
+// encoded by hand. Field numbers follow gnoi/cert/cert.proto; fields
+// the collector does not use are skipped when decoding.
+
+const rotateMethod = "/gnoi.certificate.CertificateManagement/Rotate"
+
+var rotateStreamDesc = grpc.StreamDesc{
+	StreamName:    "Rotate",
+	ClientStreams: true,
+	ServerStreams: true,
+}
+
+// gNOI CertificateType and KeyType values.
+const (
+	certTypeX509 = 1
+	keyTypeRSA   = 1
+)
+
+// csrParams is the subset of CSRParams the collector sets.
+type csrParams struct {
+	minKeySize uint32
+	commonName string
+	ipAddress  string
+}
+
+// rotateRequest is a RotateCertificateRequest; exactly one of its
+// fields is set.
+type rotateRequest struct {
+	generateCSR     *generateCSRRequest
+	loadCertificate *loadCertificateRequest
+	finalize        bool
+}
+
+type generateCSRRequest struct {
+	params        csrParams
+	certificateID string
+}
+
+// loadCertificateRequest carries a PEM certificate and, when the key
+// is pushed rather than generated on the switch, its PEM key pair.
+type loadCertificateRequest struct {
+	certificate   []byte
+	privateKey    []byte
+	publicKey     []byte
+	certificateID string
+}
+
+// rotateResponse is a RotateCertificateResponse: either the CSR the
+// switch generated or the acknowledgement of a loaded certificate.
+type rotateResponse struct {
+	csr    []byte
+	loaded bool
+}
+
+func (r *rotateRequest) marshal() []byte {
+	var b []byte
+	switch {
+	case r.generateCSR != nil:
+		var params []byte
+		params = appendVarintField(params, 1, certTypeX509)
+		params = appendVarintField(params, 2, uint64(r.generateCSR.params.minKeySize))
+		params = appendVarintField(params, 3, keyTypeRSA)
+		params = appendBytesField(params, 4, []byte(r.generateCSR.params.commonName))
+		params = appendBytesField(params, 10, []byte(r.generateCSR.params.ipAddress))
+		var req []byte
+		req = appendMessageField(req, 1, params)
+		req = appendBytesField(req, 2, []byte(r.generateCSR.certificateID))
+		b = appendMessageField(b, 1, req)
+	case r.loadCertificate != nil:
+		lc := r.loadCertificate
+		var cert []byte
+		cert = appendVarintField(cert, 1, certTypeX509)
+		cert = appendBytesField(cert, 2, lc.certificate)
+		var req []byte
+		req = appendMessageField(req, 1, cert)
+		if lc.privateKey != nil {
+			var pair []byte
+			pair = appendBytesField(pair, 1, lc.privateKey)
+			pair = appendBytesField(pair, 2, lc.publicKey)
+			req = appendMessageField(req, 2, pair)
+		}
+		req = appendBytesField(req, 4, []byte(lc.certificateID))
+		b = appendMessageField(b, 2, req)
+	case r.finalize:
+		b = appendMessageField(b, 3, nil)
+	}
+	return b
+}
+
+func (r *rotateRequest) unmarshal(b []byte) error {
+	*r = rotateRequest{}
+	return rangeFields(b, func(num protowire.Number, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			r.generateCSR = &generateCSRRequest{}
+			return rangeFields(data, func(num protowire.Number, _ uint64, data []byte) error {
+				switch num {
+				case 1:
+					return rangeFields(data, func(num protowire.Number, v uint64, data []byte) error {
+						switch num {
+						case 2:
+							r.generateCSR.params.minKeySize = uint32(v)
+						case 4:
+							r.generateCSR.params.commonName = string(data)
+						case 10:
+							r.generateCSR.params.ipAddress = string(data)
+						}
+						return nil
+					})
+				case 2:
+					r.generateCSR.certificateID = string(data)
+				}
+				return nil
+			})
+		case 2:
+			lc := &loadCertificateRequest{}
+			r.loadCertificate = lc
+			return rangeFields(data, func(num protowire.Number, _ uint64, data []byte) error {
+				switch num {
+				case 1:
+					return rangeFields(data, func(num protowire.Number, _ uint64, data []byte) error {
+						if num == 2 {
+							lc.certificate = data
+						}
+						return nil
+					})
+				case 2:
+					return rangeFields(data, func(num protowire.Number, _ uint64, data []byte) error {
+						switch num {
+						case 1:
+							lc.privateKey = data
+						case 2:
+							lc.publicKey = data
+						}
+						return nil
+					})
+				case 4:
+					lc.certificateID = string(data)
+				}
+				return nil
+			})
+		case 3:
+			r.finalize = true
+		}
+		return nil
+	})
+}
+
+func (r *rotateResponse) marshal() []byte {
+	var b []byte
+	if r.csr != nil {
+		var csr []byte
+		csr = appendVarintField(csr, 1, certTypeX509)
+		csr = appendBytesField(csr, 2, r.csr)
+		b = appendMessageField(b, 1, appendMessageField(nil, 1, csr))
+	}
+	if r.loaded {
+		b = appendMessageField(b, 2, nil)
+	}
+	return b
+}
+
+func (r *rotateResponse) unmarshal(b []byte) error {
+	*r = rotateResponse{}
+	return rangeFields(b, func(num protowire.Number, _ uint64, data []byte) error {
+		switch num {
+		case 1:
+			return rangeFields(data, func(num protowire.Number, _ uint64, data []byte) error {
+				if num != 1 {
+					return nil
+				}
+				return rangeFields(data, func(num protowire.Number, _ uint64, data []byte) error {
+					if num == 2 {
+						r.csr = data
+					}
+					return nil
+				})
+			})
+		case 2:
+			r.loaded = true
+		}
+		return nil
+	})
+}
+
+func appendVarintField(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendBytesField appends a string or bytes field, omitting it when
+// empty as proto3 does.
+func appendBytesField(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	return appendMessageField(b, num, v)
+}
+
+// appendMessageField appends a message field, which is present even
+// when empty (oneof members such as FinalizeRequest have no fields).
+func appendMessageField(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+// rangeFields calls fn for each field of an encoded message with its
+// varint value or length-delimited payload. Other wire types are
+// skipped.
+func rangeFields(b []byte, fn func(num protowire.Number, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var v uint64
+		var data []byte
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gnoiMessage is implemented by the hand-encoded gNOI messages.
+type gnoiMessage interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// gnoiCodec carries the hand-encoded messages over gRPC. It is named
+// "proto" so the content type is the one gNOI servers expect.
+type gnoiCodec struct{}
+
+func (gnoiCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(gnoiMessage)
+	if !ok {
+		return nil, fmt.Errorf("gNOI codec: unsupported message %T", v)
+	}
+	return m.marshal(), nil
+}
+
+func (gnoiCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(gnoiMessage)
+	if !ok {
+		return fmt.Errorf("gNOI codec: unsupported message %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (gnoiCodec) Name() string { return "proto" }
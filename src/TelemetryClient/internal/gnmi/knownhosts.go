@@ -0,0 +1,244 @@
+package gnmi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"gnmi-collector/internal/config"
+)
+
+// Fingerprint change policies for tls.fingerprint_policy.
+const (
+	PolicyStrict           = "strict"
+	PolicyWarn             = "warn"
+	PolicyAcceptIfSignedBy = "accept-if-signed-by"
+)
+
+// knownHostsMu serializes read-modify-write cycles on known_hosts files,
+// which several targets may share.
+var knownHostsMu sync.Mutex
+
+// FingerprintChange describes a server certificate whose fingerprint
+// differs from the one recorded for its address in known_hosts, and
+// what the configured policy decided.
+type FingerprintChange struct {
+	Addr           string
+	OldFingerprint string
+	NewFingerprint string
+	Subject        string
+	Issuer         string
+	Policy         string
+	Accepted       bool
+	Reason         string
+}
+
+// FingerprintChangeError is returned when the policy rejects a changed
+// server certificate.
+type FingerprintChangeError struct {
+	Change *FingerprintChange
+}
+
+func (e *FingerprintChangeError) Error() string {
+	return fmt.Sprintf("server certificate of %s changed (known SHA-256: %s, presented: %s) and was rejected: %s",
+		e.Change.Addr, e.Change.OldFingerprint, e.Change.NewFingerprint, e.Change.Reason)
+}
+
+// KnownHostsCertPool is persistent trust-on-first-use. It probes the
+// server and compares its certificate with the fingerprint recorded for
+// addr in tlsCfg.KnownHosts: an unknown address is recorded and trusted,
+// a matching one is trusted, and a changed one is handled by
+// tlsCfg.FingerprintPolicy. An accepted change updates the file and is
+// returned alongside the pool; a rejected one returns a
+// *FingerprintChangeError.
+func KnownHostsCertPool(addr string, tlsCfg config.TLSConfig, clientCerts []tls.Certificate) (*x509.CertPool, string, *FingerprintChange, error) {
+	chain, err := fetchServerChain(addr, clientCerts)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	cert := chain[0]
+	fp := CertFingerprint(cert)
+	serverName := CertServerName(cert)
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	hosts, err := readKnownHosts(tlsCfg.KnownHosts)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	var change *FingerprintChange
+	switch known, ok := hosts[addr]; {
+	case !ok:
+		log.Printf("TOFU: recording server certificate of %s in %s (ServerName=%s, SHA-256=%s)", addr, tlsCfg.KnownHosts, serverName, fp)
+	case known == fp:
+		log.Printf("TLS: server certificate of %s matches %s (SHA-256=%s)", addr, tlsCfg.KnownHosts, fp)
+	default:
+		change = evaluateChange(addr, known, chain, tlsCfg)
+		if !change.Accepted {
+			return nil, "", change, &FingerprintChangeError{Change: change}
+		}
+	}
+
+	if hosts[addr] != fp {
+		hosts[addr] = fp
+		if err := writeKnownHosts(tlsCfg.KnownHosts, hosts); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool, serverName, change, nil
+}
+
+// CheckServerCert probes addr and, when its certificate no longer has
+// the pinned fingerprint, applies tlsCfg.FingerprintPolicy as
+// KnownHostsCertPool does. It is for pins kept outside known_hosts: a
+// ca_file or the in-memory TOFU certificate. It returns the presented
+// certificate and the change, nil when the fingerprint is unchanged; a
+// rejected change also returns a *FingerprintChangeError.
+func CheckServerCert(addr, pinned string, tlsCfg config.TLSConfig, clientCerts []tls.Certificate) (*x509.Certificate, *FingerprintChange, error) {
+	chain, err := fetchServerChain(addr, clientCerts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if CertFingerprint(chain[0]) == pinned {
+		return chain[0], nil, nil
+	}
+	change := evaluateChange(addr, pinned, chain, tlsCfg)
+	if !change.Accepted {
+		return nil, change, &FingerprintChangeError{Change: change}
+	}
+	return chain[0], change, nil
+}
+
+// evaluateChange applies the fingerprint policy to chain, presented by
+// addr in place of the certificate with fingerprint known, and logs the
+// decision.
+func evaluateChange(addr, known string, chain []*x509.Certificate, tlsCfg config.TLSConfig) *FingerprintChange {
+	cert := chain[0]
+	change := &FingerprintChange{
+		Addr:           addr,
+		OldFingerprint: known,
+		NewFingerprint: CertFingerprint(cert),
+		Subject:        cert.Subject.String(),
+		Issuer:         cert.Issuer.String(),
+		Policy:         tlsCfg.FingerprintPolicy,
+	}
+	change.Accepted, change.Reason = checkFingerprintChange(chain, tlsCfg)
+	if change.Accepted {
+		log.Printf("WARN: server certificate of %s changed — known SHA-256 %s, presented %s — accepted: %s", addr, known, change.NewFingerprint, change.Reason)
+	} else {
+		log.Printf("ERROR: server certificate of %s changed — known SHA-256 %s, presented %s — rejected: %s", addr, known, change.NewFingerprint, change.Reason)
+	}
+	return change
+}
+
+// checkFingerprintChange applies the fingerprint policy to a changed
+// server certificate chain (leaf first).
+func checkFingerprintChange(chain []*x509.Certificate, tlsCfg config.TLSConfig) (bool, string) {
+	switch tlsCfg.FingerprintPolicy {
+	case PolicyWarn:
+		return true, "fingerprint_policy is warn"
+	case PolicyAcceptIfSignedBy:
+		roots, err := LoadCACertPool(tlsCfg.SigningCAFile)
+		if err != nil {
+			return false, err.Error()
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range chain[1:] {
+			intermediates.AddCert(c)
+		}
+		_, err = chain[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err != nil {
+			return false, fmt.Sprintf("not signed by %s: %v", tlsCfg.SigningCAFile, err)
+		}
+		return true, "signed by " + tlsCfg.SigningCAFile
+	default:
+		return false, "fingerprint_policy is strict"
+	}
+}
+
+// recordKnownHost sets the fingerprint recorded for addr, e.g. after the
+// collector rotated the server certificate itself.
+func recordKnownHost(path, addr, fingerprint string) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	hosts, err := readKnownHosts(path)
+	if err != nil {
+		return err
+	}
+	hosts[addr] = fingerprint
+	return writeKnownHosts(path, hosts)
+}
+
+// readKnownHosts parses a known_hosts file of "address fingerprint"
+// lines; blank lines and # comments are ignored. A missing file has no
+// entries.
+func readKnownHosts(path string) (map[string]string, error) {
+	hosts := map[string]string{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return hosts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading known_hosts %s: %w", path, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("known_hosts %s line %d: want \"address fingerprint\"", path, n)
+		}
+		hosts[fields[0]] = fields[1]
+	}
+	return hosts, nil
+}
+
+// writeKnownHosts replaces the known_hosts file atomically, with the
+// entries sorted by address.
+func writeKnownHosts(path string, hosts map[string]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating known_hosts directory: %w", err)
+	}
+	addrs := make([]string, 0, len(hosts))
+	for addr := range hosts {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	var buf bytes.Buffer
+	buf.WriteString("# gnmi-collector known_hosts: <address> <SHA-256 fingerprint of the server certificate>\n")
+	for _, addr := range addrs {
+		fmt.Fprintf(&buf, "%s %s\n", addr, hosts[addr])
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("writing temp known_hosts file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("renaming known_hosts file: %w", err)
+	}
+	return nil
+}
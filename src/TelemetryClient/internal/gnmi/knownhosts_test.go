@@ -0,0 +1,227 @@
+package gnmi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/config"
+)
+
+// testCA is a throwaway certificate authority for server certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a server certificate for 127.0.0.1 signed by the CA.
+func (ca *testCA) issue(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test-switch"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("create server certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// serveTLS accepts TLS connections presenting cert until the test ends
+// and returns the listener address.
+func serveTLS(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestKnownHostsFirstUseAndMatch(t *testing.T) {
+	ca := newTestCA(t)
+	addr := serveTLS(t, ca.issue(t))
+	tlsCfg := config.TLSConfig{KnownHosts: filepath.Join(t.TempDir(), "known_hosts"), FingerprintPolicy: PolicyStrict}
+
+	pool, serverName, change, err := KnownHostsCertPool(addr, tlsCfg, nil)
+	if err != nil || pool == nil || change != nil {
+		t.Fatalf("first use: pool=%v change=%v err=%v", pool != nil, change, err)
+	}
+	if serverName != "127.0.0.1" {
+		t.Errorf("serverName = %q", serverName)
+	}
+	hosts, err := readKnownHosts(tlsCfg.KnownHosts)
+	if err != nil || len(hosts[addr]) != 95 {
+		t.Fatalf("known_hosts after first use = %v, %v", hosts, err)
+	}
+
+	if _, _, change, err := KnownHostsCertPool(addr, tlsCfg, nil); err != nil || change != nil {
+		t.Errorf("same certificate: change=%v err=%v", change, err)
+	}
+}
+
+func TestKnownHostsFingerprintChange(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := SaveCertPEM(ca.cert, caFile); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy   string
+		issuer   *testCA
+		accepted bool
+	}{
+		{PolicyStrict, ca, false},
+		{PolicyWarn, other, true},
+		{PolicyAcceptIfSignedBy, ca, true},
+		{PolicyAcceptIfSignedBy, other, false},
+	}
+	for _, tt := range tests {
+		addr := serveTLS(t, tt.issuer.issue(t))
+		tlsCfg := config.TLSConfig{
+			KnownHosts:        filepath.Join(t.TempDir(), "known_hosts"),
+			FingerprintPolicy: tt.policy,
+			SigningCAFile:     caFile,
+		}
+		const oldFP = "00:11:22"
+		if err := writeKnownHosts(tlsCfg.KnownHosts, map[string]string{addr: oldFP}); err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, change, err := KnownHostsCertPool(addr, tlsCfg, nil)
+		if change == nil || change.OldFingerprint != oldFP || change.Accepted != tt.accepted {
+			t.Errorf("%s: change = %+v, want accepted=%v", tt.policy, change, tt.accepted)
+			continue
+		}
+		var rejected *FingerprintChangeError
+		if got := errors.As(err, &rejected); got == tt.accepted {
+			t.Errorf("%s: err = %v, want a FingerprintChangeError only on rejection", tt.policy, err)
+		}
+
+		hosts, _ := readKnownHosts(tlsCfg.KnownHosts)
+		if updated := hosts[addr] == change.NewFingerprint; updated != tt.accepted {
+			t.Errorf("%s: known_hosts entry = %s, want it updated only when accepted", tt.policy, hosts[addr])
+		}
+	}
+}
+
+func TestRefetchAndSavePolicy(t *testing.T) {
+	ca := newTestCA(t)
+	pinned := newTestCA(t).cert
+
+	for _, tt := range []struct {
+		policy   string
+		accepted bool
+	}{{PolicyStrict, false}, {PolicyWarn, true}} {
+		addr := serveTLS(t, ca.issue(t))
+		tlsCfg := config.TLSConfig{CAFile: filepath.Join(t.TempDir(), "ca.pem"), FingerprintPolicy: tt.policy}
+		if err := SaveCertPEM(pinned, tlsCfg.CAFile); err != nil {
+			t.Fatal(err)
+		}
+
+		pool, change, err := RefetchAndSave(addr, tlsCfg, nil)
+		if change == nil || change.OldFingerprint != CertFingerprint(pinned) || change.Accepted != tt.accepted {
+			t.Errorf("%s: change = %+v, want accepted=%v", tt.policy, change, tt.accepted)
+			continue
+		}
+		if (pool != nil) != tt.accepted || (err == nil) != tt.accepted {
+			t.Errorf("%s: pool=%v err=%v, want a pool only when accepted", tt.policy, pool != nil, err)
+		}
+		saved, _ := LoadCACertPool(tlsCfg.CAFile)
+		if updated := !saved.Equal(certPool(pinned)); updated != tt.accepted {
+			t.Errorf("%s: ca_file updated = %v, want %v", tt.policy, updated, tt.accepted)
+		}
+	}
+}
+
+func TestCheckServerCert(t *testing.T) {
+	addr := serveTLS(t, newTestCA(t).issue(t))
+	tlsCfg := config.TLSConfig{FingerprintPolicy: PolicyStrict}
+
+	_, change, err := CheckServerCert(addr, "00:11:22", tlsCfg, nil)
+	var rejected *FingerprintChangeError
+	if change == nil || change.Accepted || !errors.As(err, &rejected) {
+		t.Fatalf("changed certificate: change=%+v err=%v, want a strict rejection", change, err)
+	}
+
+	cert, change, err := CheckServerCert(addr, change.NewFingerprint, tlsCfg, nil)
+	if cert == nil || change != nil || err != nil {
+		t.Errorf("pinned certificate: cert=%v change=%+v err=%v", cert != nil, change, err)
+	}
+}
+
+// certPool returns a pool holding only cert.
+func certPool(cert *x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool
+}
+
+func TestReadKnownHostsMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	os.WriteFile(path, []byte("# comment\n\n10.0.0.1:50051 aa:bb\n10.0.0.2:50051\n"), 0644)
+	_, err := readKnownHosts(path)
+	if err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("err = %v, want a line 4 parse error", err)
+	}
+
+	hosts, err := readKnownHosts(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(hosts) != 0 {
+		t.Errorf("missing file: %v, %v", hosts, err)
+	}
+}
@@ -0,0 +1,190 @@
+package gnmi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+
+	"gnmi-collector/internal/config"
+)
+
+// ClientCertificates loads the client certificate configured for the
+// target's mTLS, decrypting an encrypted PKCS#8 key with the configured
+// password. It returns nil when no client certificate is configured.
+func ClientCertificates(cfg *config.Config) ([]tls.Certificate, error) {
+	t := cfg.Target.TLS
+	if !t.MutualTLS() {
+		return nil, nil
+	}
+	certPEM, err := os.ReadFile(t.ClientCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(t.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client key: %w", err)
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("client key %s contains no PEM data", t.ClientKeyFile)
+	}
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		password, err := cfg.ResolveClientKeyPassword()
+		if err != nil {
+			return nil, err
+		}
+		if password == "" {
+			return nil, fmt.Errorf("client key %s is encrypted but no password is set (client_key_password_env)", t.ClientKeyFile)
+		}
+		der, err := decryptPKCS8(block.Bytes, password)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting client key %s: %w", t.ClientKeyFile, err)
+		}
+		keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	case block.Headers["Proc-Type"] != "":
+		return nil, fmt.Errorf("client key %s uses legacy PEM encryption — convert it with openssl pkcs8 -topk8", t.ClientKeyFile)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %w", err)
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// applyTLSSettings sets the client certificates and the server name,
+// version and cipher overrides of t on tlsCfg.
+func applyTLSSettings(tlsCfg *tls.Config, t config.TLSConfig, clientCerts []tls.Certificate) error {
+	tlsCfg.Certificates = clientCerts
+	if t.ServerName != "" {
+		tlsCfg.ServerName = t.ServerName
+	}
+	tlsCfg.MinVersion = t.MinTLSVersion()
+	suites, err := t.CipherSuiteIDs()
+	if err != nil {
+		return err
+	}
+	tlsCfg.CipherSuites = suites
+	return nil
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+	pbkdf2PRFs = map[string]func() hash.Hash{
+		"1.2.840.113549.2.7":  sha1.New,
+		"1.2.840.113549.2.8":  sha256.New224,
+		"1.2.840.113549.2.9":  sha256.New,
+		"1.2.840.113549.2.10": sha512.New384,
+		"1.2.840.113549.2.11": sha512.New,
+	}
+	// AES-CBC key sizes by encryption scheme OID.
+	pbes2Ciphers = map[string]int{
+		"2.16.840.1.101.3.4.1.2":  16,
+		"2.16.840.1.101.3.4.1.22": 24,
+		"2.16.840.1.101.3.4.1.42": 32,
+	}
+)
+
+// encryptedPrivateKeyInfo and the PBES2 parameter types follow RFC 8018.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts a DER EncryptedPrivateKeyInfo protected with
+// PBES2 (PBKDF2 and AES-CBC, as written by openssl pkcs8 -topk8) and
+// returns the DER PKCS#8 private key.
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("parsing encrypted key: %w", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s (want PBES2)", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("parsing PBES2 parameters: %w", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %s (want PBKDF2)", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("parsing PBKDF2 parameters: %w", err)
+	}
+	prf := sha1.New // RFC 8018 default
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = pbkdf2PRFs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", kdf.PRF.Algorithm)
+		}
+	}
+	keyLen, ok := pbes2Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported key cipher %s (want AES-CBC)", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC IV")
+	}
+
+	key, err := pbkdf2.Key(prf, password, kdf.Salt, kdf.IterationCount, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted key length is not a multiple of the block size")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	errPassword := errors.New("incorrect password or corrupt key")
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errPassword
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, errPassword
+		}
+	}
+	plain = plain[:len(plain)-pad]
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		return nil, errPassword
+	}
+	return plain, nil
+}
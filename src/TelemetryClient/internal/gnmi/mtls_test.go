@@ -0,0 +1,199 @@
+package gnmi
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"gnmi-collector/internal/config"
+)
+
+// The encrypted key was written by
+// openssl pkcs8 -topk8 -v2 aes-256-cbc -v2prf hmacWithSHA256 -passout pass:collector
+const (
+	testClientKey          = "../../testdata/client-key.pem"
+	testClientKeyEncrypted = "../../testdata/client-key-encrypted.pem"
+	testClientKeyPassword  = "collector"
+)
+
+func readPEMBlock(t *testing.T, path string) *pem.Block {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s: no PEM data", path)
+	}
+	return block
+}
+
+func TestDecryptPKCS8(t *testing.T) {
+	plain := readPEMBlock(t, testClientKey)
+	encrypted := readPEMBlock(t, testClientKeyEncrypted)
+
+	der, err := decryptPKCS8(encrypted.Bytes, testClientKeyPassword)
+	if err != nil {
+		t.Fatalf("decryptPKCS8: %v", err)
+	}
+	if string(der) != string(plain.Bytes) {
+		t.Error("decrypted key differs from the plain PKCS#8 key")
+	}
+	if _, err := decryptPKCS8(encrypted.Bytes, "wrong"); err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+}
+
+// issueClient writes a client certificate for the test client key,
+// signed by the CA, and returns its path.
+func (ca *testCA) issueClient(t *testing.T) string {
+	t.Helper()
+	key, err := x509.ParsePKCS8PrivateKey(readPEMBlock(t, testClientKey).Bytes)
+	if err != nil {
+		t.Fatalf("parse client key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "gnmi-collector"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.(crypto.Signer).Public(), ca.key)
+	if err != nil {
+		t.Fatalf("create client certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "client.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// mtlsServer is a gNMI server that requires a client certificate signed
+// by its CA and records how each Capabilities call was authenticated.
+type mtlsServer struct {
+	gpb.UnimplementedGNMIServer
+	mu       sync.Mutex
+	clientCN string
+	username []string
+}
+
+func (s *mtlsServer) Capabilities(ctx context.Context, _ *gpb.CapabilityRequest) (*gpb.CapabilityResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			s.clientCN = info.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.username = md.Get("username")
+	return &gpb.CapabilityResponse{GNMIVersion: "0.8.0"}, nil
+}
+
+// startMTLSServer serves srv with a certificate from ca, requiring
+// client certificates from the same CA, and returns its port.
+func startMTLSServer(t *testing.T, ca *testCA, srv *mtlsServer) int {
+	t.Helper()
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	creds := credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.Creds(creds))
+	gpb.RegisterGNMIServer(s, srv)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewClientMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	srv := &mtlsServer{}
+	port := startMTLSServer(t, ca, srv)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := SaveCertPEM(ca.cert, caFile); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_GNMI_KEY_PASSWORD", testClientKeyPassword)
+
+	newCfg := func(tlsCfg config.TLSConfig) *config.Config {
+		tlsCfg.Enabled = true
+		tlsCfg.CAFile = caFile
+		return &config.Config{
+			Target:     config.TargetConfig{Address: "127.0.0.1", Port: port, TLS: tlsCfg},
+			Collection: config.CollectionConfig{Timeout: 5 * time.Second},
+		}
+	}
+	capabilities := func(cfg *config.Config) error {
+		client, err := NewClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = client.Capabilities(ctx)
+		return err
+	}
+
+	err := capabilities(newCfg(config.TLSConfig{
+		ClientCertFile:       ca.issueClient(t),
+		ClientKeyFile:        testClientKeyEncrypted,
+		ClientKeyPasswordEnv: "TEST_GNMI_KEY_PASSWORD",
+		MinVersion:           "1.3",
+	}))
+	if err != nil {
+		t.Fatalf("Capabilities with client certificate: %v", err)
+	}
+	srv.mu.Lock()
+	if srv.clientCN != "gnmi-collector" || len(srv.username) != 0 {
+		t.Errorf("server saw client CN %q and username metadata %v; want the certificate and no metadata", srv.clientCN, srv.username)
+	}
+	srv.mu.Unlock()
+
+	if err := capabilities(newCfg(config.TLSConfig{})); err == nil {
+		t.Error("expected the server to reject a client without a certificate")
+	}
+}
+
+func TestApplyTLSSettings(t *testing.T) {
+	tlsCfg := &tls.Config{ServerName: "from-cert"}
+	err := applyTLSSettings(tlsCfg, config.TLSConfig{
+		ServerName:   "switch.example.net",
+		MinVersion:   "1.2",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("applyTLSSettings: %v", err)
+	}
+	if tlsCfg.ServerName != "switch.example.net" || tlsCfg.MinVersion != tls.VersionTLS12 ||
+		len(tlsCfg.CipherSuites) != 1 || tlsCfg.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("tls.Config = server name %q, min version %x, suites %v", tlsCfg.ServerName, tlsCfg.MinVersion, tlsCfg.CipherSuites)
+	}
+}
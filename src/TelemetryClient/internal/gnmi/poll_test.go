@@ -0,0 +1,86 @@
+package gnmi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+
+	"gnmi-collector/internal/config"
+)
+
+// fakeGNMI serves Subscribe from an in-memory stream.
+type fakeGNMI struct {
+	gpb.GNMIClient
+	stream *fakeStream
+}
+
+func (f *fakeGNMI) Subscribe(context.Context, ...grpc.CallOption) (grpc.BidiStreamingClient[gpb.SubscribeRequest, gpb.SubscribeResponse], error) {
+	return f.stream, nil
+}
+
+// fakeStream records sent requests and answers every Poll with one
+// update and a sync_response.
+type fakeStream struct {
+	grpc.ClientStream
+	sent chan *gpb.SubscribeRequest
+	recv chan *gpb.SubscribeResponse
+}
+
+func (s *fakeStream) Send(req *gpb.SubscribeRequest) error {
+	s.sent <- req
+	if req.GetPoll() != nil {
+		s.recv <- &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: &gpb.Notification{Timestamp: 1}}}
+		s.recv <- &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}}
+	}
+	return nil
+}
+
+func (s *fakeStream) Recv() (*gpb.SubscribeResponse, error) {
+	resp, ok := <-s.recv
+	if !ok {
+		return nil, io.EOF
+	}
+	return resp, nil
+}
+
+func TestSubscribePoll(t *testing.T) {
+	stream := &fakeStream{sent: make(chan *gpb.SubscribeRequest, 4), recv: make(chan *gpb.SubscribeResponse, 4)}
+	c := &Client{cfg: &config.Config{}, gnmi: &fakeGNMI{stream: stream}}
+
+	polls := make(chan struct{}, 1)
+	polls <- struct{}{}
+	errDone := errors.New("done")
+	var updates int
+	err := c.SubscribePoll(context.Background(), []SubscriptionPath{{YANGPath: "/interfaces", Mode: "on_change"}}, polls,
+		func(resp *gpb.SubscribeResponse) error {
+			if resp.GetSyncResponse() {
+				return errDone
+			}
+			updates++
+			return nil
+		})
+	if !errors.Is(err, errDone) || updates != 1 {
+		t.Fatalf("SubscribePoll = %v after %d updates, want one poll answered", err, updates)
+	}
+
+	list := (<-stream.sent).GetSubscribe()
+	if list.GetMode() != gpb.SubscriptionList_POLL {
+		t.Errorf("list mode = %v, want POLL", list.GetMode())
+	}
+	if sub := list.GetSubscription()[0]; sub.GetMode() != gpb.SubscriptionMode_TARGET_DEFINED || sub.GetHeartbeatInterval() != 0 {
+		t.Errorf("subscription = %v, want stream settings left out", sub)
+	}
+	select {
+	case req := <-stream.sent:
+		if req.GetPoll() == nil {
+			t.Errorf("second request = %v, want a Poll", req)
+		}
+	case <-time.After(time.Second):
+		t.Error("no Poll request sent")
+	}
+}
@@ -0,0 +1,135 @@
+package gnmi
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// decodeDecimal converts a gNMI Decimal64 to float64. The digits are
+// first rendered as an exact decimal string ("173" with precision 2 is
+// "1.73") so the float is the closest one to the device's value.
+func decodeDecimal(d *gpb.Decimal64) (interface{}, error) {
+	s := decimalString(d)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("decimal64 %s: %w", s, err)
+	}
+	return f, nil
+}
+
+// decimalString renders a Decimal64 exactly, e.g. digits=-5 precision=3
+// as "-0.005".
+func decimalString(d *gpb.Decimal64) string {
+	digits := strconv.FormatInt(d.GetDigits(), 10)
+	precision := int(d.GetPrecision())
+	if precision == 0 {
+		return digits
+	}
+	sign := ""
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if len(digits) <= precision {
+		digits = strings.Repeat("0", precision-len(digits)+1) + digits
+	}
+	point := len(digits) - precision
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// float32To64 widens a float32 through its shortest decimal form, so
+// 1.73 arrives as 1.73 rather than 1.7300000190734863.
+func float32To64(f float32) float64 {
+	v, err := strconv.ParseFloat(strconv.FormatFloat(float64(f), 'g', -1, 32), 64)
+	if err != nil {
+		return float64(f)
+	}
+	return v
+}
+
+// decodeLeaflist converts a leaf-list (allowed VLANs, supported speeds)
+// into []interface{}, the same shape a JSON array decodes to.
+func decodeLeaflist(arr *gpb.ScalarArray) (interface{}, error) {
+	out := make([]interface{}, 0, len(arr.GetElement()))
+	for i, elem := range arr.GetElement() {
+		v, err := decodeTypedValue(elem)
+		if err != nil {
+			return nil, fmt.Errorf("leaf-list element %d: %w", i, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// decodeAny unpacks an Any whose message type is linked into the
+// collector into its protobuf JSON form as a map. Unknown types are
+// kept as their type URL and serialized bytes.
+func decodeAny(a *anypb.Any) interface{} {
+	raw := map[string]interface{}{"@type": a.GetTypeUrl(), "value": a.GetValue()}
+	msg, err := a.UnmarshalNew()
+	if err != nil {
+		return raw
+	}
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return raw
+	}
+	var result interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return raw
+	}
+	return result
+}
+
+// groupLeafUpdates rebuilds Get-style notifications from leaf-level
+// updates. Every scalar update deeper than the requested path (depth
+// elements) is filed under the instance of that path it belongs to,
+// e.g. with /interfaces/interface/state/counters requested,
+//
+//	/interfaces/interface[name=Ethernet0]/state/counters/in-octets = 100
+//
+// becomes in-octets=100 in the map of the update at
+// /interfaces/interface[name=Ethernet0]/state/counters. When the
+// instance is a list entry its keys are included in the map, as JSON
+// encoding does. Other updates are left as they are.
+func groupLeafUpdates(notifs []Notification, depth int) []Notification {
+	result := make([]Notification, 0, len(notifs))
+	for _, n := range notifs {
+		var (
+			updates []Update
+			trees   = map[string]map[string]interface{}{}
+		)
+		for _, u := range n.Updates {
+			parts := splitPathSegments(strings.Trim(u.Path, "/"))
+			_, isMap := u.Value.(map[string]interface{})
+			if isMap || depth == 0 || len(parts) <= depth {
+				updates = append(updates, u)
+				continue
+			}
+			entity := "/" + strings.Join(parts[:depth], "/")
+			tree, ok := trees[entity]
+			if !ok {
+				tree = map[string]interface{}{}
+				last := parts[depth-1]
+				if idx := strings.Index(last, "["); idx != -1 {
+					for _, kv := range parseKeys(last[idx:]) {
+						if k, v, ok := strings.Cut(kv, "="); ok {
+							tree[k] = v
+						}
+					}
+				}
+				trees[entity] = tree
+				updates = append(updates, Update{Path: entity, Value: tree})
+			}
+			setNestedValue(tree, parts[depth:], u.Value)
+		}
+		n.Updates = updates
+		result = append(result, n)
+	}
+	return result
+}
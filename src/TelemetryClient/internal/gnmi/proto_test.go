@@ -0,0 +1,167 @@
+package gnmi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"gnmi-collector/internal/config"
+)
+
+func TestDecodeTypedValueScalars(t *testing.T) {
+	dec, _ := anypb.New(&gpb.Decimal64{Digits: 173, Precision: 2})
+	tests := []struct {
+		name string
+		val  *gpb.TypedValue
+		want interface{}
+	}{
+		{"decimal", &gpb.TypedValue{Value: &gpb.TypedValue_DecimalVal{DecimalVal: &gpb.Decimal64{Digits: 173, Precision: 2}}}, 1.73},
+		{"negative decimal", &gpb.TypedValue{Value: &gpb.TypedValue_DecimalVal{DecimalVal: &gpb.Decimal64{Digits: -5, Precision: 3}}}, -0.005},
+		{"float", &gpb.TypedValue{Value: &gpb.TypedValue_FloatVal{FloatVal: 1.73}}, 1.73},
+		{"double", &gpb.TypedValue{Value: &gpb.TypedValue_DoubleVal{DoubleVal: 2.5}}, 2.5},
+		{"ascii", &gpb.TypedValue{Value: &gpb.TypedValue_AsciiVal{AsciiVal: "show version"}}, "show version"},
+		{"proto bytes", &gpb.TypedValue{Value: &gpb.TypedValue_ProtoBytes{ProtoBytes: []byte{8, 1}}}, []byte{8, 1}},
+		{"leaf-list", &gpb.TypedValue{Value: &gpb.TypedValue_LeaflistVal{LeaflistVal: &gpb.ScalarArray{Element: []*gpb.TypedValue{
+			{Value: &gpb.TypedValue_UintVal{UintVal: 10}},
+			{Value: &gpb.TypedValue_UintVal{UintVal: 20}},
+		}}}}, []interface{}{uint64(10), uint64(20)}},
+		{"known any", &gpb.TypedValue{Value: &gpb.TypedValue_AnyVal{AnyVal: dec}},
+			map[string]interface{}{"digits": "173", "precision": 2.0}},
+		{"unknown any", &gpb.TypedValue{Value: &gpb.TypedValue_AnyVal{AnyVal: &anypb.Any{TypeUrl: "type.googleapis.com/vendor.Stats", Value: []byte{1}}}},
+			map[string]interface{}{"@type": "type.googleapis.com/vendor.Stats", "value": []byte{1}}},
+	}
+	for _, tt := range tests {
+		got, err := decodeTypedValue(tt.val)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	tests := []struct {
+		digits    int64
+		precision uint32
+		want      string
+	}{
+		{173, 2, "1.73"},
+		{5, 3, "0.005"},
+		{-5, 3, "-0.005"},
+		{-1200, 2, "-12.00"},
+		{42, 0, "42"},
+	}
+	for _, tt := range tests {
+		if got := decimalString(&gpb.Decimal64{Digits: tt.digits, Precision: tt.precision}); got != tt.want {
+			t.Errorf("decimalString(%d, %d) = %q, want %q", tt.digits, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestGroupLeafUpdates(t *testing.T) {
+	notifs := []Notification{{
+		Timestamp: 1,
+		Updates: []Update{
+			{Path: "/interfaces/interface[name=Ethernet0]/state/counters/in-octets", Value: uint64(100)},
+			{Path: "/interfaces/interface[name=Ethernet0]/state/counters/out-octets", Value: uint64(200)},
+			{Path: "/interfaces/interface[name=Ethernet4]/state/counters/in-octets", Value: uint64(300)},
+		},
+	}}
+	got := groupLeafUpdates(notifs, 4)
+	want := []Update{
+		{Path: "/interfaces/interface[name=Ethernet0]/state/counters", Value: map[string]interface{}{"in-octets": uint64(100), "out-octets": uint64(200)}},
+		{Path: "/interfaces/interface[name=Ethernet4]/state/counters", Value: map[string]interface{}{"in-octets": uint64(300)}},
+	}
+	if len(got) != 1 || !reflect.DeepEqual(got[0].Updates, want) {
+		t.Errorf("groupLeafUpdates = %#v, want %#v", got, want)
+	}
+}
+
+func TestGroupLeafUpdatesListEntry(t *testing.T) {
+	notifs := []Notification{{Updates: []Update{
+		{Path: "/components/component[name=PSU 1]/state/type", Value: "POWER_SUPPLY"},
+		{Path: "/components/component[name=PSU 1]/power-supply/state/capacity", Value: 1100.0},
+		{Path: "/components/component[name=PSU 1]/state/supported-speeds", Value: []interface{}{"SPEED_10GB"}},
+	}}}
+	got := groupLeafUpdates(notifs, 2)
+	want := map[string]interface{}{
+		"name":         "PSU 1",
+		"state":        map[string]interface{}{"type": "POWER_SUPPLY", "supported-speeds": []interface{}{"SPEED_10GB"}},
+		"power-supply": map[string]interface{}{"state": map[string]interface{}{"capacity": 1100.0}},
+	}
+	if len(got[0].Updates) != 1 || got[0].Updates[0].Path != "/components/component[name=PSU 1]" ||
+		!reflect.DeepEqual(got[0].Updates[0].Value, want) {
+		t.Errorf("groupLeafUpdates = %#v, want one update with %#v", got[0].Updates, want)
+	}
+}
+
+func TestGroupLeafUpdatesKeepsTrees(t *testing.T) {
+	tree := Update{Path: "/system/state", Value: map[string]interface{}{"hostname": "tor1"}}
+	leaf := Update{Path: "/system/state", Value: "tor1"}
+	got := groupLeafUpdates([]Notification{{Updates: []Update{tree, leaf}}}, 2)
+	if !reflect.DeepEqual(got[0].Updates, []Update{tree, leaf}) {
+		t.Errorf("groupLeafUpdates changed updates at the requested depth: %#v", got[0].Updates)
+	}
+}
+
+// fakeGetter answers Get with a canned response.
+type fakeGetter struct {
+	gpb.GNMIClient
+	resp *gpb.GetResponse
+}
+
+func (f *fakeGetter) Get(context.Context, *gpb.GetRequest, ...grpc.CallOption) (*gpb.GetResponse, error) {
+	return f.resp, nil
+}
+
+func TestGetProtoMatchesJSONShape(t *testing.T) {
+	leaf := func(name string, v uint64) *gpb.Update {
+		return &gpb.Update{
+			Path: &gpb.Path{Elem: []*gpb.PathElem{{Name: "counters"}, {Name: name}}},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: v}},
+		}
+	}
+	prefix := &gpb.Path{Elem: []*gpb.PathElem{
+		{Name: "interfaces"}, {Name: "interface", Key: map[string]string{"name": "Ethernet0"}}, {Name: "state"},
+	}}
+	protoResp := &gpb.GetResponse{Notification: []*gpb.Notification{{
+		Timestamp: 1, Prefix: prefix, Update: []*gpb.Update{leaf("in-octets", 100), leaf("out-octets", 200)},
+	}}}
+	jsonResp := &gpb.GetResponse{Notification: []*gpb.Notification{{
+		Timestamp: 1,
+		Update: []*gpb.Update{{
+			Path: &gpb.Path{Elem: append(prefix.GetElem(), &gpb.PathElem{Name: "counters"})},
+			Val:  &gpb.TypedValue{Value: &gpb.TypedValue_JsonVal{JsonVal: []byte(`{"in-octets":100,"out-octets":200}`)}},
+		}},
+	}}}
+
+	get := func(encoding string, resp *gpb.GetResponse) []Notification {
+		cfg := &config.Config{Collection: config.CollectionConfig{Encoding: encoding}}
+		c := &Client{cfg: cfg, gnmi: &fakeGetter{resp: resp}}
+		notifs, err := c.Get(context.Background(), "/openconfig-interfaces:interfaces/interface/state/counters")
+		if err != nil {
+			t.Fatalf("Get(%s): %v", encoding, err)
+		}
+		return notifs
+	}
+	proto, js := get("PROTO", protoResp), get("JSON", jsonResp)
+	if len(proto) != 1 || len(proto[0].Updates) != 1 || len(js) != 1 || len(js[0].Updates) != 1 {
+		t.Fatalf("PROTO %#v and JSON %#v should each have one update", proto, js)
+	}
+	p, j := proto[0].Updates[0], js[0].Updates[0]
+	if p.Path != j.Path {
+		t.Errorf("PROTO path %q, JSON path %q", p.Path, j.Path)
+	}
+	pm, _ := p.Value.(map[string]interface{})
+	jm, _ := j.Value.(map[string]interface{})
+	if len(pm) != len(jm) || pm["in-octets"] != uint64(100) || jm["in-octets"] != 100.0 {
+		t.Errorf("PROTO value %#v, JSON value %#v", p.Value, j.Value)
+	}
+}
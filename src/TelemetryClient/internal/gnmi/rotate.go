@@ -0,0 +1,296 @@
+package gnmi
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"gnmi-collector/internal/config"
+
+	"google.golang.org/grpc"
+)
+
+// rotateTimeout bounds one rotation, including key generation on the
+// switch.
+const rotateTimeout = 2 * time.Minute
+
+// RotateCertificate replaces the switch's gNMI server certificate
+// through gNOI CertificateManagement.Rotate on the client's connection.
+// The switch generates a key and CSR (or the configured key is pushed),
+// the certificate is signed by the local signing CA and loaded, and the
+// rotation is finalized only once a new connection is served the new
+// certificate; otherwise the stream is abandoned and the switch rolls
+// back. The pinned ca_file, or the known_hosts entry, is then swapped
+// to the new certificate. It returns the installed certificate.
+func (c *Client) RotateCertificate(ctx context.Context) (*x509.Certificate, error) {
+	tlsCfg := c.cfg.Target.TLS
+	rc := tlsCfg.Rotation
+	if !tlsCfg.Enabled || rc == nil {
+		return nil, fmt.Errorf("certificate rotation is not configured for %s", c.cfg.TargetLabel())
+	}
+	caCert, caKey, err := loadSigningCA(rc.SigningCACert, rc.SigningCAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelling an unfinalized stream makes the switch roll back.
+	ctx, cancel := context.WithTimeout(ctx, rotateTimeout)
+	defer cancel()
+	stream, err := c.conn.NewStream(c.authContext(ctx), &rotateStreamDesc, rotateMethod, grpc.ForceCodec(gnoiCodec{}))
+	if err != nil {
+		return nil, fmt.Errorf("opening gNOI Rotate stream: %w", err)
+	}
+
+	commonName := rc.CommonName
+	if commonName == "" {
+		commonName = c.cfg.Target.Address
+	}
+	load := &loadCertificateRequest{certificateID: rc.CertificateID}
+	var template *x509.Certificate
+	var pub crypto.PublicKey
+	if rc.KeyFile != "" {
+		key, err := loadPrivateKey(rc.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		pub = key.Public()
+		privDER, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("encoding key %s: %w", rc.KeyFile, err)
+		}
+		pubDER, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("encoding public key of %s: %w", rc.KeyFile, err)
+		}
+		load.privateKey = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})
+		load.publicKey = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+		template = &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	} else {
+		csr, err := generateCSR(stream, rc, commonName, c.cfg.Target.Address)
+		if err != nil {
+			return nil, err
+		}
+		pub = csr.PublicKey
+		template = &x509.Certificate{
+			Subject:        csr.Subject,
+			DNSNames:       csr.DNSNames,
+			IPAddresses:    csr.IPAddresses,
+			URIs:           csr.URIs,
+			EmailAddresses: csr.EmailAddresses,
+		}
+	}
+	addHostSAN(template, c.cfg.Target.Address)
+
+	cert, err := signServerCert(template, pub, caCert, caKey, rc.Validity)
+	if err != nil {
+		return nil, err
+	}
+	load.certificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := stream.SendMsg(&rotateRequest{loadCertificate: load}); err != nil {
+		return nil, fmt.Errorf("gNOI Rotate load certificate: %w", err)
+	}
+	var resp rotateResponse
+	if err := stream.RecvMsg(&resp); err != nil {
+		return nil, fmt.Errorf("gNOI Rotate load certificate: %w", err)
+	}
+	if !resp.loaded {
+		return nil, errors.New("gNOI Rotate: switch did not acknowledge the loaded certificate")
+	}
+
+	// Until the rotation is finalized the switch serves the new
+	// certificate on new connections; check before committing to it.
+	clientCerts, err := ClientCertificates(c.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("TLS client certificate: %w", err)
+	}
+	served, err := FetchServerCert(c.cfg.TargetAddr(), clientCerts)
+	if err != nil {
+		return nil, fmt.Errorf("verifying rotated certificate: %w", err)
+	}
+	if !bytes.Equal(served.Raw, cert.Raw) {
+		return nil, fmt.Errorf("switch still serves SHA-256 %s after loading %s — rotation abandoned", CertFingerprint(served), CertFingerprint(cert))
+	}
+
+	if err := stream.SendMsg(&rotateRequest{finalize: true}); err != nil {
+		return nil, fmt.Errorf("gNOI Rotate finalize: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("gNOI Rotate finalize: %w", err)
+	}
+	if err := stream.RecvMsg(&resp); err != io.EOF {
+		if err == nil {
+			err = errors.New("unexpected response")
+		}
+		return nil, fmt.Errorf("gNOI Rotate finalize: %w", err)
+	}
+	log.Printf("INFO: rotated server certificate of %s (SHA-256=%s, expires %s)",
+		c.cfg.TargetAddr(), CertFingerprint(cert), cert.NotAfter.Format(time.RFC3339))
+
+	return cert, pinRotatedCert(c.cfg, cert)
+}
+
+// generateCSR asks the switch to generate a key pair and returns its
+// verified certificate signing request.
+func generateCSR(stream grpc.ClientStream, rc *config.CertRotationConfig, commonName, host string) (*x509.CertificateRequest, error) {
+	params := csrParams{minKeySize: uint32(rc.MinKeySize), commonName: commonName}
+	if net.ParseIP(host) != nil {
+		params.ipAddress = host
+	}
+	req := &rotateRequest{generateCSR: &generateCSRRequest{params: params, certificateID: rc.CertificateID}}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, fmt.Errorf("gNOI Rotate generate CSR: %w", err)
+	}
+	var resp rotateResponse
+	if err := stream.RecvMsg(&resp); err != nil {
+		return nil, fmt.Errorf("gNOI Rotate generate CSR: %w", err)
+	}
+	der := resp.csr
+	if block, _ := pem.Decode(resp.csr); block != nil {
+		der = block.Bytes
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CSR from switch: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("CSR from switch: %w", err)
+	}
+	if key, ok := csr.PublicKey.(*rsa.PublicKey); ok && key.N.BitLen() < rc.MinKeySize {
+		return nil, fmt.Errorf("CSR from switch has a %d-bit RSA key, below min_key_size %d", key.N.BitLen(), rc.MinKeySize)
+	}
+	return csr, nil
+}
+
+// addHostSAN makes sure the certificate names the address the
+// collector dials, since verification ignores the common name.
+func addHostSAN(template *x509.Certificate, host string) {
+	if ip := net.ParseIP(host); ip != nil {
+		for _, have := range template.IPAddresses {
+			if have.Equal(ip) {
+				return
+			}
+		}
+		template.IPAddresses = append(template.IPAddresses, ip)
+		return
+	}
+	for _, have := range template.DNSNames {
+		if have == host {
+			return
+		}
+	}
+	template.DNSNames = append(template.DNSNames, host)
+}
+
+// signServerCert issues a server certificate for pub from template,
+// valid from now for validity.
+func signServerCert(template *x509.Certificate, pub crypto.PublicKey, caCert *x509.Certificate, caKey crypto.Signer, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generating serial number: %w", err)
+	}
+	now := time.Now()
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-5 * time.Minute)
+	template.NotAfter = now.Add(validity)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, pub, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("signing server certificate: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// loadSigningCA reads the signing CA certificate and its key and checks
+// that they belong together.
+func loadSigningCA(certFile, keyFile string) (*x509.Certificate, crypto.Signer, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading signing CA %s: %w", certFile, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, fmt.Errorf("signing CA %s contains no PEM data", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing signing CA %s: %w", certFile, err)
+	}
+	key, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(cert.PublicKey) {
+		return nil, nil, fmt.Errorf("signing CA key %s does not match %s", keyFile, certFile)
+	}
+	return cert, key, nil
+}
+
+// loadPrivateKey reads an unencrypted PKCS#8, PKCS#1 or SEC 1 PEM key.
+func loadPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s contains no PEM data", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s: unsupported PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing key %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %s: unsupported key type %T", path, key)
+	}
+	return signer, nil
+}
+
+// pinRotatedCert swaps the trust the collector pins for the target to a
+// rotated certificate: the ca_file is replaced atomically, or the
+// known_hosts entry updated. Rotation requires one of the two, so a
+// running collector picks the certificate up when it reconnects.
+func pinRotatedCert(cfg *config.Config, cert *x509.Certificate) error {
+	tlsCfg := cfg.Target.TLS
+	switch {
+	case tlsCfg.CAFile != "":
+		if err := SaveCertPEM(cert, tlsCfg.CAFile); err != nil {
+			return fmt.Errorf("pinning rotated certificate: %w", err)
+		}
+		log.Printf("TLS: pinned rotated certificate in %s", tlsCfg.CAFile)
+	case tlsCfg.KnownHosts != "":
+		if err := recordKnownHost(tlsCfg.KnownHosts, cfg.TargetAddr(), CertFingerprint(cert)); err != nil {
+			return fmt.Errorf("pinning rotated certificate: %w", err)
+		}
+		log.Printf("TLS: recorded rotated certificate of %s in %s", cfg.TargetAddr(), tlsCfg.KnownHosts)
+	}
+	return nil
+}
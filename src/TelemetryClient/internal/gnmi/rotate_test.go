@@ -0,0 +1,287 @@
+package gnmi
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"gnmi-collector/internal/config"
+)
+
+// certStub is a gNOI CertificateManagement server that generates CSRs,
+// serves a loaded certificate on new connections straight away and
+// rolls it back unless the rotation is finalized.
+type certStub struct {
+	mu         sync.Mutex
+	serving    tls.Certificate
+	finalized  bool
+	pushedKey  bool
+	ignoreLoad bool // Acknowledge loads without serving the new certificate
+}
+
+func (s *certStub) current() tls.Certificate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.serving
+}
+
+func (s *certStub) serve(cert tls.Certificate) {
+	s.mu.Lock()
+	s.serving = cert
+	s.mu.Unlock()
+}
+
+func (s *certStub) rotate(_ any, stream grpc.ServerStream) error {
+	previous := s.current()
+	var key crypto.Signer
+	for {
+		var req rotateRequest
+		if err := stream.RecvMsg(&req); err != nil {
+			s.serve(previous)
+			if err == io.EOF {
+				return errors.New("stream closed without finalize")
+			}
+			return err
+		}
+		switch {
+		case req.generateCSR != nil:
+			rsaKey, err := rsa.GenerateKey(rand.Reader, int(req.generateCSR.params.minKeySize))
+			if err != nil {
+				return err
+			}
+			key = rsaKey
+			template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: req.generateCSR.params.commonName}}
+			if ip := net.ParseIP(req.generateCSR.params.ipAddress); ip != nil {
+				template.IPAddresses = []net.IP{ip}
+			}
+			der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+			if err != nil {
+				return err
+			}
+			csr := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+			if err := stream.SendMsg(&rotateResponse{csr: csr}); err != nil {
+				return err
+			}
+		case req.loadCertificate != nil:
+			if pk := req.loadCertificate.privateKey; pk != nil {
+				block, _ := pem.Decode(pk)
+				parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+				if err != nil {
+					return err
+				}
+				key = parsed.(crypto.Signer)
+				s.mu.Lock()
+				s.pushedKey = true
+				s.mu.Unlock()
+			}
+			block, _ := pem.Decode(req.loadCertificate.certificate)
+			if !s.ignoreLoad {
+				s.serve(tls.Certificate{Certificate: [][]byte{block.Bytes}, PrivateKey: key})
+			}
+			if err := stream.SendMsg(&rotateResponse{loaded: true}); err != nil {
+				return err
+			}
+		case req.finalize:
+			s.mu.Lock()
+			s.finalized = true
+			s.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// startCertStub serves stub over TLS, initially with a certificate
+// from ca, and returns its port.
+func startCertStub(t *testing.T, ca *testCA, stub *certStub) int {
+	t.Helper()
+	stub.serve(ca.issue(t))
+	creds := credentials.NewTLS(&tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert := stub.current()
+			return &cert, nil
+		},
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := grpc.NewServer(grpc.Creds(creds), grpc.ForceServerCodec(gnoiCodec{}))
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "gnoi.certificate.CertificateManagement",
+		HandlerType: (*any)(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Rotate",
+			Handler:       stub.rotate,
+			ClientStreams: true,
+			ServerStreams: true,
+		}},
+	}, stub)
+	go s.Serve(ln)
+	t.Cleanup(s.Stop)
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// writeKey writes key as a PKCS#8 PEM file and returns its path.
+func writeKey(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rotationTarget starts a stub and returns a config for it that
+// rotates with a fresh signing CA, and that CA.
+func rotationTarget(t *testing.T, stub *certStub, tlsCfg config.TLSConfig) (*config.Config, *testCA) {
+	t.Helper()
+	port := startCertStub(t, newTestCA(t), stub)
+	signer := newTestCA(t)
+	caFile := filepath.Join(t.TempDir(), "signing-ca.pem")
+	if err := SaveCertPEM(signer.cert, caFile); err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg.Enabled = true
+	tlsCfg.Rotation = &config.CertRotationConfig{
+		SigningCACert: caFile,
+		SigningCAKey:  writeKey(t, signer.key),
+		CertificateID: "gnmi",
+		MinKeySize:    2048,
+		Validity:      90 * 24 * time.Hour,
+	}
+	return &config.Config{
+		Target:     config.TargetConfig{Address: "127.0.0.1", Port: port, TLS: tlsCfg},
+		Collection: config.CollectionConfig{Timeout: 5 * time.Second},
+	}, signer
+}
+
+func rotate(t *testing.T, cfg *config.Config) (*x509.Certificate, error) {
+	t.Helper()
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return client.RotateCertificate(ctx)
+}
+
+func TestRotateCertificateCSR(t *testing.T) {
+	stub := &certStub{}
+	pinned := filepath.Join(t.TempDir(), "switch.pem")
+	cfg, signer := rotationTarget(t, stub, config.TLSConfig{CAFile: pinned})
+
+	cert, err := rotate(t, cfg)
+	if err != nil {
+		t.Fatalf("RotateCertificate: %v", err)
+	}
+	if !stub.finalized || stub.pushedKey {
+		t.Errorf("stub finalized=%v pushedKey=%v, want a finalized CSR rotation", stub.finalized, stub.pushedKey)
+	}
+	if err := cert.CheckSignatureFrom(signer.cert); err != nil {
+		t.Errorf("rotated certificate not signed by the signing CA: %v", err)
+	}
+	if len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) || cert.Subject.CommonName != "127.0.0.1" {
+		t.Errorf("rotated certificate names %v / %q", cert.IPAddresses, cert.Subject.CommonName)
+	}
+	if key, ok := cert.PublicKey.(*rsa.PublicKey); !ok || key.N.BitLen() != 2048 {
+		t.Errorf("rotated certificate key = %T, want the switch's 2048-bit RSA key", cert.PublicKey)
+	}
+
+	pool, err := LoadCACertPool(pinned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+		t.Errorf("ca_file does not pin the rotated certificate: %v", err)
+	}
+}
+
+func TestRotateCertificatePushedKey(t *testing.T) {
+	stub := &certStub{}
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	cfg, _ := rotationTarget(t, stub, config.TLSConfig{KnownHosts: knownHosts, FingerprintPolicy: PolicyStrict})
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Target.TLS.Rotation.KeyFile = writeKey(t, key)
+	cfg.Target.TLS.Rotation.CommonName = "leaf1"
+
+	cert, err := rotate(t, cfg)
+	if err != nil {
+		t.Fatalf("RotateCertificate: %v", err)
+	}
+	if !stub.finalized || !stub.pushedKey {
+		t.Errorf("stub finalized=%v pushedKey=%v, want a finalized rotation with a pushed key", stub.finalized, stub.pushedKey)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) || cert.Subject.CommonName != "leaf1" {
+		t.Errorf("rotated certificate is not for the pushed key and common name")
+	}
+	hosts, _ := readKnownHosts(knownHosts)
+	if hosts[cfg.TargetAddr()] != CertFingerprint(cert) {
+		t.Errorf("known_hosts entry = %s, want the rotated fingerprint", hosts[cfg.TargetAddr()])
+	}
+}
+
+func TestRotateCertificateAbandoned(t *testing.T) {
+	stub := &certStub{ignoreLoad: true}
+	pinned := filepath.Join(t.TempDir(), "switch.pem")
+	cfg, _ := rotationTarget(t, stub, config.TLSConfig{CAFile: pinned})
+	original := stub.current().Certificate[0]
+
+	if _, err := rotate(t, cfg); err == nil {
+		t.Fatal("expected an error when the switch does not serve the loaded certificate")
+	}
+	stub.mu.Lock()
+	if stub.finalized {
+		t.Error("rotation was finalized")
+	}
+	stub.mu.Unlock()
+	data, _ := os.ReadFile(pinned)
+	if block, _ := pem.Decode(data); block == nil || string(block.Bytes) != string(original) {
+		t.Error("ca_file no longer pins the original certificate after an abandoned rotation")
+	}
+}
+
+func TestRotateMessagesRoundTrip(t *testing.T) {
+	req := &rotateRequest{loadCertificate: &loadCertificateRequest{
+		certificate: []byte("cert"), privateKey: []byte("priv"), publicKey: []byte("pub"), certificateID: "gnmi",
+	}}
+	var got rotateRequest
+	if err := got.unmarshal(req.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	lc := got.loadCertificate
+	if lc == nil || string(lc.certificate) != "cert" || string(lc.privateKey) != "priv" || string(lc.publicKey) != "pub" || lc.certificateID != "gnmi" {
+		t.Errorf("load certificate = %+v", lc)
+	}
+
+	var fin rotateRequest
+	if err := fin.unmarshal((&rotateRequest{finalize: true}).marshal()); err != nil || !fin.finalize {
+		t.Errorf("finalize = %+v, %v", fin, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -12,6 +13,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"gnmi-collector/internal/config"
 )
 
 const tofuProbeTimeout = 10 * time.Second
@@ -20,7 +23,18 @@ const tofuProbeTimeout = 10 * time.Second
 // verification) and returns the server's leaf certificate in DER form.
 // This is used for trust-on-first-use (TOFU) cert bootstrapping.
 // The probe has a 10-second timeout to avoid hanging on unreachable targets.
-func FetchServerCert(addr string) (*x509.Certificate, error) {
+// clientCerts are presented to servers that require client authentication.
+func FetchServerCert(addr string, clientCerts []tls.Certificate) (*x509.Certificate, error) {
+	chain, err := fetchServerChain(addr, clientCerts)
+	if err != nil {
+		return nil, err
+	}
+	return chain[0], nil
+}
+
+// fetchServerChain probes the server like FetchServerCert and returns
+// every certificate it presented, leaf first.
+func fetchServerChain(addr string, clientCerts []tls.Certificate) ([]*x509.Certificate, error) {
 	dialer := &net.Dialer{Timeout: tofuProbeTimeout}
 	// WORKAROUND: InsecureSkipVerify is required here because the TOFU probe
 	// must connect before we have any trusted cert to verify against.
@@ -29,6 +43,7 @@ func FetchServerCert(addr string) (*x509.Certificate, error) {
 	// for gRPC, replace TOFU with standard certificate validation.
 	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
 		InsecureSkipVerify: true,
+		Certificates:       clientCerts,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("TLS probe to %s: %w", addr, err)
@@ -39,7 +54,7 @@ func FetchServerCert(addr string) (*x509.Certificate, error) {
 	if len(certs) == 0 {
 		return nil, fmt.Errorf("server at %s presented no certificates", addr)
 	}
-	return certs[0], nil
+	return certs, nil
 }
 
 // CertFingerprint returns the SHA-256 fingerprint of a certificate as a
@@ -70,10 +85,10 @@ func CertServerName(cert *x509.Certificate) string {
 // fetches its leaf certificate, and returns an in-memory CertPool
 // along with the ServerName to use for hostname verification.
 // The pool and server name are NOT persisted to disk.
-func TOFUCertPool(addr string) (*x509.CertPool, string, error) {
-	cert, err := FetchServerCert(addr)
+func TOFUCertPool(addr string, clientCerts []tls.Certificate) (*x509.CertPool, string, string, error) {
+	cert, err := FetchServerCert(addr, clientCerts)
 	if err != nil {
-		return nil, "", err
+		return nil, "", "", err
 	}
 
 	fp := CertFingerprint(cert)
@@ -82,15 +97,15 @@ func TOFUCertPool(addr string) (*x509.CertPool, string, error) {
 
 	pool := x509.NewCertPool()
 	pool.AddCert(cert)
-	return pool, serverName, nil
+	return pool, serverName, fp, nil
 }
 
 // TOFURefetch re-probes the server and returns an updated CertPool
 // if the certificate has changed since the given fingerprint.
 // Returns the new pool, new fingerprint, and server name.
 // Returns nil pool if the cert is unchanged.
-func TOFURefetch(addr, oldFingerprint string) (*x509.CertPool, string, string, error) {
-	cert, err := FetchServerCert(addr)
+func TOFURefetch(addr, oldFingerprint string, clientCerts []tls.Certificate) (*x509.CertPool, string, string, error) {
+	cert, err := FetchServerCert(addr, clientCerts)
 	if err != nil {
 		return nil, "", "", fmt.Errorf("cert re-fetch probe failed: %w", err)
 	}
@@ -153,7 +168,7 @@ func LoadCACertPool(path string) (*x509.CertPool, error) {
 // exist, it probes the server via TOFU, saves the cert, and returns
 // the loaded cert pool. Returns nil if ca_file is not configured
 // (caller should use in-memory TOFU instead).
-func BootstrapCert(addr, caFile string) (*x509.CertPool, error) {
+func BootstrapCert(addr, caFile string, clientCerts []tls.Certificate) (*x509.CertPool, error) {
 	if caFile == "" {
 		return nil, nil
 	}
@@ -170,7 +185,7 @@ func BootstrapCert(addr, caFile string) (*x509.CertPool, error) {
 
 	// File doesn't exist — auto-fetch via TOFU
 	log.Printf("ca_file %s not found — fetching server certificate from %s (TOFU)", caFile, addr)
-	cert, err := FetchServerCert(addr)
+	cert, err := FetchServerCert(addr, clientCerts)
 	if err != nil {
 		return nil, err
 	}
@@ -230,41 +245,59 @@ func asErr[T error](target *T, err error) bool {
 	return false
 }
 
-// RefetchAndSave probes the server for its current certificate and
-// compares it to the existing pinned cert. If the cert has changed,
-// it saves the new one and returns the updated cert pool. If the cert
-// is the same, it returns nil (the problem isn't a changed cert).
-func RefetchAndSave(addr, caFile string) (*x509.CertPool, error) {
-	newCert, err := FetchServerCert(addr)
+// CAFileFingerprint returns the SHA-256 fingerprint of the first
+// certificate in caFile, or "" when it cannot be read.
+func CAFileFingerprint(caFile string) string {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return ""
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("cert re-fetch probe failed: %w", err)
+		return ""
 	}
-	newFP := CertFingerprint(newCert)
+	return CertFingerprint(cert)
+}
+
+// RefetchAndSave probes the server for its current certificate and
+// compares it to the cert pinned in tlsCfg.CAFile. If the cert has
+// changed and the fingerprint policy accepts it, it saves the new one
+// and returns the updated cert pool with the change. A rejected change
+// is returned with a *FingerprintChangeError and nothing is saved. If
+// the cert is the same, it returns an error (the problem isn't a
+// changed cert).
+func RefetchAndSave(addr string, tlsCfg config.TLSConfig, clientCerts []tls.Certificate) (*x509.CertPool, *FingerprintChange, error) {
+	caFile := tlsCfg.CAFile
 
 	// Load existing cert to compare fingerprints
-	oldFP := "(none)"
-	if data, err := os.ReadFile(caFile); err == nil {
-		block, _ := pem.Decode(data)
-		if block != nil {
-			if oldCert, err := x509.ParseCertificate(block.Bytes); err == nil {
-				oldFP = CertFingerprint(oldCert)
-			}
-		}
+	oldFP := CAFileFingerprint(caFile)
+	if oldFP == "" {
+		oldFP = "(none)"
 	}
 
-	if oldFP == newFP {
+	newCert, change, err := CheckServerCert(addr, oldFP, tlsCfg, clientCerts)
+	if err != nil {
+		var rejected *FingerprintChangeError
+		if errors.As(err, &rejected) {
+			return nil, change, err
+		}
+		return nil, nil, fmt.Errorf("cert re-fetch probe failed: %w", err)
+	}
+	if change == nil {
 		// Cert hasn't changed — the TLS error is something else
-		return nil, fmt.Errorf("server certificate unchanged (SHA-256: %s) — TLS error is not caused by cert rotation", newFP)
+		return nil, nil, fmt.Errorf("server certificate unchanged (SHA-256: %s) — TLS error is not caused by cert rotation", oldFP)
 	}
 
-	log.Printf("WARN: server certificate changed — old fingerprint: %s, new fingerprint: %s", oldFP, newFP)
-
 	if err := SaveCertPEM(newCert, caFile); err != nil {
-		return nil, err
+		return nil, change, err
 	}
 	log.Printf("Saved updated server certificate to %s", caFile)
 
 	pool := x509.NewCertPool()
 	pool.AddCert(newCert)
-	return pool, nil
+	return pool, change, nil
 }
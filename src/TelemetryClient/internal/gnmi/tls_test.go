@@ -194,7 +194,7 @@ func TestRefetchAndSave_SameCert(t *testing.T) {
 
 func TestBootstrapCert_NoCAFile(t *testing.T) {
 	// When ca_file is empty, BootstrapCert returns nil (caller should use TOFU)
-	pool, err := BootstrapCert("localhost:50051", "")
+	pool, err := BootstrapCert("localhost:50051", "", nil)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -212,7 +212,7 @@ func TestBootstrapCert_ExistingFile(t *testing.T) {
 		t.Fatalf("save: %v", err)
 	}
 
-	pool, err := BootstrapCert("localhost:50051", path)
+	pool, err := BootstrapCert("localhost:50051", path, nil)
 	if err != nil {
 		t.Fatalf("BootstrapCert: %v", err)
 	}
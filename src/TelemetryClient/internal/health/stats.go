@@ -0,0 +1,420 @@
+// Package health tracks the collector's own behaviour — per-path request
+// latency and errors, Subscribe ONCE fallbacks, entry counts, reconnects,
+// batch sizes and sink send times — and exposes it on /healthz, /readyz,
+// the internal /metrics families and the periodic CollectorHealth_CL row.
+package health
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gnmi-collector/internal/prometheus"
+	"gnmi-collector/internal/spool"
+)
+
+// Stats holds the counters of every target. It is safe for concurrent
+// use; collectors record into it through their Target handle.
+type Stats struct {
+	staleAfter time.Duration
+	start      time.Time
+	now        func() time.Time
+
+	mu      sync.Mutex
+	spool   *spool.Spool
+	targets map[string]*target
+}
+
+type target struct {
+	reconnects uint64
+	lastUpdate time.Time
+	paths      map[string]*pathStats
+	batches    map[string]*summary // Entries per written batch, by table
+	sinks      map[string]*sinkStats
+}
+
+type pathStats struct {
+	requests   map[string]*summary // Latency in seconds, by method (get, subscribe_once)
+	errors     map[string]uint64
+	fallbacks  uint64
+	entries    uint64
+	lastUpdate time.Time
+	status     string // PathStreaming, PathPolled or PathFailed; "" until known
+}
+
+type sinkStats struct {
+	latency  summary
+	failures uint64
+}
+
+// summary accumulates a Prometheus summary without quantiles.
+type summary struct {
+	count uint64
+	sum   float64
+}
+
+func (s *summary) observe(v float64) {
+	s.count++
+	s.sum += v
+}
+
+func (s *summary) avg() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum / float64(s.count)
+}
+
+// NewStats creates empty stats. A target is ready once it delivered an
+// update; with staleAfter > 0 it stops being ready when its last update
+// is older than that.
+func NewStats(staleAfter time.Duration) *Stats {
+	return &Stats{
+		staleAfter: staleAfter,
+		start:      time.Now(),
+		now:        time.Now,
+		targets:    map[string]*target{},
+	}
+}
+
+// SetSpool includes the Azure upload spool's backlog in the stats.
+func (s *Stats) SetSpool(sp *spool.Spool) {
+	s.mu.Lock()
+	s.spool = sp
+	s.mu.Unlock()
+}
+
+// Target registers a target, keeping its counters if it is already
+// known (a restart after a reload), and returns its handle. A nil Stats
+// yields a nil handle, on which every method is a no-op.
+func (s *Stats) Target(name string) *Target {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.targets[name]; !ok {
+		s.targets[name] = &target{
+			paths:   map[string]*pathStats{},
+			batches: map[string]*summary{},
+			sinks:   map[string]*sinkStats{},
+		}
+	}
+	return &Target{s: s, name: name}
+}
+
+// Remove forgets a target that was removed from the config.
+func (s *Stats) Remove(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	delete(s.targets, name)
+	s.mu.Unlock()
+}
+
+// Target records the stats of one target.
+type Target struct {
+	s    *Stats
+	name string
+}
+
+// with runs fn on the target's counters under the lock. Counters of a
+// target removed in the meantime are discarded.
+func (t *Target) with(fn func(tg *target, now time.Time)) {
+	if t == nil {
+		return
+	}
+	t.s.mu.Lock()
+	defer t.s.mu.Unlock()
+	if tg, ok := t.s.targets[t.name]; ok {
+		fn(tg, t.s.now())
+	}
+}
+
+func (tg *target) path(name string) *pathStats {
+	p, ok := tg.paths[name]
+	if !ok {
+		p = &pathStats{requests: map[string]*summary{}, errors: map[string]uint64{}}
+		tg.paths[name] = p
+	}
+	return p
+}
+
+// ObservePath records one gNMI request for a path; method is "get" or
+// "subscribe_once".
+func (t *Target) ObservePath(path, method string, d time.Duration, err error) {
+	t.with(func(tg *target, _ time.Time) {
+		p := tg.path(path)
+		r, ok := p.requests[method]
+		if !ok {
+			r = &summary{}
+			p.requests[method] = r
+		}
+		r.observe(d.Seconds())
+		if err != nil {
+			p.errors[method]++
+		}
+	})
+}
+
+// Path statuses reported by SetPathStatus.
+const (
+	PathStreaming = "streaming" // Delivered by the subscribe stream
+	PathPolled    = "polled"    // Fetched with Get or Subscribe ONCE, and the last fetch succeeded
+	PathFailed    = "failed"    // The last poll of the path failed
+)
+
+// SetPathStatus records how a path is currently collected.
+func (t *Target) SetPathStatus(path, status string) {
+	t.with(func(tg *target, _ time.Time) { tg.path(path).status = status })
+}
+
+// Fallback records a poll that fell back from Get to Subscribe ONCE.
+func (t *Target) Fallback(path string) {
+	t.with(func(tg *target, _ time.Time) { tg.path(path).fallbacks++ })
+}
+
+// Entries records n transformed entries for a path, marking it updated.
+func (t *Target) Entries(path string, n int) {
+	t.with(func(tg *target, now time.Time) {
+		p := tg.path(path)
+		p.entries += uint64(n)
+		p.lastUpdate = now
+		tg.lastUpdate = now
+	})
+}
+
+// Reconnect records a reconnect of the target's gNMI session.
+func (t *Target) Reconnect() {
+	t.with(func(tg *target, _ time.Time) { tg.reconnects++ })
+}
+
+// Batch records the size of a batch written to the sinks.
+func (t *Target) Batch(table string, n int) {
+	t.with(func(tg *target, _ time.Time) {
+		b, ok := tg.batches[table]
+		if !ok {
+			b = &summary{}
+			tg.batches[table] = b
+		}
+		b.observe(float64(n))
+	})
+}
+
+// ObserveSend records one write to a sink.
+func (t *Target) ObserveSend(sink string, d time.Duration, err error) {
+	t.with(func(tg *target, _ time.Time) {
+		st, ok := tg.sinks[sink]
+		if !ok {
+			st = &sinkStats{}
+			tg.sinks[sink] = st
+		}
+		st.latency.observe(d.Seconds())
+		if err != nil {
+			st.failures++
+		}
+	})
+}
+
+// Report returns the target's stats as the message of a CollectorHealth_CL
+// row. Counters are cumulative since the collector started.
+func (t *Target) Report() map[string]interface{} {
+	msg := map[string]interface{}{}
+	t.with(func(tg *target, now time.Time) {
+		msg["target"] = t.name
+		msg["uptime_seconds"] = int64(now.Sub(t.s.start).Seconds())
+		msg["ready"] = t.s.readyLocked(tg, now) == ""
+		msg["reconnects"] = tg.reconnects
+		if !tg.lastUpdate.IsZero() {
+			msg["last_update_age_seconds"] = now.Sub(tg.lastUpdate).Seconds()
+		}
+
+		paths := map[string]interface{}{}
+		for name, p := range tg.paths {
+			var requests, errors uint64
+			var latency summary
+			for method, r := range p.requests {
+				requests += r.count
+				errors += p.errors[method]
+				latency.count += r.count
+				latency.sum += r.sum
+			}
+			ps := map[string]interface{}{
+				"requests":       requests,
+				"errors":         errors,
+				"fallbacks":      p.fallbacks,
+				"entries":        p.entries,
+				"latency_avg_ms": latency.avg() * 1000,
+			}
+			if p.status != "" {
+				ps["status"] = p.status
+			}
+			if !p.lastUpdate.IsZero() {
+				ps["last_update_age_seconds"] = now.Sub(p.lastUpdate).Seconds()
+			}
+			paths[name] = ps
+		}
+		msg["paths"] = paths
+
+		batches := map[string]interface{}{}
+		for table, b := range tg.batches {
+			batches[table] = map[string]interface{}{"batches": b.count, "entries_avg": b.avg()}
+		}
+		msg["batches"] = batches
+
+		sinks := map[string]interface{}{}
+		for name, st := range tg.sinks {
+			sinks[name] = map[string]interface{}{
+				"sends":          st.latency.count,
+				"failures":       st.failures,
+				"latency_avg_ms": st.latency.avg() * 1000,
+			}
+		}
+		msg["sinks"] = sinks
+
+		if t.s.spool != nil {
+			sp := t.s.spool.Stats()
+			msg["spool_batches"] = sp.Batches
+			msg["spool_bytes"] = sp.Bytes
+			msg["spool_dropped"] = sp.Dropped
+			msg["spool_oldest_age_seconds"] = sp.OldestAge.Seconds()
+		}
+	})
+	return msg
+}
+
+// readyLocked returns why a target is not ready, or "" when it is.
+func (s *Stats) readyLocked(tg *target, now time.Time) string {
+	switch {
+	case tg.lastUpdate.IsZero():
+		return "no update yet"
+	case s.staleAfter > 0 && now.Sub(tg.lastUpdate) > s.staleAfter:
+		return fmt.Sprintf("last update %s ago", now.Sub(tg.lastUpdate).Round(time.Second))
+	}
+	return ""
+}
+
+// Healthz reports that the process is up and serving.
+func (s *Stats) Healthz(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz succeeds once every target has delivered fresh data and lists
+// the targets that have not otherwise.
+func (s *Stats) Readyz(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	now := s.now()
+	var notReady []string
+	for name, tg := range s.targets {
+		if why := s.readyLocked(tg, now); why != "" {
+			notReady = append(notReady, name+": "+why)
+		}
+	}
+	empty := len(s.targets) == 0
+	s.mu.Unlock()
+
+	switch {
+	case empty:
+		http.Error(w, "not ready: no targets", http.StatusServiceUnavailable)
+	case len(notReady) > 0:
+		sort.Strings(notReady)
+		http.Error(w, "not ready:\n"+strings.Join(notReady, "\n"), http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ready")
+	}
+}
+
+// WriteMetrics writes the gnmi_collector_* families.
+func (s *Stats) WriteMetrics(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+
+	names := make([]string, 0, len(s.targets))
+	for name := range s.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fams := map[string]*prometheus.Family{}
+	add := func(name, typ, help, suffix string, value float64, labels ...[2]string) {
+		f, ok := fams[name]
+		if !ok {
+			f = &prometheus.Family{Name: name, Type: typ, Help: help}
+			fams[name] = f
+		}
+		f.Samples = append(f.Samples, prometheus.Sample{Suffix: suffix, Labels: labels, Value: value})
+	}
+
+	add("gnmi_collector_start_time_seconds", "gauge", "Unix time the collector started.", "",
+		float64(s.start.Unix()))
+	for _, name := range names {
+		tg := s.targets[name]
+		tl := [2]string{"target", name}
+
+		ready := 0.0
+		if s.readyLocked(tg, now) == "" {
+			ready = 1
+		}
+		add("gnmi_collector_target_ready", "gauge", "Whether the target delivered fresh data.", "", ready, tl)
+		add("gnmi_collector_reconnects_total", "counter", "gNMI session reconnects.", "", float64(tg.reconnects), tl)
+
+		for _, path := range sortedKeys(tg.paths) {
+			p := tg.paths[path]
+			pl := [2]string{"path", path}
+			for _, method := range sortedKeys(p.requests) {
+				r := p.requests[method]
+				ml := [2]string{"method", method}
+				add("gnmi_collector_path_request_seconds", "summary", "Latency of gNMI Get and Subscribe ONCE requests.", "_sum", r.sum, tl, pl, ml)
+				add("gnmi_collector_path_request_seconds", "summary", "Latency of gNMI Get and Subscribe ONCE requests.", "_count", float64(r.count), tl, pl, ml)
+				add("gnmi_collector_path_errors_total", "counter", "Failed gNMI requests.", "", float64(p.errors[method]), tl, pl, ml)
+			}
+			add("gnmi_collector_path_fallbacks_total", "counter", "Polls that fell back from Get to Subscribe ONCE.", "", float64(p.fallbacks), tl, pl)
+			add("gnmi_collector_path_entries_total", "counter", "Entries produced by the path's transformer.", "", float64(p.entries), tl, pl)
+			if p.status != "" {
+				add("gnmi_collector_path_status", "gauge", "How the path is collected: streaming, polled or failed.", "", 1, tl, pl, [2]string{"status", p.status})
+			}
+			if !p.lastUpdate.IsZero() {
+				add("gnmi_collector_path_last_update_age_seconds", "gauge", "Time since the path last produced entries.", "", now.Sub(p.lastUpdate).Seconds(), tl, pl)
+			}
+		}
+		for _, table := range sortedKeys(tg.batches) {
+			b := tg.batches[table]
+			bl := [2]string{"table", table}
+			add("gnmi_collector_batch_entries", "summary", "Entries per batch written to the sinks.", "_sum", b.sum, tl, bl)
+			add("gnmi_collector_batch_entries", "summary", "Entries per batch written to the sinks.", "_count", float64(b.count), tl, bl)
+		}
+		for _, sk := range sortedKeys(tg.sinks) {
+			st := tg.sinks[sk]
+			sl := [2]string{"sink", sk}
+			add("gnmi_collector_sink_send_seconds", "summary", "Latency of sink writes.", "_sum", st.latency.sum, tl, sl)
+			add("gnmi_collector_sink_send_seconds", "summary", "Latency of sink writes.", "_count", float64(st.latency.count), tl, sl)
+			add("gnmi_collector_sink_failures_total", "counter", "Failed or deferred sink writes.", "", float64(st.failures), tl, sl)
+		}
+	}
+	if s.spool != nil {
+		sp := s.spool.Stats()
+		add("gnmi_collector_spool_batches", "gauge", "Batches queued in the Azure upload spool.", "", float64(sp.Batches))
+		add("gnmi_collector_spool_bytes", "gauge", "Bytes queued in the Azure upload spool.", "", float64(sp.Bytes))
+		add("gnmi_collector_spool_oldest_age_seconds", "gauge", "Age of the oldest spooled batch.", "", sp.OldestAge.Seconds())
+		add("gnmi_collector_spool_dropped_total", "counter", "Spooled batches dropped by the size or age limit.", "", float64(sp.Dropped))
+	}
+
+	for _, name := range sortedKeys(fams) {
+		prometheus.WriteFamily(w, *fams[name])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package health
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	now := time.Now()
+	s := NewStats(10 * time.Minute)
+	s.now = func() time.Time { return now }
+
+	status := func() (int, string) {
+		rec := httptest.NewRecorder()
+		s.Readyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+		return rec.Code, rec.Body.String()
+	}
+
+	if code, _ := status(); code != http.StatusServiceUnavailable {
+		t.Errorf("no targets: code = %d, want 503", code)
+	}
+
+	a, b := s.Target("tor-a"), s.Target("tor-b")
+	a.Entries("interface-counters", 48)
+	if code, body := status(); code != http.StatusServiceUnavailable || !strings.Contains(body, "tor-b: no update yet") {
+		t.Errorf("one target silent: %d %q", code, body)
+	}
+
+	b.Entries("interface-counters", 48)
+	if code, _ := status(); code != http.StatusOK {
+		t.Errorf("all targets updated: code = %d, want 200", code)
+	}
+
+	now = now.Add(11 * time.Minute)
+	b.Entries("interface-counters", 48)
+	if code, body := status(); code != http.StatusServiceUnavailable || !strings.Contains(body, "tor-a: last update 11m0s ago") {
+		t.Errorf("stale target: %d %q", code, body)
+	}
+
+	s.Remove("tor-a")
+	if code, _ := status(); code != http.StatusOK {
+		t.Errorf("after removing the stale target: code = %d, want 200", code)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	s := NewStats(0)
+	tg := s.Target("tor-a")
+	tg.ObservePath("bgp-neighbors", "get", 200*time.Millisecond, errors.New("unavailable"))
+	tg.Fallback("bgp-neighbors")
+	tg.ObservePath("bgp-neighbors", "subscribe_once", 300*time.Millisecond, nil)
+	tg.Entries("bgp-neighbors", 4)
+	tg.SetPathStatus("bgp-neighbors", PathPolled)
+	tg.Reconnect()
+	tg.Batch("CiscoBgp_CL", 4)
+	tg.ObserveSend("azure", 50*time.Millisecond, nil)
+
+	var buf bytes.Buffer
+	s.WriteMetrics(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE gnmi_collector_path_request_seconds summary\n",
+		`gnmi_collector_path_request_seconds_count{target="tor-a",path="bgp-neighbors",method="get"} 1`,
+		`gnmi_collector_path_errors_total{target="tor-a",path="bgp-neighbors",method="get"} 1`,
+		`gnmi_collector_path_errors_total{target="tor-a",path="bgp-neighbors",method="subscribe_once"} 0`,
+		`gnmi_collector_path_fallbacks_total{target="tor-a",path="bgp-neighbors"} 1`,
+		`gnmi_collector_path_entries_total{target="tor-a",path="bgp-neighbors"} 4`,
+		`gnmi_collector_path_status{target="tor-a",path="bgp-neighbors",status="polled"} 1`,
+		`gnmi_collector_reconnects_total{target="tor-a"} 1`,
+		`gnmi_collector_batch_entries_sum{target="tor-a",table="CiscoBgp_CL"} 4`,
+		`gnmi_collector_sink_send_seconds_count{target="tor-a",sink="azure"} 1`,
+		`gnmi_collector_target_ready{target="tor-a"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %q\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "# TYPE gnmi_collector_path_request_seconds") != 1 {
+		t.Errorf("family header repeated:\n%s", out)
+	}
+}
+
+func TestReport(t *testing.T) {
+	s := NewStats(0)
+	tg := s.Target("tor-a")
+	tg.ObservePath("temperature", "get", 100*time.Millisecond, nil)
+	tg.ObservePath("temperature", "get", 300*time.Millisecond, nil)
+	tg.Entries("temperature", 6)
+	tg.SetPathStatus("temperature", PathStreaming)
+	tg.ObserveSend("azure", time.Second, errors.New("503"))
+
+	msg := tg.Report()
+	if msg["target"] != "tor-a" || msg["ready"] != true {
+		t.Errorf("report = %v", msg)
+	}
+	p := msg["paths"].(map[string]interface{})["temperature"].(map[string]interface{})
+	if p["requests"] != uint64(2) || p["entries"] != uint64(6) || p["latency_avg_ms"] != 200.0 || p["status"] != PathStreaming {
+		t.Errorf("path stats = %v", p)
+	}
+	sk := msg["sinks"].(map[string]interface{})["azure"].(map[string]interface{})
+	if sk["failures"] != uint64(1) {
+		t.Errorf("sink stats = %v", sk)
+	}
+}
+
+func TestNilTargetIsNoop(t *testing.T) {
+	var s *Stats
+	tg := s.Target("x")
+	tg.Entries("p", 1)
+	tg.Reconnect()
+	if msg := tg.Report(); len(msg) != 0 {
+		t.Errorf("nil target report = %v", msg)
+	}
+}
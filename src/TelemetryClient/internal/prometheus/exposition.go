@@ -0,0 +1,84 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Source is anything that can write metric families in the text
+// exposition format: the telemetry Store, the collector's own stats.
+type Source interface {
+	WriteMetrics(w io.Writer)
+}
+
+// Handler serves the metrics of all sources on one endpoint. Sources
+// must not write families with the same name.
+func Handler(sources ...Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		bw := bufio.NewWriter(w)
+		for _, src := range sources {
+			src.WriteMetrics(bw)
+		}
+		bw.Flush()
+	})
+}
+
+// Sample is one series of a Family. Suffix is appended to the family
+// name, for the _sum and _count series of a summary.
+type Sample struct {
+	Suffix string
+	Labels [][2]string
+	Value  float64
+}
+
+// Family is a metric and its series.
+type Family struct {
+	Name, Help, Type string
+	Samples          []Sample
+}
+
+// WriteFamily writes f in the text exposition format. A family with no
+// samples is omitted.
+func WriteFamily(w io.Writer, f Family) {
+	if len(f.Samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.Name, f.Help, f.Name, f.Type)
+	for _, smp := range f.Samples {
+		fmt.Fprintf(w, "%s%s{%s} %s\n", f.Name, smp.Suffix, renderLabels(smp.Labels), formatValue(smp.Value))
+	}
+}
+
+// Sanitize maps a field name onto the [a-zA-Z0-9_] metric/label charset.
+func Sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func renderLabels(labels [][2]string) string {
+	var b strings.Builder
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, l[0], labelEscaper.Replace(l[1]))
+	}
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
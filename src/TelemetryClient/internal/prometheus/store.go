@@ -0,0 +1,153 @@
+// Package prometheus keeps the latest transformed telemetry values and
+// serves them in the Prometheus text exposition format. Which message
+// fields become metrics, and which become labels, is declared per data
+// type next to the transformers (see transform.RegisterMetrics).
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gnmi-collector/internal/transform"
+)
+
+// Store holds one sample per series, replaced as new rows arrive.
+// Series that are not refreshed within the expiry window (an interface
+// that disappeared, a removed target) are dropped at scrape time.
+type Store struct {
+	expireAfter time.Duration
+	hostname    string // For rows without a target identity
+	now         func() time.Time
+
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+type family struct {
+	help, typ string
+	series    map[string]*sample // Keyed by the rendered label set
+}
+
+type sample struct {
+	labels  string
+	value   float64
+	updated time.Time
+}
+
+// NewStore creates an empty store. expireAfter <= 0 keeps series forever.
+func NewStore(expireAfter time.Duration) *Store {
+	hostname, _ := os.Hostname()
+	return &Store{
+		expireAfter: expireAfter,
+		hostname:    hostname,
+		now:         time.Now,
+		families:    map[string]*family{},
+	}
+}
+
+// Update records the rows of one table collected from hostname. Rows
+// whose data type declares no metrics are ignored.
+func (s *Store) Update(hostname, table string, rows []transform.CommonFields) {
+	if hostname == "" {
+		hostname = s.hostname
+	}
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range rows {
+		spec, ok := transform.MetricsFor(row.DataType)
+		if !ok {
+			continue
+		}
+		msg, ok := row.Message.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		labels := [][2]string{{"hostname", hostname}, {"table", table}}
+		for _, key := range spec.Labels {
+			labels = append(labels, [2]string{Sanitize(key), transform.GetString(msg, key)})
+		}
+		rendered := renderLabels(labels)
+
+		for _, field := range spec.Counters {
+			s.set(metricName(row.DataType, field)+"_total", "counter", row.DataType, field, rendered, msg, now)
+		}
+		for _, field := range spec.Gauges {
+			s.set(metricName(row.DataType, field), "gauge", row.DataType, field, rendered, msg, now)
+		}
+	}
+}
+
+func (s *Store) set(name, typ, dataType, field, labels string, msg map[string]interface{}, now time.Time) {
+	v, ok := transform.MetricValue(msg[field])
+	if !ok {
+		return
+	}
+	f := s.families[name]
+	if f == nil {
+		f = &family{
+			help:   fmt.Sprintf("Field %s of %s rows.", field, dataType),
+			typ:    typ,
+			series: map[string]*sample{},
+		}
+		s.families[name] = f
+	}
+	f.series[labels] = &sample{labels: labels, value: v, updated: now}
+}
+
+// ServeHTTP writes every live series in the text exposition format.
+func (s *Store) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	Handler(s).ServeHTTP(w, r)
+}
+
+// WriteMetrics writes every live series, dropping the expired ones.
+func (s *Store) WriteMetrics(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cutoff time.Time
+	if s.expireAfter > 0 {
+		cutoff = s.now().Add(-s.expireAfter)
+	}
+
+	names := make([]string, 0, len(s.families))
+	for name, f := range s.families {
+		for key, smp := range f.series {
+			if smp.updated.Before(cutoff) {
+				delete(f.series, key)
+			}
+		}
+		if len(f.series) == 0 {
+			delete(s.families, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := s.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.typ)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			smp := f.series[key]
+			fmt.Fprintf(w, "%s{%s} %s\n", name, smp.labels, formatValue(smp.value))
+		}
+	}
+}
+
+// metricName builds gnmi_<data_type>_<field>.
+func metricName(dataType, field string) string {
+	return "gnmi_" + Sanitize(dataType) + "_" + Sanitize(field)
+}
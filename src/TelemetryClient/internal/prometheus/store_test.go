@@ -0,0 +1,100 @@
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/transform"
+)
+
+func scrape(t *testing.T, s *Store) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != contentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestStoreExposesDeclaredFields(t *testing.T) {
+	s := NewStore(0)
+	s.Update("tor-1", "InterfaceCounter_CL", []transform.CommonFields{
+		transform.NewCommonFields("interface_counters", map[string]interface{}{
+			"interface_name":   "Eth1/1",
+			"interface_type":   "ethernet",
+			"in_octets":        int64(1000),
+			"out_octets":       int64(2000),
+			"has_ingress_data": true, // Not declared, not exported
+		}, 0),
+	})
+	s.Update("tor-1", "EnvTemperature_CL", []transform.CommonFields{
+		transform.NewCommonFields("environment_temperature", map[string]interface{}{
+			"module":       "1",
+			"sensor":       `FRONT "A"`,
+			"current_temp": "41.5",
+			"status":       "Ok",
+		}, 0),
+	})
+
+	out := scrape(t, s)
+	for _, want := range []string{
+		"# TYPE gnmi_interface_counters_in_octets_total counter\n",
+		`gnmi_interface_counters_in_octets_total{hostname="tor-1",table="InterfaceCounter_CL",interface_name="Eth1/1",interface_type="ethernet"} 1000` + "\n",
+		"# TYPE gnmi_environment_temperature_current_temp gauge\n",
+		`gnmi_environment_temperature_current_temp{hostname="tor-1",table="EnvTemperature_CL",module="1",sensor="FRONT \"A\""} 41.5` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("scrape missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "has_ingress_data") || strings.Contains(out, "status") {
+		t.Errorf("undeclared fields exported:\n%s", out)
+	}
+	// Empty thresholds are not numbers and produce no sample.
+	if strings.Contains(out, "high_threshold") {
+		t.Errorf("missing value exported:\n%s", out)
+	}
+}
+
+func TestStoreReplacesAndExpires(t *testing.T) {
+	now := time.Now()
+	s := NewStore(10 * time.Minute)
+	s.now = func() time.Time { return now }
+	row := func(name string, v int64) transform.CommonFields {
+		return transform.NewCommonFields("route_summary", map[string]interface{}{"vrf": name, "route_total": v}, 0)
+	}
+
+	s.Update("tor-1", "Route_CL", []transform.CommonFields{row("default", 10), row("mgmt", 3)})
+	now = now.Add(6 * time.Minute)
+	s.Update("tor-1", "Route_CL", []transform.CommonFields{row("default", 12)})
+
+	out := scrape(t, s)
+	if !strings.Contains(out, `vrf="default"} 12`) || !strings.Contains(out, `vrf="mgmt"} 3`) {
+		t.Errorf("want latest default and still-fresh mgmt:\n%s", out)
+	}
+
+	now = now.Add(6 * time.Minute)
+	out = scrape(t, s)
+	if strings.Contains(out, `vrf="mgmt"`) || !strings.Contains(out, `vrf="default"} 12`) {
+		t.Errorf("want mgmt expired:\n%s", out)
+	}
+
+	now = now.Add(time.Hour)
+	if out := scrape(t, s); out != "" {
+		t.Errorf("want empty scrape after everything expired, got:\n%s", out)
+	}
+}
+
+func TestStoreDefaultsHostname(t *testing.T) {
+	s := NewStore(0)
+	s.hostname = "collector-host"
+	s.Update("", "Route_CL", []transform.CommonFields{
+		transform.NewCommonFields("route_summary", map[string]interface{}{"vrf": "default", "route_total": 1}, 0),
+	})
+	if out := scrape(t, s); !strings.Contains(out, `hostname="collector-host"`) {
+		t.Errorf("want collector hostname label:\n%s", out)
+	}
+}
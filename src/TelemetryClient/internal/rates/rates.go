@@ -0,0 +1,290 @@
+// Package rates turns cumulative counters into per-interval deltas and
+// rates. A Tracker keeps the previous sample of every counter of one
+// target and, for each new row, adds <counter>_delta and
+// <counter>_per_sec fields next to the raw value. Interface counter rows
+// additionally get in/out bits per second and utilization against the
+// link speed learned from interface_ethernet rows.
+//
+// Which fields are counters, and which fields identify the entity a row
+// describes, comes from the data type's transform.MetricSpec.
+package rates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gnmi-collector/internal/transform"
+)
+
+// DefaultDataTypes are the data types processed when none are configured.
+var DefaultDataTypes = []string{"interface_counters", "interface_error_counters"}
+
+const (
+	// A sample not refreshed for this long (a removed interface) is
+	// dropped when the state is saved.
+	sampleTTL = 24 * time.Hour
+
+	// A decrease is read as a 64-bit wrap only when the wrapped delta is
+	// below this; anything larger is a counter reset.
+	maxWrapDelta = 1 << 62
+)
+
+// Tracker holds the last sample of every counter of one target. It is
+// safe for concurrent use. A nil *Tracker leaves rows untouched.
+type Tracker struct {
+	path      string
+	dataTypes map[string]bool
+
+	mu    sync.Mutex
+	state state
+	dirty bool
+}
+
+// state is the persisted form of a Tracker.
+type state struct {
+	BootTime time.Time          `json:"boot_time,omitzero"` // Device boot, from system_uptime rows
+	Samples  map[string]sample  `json:"samples"`            // Keyed by data type, entity and counter
+	Speeds   map[string]float64 `json:"speeds,omitempty"`   // Link speed in bits/s, by interface
+}
+
+type sample struct {
+	Value uint64    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// NewTracker creates a tracker for the given data types (DefaultDataTypes
+// when empty). With a non-empty path the previous samples are loaded from
+// it, so deltas continue across collector restarts; a missing file is
+// not an error.
+func NewTracker(path string, dataTypes []string) (*Tracker, error) {
+	if len(dataTypes) == 0 {
+		dataTypes = DefaultDataTypes
+	}
+	t := &Tracker{
+		path:      path,
+		dataTypes: map[string]bool{},
+		state:     state{Samples: map[string]sample{}, Speeds: map[string]float64{}},
+	}
+	for _, dt := range dataTypes {
+		t.dataTypes[dt] = true
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read rate state: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		return nil, fmt.Errorf("parse rate state %s: %w", path, err)
+	}
+	if t.state.Samples == nil {
+		t.state.Samples = map[string]sample{}
+	}
+	if t.state.Speeds == nil {
+		t.state.Speeds = map[string]float64{}
+	}
+	return t, nil
+}
+
+// Apply adds delta and rate fields to the counter rows in place. Boot
+// time and link speed rows are read first, so a reboot or speed change
+// reported in the same batch already applies to its counters. The first
+// sample of a counter, and the first one after a reset or reboot, only
+// sets the baseline and gets no delta.
+func (t *Tracker) Apply(rows []transform.CommonFields) {
+	if t == nil || len(rows) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, row := range rows {
+		msg, ok := row.Message.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch row.DataType {
+		case "system_uptime":
+			if boot, err := time.Parse(time.RFC3339, transform.GetString(msg, "system_start_time")); err == nil {
+				t.state.BootTime = boot
+				t.dirty = true
+			}
+		case "interface_ethernet":
+			if bps := parseSpeed(transform.GetString(msg, "speed")); bps > 0 {
+				t.state.Speeds[transform.GetString(msg, "interface_name")] = bps
+				t.dirty = true
+			}
+		}
+	}
+
+	for _, row := range rows {
+		if !t.dataTypes[row.DataType] {
+			continue
+		}
+		msg, ok := row.Message.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		spec, ok := transform.MetricsFor(row.DataType)
+		if !ok || len(spec.Counters) == 0 {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339Nano, row.Timestamp)
+		if err != nil {
+			continue
+		}
+		t.applyRow(row.DataType, spec, msg, at)
+	}
+}
+
+func (t *Tracker) applyRow(dataType string, spec transform.MetricSpec, msg map[string]interface{}, at time.Time) {
+	entity := make([]string, len(spec.Labels))
+	for i, label := range spec.Labels {
+		entity[i] = transform.GetString(msg, label)
+	}
+	prefix := dataType + "|" + strings.Join(entity, "|") + "|"
+
+	perSec := map[string]float64{}
+	for _, field := range spec.Counters {
+		cur, ok := counterValue(msg[field])
+		if !ok {
+			continue
+		}
+		key := prefix + field
+		prev, seen := t.state.Samples[key]
+		t.state.Samples[key] = sample{Value: cur, Time: at}
+		t.dirty = true
+
+		// Samples from before the last boot belong to counters that
+		// have since restarted from zero.
+		if !seen || !at.After(prev.Time) || prev.Time.Before(t.state.BootTime) {
+			continue
+		}
+		delta, ok := counterDelta(prev.Value, cur)
+		if !ok {
+			continue
+		}
+		rate := float64(delta) / at.Sub(prev.Time).Seconds()
+		msg[field+"_delta"] = delta
+		msg[field+"_per_sec"] = rate
+		perSec[field] = rate
+	}
+
+	if dataType != "interface_counters" {
+		return
+	}
+	speed := t.state.Speeds[transform.GetString(msg, "interface_name")]
+	for _, dir := range []string{"in", "out"} {
+		rate, ok := perSec[dir+"_octets"]
+		if !ok {
+			continue
+		}
+		bps := rate * 8
+		msg[dir+"_bps"] = bps
+		if speed > 0 {
+			msg[dir+"_utilization_pct"] = math.Round(bps/speed*100*100) / 100
+		}
+	}
+}
+
+// Save writes the current samples to the state file, dropping samples
+// that have not been refreshed for a day. It is a no-op without a state
+// file or when nothing changed since the last save.
+func (t *Tracker) Save() error {
+	if t == nil || t.path == "" {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-sampleTTL)
+	for key, s := range t.state.Samples {
+		if s.Time.Before(cutoff) {
+			delete(t.state.Samples, key)
+		}
+	}
+	data, err := json.Marshal(t.state)
+	if err != nil {
+		return fmt.Errorf("encode rate state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return fmt.Errorf("create rate state dir: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write rate state: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("write rate state: %w", err)
+	}
+	t.dirty = false
+	return nil
+}
+
+// counterDelta returns cur-prev, treating a decrease as a 64-bit wrap
+// when the wrapped distance is plausible and as a reset otherwise.
+func counterDelta(prev, cur uint64) (uint64, bool) {
+	if cur >= prev {
+		return cur - prev, true
+	}
+	if wrapped := cur + (math.MaxUint64 - prev) + 1; wrapped < maxWrapDelta {
+		return wrapped, true
+	}
+	return 0, false
+}
+
+// counterValue reads a counter field as the unsigned 64-bit value the
+// device reported. Transformers store counters as int64, so values past
+// 2^63 arrive negative and are reinterpreted rather than rejected.
+func counterValue(v interface{}) (uint64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return uint64(n), true
+	case int:
+		return uint64(n), true
+	case uint64:
+		return n, true
+	case float64:
+		if n < 0 {
+			return 0, false
+		}
+		return uint64(n), true
+	case string:
+		u, err := strconv.ParseUint(n, 10, 64)
+		return u, err == nil
+	}
+	return 0, false
+}
+
+// parseSpeed converts a normalized interface_ethernet speed ("10M",
+// "100G", "400G") to bits per second. Unknown values return 0.
+func parseSpeed(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	unit := map[byte]float64{'M': 1e6, 'G': 1e9, 'T': 1e12}[s[len(s)-1]]
+	if unit == 0 {
+		return 0
+	}
+	n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return n * unit
+}
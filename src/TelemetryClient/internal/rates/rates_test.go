@@ -0,0 +1,157 @@
+package rates
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gnmi-collector/internal/transform"
+)
+
+var t0 = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func counterRow(at time.Time, iface string, inOctets, outOctets int64) transform.CommonFields {
+	return transform.CommonFields{
+		DataType:  "interface_counters",
+		Timestamp: at.Format(time.RFC3339Nano),
+		Message: map[string]interface{}{
+			"interface_name": iface,
+			"interface_type": "ethernet",
+			"in_octets":      inOctets,
+			"out_octets":     outOctets,
+		},
+	}
+}
+
+func speedRow(iface, speed string) transform.CommonFields {
+	return transform.CommonFields{
+		DataType:  "interface_ethernet",
+		Timestamp: t0.Format(time.RFC3339Nano),
+		Message:   map[string]interface{}{"interface_name": iface, "speed": speed},
+	}
+}
+
+func bootRow(boot time.Time) transform.CommonFields {
+	return transform.CommonFields{
+		DataType:  "system_uptime",
+		Timestamp: t0.Format(time.RFC3339Nano),
+		Message:   map[string]interface{}{"system_start_time": boot.Format(time.RFC3339)},
+	}
+}
+
+func msgOf(row transform.CommonFields) map[string]interface{} {
+	return row.Message.(map[string]interface{})
+}
+
+func TestApplyDeltaAndRate(t *testing.T) {
+	tr, _ := NewTracker("", nil)
+
+	first := counterRow(t0, "Ethernet1/1", 1000, 5000)
+	tr.Apply([]transform.CommonFields{speedRow("Ethernet1/1", "10G"), first})
+	if _, ok := msgOf(first)["in_octets_delta"]; ok {
+		t.Fatal("first sample should only set the baseline")
+	}
+
+	second := counterRow(t0.Add(10*time.Second), "Ethernet1/1", 1000+125_000_000, 5000)
+	tr.Apply([]transform.CommonFields{second})
+	msg := msgOf(second)
+	if msg["in_octets_delta"] != uint64(125_000_000) {
+		t.Errorf("in_octets_delta = %v", msg["in_octets_delta"])
+	}
+	if msg["in_octets_per_sec"] != 12_500_000.0 {
+		t.Errorf("in_octets_per_sec = %v", msg["in_octets_per_sec"])
+	}
+	if msg["in_bps"] != 100e6 {
+		t.Errorf("in_bps = %v", msg["in_bps"])
+	}
+	if msg["in_utilization_pct"] != 1.0 {
+		t.Errorf("in_utilization_pct = %v, want 1 (100 Mb/s of 10G)", msg["in_utilization_pct"])
+	}
+	if msg["out_octets_delta"] != uint64(0) || msg["out_utilization_pct"] != 0.0 {
+		t.Errorf("idle direction: delta=%v util=%v", msg["out_octets_delta"], msg["out_utilization_pct"])
+	}
+}
+
+func TestApplyWrapAndReset(t *testing.T) {
+	tr, _ := NewTracker("", nil)
+	var u uint64 = math.MaxUint64 - 99
+	nearMax := int64(u) // Transformers store counters as int64, so this is negative
+	tr.Apply([]transform.CommonFields{counterRow(t0, "Ethernet1/1", nearMax, 1_000_000)})
+
+	row := counterRow(t0.Add(time.Second), "Ethernet1/1", 50, 10)
+	tr.Apply([]transform.CommonFields{row})
+	msg := msgOf(row)
+	if msg["in_octets_delta"] != uint64(150) {
+		t.Errorf("wrapped in_octets_delta = %v, want 150", msg["in_octets_delta"])
+	}
+	if _, ok := msg["out_octets_delta"]; ok {
+		t.Errorf("reset out_octets should get no delta, got %v", msg["out_octets_delta"])
+	}
+
+	// The reset sample becomes the new baseline.
+	row = counterRow(t0.Add(2*time.Second), "Ethernet1/1", 60, 30)
+	tr.Apply([]transform.CommonFields{row})
+	if msgOf(row)["out_octets_delta"] != uint64(20) {
+		t.Errorf("after reset out_octets_delta = %v, want 20", msgOf(row)["out_octets_delta"])
+	}
+}
+
+func TestApplyReboot(t *testing.T) {
+	tr, _ := NewTracker("", nil)
+	tr.Apply([]transform.CommonFields{counterRow(t0, "Ethernet1/1", 1000, 1000)})
+
+	// The switch rebooted and the counters already grew past the old
+	// value; the boot time in the same batch invalidates the baseline.
+	row := counterRow(t0.Add(time.Hour), "Ethernet1/1", 5000, 5000)
+	tr.Apply([]transform.CommonFields{bootRow(t0.Add(30 * time.Minute)), row})
+	if _, ok := msgOf(row)["in_octets_delta"]; ok {
+		t.Errorf("sample after reboot should only set the baseline, got %v", msgOf(row))
+	}
+}
+
+func TestSaveAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tor-1", "rates.json")
+	tr, err := NewTracker(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	tr.Apply([]transform.CommonFields{speedRow("Ethernet1/1", "100G"), counterRow(now, "Ethernet1/1", 1000, 0)})
+	if err := tr.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := NewTracker(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := counterRow(now.Add(time.Minute), "Ethernet1/1", 7000, 0)
+	restarted.Apply([]transform.CommonFields{row})
+	msg := msgOf(row)
+	if msg["in_octets_delta"] != uint64(6000) || msg["in_octets_per_sec"] != 100.0 {
+		t.Errorf("after restart: delta=%v per_sec=%v", msg["in_octets_delta"], msg["in_octets_per_sec"])
+	}
+	if _, ok := msg["in_utilization_pct"]; !ok {
+		t.Error("link speed was not persisted")
+	}
+}
+
+func TestApplyIgnoresOtherDataTypes(t *testing.T) {
+	tr, _ := NewTracker("", []string{"interface_error_counters"})
+	for _, at := range []time.Time{t0, t0.Add(time.Minute)} {
+		row := counterRow(at, "Ethernet1/1", at.Unix(), 0)
+		tr.Apply([]transform.CommonFields{row})
+		if _, ok := msgOf(row)["in_octets_delta"]; ok {
+			t.Fatalf("interface_counters processed although not configured")
+		}
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	for in, want := range map[string]float64{"10M": 10e6, "25G": 25e9, "400G": 400e9, "UNKNOWN": 0, "": 0} {
+		if got := parseSpeed(in); got != want {
+			t.Errorf("parseSpeed(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
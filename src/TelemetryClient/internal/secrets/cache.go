@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// minRetryDelay is how long a secret whose lookup failed waits before
+// the store is asked again; the delay doubles with each further failure
+// up to the refresh interval.
+const minRetryDelay = 5 * time.Second
+
+// Cache wraps a provider and reuses each secret for the refresh
+// interval before asking the store again, so a rotated secret takes
+// effect within one interval. A lookup that fails once a value is known
+// keeps serving that value, so a briefly unreachable store does not
+// break a running collector. The store is asked for one secret at a
+// time, outside the lock, and not again until a failed lookup's retry
+// delay has passed.
+type Cache struct {
+	provider CredentialProvider
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	value    string
+	known    bool          // value came from a successful lookup
+	err      error         // Error of the last lookup while no value is known
+	next     time.Time     // When the store is asked again
+	failures int           // Consecutive failed lookups
+	pending  chan struct{} // Closed when the lookup in flight ends
+}
+
+// NewCache caches p's secrets for interval.
+func NewCache(p CredentialProvider, interval time.Duration) *Cache {
+	return &Cache{
+		provider: p,
+		interval: interval,
+		now:      time.Now,
+		entries:  map[string]*cacheEntry{},
+	}
+}
+
+func (c *Cache) Get(name string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	if !ok {
+		entry = &cacheEntry{}
+		c.entries[name] = entry
+	}
+	// Without a value to serve, wait for a lookup already in flight.
+	for entry.pending != nil && !entry.known {
+		pending := entry.pending
+		c.mu.Unlock()
+		<-pending
+		c.mu.Lock()
+	}
+	if entry.pending != nil || c.now().Before(entry.next) {
+		value, err := entry.value, entry.err
+		c.mu.Unlock()
+		return value, err
+	}
+	pending := make(chan struct{})
+	entry.pending = pending
+	c.mu.Unlock()
+
+	value, err := c.provider.Get(name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.pending = nil
+	close(pending)
+	if err != nil {
+		entry.failures++
+		delay := c.retryDelay(entry.failures)
+		entry.next = c.now().Add(delay)
+		if entry.known {
+			log.Printf("WARN: refreshing secret %s failed, keeping the previous value and retrying in %s: %v", name, delay, err)
+			return entry.value, nil
+		}
+		entry.err = err
+		return "", err
+	}
+	if entry.known && value != entry.value {
+		log.Printf("INFO: secret %s changed, using the new value", name)
+	}
+	entry.value, entry.known, entry.err, entry.failures = value, true, nil, 0
+	entry.next = c.now().Add(c.interval)
+	return value, nil
+}
+
+// retryDelay returns the wait after the given number of consecutive
+// failed lookups.
+func (c *Cache) retryDelay(failures int) time.Duration {
+	delay := minRetryDelay
+	for i := 1; i < failures && delay < c.interval; i++ {
+		delay *= 2
+	}
+	return min(delay, c.interval)
+}
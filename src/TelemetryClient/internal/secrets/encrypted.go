@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EncryptedFile reads secrets from a JSON object of name/value pairs
+// encrypted with AES-256-GCM, keyed by the SHA-256 of a host key file
+// that only the collector's host holds. The file is the base64 of the
+// nonce followed by the ciphertext, as written by Encrypt.
+type EncryptedFile struct {
+	Path        string
+	HostKeyFile string
+}
+
+func (e *EncryptedFile) Get(name string) (string, error) {
+	key, err := e.hostKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(e.Path)
+	if err != nil {
+		return "", fmt.Errorf("reading encrypted secrets %s: %w", e.Path, err)
+	}
+	plain, err := decrypt(key, data)
+	if err != nil {
+		return "", fmt.Errorf("decrypting %s: %w", e.Path, err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(plain, &values); err != nil {
+		return "", fmt.Errorf("%s: secrets must be a JSON object of strings: %w", e.Path, err)
+	}
+	return values[name], nil
+}
+
+// hostKey reads the host key file, which must be private to its owner.
+func (e *EncryptedFile) hostKey() ([]byte, error) {
+	if err := checkPrivate(e.HostKeyFile); err != nil {
+		return nil, fmt.Errorf("host key: %w", err)
+	}
+	key, err := os.ReadFile(e.HostKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading host key: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("host key %s is empty", e.HostKeyFile)
+	}
+	return key, nil
+}
+
+// Encrypt encrypts plaintext for an EncryptedFile with the given host
+// key.
+func Encrypt(hostKey, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func decrypt(hostKey, data []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not base64: %w", err)
+	}
+	aead, err := newAEAD(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("file is too short")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("wrong host key or corrupted file")
+	}
+	return plain, nil
+}
+
+func newAEAD(hostKey []byte) (cipher.AEAD, error) {
+	key := sha256.Sum256(hostKey)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
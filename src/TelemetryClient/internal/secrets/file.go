@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dir reads each secret from the file of the same name in a directory,
+// with trailing newlines removed. A missing file means the secret is
+// not set.
+type Dir struct {
+	Path string
+	// CheckPermissions rejects files that are not regular files or that
+	// group or others can access.
+	CheckPermissions bool
+}
+
+func (d *Dir) Get(name string) (string, error) {
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	path := filepath.Join(d.Path, name)
+	if d.CheckPermissions {
+		if err := checkPrivate(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return "", nil
+			}
+			return "", err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", name, err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// checkPrivate fails unless path is a regular file only its owner can
+// access.
+func checkPrivate(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("%s has permissions %04o — restrict it to its owner (chmod 600)", path, perm)
+	}
+	return nil
+}
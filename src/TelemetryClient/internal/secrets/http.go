@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// keyVaultAPIVersion is the api-version sent with every request.
+const keyVaultAPIVersion = "7.4"
+
+// HTTP reads secrets from a REST endpoint in the style of Azure Key
+// Vault: GET <url>/secrets/<name>?api-version=7.4 answering
+// {"value": "..."}. Key Vault names allow only letters, digits and
+// dashes, so underscores in names are sent as dashes. A 404 means the
+// secret is not set.
+type HTTP struct {
+	URL        string
+	Tokens     TokenSource // Bearer token source; none is sent when nil
+	httpClient *http.Client
+}
+
+// TokenSource supplies the bearer token of the http provider. It is
+// asked on every request, so it can renew a token that expires.
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// EnvToken reads the bearer token from the named environment variable
+// on every request, so an updated token is picked up.
+type EnvToken string
+
+func (e EnvToken) Token(context.Context) (string, error) {
+	return os.Getenv(string(e)), nil
+}
+
+// NewHTTP returns a provider for the secret endpoint at baseURL.
+func NewHTTP(baseURL string, tokens TokenSource) *HTTP {
+	return &HTTP{
+		URL:        strings.TrimRight(baseURL, "/"),
+		Tokens:     tokens,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *HTTP) Get(name string) (string, error) {
+	secretName := strings.ReplaceAll(name, "_", "-")
+	status, body, err := h.fetch(secretName)
+	if err == nil && status == http.StatusUnauthorized && h.Tokens != nil {
+		// The token may have expired: drop a cached one and retry once.
+		if inv, ok := h.Tokens.(interface{ Invalidate() }); ok {
+			inv.Invalidate()
+		}
+		status, body, err = h.fetch(secretName)
+	}
+	if err != nil {
+		return "", err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("secret endpoint returned %d for %s: %s", status, secretName, string(body))
+	}
+
+	var secret struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("decoding secret %s: %w", secretName, err)
+	}
+	return secret.Value, nil
+}
+
+// fetch requests one secret and returns the status code and body.
+func (h *HTTP) fetch(secretName string) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.httpClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", h.URL+"/secrets/"+url.PathEscape(secretName)+"?api-version="+keyVaultAPIVersion, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("creating secret request: %w", err)
+	}
+	if h.Tokens != nil {
+		token, err := h.Tokens.Token(ctx)
+		if err != nil {
+			return 0, nil, fmt.Errorf("secret endpoint token: %w", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("secret request for %s: %w", secretName, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return resp.StatusCode, body, nil
+}
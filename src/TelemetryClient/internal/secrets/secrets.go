@@ -0,0 +1,79 @@
+// Package secrets looks up the collector's credentials — gNMI
+// username and password, Log Analytics workspace keys, service
+// principal secrets — by name from a configurable store, and re-reads
+// them periodically so rotated values take effect without a restart.
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultRefreshInterval is how long a looked-up secret is reused
+// before the store is asked again.
+const DefaultRefreshInterval = 5 * time.Minute
+
+// CredentialProvider looks up secrets by name. A secret that is not set
+// returns "" and no error.
+type CredentialProvider interface {
+	Get(name string) (string, error)
+}
+
+// Options selects and configures a provider.
+type Options struct {
+	Provider        string      // env (default), file, systemd, encrypted_file or http
+	Dir             string      // file: directory with one file per secret
+	File            string      // encrypted_file: the encrypted secrets file
+	HostKeyFile     string      // encrypted_file: key the file is encrypted with
+	URL             string      // http: base URL of the secret endpoint
+	Tokens          TokenSource // http: bearer tokens, if the endpoint needs them
+	RefreshInterval time.Duration
+}
+
+// New returns the provider described by opts. Providers backed by a
+// store that can change while the collector runs are wrapped in a
+// Cache that re-reads each secret every refresh interval.
+func New(opts Options) (CredentialProvider, error) {
+	var p CredentialProvider
+	switch opts.Provider {
+	case "", "env":
+		return Env{}, nil
+	case "file":
+		if opts.Dir == "" {
+			return nil, fmt.Errorf("file provider requires dir")
+		}
+		p = &Dir{Path: opts.Dir, CheckPermissions: true}
+	case "systemd":
+		dir := os.Getenv("CREDENTIALS_DIRECTORY")
+		if dir == "" {
+			return nil, fmt.Errorf("systemd provider requires $CREDENTIALS_DIRECTORY — set LoadCredential= in the unit")
+		}
+		// systemd restricts the directory to the service itself.
+		p = &Dir{Path: dir}
+	case "encrypted_file":
+		if opts.File == "" || opts.HostKeyFile == "" {
+			return nil, fmt.Errorf("encrypted_file provider requires file and host_key_file")
+		}
+		p = &EncryptedFile{Path: opts.File, HostKeyFile: opts.HostKeyFile}
+	case "http":
+		if opts.URL == "" {
+			return nil, fmt.Errorf("http provider requires url")
+		}
+		p = NewHTTP(opts.URL, opts.Tokens)
+	default:
+		return nil, fmt.Errorf("unknown provider %q (supported: env, file, systemd, encrypted_file, http)", opts.Provider)
+	}
+	interval := opts.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+	return NewCache(p, interval), nil
+}
+
+// Env reads secrets from environment variables of the same name.
+type Env struct{}
+
+func (Env) Get(name string) (string, error) {
+	return os.Getenv(name), nil
+}
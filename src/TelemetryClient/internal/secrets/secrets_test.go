@@ -0,0 +1,306 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "GNMI_PASS"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "OPEN"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := &Dir{Path: dir, CheckPermissions: true}
+
+	if v, err := d.Get("GNMI_PASS"); err != nil || v != "s3cret" {
+		t.Errorf("Get(GNMI_PASS) = %q, %v; want s3cret", v, err)
+	}
+	if v, err := d.Get("MISSING"); err != nil || v != "" {
+		t.Errorf("Get(MISSING) = %q, %v; want unset", v, err)
+	}
+	if _, err := d.Get("OPEN"); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+		t.Errorf("Get(OPEN) error = %v, want a permissions error", err)
+	}
+	if _, err := d.Get("../GNMI_PASS"); err == nil {
+		t.Error("a name with a path should be rejected")
+	}
+	// Without the check (systemd) the mode is left to the service manager.
+	d.CheckPermissions = false
+	if v, err := d.Get("OPEN"); err != nil || v != "x" {
+		t.Errorf("unchecked Get(OPEN) = %q, %v", v, err)
+	}
+}
+
+func TestNewSystemd(t *testing.T) {
+	t.Setenv("CREDENTIALS_DIRECTORY", "")
+	if _, err := New(Options{Provider: "systemd"}); err == nil {
+		t.Error("systemd provider without $CREDENTIALS_DIRECTORY should fail")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "LA_KEY"), []byte("key"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	p, err := New(Options{Provider: "systemd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.Get("LA_KEY"); err != nil || v != "key" {
+		t.Errorf("Get(LA_KEY) = %q, %v; want key", v, err)
+	}
+}
+
+func TestEncryptedFile(t *testing.T) {
+	dir := t.TempDir()
+	hostKey := filepath.Join(dir, "host.key")
+	if err := os.WriteFile(hostKey, []byte("0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Encrypt([]byte("0123456789abcdef"), []byte(`{"GNMI_PASS":"s3cret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "secrets.enc")
+	if err := os.WriteFile(file, sealed, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &EncryptedFile{Path: file, HostKeyFile: hostKey}
+	if v, err := e.Get("GNMI_PASS"); err != nil || v != "s3cret" {
+		t.Errorf("Get(GNMI_PASS) = %q, %v; want s3cret", v, err)
+	}
+	if v, err := e.Get("GNMI_USER"); err != nil || v != "" {
+		t.Errorf("Get(GNMI_USER) = %q, %v; want unset", v, err)
+	}
+
+	if err := os.WriteFile(hostKey, []byte("another host key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Get("GNMI_PASS"); err == nil || !strings.Contains(err.Error(), "wrong host key") {
+		t.Errorf("error with the wrong key = %v", err)
+	}
+	if err := os.Chmod(hostKey, 0640); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Get("GNMI_PASS"); err == nil || !strings.Contains(err.Error(), "host key") {
+		t.Errorf("error with a readable host key = %v", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("api-version") != keyVaultAPIVersion {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/secrets/LA-PRIMARY-KEY":
+			w.Write([]byte(`{"value":"pk","id":"https://vault/secrets/LA-PRIMARY-KEY/1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("VAULT_TOKEN", "tok")
+	h := NewHTTP(srv.URL+"/", EnvToken("VAULT_TOKEN"))
+	if v, err := h.Get("LA_PRIMARY_KEY"); err != nil || v != "pk" {
+		t.Errorf("Get(LA_PRIMARY_KEY) = %q, %v; want pk", v, err)
+	}
+	if v, err := h.Get("LA_SECONDARY_KEY"); err != nil || v != "" {
+		t.Errorf("Get(LA_SECONDARY_KEY) = %q, %v; want unset", v, err)
+	}
+	t.Setenv("VAULT_TOKEN", "expired")
+	if _, err := h.Get("LA_PRIMARY_KEY"); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("error without a valid token = %v", err)
+	}
+	// The token is re-read on every request.
+	t.Setenv("VAULT_TOKEN", "tok")
+	if v, err := h.Get("LA_PRIMARY_KEY"); err != nil || v != "pk" {
+		t.Errorf("Get after the token was updated = %q, %v; want pk", v, err)
+	}
+
+	// A cached token rejected with 401 is dropped and the request retried.
+	tokens := &cachedToken{tokens: []string{"expired", "tok"}}
+	h = NewHTTP(srv.URL, tokens)
+	if v, err := h.Get("LA_PRIMARY_KEY"); err != nil || v != "pk" || tokens.invalidated != 1 {
+		t.Errorf("Get with an expired cached token = %q, %v after %d invalidations; want pk after 1", v, err, tokens.invalidated)
+	}
+}
+
+// cachedToken hands out tokens in turn, moving to the next one only
+// when invalidated.
+type cachedToken struct {
+	tokens      []string
+	invalidated int
+}
+
+func (c *cachedToken) Token(context.Context) (string, error) {
+	return c.tokens[c.invalidated], nil
+}
+
+func (c *cachedToken) Invalidate() { c.invalidated++ }
+
+type countingProvider struct {
+	value string
+	err   error
+	calls int
+}
+
+func (p *countingProvider) Get(string) (string, error) {
+	p.calls++
+	return p.value, p.err
+}
+
+func TestCache(t *testing.T) {
+	p := &countingProvider{value: "v1"}
+	c := NewCache(p, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	get := func() string {
+		t.Helper()
+		v, err := c.Get("KEY")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	if v := get(); v != "v1" || p.calls != 1 {
+		t.Fatalf("first Get = %q after %d calls", v, p.calls)
+	}
+	p.value = "v2"
+	if v := get(); v != "v1" || p.calls != 1 {
+		t.Errorf("Get within the interval = %q after %d calls, want the cached v1", v, p.calls)
+	}
+	now = now.Add(time.Minute)
+	if v := get(); v != "v2" || p.calls != 2 {
+		t.Errorf("Get after the interval = %q after %d calls, want v2", v, p.calls)
+	}
+
+	// A failing store keeps serving the last value.
+	now = now.Add(time.Minute)
+	p.err = errors.New("store unreachable")
+	if v := get(); v != "v2" {
+		t.Errorf("Get with a failing store = %q, want the stale v2", v)
+	}
+	if _, err := c.Get("OTHER"); err == nil {
+		t.Error("a secret never fetched should surface the store error")
+	}
+
+	// Failed lookups are not retried before the retry delay, which
+	// doubles with each failure.
+	calls := p.calls
+	for _, delay := range []time.Duration{minRetryDelay, 2 * minRetryDelay} {
+		if v := get(); v != "v2" || p.calls != calls {
+			t.Errorf("Get within the retry delay = %q after %d calls, want the stale v2 from the cache", v, p.calls)
+		}
+		if _, err := c.Get("OTHER"); err == nil || p.calls != calls {
+			t.Errorf("Get(OTHER) within the retry delay = %v after %d calls, want the cached error", err, p.calls)
+		}
+		now = now.Add(delay)
+		get()
+		c.Get("OTHER")
+		if p.calls != calls+2 {
+			t.Errorf("after %s: %d calls, want a retry of each secret", delay, p.calls-calls)
+		}
+		calls = p.calls
+	}
+	p.err = nil
+	now = now.Add(4 * minRetryDelay)
+	if v := get(); v != "v2" {
+		t.Errorf("Get after the store recovered = %q", v)
+	}
+	if v, err := c.Get("OTHER"); err != nil || v != "v2" {
+		t.Errorf("Get(OTHER) after the store recovered = %q, %v", v, err)
+	}
+}
+
+// blockingProvider answers once release is closed.
+type blockingProvider struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (p *blockingProvider) Get(string) (string, error) {
+	p.calls.Add(1)
+	<-p.release
+	return "v", nil
+}
+
+func TestCacheSingleFlight(t *testing.T) {
+	p := &blockingProvider{release: make(chan struct{})}
+	c := NewCache(p, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var mu sync.Mutex
+	c.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	// Concurrent first lookups share one request to the store.
+	var wg sync.WaitGroup
+	values := make([]string, 5)
+	for i := range values {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], _ = c.Get("KEY")
+		}()
+	}
+	for p.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(p.release)
+	wg.Wait()
+	if p.calls.Load() != 1 {
+		t.Errorf("store asked %d times, want once", p.calls.Load())
+	}
+	for _, v := range values {
+		if v != "v" {
+			t.Errorf("values = %q, want v for every caller", values)
+			break
+		}
+	}
+
+	// While a refresh is in flight, other lookups get the known value
+	// without waiting for the store.
+	p.release = make(chan struct{})
+	mu.Lock()
+	now = now.Add(time.Minute)
+	mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		c.Get("KEY")
+		close(done)
+	}()
+	for p.calls.Load() == 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if v, err := c.Get("KEY"); v != "v" || err != nil {
+		t.Errorf("Get during a refresh = %q, %v; want the known value", v, err)
+	}
+	close(p.release)
+	<-done
+	if p.calls.Load() != 2 {
+		t.Errorf("store asked %d times, want one refresh", p.calls.Load())
+	}
+}
@@ -0,0 +1,53 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"gnmi-collector/internal/azure"
+	"gnmi-collector/internal/spool"
+	"gnmi-collector/internal/transform"
+)
+
+// Azure posts rows to Log Analytics through the HTTP Data Collector API.
+// The Logger is shared by every target, so Close leaves it open.
+//
+// With a spool, batches that fail with a retryable error are queued on
+// disk for the spool's drainer instead of being lost. While a backlog
+// exists new batches queue behind it, which keeps replay in order and
+// avoids hammering a workspace that is known to be unreachable.
+type Azure struct {
+	logger *azure.Logger
+	spool  *spool.Spool
+	id     Identity
+}
+
+// NewAzure creates a sink sending through logger. sp may be nil.
+func NewAzure(logger *azure.Logger, sp *spool.Spool, id Identity) *Azure {
+	return &Azure{logger: logger, spool: sp, id: id}
+}
+
+func (a *Azure) Write(_ context.Context, table string, rows []transform.CommonFields) error {
+	flat := FlattenAll(rows, a.id)
+	if a.spool == nil {
+		return a.logger.Send(table, flat)
+	}
+
+	if n := a.spool.Len(); n > 0 {
+		if err := a.spool.Enqueue(table, flat); err != nil {
+			return fmt.Errorf("spool: %w", err)
+		}
+		return fmt.Errorf("%w: queued behind %d spooled batches", ErrDeferred, n)
+	}
+
+	err := a.logger.Send(table, flat)
+	if err == nil || !azure.IsRetryable(err) {
+		return err
+	}
+	if serr := a.spool.Enqueue(table, flat); serr != nil {
+		return fmt.Errorf("%w (spool: %v)", err, serr)
+	}
+	return fmt.Errorf("%w: spooled after %v", ErrDeferred, err)
+}
+
+func (a *Azure) Close() error { return nil }
@@ -0,0 +1,40 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gnmi-collector/internal/transform"
+)
+
+// Directory writes each batch as a JSON array to <dir>/<table>.json,
+// replacing the previous batch for that table. These files can be sent
+// to Azure by the existing azure-logger script from the default VRF.
+type Directory struct {
+	dir string
+	id  Identity
+}
+
+// NewDirectory creates a sink writing into dir, created on first write.
+func NewDirectory(dir string, id Identity) *Directory {
+	return &Directory{dir: dir, id: id}
+}
+
+func (d *Directory) Write(_ context.Context, table string, rows []transform.CommonFields) error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(FlattenAll(rows, d.id))
+	if err != nil {
+		return fmt.Errorf("marshaling transformed data: %w", err)
+	}
+
+	path := filepath.Join(d.dir, table+".json")
+	return os.WriteFile(path, data, 0644)
+}
+
+func (d *Directory) Close() error { return nil }
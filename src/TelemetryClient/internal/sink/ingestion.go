@@ -0,0 +1,27 @@
+package sink
+
+import (
+	"context"
+
+	"gnmi-collector/internal/azure"
+	"gnmi-collector/internal/transform"
+)
+
+// Ingestion sends rows through the Azure Monitor Logs Ingestion API.
+// The client (and its token cache) is shared by every target, so Close
+// leaves it open.
+type Ingestion struct {
+	client *azure.IngestionClient
+	id     Identity
+}
+
+// NewIngestion creates a sink sending through client.
+func NewIngestion(client *azure.IngestionClient, id Identity) *Ingestion {
+	return &Ingestion{client: client, id: id}
+}
+
+func (s *Ingestion) Write(ctx context.Context, table string, rows []transform.CommonFields) error {
+	return s.client.Send(ctx, table, FlattenAll(rows, s.id))
+}
+
+func (s *Ingestion) Close() error { return nil }
@@ -0,0 +1,27 @@
+package sink
+
+import (
+	"context"
+
+	"gnmi-collector/internal/prometheus"
+	"gnmi-collector/internal/transform"
+)
+
+// Prometheus records the latest values in the store served on /metrics.
+// The store is shared by every target, so Close leaves it in place.
+type Prometheus struct {
+	store *prometheus.Store
+	id    Identity
+}
+
+// NewPrometheus creates a sink updating store.
+func NewPrometheus(store *prometheus.Store, id Identity) *Prometheus {
+	return &Prometheus{store: store, id: id}
+}
+
+func (p *Prometheus) Write(_ context.Context, table string, rows []transform.CommonFields) error {
+	p.store.Update(p.id.Hostname, table, rows)
+	return nil
+}
+
+func (p *Prometheus) Close() error { return nil }
@@ -0,0 +1,209 @@
+// Package sink defines the destinations transformed telemetry rows are
+// written to. The collector hands every merged batch to a single Sink;
+// the stdout, directory, Azure and Prometheus implementations, table
+// filtering and fan-out to several destinations all live behind that
+// interface, so a new destination doesn't touch the collection loop.
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"gnmi-collector/internal/azure"
+	"gnmi-collector/internal/config"
+	"gnmi-collector/internal/health"
+	"gnmi-collector/internal/prometheus"
+	"gnmi-collector/internal/spool"
+	"gnmi-collector/internal/transform"
+)
+
+// ErrDeferred marks a Write whose rows were not delivered yet but are
+// safely queued for a later retry (see the Azure sink's spool).
+var ErrDeferred = errors.New("delivery deferred")
+
+// Sink receives the transformed rows of one table at a time.
+type Sink interface {
+	Write(ctx context.Context, table string, rows []transform.CommonFields) error
+	Close() error
+}
+
+// Identity is the switch identity stamped into every row. An empty
+// Hostname leaves hostname to the Azure logger, which fills it with the
+// collector host's name; an empty DeviceType likewise leaves device_type
+// to the logger.
+type Identity struct {
+	Hostname   string
+	DeviceType string
+}
+
+// Env holds the shared resources sinks are built from.
+type Env struct {
+	Logger   *azure.Logger     // Required by azure sinks
+	Spool    *spool.Spool      // Optional retry queue for azure sinks
+	Metrics  *prometheus.Store // Required by prometheus sinks
+	Stats    *health.Target    // Records send latency and failures; may be nil
+	Identity Identity
+
+	// Ingestion holds the clients of logs_ingestion sinks, keyed by
+	// their config.
+	Ingestion map[*config.LogsIngestionConfig]*azure.IngestionClient
+}
+
+// New builds the sink described by sc, wrapped with its table filter.
+func New(sc config.SinkConfig, env Env) (Sink, error) {
+	var s Sink
+	switch sc.Type {
+	case "stdout":
+		s = NewStdout(env.Identity)
+	case "directory":
+		s = NewDirectory(sc.Dir, env.Identity)
+	case "azure":
+		if env.Logger == nil {
+			return nil, fmt.Errorf("azure sink requires Azure credentials")
+		}
+		s = NewAzure(env.Logger, env.Spool, env.Identity)
+	case "logs_ingestion":
+		client := env.Ingestion[sc.LogsIngestion]
+		if client == nil {
+			return nil, fmt.Errorf("logs_ingestion sink has no client")
+		}
+		s = NewIngestion(client, env.Identity)
+	case "prometheus":
+		if env.Metrics == nil {
+			return nil, fmt.Errorf("prometheus sink has no metrics store")
+		}
+		s = NewPrometheus(env.Metrics, env.Identity)
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", sc.Type)
+	}
+	if env.Stats != nil {
+		s = &instrumented{Sink: s, name: sc.Type, stats: env.Stats}
+	}
+	return Filter(s, sc.Type, sc.Include, sc.Exclude), nil
+}
+
+// instrumented records the latency and outcome of every write.
+type instrumented struct {
+	Sink
+	name  string
+	stats *health.Target
+}
+
+func (i *instrumented) Write(ctx context.Context, table string, rows []transform.CommonFields) error {
+	start := time.Now()
+	err := i.Sink.Write(ctx, table, rows)
+	i.stats.ObserveSend(i.name, time.Since(start), err)
+	return err
+}
+
+// Flatten converts an entry into a flat map suitable for Azure Log
+// Analytics ingestion. The Message map fields are promoted to the top
+// level so that LA does not prefix them with "message_", and the
+// non-empty identity fields are stamped as hostname/device_type.
+func Flatten(e transform.CommonFields, id Identity) map[string]interface{} {
+	flat := map[string]interface{}{
+		"data_type": e.DataType,
+		"timestamp": e.Timestamp,
+		"date":      e.Date,
+	}
+	if msg, ok := e.Message.(map[string]interface{}); ok {
+		for k, v := range msg {
+			flat[k] = v
+		}
+	} else if e.Message != nil {
+		flat["message"] = e.Message
+	}
+	if id.Hostname != "" {
+		flat["hostname"] = id.Hostname
+	}
+	if id.DeviceType != "" {
+		flat["device_type"] = id.DeviceType
+	}
+	return flat
+}
+
+// FlattenAll flattens every row with Flatten.
+func FlattenAll(rows []transform.CommonFields, id Identity) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(rows))
+	for _, e := range rows {
+		out = append(out, Flatten(e, id))
+	}
+	return out
+}
+
+// filtered restricts a sink to the tables matching its include/exclude
+// patterns and tags its errors with the sink type.
+type filtered struct {
+	Sink
+	name             string
+	include, exclude []string
+}
+
+// Filter wraps s so it only receives tables accepted by the include and
+// exclude patterns (path.Match syntax). Errors are prefixed with name.
+func Filter(s Sink, name string, include, exclude []string) Sink {
+	return &filtered{Sink: s, name: name, include: include, exclude: exclude}
+}
+
+func (f *filtered) Write(ctx context.Context, table string, rows []transform.CommonFields) error {
+	if !accepts(table, f.include, f.exclude) {
+		return nil
+	}
+	if err := f.Sink.Write(ctx, table, rows); err != nil {
+		return fmt.Errorf("%s sink: %w", f.name, err)
+	}
+	return nil
+}
+
+func accepts(table string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, table); ok {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if ok, _ := path.Match(pattern, table); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// multi writes to several sinks.
+type multi []Sink
+
+// Multi returns a sink that writes every batch to all of sinks. A failing
+// sink does not stop the others from receiving the batch; the returned
+// error joins the failures.
+func Multi(sinks ...Sink) Sink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return multi(sinks)
+}
+
+func (m multi) Write(ctx context.Context, table string, rows []transform.CommonFields) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Write(ctx, table, rows); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multi) Close() error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
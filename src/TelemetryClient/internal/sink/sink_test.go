@@ -0,0 +1,194 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gnmi-collector/internal/config"
+	"gnmi-collector/internal/health"
+	"gnmi-collector/internal/prometheus"
+	"gnmi-collector/internal/transform"
+)
+
+// recorder is a Sink that remembers the tables it was given.
+type recorder struct {
+	tables []string
+	err    error
+	closed bool
+}
+
+func (r *recorder) Write(_ context.Context, table string, _ []transform.CommonFields) error {
+	r.tables = append(r.tables, table)
+	return r.err
+}
+
+func (r *recorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+var testRows = []transform.CommonFields{{
+	DataType: "interface_counters",
+	Message:  map[string]interface{}{"interface_name": "Eth1/1"},
+}}
+
+func TestFlattenStampsIdentity(t *testing.T) {
+	if _, ok := Flatten(testRows[0], Identity{})["hostname"]; ok {
+		t.Error("empty identity should not stamp hostname")
+	}
+
+	flat := Flatten(testRows[0], Identity{Hostname: "tor-1", DeviceType: "sonic"})
+	if flat["hostname"] != "tor-1" {
+		t.Errorf("hostname = %v, want tor-1", flat["hostname"])
+	}
+	if flat["device_type"] != "sonic" {
+		t.Errorf("device_type = %v, want sonic", flat["device_type"])
+	}
+	if flat["interface_name"] != "Eth1/1" {
+		t.Errorf("message fields should be promoted, got %v", flat)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name             string
+		include, exclude []string
+		table            string
+		want             bool
+	}{
+		{"no patterns", nil, nil, "CiscoInterfaceCounter_CL", true},
+		{"include glob", []string{"Cisco*"}, nil, "CiscoInterfaceCounter_CL", true},
+		{"include miss", []string{"Cisco*"}, nil, "SonicBgp_CL", false},
+		{"exclude", nil, []string{"*Bgp*"}, "SonicBgp_CL", false},
+		{"exclude wins", []string{"Sonic*"}, []string{"SonicBgp_CL"}, "SonicBgp_CL", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &recorder{}
+			if err := Filter(rec, "test", tt.include, tt.exclude).Write(context.Background(), tt.table, testRows); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if got := len(rec.tables) == 1; got != tt.want {
+				t.Errorf("table %s delivered = %v, want %v", tt.table, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiWritesAllSinks(t *testing.T) {
+	failing := &recorder{err: errors.New("boom")}
+	ok := &recorder{}
+	m := Multi(Filter(failing, "azure", nil, nil), ok)
+
+	err := m.Write(context.Background(), "T_CL", testRows)
+	if err == nil || !strings.Contains(err.Error(), "azure sink: boom") {
+		t.Errorf("Write() error = %v, want the failing sink's error", err)
+	}
+	if len(ok.tables) != 1 {
+		t.Error("a failing sink must not stop delivery to the others")
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !failing.closed || !ok.closed {
+		t.Error("Close should close every sink")
+	}
+}
+
+func TestDirectoryWritesFlattenedRows(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out")
+	d := NewDirectory(dir, Identity{Hostname: "tor-1", DeviceType: "cisco-nx-os"})
+	if err := d.Write(context.Background(), "T_CL", testRows); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "T_CL.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(data, &rows); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["hostname"] != "tor-1" || rows[0]["interface_name"] != "Eth1/1" {
+		t.Errorf("rows = %v", rows)
+	}
+}
+
+func TestStdoutLabelsTarget(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewStdout(Identity{Hostname: "tor-1"})
+	s.w = &buf
+	if err := s.Write(context.Background(), "T_CL", testRows); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "[tor-1/T_CL] {") {
+		t.Errorf("output = %q, want [tor-1/T_CL] prefix", buf.String())
+	}
+}
+
+func TestNewRejectsAzureWithoutLogger(t *testing.T) {
+	if _, err := New(config.SinkConfig{Type: "azure"}, Env{}); err == nil {
+		t.Error("azure sink without a logger should fail")
+	}
+	if _, err := New(config.SinkConfig{Type: "stdout"}, Env{}); err != nil {
+		t.Errorf("stdout sink: %v", err)
+	}
+}
+
+func TestPrometheusSinkUpdatesStore(t *testing.T) {
+	store := prometheus.NewStore(0)
+	s, err := New(config.SinkConfig{Type: "prometheus", Include: []string{"Route*"}}, Env{
+		Metrics:  store,
+		Identity: Identity{Hostname: "tor-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []transform.CommonFields{{
+		DataType: "route_summary",
+		Message:  map[string]interface{}{"vrf": "default", "route_total": int64(7)},
+	}}
+	s.Write(context.Background(), "Route_CL", rows)
+	s.Write(context.Background(), "Other_CL", rows)
+
+	rec := httptest.NewRecorder()
+	store.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	if !strings.Contains(out, `gnmi_route_summary_route_total{hostname="tor-1",table="Route_CL",vrf="default"} 7`) {
+		t.Errorf("scrape missing route_total sample:\n%s", out)
+	}
+	if strings.Contains(out, "Other_CL") {
+		t.Errorf("excluded table reached the store:\n%s", out)
+	}
+
+	if _, err := New(config.SinkConfig{Type: "prometheus"}, Env{}); err == nil {
+		t.Error("prometheus sink without a store should fail")
+	}
+}
+
+func TestNewRecordsSendStats(t *testing.T) {
+	stats := health.NewStats(0)
+	s, err := New(config.SinkConfig{Type: "directory", Dir: t.TempDir(), Exclude: []string{"Skip*"}}, Env{
+		Stats: stats.Target("tor-1"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write(context.Background(), "T_CL", testRows)
+	s.Write(context.Background(), "Skip_CL", testRows)
+
+	var buf bytes.Buffer
+	stats.WriteMetrics(&buf)
+	if !strings.Contains(buf.String(), `gnmi_collector_sink_send_seconds_count{target="tor-1",sink="directory"} 1`) {
+		t.Errorf("want one recorded send (excluded table not counted):\n%s", buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gnmi-collector/internal/transform"
+)
+
+// Stdout prints rows as indented JSON, tagging each with its table (and
+// target, when named). Used for --dry-run and local debugging.
+type Stdout struct {
+	w     io.Writer
+	label string
+}
+
+// NewStdout creates a sink printing to os.Stdout.
+func NewStdout(id Identity) *Stdout {
+	label := ""
+	if id.Hostname != "" {
+		label = id.Hostname + "/"
+	}
+	return &Stdout{w: os.Stdout, label: label}
+}
+
+func (s *Stdout) Write(_ context.Context, table string, rows []transform.CommonFields) error {
+	for _, e := range rows {
+		data, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshaling %s row: %w", table, err)
+		}
+		fmt.Fprintf(s.w, "[%s%s] %s\n", s.label, table, string(data))
+	}
+	return nil
+}
+
+func (s *Stdout) Close() error { return nil }
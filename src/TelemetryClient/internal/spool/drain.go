@@ -0,0 +1,69 @@
+package spool
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	initialRetryDelay = 5 * time.Second
+	maxRetryDelay     = 5 * time.Minute
+)
+
+// SendFunc delivers one replayed batch.
+type SendFunc func(table string, rows []map[string]interface{}) error
+
+// Run replays queued batches in order until ctx is cancelled. A failed
+// send is retried with exponential backoff; batches whose error is not
+// retryable (e.g. a payload Azure rejects with 400) are dropped so they
+// cannot block the queue forever.
+func (s *Spool) Run(ctx context.Context, send SendFunc, retryable func(error) bool) {
+	delay := initialRetryDelay
+	replayed := 0
+	for {
+		b, pos, ok, err := s.peek()
+		if !ok {
+			if replayed > 0 {
+				log.Printf("Spool drained: replayed %d batches", replayed)
+				replayed = 0
+			}
+			select {
+			case <-s.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			log.Printf("ERROR: spool: dropping unreadable batch: %v", err)
+			s.ack(pos, true)
+			continue
+		}
+
+		if err := send(b.Table, b.Rows); err != nil {
+			if !retryable(err) {
+				log.Printf("ERROR: spool: dropping %d rows for %s rejected by Azure: %v", len(b.Rows), b.Table, err)
+				s.ack(pos, true)
+				continue
+			}
+			st := s.Stats()
+			log.Printf("WARN: spool replay failed: %v — %d batches (%d bytes) queued, oldest %s; retrying in %s",
+				err, st.Batches, st.Bytes, st.OldestAge.Round(time.Second), delay)
+			select {
+			case <-time.After(delay):
+				delay = delay * 2
+				if delay > maxRetryDelay {
+					delay = maxRetryDelay
+				}
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		delay = initialRetryDelay
+		replayed++
+		s.ack(pos, false)
+	}
+}
@@ -0,0 +1,473 @@
+// Package spool implements a bounded, crash-safe on-disk queue for
+// batches that could not be delivered to Azure. Batches are appended to
+// segment files as length- and CRC-framed JSON records; a background
+// drainer replays them in order once the workspace is reachable again.
+//
+// Layout of the spool directory:
+//
+//	00000000000000000001.seg   segment files, appended in sequence order
+//	ack                        "<segment> <offset>" of the next record to replay
+//
+// A record torn by a crash is detected by its length/CRC and truncated
+// on Open. The ack position is persisted after every replayed batch, so
+// at most one batch is sent twice after a crash.
+package spool
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxBytes     = 256 << 20
+	DefaultMaxAge       = 24 * time.Hour
+	DefaultSegmentBytes = 8 << 20
+
+	recordHeaderSize = 8 // uint32 payload length + uint32 CRC-32 (IEEE)
+	segmentSuffix    = ".seg"
+	ackFile          = "ack"
+)
+
+// Drop policies applied when an Enqueue would exceed MaxBytes.
+const (
+	DropOldest = "oldest" // Evict the oldest queued batches to make room (default)
+	DropNewest = "newest" // Reject the incoming batch and keep the backlog
+)
+
+// ErrFull is returned by Enqueue when the batch cannot be stored.
+var ErrFull = errors.New("spool full")
+
+// Options bounds the spool. Zero values select the defaults.
+type Options struct {
+	MaxBytes     int64         // Total size of queued records
+	MaxAge       time.Duration // Batches older than this are dropped unsent
+	SegmentBytes int64         // Size at which a new segment file is started
+	DropPolicy   string        // DropOldest or DropNewest
+}
+
+// Batch is one spooled Azure upload.
+type Batch struct {
+	Table string                   `json:"table"`
+	Time  time.Time                `json:"time"`
+	Rows  []map[string]interface{} `json:"rows"`
+}
+
+// Stats describes the spool backlog.
+type Stats struct {
+	Batches   int           // Queued batches
+	Bytes     int64         // Queued record bytes
+	OldestAge time.Duration // Age of the oldest queued batch; 0 when empty
+	Segments  int           // Segment files on disk
+	Dropped   uint64        // Batches dropped (full, expired or corrupt) since Open
+}
+
+type recordMeta struct {
+	off  int64 // Offset of the record header in the segment file
+	size int64 // Header plus payload
+	time time.Time
+}
+
+type segment struct {
+	seq     uint64
+	records []recordMeta
+	head    int   // Index of the first record not yet replayed
+	size    int64 // Bytes written to the file
+}
+
+// position identifies a record; used to ack exactly what was replayed.
+type position struct {
+	seq uint64
+	idx int
+}
+
+// Spool is safe for concurrent use by many writers and one drainer.
+type Spool struct {
+	dir  string
+	opts Options
+
+	mu      sync.Mutex
+	segs    []*segment
+	active  *os.File // Append handle of the last segment, opened lazily
+	nextSeq uint64
+	bytes   int64
+	batches int
+	dropped uint64
+	notify  chan struct{}
+}
+
+// Open loads (or creates) the spool in dir, recovering from torn writes
+// and discarding batches that were already replayed.
+func Open(dir string, opts Options) (*Spool, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = DefaultSegmentBytes
+	}
+	if opts.DropPolicy == "" {
+		opts.DropPolicy = DropOldest
+	}
+	if opts.DropPolicy != DropOldest && opts.DropPolicy != DropNewest {
+		return nil, fmt.Errorf("unknown drop policy %q", opts.DropPolicy)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating spool dir: %w", err)
+	}
+
+	s := &Spool{dir: dir, opts: opts, nextSeq: 1, notify: make(chan struct{}, 1)}
+
+	ackSeq, ackOff, err := s.readAck()
+	if err != nil {
+		return nil, err
+	}
+	if ackSeq >= s.nextSeq {
+		s.nextSeq = ackSeq + 1
+	}
+
+	seqs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+		if seq < ackSeq {
+			os.Remove(s.segmentPath(seq))
+			continue
+		}
+		seg, err := s.loadSegment(seq)
+		if err != nil {
+			return nil, err
+		}
+		if seq == ackSeq {
+			for seg.head < len(seg.records) && seg.records[seg.head].off < ackOff {
+				seg.head++
+			}
+		}
+		if seg.head == len(seg.records) {
+			os.Remove(s.segmentPath(seq))
+			continue
+		}
+		for _, r := range seg.records[seg.head:] {
+			s.bytes += r.size
+			s.batches++
+		}
+		s.segs = append(s.segs, seg)
+	}
+
+	s.mu.Lock()
+	s.expireLocked(time.Now())
+	s.mu.Unlock()
+	return s, nil
+}
+
+// Close releases the active segment file.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeActiveLocked()
+}
+
+// Len returns the number of queued batches.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
+
+// Stats returns the current backlog.
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{Batches: s.batches, Bytes: s.bytes, Segments: len(s.segs), Dropped: s.dropped}
+	if len(s.segs) > 0 {
+		head := s.segs[0]
+		st.OldestAge = time.Since(head.records[head.head].time)
+	}
+	return st
+}
+
+// Enqueue durably appends a batch. When the spool is full the drop
+// policy decides whether older batches are evicted or this one is
+// rejected with ErrFull.
+func (s *Spool) Enqueue(table string, rows []map[string]interface{}) error {
+	now := time.Now().UTC()
+	payload, err := json.Marshal(Batch{Table: table, Time: now, Rows: rows})
+	if err != nil {
+		return fmt.Errorf("marshaling batch: %w", err)
+	}
+	rec := make([]byte, recordHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload))
+	copy(rec[recordHeaderSize:], payload)
+	size := int64(len(rec))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked(now)
+	if size > s.opts.MaxBytes {
+		s.dropped++
+		return fmt.Errorf("%w: %d-byte batch exceeds max_bytes", ErrFull, size)
+	}
+	for s.bytes+size > s.opts.MaxBytes {
+		if s.opts.DropPolicy == DropNewest {
+			s.dropped++
+			return ErrFull
+		}
+		s.advanceLocked(true)
+	}
+
+	seg, created, err := s.activeSegmentLocked(size)
+	if err != nil {
+		return err
+	}
+	_, err = s.active.Write(rec)
+	if err == nil {
+		err = s.active.Sync()
+	}
+	if err != nil {
+		// Cut off the partial record so the segment stays parseable.
+		if created {
+			s.closeActiveLocked()
+			os.Remove(s.segmentPath(seg.seq))
+		} else {
+			s.active.Truncate(seg.size)
+		}
+		return fmt.Errorf("writing spool segment: %w", err)
+	}
+	if created {
+		s.segs = append(s.segs, seg)
+	}
+	seg.records = append(seg.records, recordMeta{off: seg.size, size: size, time: now})
+	seg.size += size
+	s.bytes += size
+	s.batches++
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// peek reads the oldest queued batch. ok is false when the spool is
+// empty. A record that fails to decode is returned with an error so the
+// caller can drop it.
+func (s *Spool) peek() (b *Batch, pos position, ok bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expireLocked(time.Now())
+	if len(s.segs) == 0 {
+		return nil, position{}, false, nil
+	}
+	seg := s.segs[0]
+	pos = position{seq: seg.seq, idx: seg.head}
+	r := seg.records[seg.head]
+
+	f, err := os.Open(s.segmentPath(seg.seq))
+	if err != nil {
+		return nil, pos, true, err
+	}
+	defer f.Close()
+	buf := make([]byte, r.size)
+	if _, err := f.ReadAt(buf, r.off); err != nil {
+		return nil, pos, true, err
+	}
+	b = &Batch{}
+	if err := json.Unmarshal(buf[recordHeaderSize:], b); err != nil {
+		return nil, pos, true, fmt.Errorf("decoding spooled batch: %w", err)
+	}
+	return b, pos, true, nil
+}
+
+// ack removes the batch at pos after a successful replay (or drops it
+// when dropped is set). It is a no-op if the batch was already evicted.
+func (s *Spool) ack(pos position, dropped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.segs) == 0 || s.segs[0].seq != pos.seq || s.segs[0].head != pos.idx {
+		return
+	}
+	s.advanceLocked(dropped)
+}
+
+// advanceLocked moves past the oldest queued batch, deleting its segment
+// once every record in it is gone, and persists the new ack position.
+func (s *Spool) advanceLocked(dropped bool) {
+	seg := s.segs[0]
+	r := seg.records[seg.head]
+	seg.head++
+	s.bytes -= r.size
+	s.batches--
+	if dropped {
+		s.dropped++
+	}
+
+	if seg.head < len(seg.records) {
+		s.writeAck(seg.seq, seg.records[seg.head].off)
+		return
+	}
+	if len(s.segs) == 1 {
+		s.closeActiveLocked()
+	}
+	os.Remove(s.segmentPath(seg.seq))
+	s.segs = s.segs[1:]
+	s.writeAck(seg.seq+1, 0)
+}
+
+// expireLocked drops batches older than MaxAge.
+func (s *Spool) expireLocked(now time.Time) {
+	cutoff := now.Add(-s.opts.MaxAge)
+	for len(s.segs) > 0 {
+		head := s.segs[0]
+		if !head.records[head.head].time.Before(cutoff) {
+			return
+		}
+		s.advanceLocked(true)
+	}
+}
+
+// activeSegmentLocked returns the segment the next record of size bytes
+// is appended to, starting a new one when the current one is full. A new
+// segment is only added to the index by the caller once a record has
+// been written to it, so the index never holds an empty segment.
+func (s *Spool) activeSegmentLocked(size int64) (seg *segment, created bool, err error) {
+	if n := len(s.segs); n > 0 {
+		last := s.segs[n-1]
+		if last.size+size <= s.opts.SegmentBytes {
+			if s.active == nil {
+				f, err := os.OpenFile(s.segmentPath(last.seq), os.O_WRONLY|os.O_APPEND, 0600)
+				if err != nil {
+					return nil, false, fmt.Errorf("opening spool segment: %w", err)
+				}
+				s.active = f
+			}
+			return last, false, nil
+		}
+	}
+
+	s.closeActiveLocked()
+	seg = &segment{seq: s.nextSeq}
+	f, err := os.OpenFile(s.segmentPath(seg.seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, false, fmt.Errorf("creating spool segment: %w", err)
+	}
+	s.nextSeq++
+	s.active = f
+	return seg, true, nil
+}
+
+func (s *Spool) closeActiveLocked() error {
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentSuffix))
+}
+
+func (s *Spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool dir: %w", err)
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// loadSegment indexes the records of a segment file, truncating it at
+// the first torn or corrupt record.
+func (s *Spool) loadSegment(seq uint64) (*segment, error) {
+	path := s.segmentPath(seq)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading spool segment: %w", err)
+	}
+
+	seg := &segment{seq: seq}
+	var off int64
+	for int64(len(data))-off >= recordHeaderSize {
+		n := int64(binary.LittleEndian.Uint32(data[off : off+4]))
+		sum := binary.LittleEndian.Uint32(data[off+4 : off+8])
+		end := off + recordHeaderSize + n
+		if end > int64(len(data)) {
+			break
+		}
+		payload := data[off+recordHeaderSize : end]
+		if crc32.ChecksumIEEE(payload) != sum {
+			break
+		}
+		var hdr struct {
+			Time time.Time `json:"time"`
+		}
+		if err := json.Unmarshal(payload, &hdr); err != nil {
+			break
+		}
+		seg.records = append(seg.records, recordMeta{off: off, size: end - off, time: hdr.Time})
+		off = end
+	}
+	if off < int64(len(data)) {
+		if err := os.Truncate(path, off); err != nil {
+			return nil, fmt.Errorf("truncating torn spool segment: %w", err)
+		}
+	}
+	seg.size = off
+	return seg, nil
+}
+
+func (s *Spool) readAck() (seq uint64, off int64, err error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, ackFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading spool ack: %w", err)
+	}
+	if _, err := fmt.Sscanf(string(data), "%d %d", &seq, &off); err != nil {
+		// A damaged ack file only costs duplicate replays.
+		return 0, 0, nil
+	}
+	return seq, off, nil
+}
+
+// writeAck persists the replay position atomically (write + rename).
+func (s *Spool) writeAck(seq uint64, off int64) {
+	path := filepath.Join(s.dir, ackFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d\n", seq, off)), 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
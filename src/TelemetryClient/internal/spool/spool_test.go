@@ -0,0 +1,236 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func rows(n int) []map[string]interface{} {
+	return []map[string]interface{}{{"n": n}}
+}
+
+// drainAll pops every queued batch and returns their tables in order.
+func drainAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var tables []string
+	for {
+		b, pos, ok, err := s.peek()
+		if err != nil {
+			t.Fatalf("peek() error = %v", err)
+		}
+		if !ok {
+			return tables
+		}
+		tables = append(tables, b.Table)
+		s.ack(pos, false)
+	}
+}
+
+func TestEnqueueReplayInOrder(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{SegmentBytes: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, table := range []string{"A", "B", "C"} {
+		if err := s.Enqueue(table, rows(1)); err != nil {
+			t.Fatalf("Enqueue(%s) error = %v", table, err)
+		}
+	}
+	st := s.Stats()
+	if st.Batches != 3 || st.Bytes == 0 {
+		t.Errorf("Stats() = %+v, want 3 batches", st)
+	}
+	if st.Segments != 3 {
+		t.Errorf("segments = %d, want 3 (each record exceeds segment_bytes)", st.Segments)
+	}
+
+	got := drainAll(t, s)
+	if len(got) != 3 || got[0] != "A" || got[1] != "B" || got[2] != "C" {
+		t.Errorf("replay order = %v, want [A B C]", got)
+	}
+	if st := s.Stats(); st.Batches != 0 || st.Bytes != 0 || st.OldestAge != 0 {
+		t.Errorf("Stats() after drain = %+v, want empty", st)
+	}
+}
+
+func TestReopenResumesAfterAck(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"A", "B", "C"} {
+		if err := s.Enqueue(table, rows(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, pos, _, _ := s.peek()
+	s.ack(pos, false)
+	s.Close()
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := drainAll(t, s); len(got) != 2 || got[0] != "B" || got[1] != "C" {
+		t.Errorf("after reopen replay = %v, want [B C]", got)
+	}
+
+	// New batches after a full drain start a fresh segment.
+	if err := s.Enqueue("D", rows(1)); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainAll(t, s); len(got) != 1 || got[0] != "D" {
+		t.Errorf("replay = %v, want [D]", got)
+	}
+}
+
+func TestOpenTruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Enqueue("A", rows(1)); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Simulate a crash in the middle of appending a second record.
+	seg := s.segmentPath(1)
+	f, err := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{200, 0, 0, 0, 1, 2, 3, 4, '{', '"'})
+	f.Close()
+
+	s, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1 intact batch", s.Len())
+	}
+	if err := s.Enqueue("B", rows(2)); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainAll(t, s); len(got) != 2 || got[0] != "A" || got[1] != "B" {
+		t.Errorf("replay = %v, want [A B]", got)
+	}
+}
+
+func TestDropPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		want   []string
+		err    bool
+	}{
+		{DropOldest, []string{"B", "C"}, false},
+		{DropNewest, []string{"A", "B"}, true},
+	} {
+		t.Run(tt.policy, func(t *testing.T) {
+			s, err := Open(t.TempDir(), Options{DropPolicy: tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			if err := s.Enqueue("A", rows(1)); err != nil {
+				t.Fatal(err)
+			}
+			// Room for exactly two records of this size.
+			s.opts.MaxBytes = 2 * s.Stats().Bytes
+			if err := s.Enqueue("B", rows(1)); err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Enqueue("C", rows(1))
+			if tt.err != errors.Is(err, ErrFull) {
+				t.Errorf("Enqueue(C) error = %v, want ErrFull = %v", err, tt.err)
+			}
+			if d := s.Stats().Dropped; d != 1 {
+				t.Errorf("Dropped = %d, want 1", d)
+			}
+			got := drainAll(t, s)
+			if len(got) != 2 || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("replay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxAgeExpiresBatches(t *testing.T) {
+	s, err := Open(t.TempDir(), Options{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Enqueue("old", rows(1)); err != nil {
+		t.Fatal(err)
+	}
+	s.segs[0].records[0].time = time.Now().Add(-2 * time.Hour)
+	if err := s.Enqueue("new", rows(1)); err != nil {
+		t.Fatal(err)
+	}
+	if got := drainAll(t, s); len(got) != 1 || got[0] != "new" {
+		t.Errorf("replay = %v, want [new]", got)
+	}
+	if d := s.Stats().Dropped; d != 1 {
+		t.Errorf("Dropped = %d, want 1", d)
+	}
+}
+
+func TestRunReplaysAndDropsRejected(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "spool"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for _, table := range []string{"A", "bad", "B"} {
+		if err := s.Enqueue(table, rows(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errRejected := errors.New("400 bad request")
+	sent := make(chan string, 3)
+	send := func(table string, _ []map[string]interface{}) error {
+		if table == "bad" {
+			return errRejected
+		}
+		sent <- table
+		return nil
+	}
+	retryable := func(err error) bool { return !errors.Is(err, errRejected) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx, send, retryable)
+		close(done)
+	}()
+
+	for _, want := range []string{"A", "B"} {
+		select {
+		case got := <-sent:
+			if got != want {
+				t.Errorf("replayed %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for replay")
+		}
+	}
+	cancel()
+	<-done
+	if st := s.Stats(); st.Batches != 0 || st.Dropped != 1 {
+		t.Errorf("Stats() = %+v, want empty with 1 dropped", st)
+	}
+}
@@ -8,6 +8,10 @@ const dataTypeArp = "arp_entry"
 
 func init() {
 	Register("arp-table", func() Transformer { return &ArpTransformer{} })
+	RegisterMetrics(dataTypeArp, MetricSpec{
+		Labels: []string{"ip_address", "mac_address", "interface"},
+		Gauges: []string{"age"},
+	})
 }
 
 type ArpTransformer struct{}
@@ -8,6 +8,10 @@ const dataTypeBgpGlobal = "bgp_global"
 
 func init() {
 	Register("bgp-global", func() Transformer { return &BgpGlobalTransformer{} })
+	RegisterMetrics(dataTypeBgpGlobal, MetricSpec{
+		Labels: []string{"vrf_name", "local_as", "router_id"},
+		Gauges: []string{"total_paths", "total_prefixes"},
+	})
 }
 
 type BgpGlobalTransformer struct{}
@@ -11,6 +11,16 @@ const dataTypeBgpSummary = "bgp_summary"
 
 func init() {
 	Register("bgp-neighbors", func() Transformer { return &BgpSummaryTransformer{} })
+	RegisterMetrics(dataTypeBgpSummary, MetricSpec{
+		Labels: []string{"neighbor_address", "vrf_name", "peer_as"},
+		Counters: []string{
+			"msg_recvd", "msg_sent",
+			"messages_received_updates", "messages_received_notifications",
+			"messages_sent_updates", "messages_sent_notifications",
+			"established_transitions", "connection_attempts", "connection_drops",
+		},
+		Gauges: []string{"enabled", "prefix_received", "hold_interval", "keepalive_interval"},
+	})
 }
 
 // BgpSummaryTransformer converts gNMI BGP neighbor state data (from the
@@ -64,6 +74,28 @@ func (t *BgpSummaryTransformer) Transform(notifications []gnmi.Notification) ([]
 	return results, nil
 }
 
+// Removed emits a row for every BGP neighbor deleted from the
+// configuration.
+func (t *BgpSummaryTransformer) Removed(notifications []gnmi.Notification) ([]CommonFields, error) {
+	var results []CommonFields
+	for _, n := range notifications {
+		for _, path := range n.Deletes {
+			if !deletedEntry(path, "neighbor") {
+				continue
+			}
+			vrfName := extractKey(path, "name")
+			if vrfName == "" {
+				vrfName = "default"
+			}
+			results = append(results, NewRemovedFields(dataTypeBgpSummary, map[string]interface{}{
+				"neighbor_address": ExtractNeighborAddress(path),
+				"vrf_name":         vrfName,
+			}, n.Timestamp))
+		}
+	}
+	return results, nil
+}
+
 // buildBgpNeighborEntry extracts a single BGP neighbor entry from a
 // neighbor state map. Returns nil if the neighbor address cannot be found.
 func buildBgpNeighborEntry(vals map[string]interface{}, path, vrfName string, gnmiTimestampNs int64) *CommonFields {
@@ -177,6 +209,8 @@ func toInt64(v interface{}) (int64, bool) {
 		return int64(n), true
 	case int64:
 		return n, true
+	case uint64:
+		return int64(n), true
 	case string:
 		if n == "" {
 			return 0, false
@@ -88,10 +88,14 @@ func GetFloat(m map[string]interface{}, key string) float64 {
 		switch n := v.(type) {
 		case float64:
 			return n
+		case float32:
+			return float64(n)
 		case int:
 			return float64(n)
 		case int64:
 			return float64(n)
+		case uint64:
+			return float64(n)
 		case string:
 			// Try parsing as plain decimal first (e.g., "1.73" from NX-OS)
 			if f, err := strconv.ParseFloat(n, 64); err == nil {
@@ -117,7 +121,7 @@ func GetBool(m map[string]interface{}, key string) bool {
 }
 
 // GetInt64 safely extracts a numeric value from a map as int64.
-// Handles float64, int, string (parseable), and int64 types.
+// Handles float64, int, int64, uint64, and string (parseable) types.
 // Returns 0 if key not found or not parseable.
 func GetInt64(m map[string]interface{}, key string) int64 {
 	v, ok := m[key]
@@ -127,15 +131,20 @@ func GetInt64(m map[string]interface{}, key string) int64 {
 	return ToInt64(v)
 }
 
-// ToInt64 converts an interface value to int64.
+// ToInt64 converts an interface value to int64. Unsigned values (PROTO
+// encoding) past 2^63 wrap negative, as counters stored as int64 do.
 func ToInt64(v interface{}) int64 {
 	switch n := v.(type) {
 	case float64:
 		return int64(n)
+	case float32:
+		return int64(n)
 	case int:
 		return int64(n)
 	case int64:
 		return n
+	case uint64:
+		return int64(n)
 	case string:
 		i, _ := strconv.ParseInt(n, 10, 64)
 		return i
@@ -128,3 +128,17 @@ func TestInterfaceType(t *testing.T) {
 		}
 	}
 }
+
+func TestProtoNumericTypes(t *testing.T) {
+	// PROTO encoding decodes counters to uint64 and floats to float32.
+	m := map[string]interface{}{"octets": uint64(1234), "temp": float32(41.5)}
+	if got := GetInt64(m, "octets"); got != 1234 {
+		t.Errorf("GetInt64(uint64) = %d, want 1234", got)
+	}
+	if got := GetFloat(m, "octets"); got != 1234 {
+		t.Errorf("GetFloat(uint64) = %v, want 1234", got)
+	}
+	if got := GetFloat(m, "temp"); got != 41.5 {
+		t.Errorf("GetFloat(float32) = %v, want 41.5", got)
+	}
+}
@@ -12,6 +12,18 @@ const dataTypeEnvTemp = "environment_temperature"
 func init() {
 Register("temperature", func() Transformer { return &EnvironmentTempTransformer{} })
 Register("power-supply", func() Transformer { return &EnvironmentPowerTransformer{} })
+RegisterMetrics(dataTypeEnvTemp, MetricSpec{
+Labels: []string{"module", "sensor"},
+Gauges: []string{"current_temp", "high_threshold", "critical_high_threshold", "low_threshold"},
+})
+RegisterMetrics(dataTypeEnvPower, MetricSpec{
+Labels: []string{"ps_name"},
+Gauges: []string{
+"total_capacity", "input_voltage", "input_current", "output_voltage",
+"output_current", "output_power", "actual_input", "actual_output",
+"temp", "software_alarm",
+},
+})
 }
 
 type EnvironmentTempTransformer struct{}
@@ -8,6 +8,14 @@ const dataTypeInterfaceCounters = "interface_counters"
 
 func init() {
 	Register("interface-counters", func() Transformer { return &InterfaceCountersTransformer{} })
+	RegisterMetrics(dataTypeInterfaceCounters, MetricSpec{
+		Labels: []string{"interface_name", "interface_type"},
+		Counters: []string{
+			"in_octets", "in_ucast_pkts", "in_mcast_pkts", "in_bcast_pkts",
+			"out_octets", "out_ucast_pkts", "out_mcast_pkts", "out_bcast_pkts",
+			"in_errors", "in_discards", "out_errors", "out_discards",
+		},
+	})
 }
 
 // InterfaceCountersTransformer converts gNMI interface counter data
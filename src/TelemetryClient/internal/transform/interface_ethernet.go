@@ -10,6 +10,10 @@ const dataTypeInterfaceEthernet = "interface_ethernet"
 
 func init() {
 	Register("if-ethernet", func() Transformer { return &InterfaceEthernetTransformer{} })
+	RegisterMetrics(dataTypeInterfaceEthernet, MetricSpec{
+		Labels: []string{"interface_name", "duplex"},
+		Gauges: []string{"auto_negotiate"},
+	})
 }
 
 type InterfaceEthernetTransformer struct{}
@@ -8,6 +8,7 @@ const dataTypeInterfaceStatus = "interface_status"
 
 func init() {
 	Register("interface-status", func() Transformer { return &InterfaceStatusTransformer{} })
+	RegisterMetrics(dataTypeInterfaceStatus, MetricSpec{})
 }
 
 // InterfaceStatusTransformer converts gNMI interface state data to the
@@ -8,6 +8,7 @@ const dataTypeInventory = "inventory"
 
 func init() {
 	Register("platform-inventory", func() Transformer { return &InventoryTransformer{} })
+	RegisterMetrics(dataTypeInventory, MetricSpec{})
 }
 
 type InventoryTransformer struct{}
@@ -8,6 +8,10 @@ const dataTypeLldpNeighbor = "lldp_neighbor"
 
 func init() {
 	Register("lldp-neighbors", func() Transformer { return &LldpNeighborTransformer{} })
+	RegisterMetrics(dataTypeLldpNeighbor, MetricSpec{
+		Labels: []string{"local_port_id", "chassis_id", "port_id", "system_name"},
+		Gauges: []string{"time_remaining", "max_frame_size"},
+	})
 }
 
 // LldpNeighborTransformer converts gNMI LLDP neighbor data to the schema
@@ -72,7 +76,15 @@ func (t *LldpNeighborTransformer) Transform(notifications []gnmi.Notification) (
 					}
 				}
 
+				// The list key identifies the neighbor in delete
+				// notifications, so removed rows can be matched to it.
+				neighborID := GetString(nbr, "id")
+				if neighborID == "" {
+					neighborID = GetString(state, "id")
+				}
+
 				msg := map[string]interface{}{
+					"neighbor_id":          neighborID,
 					"chassis_id":           GetString(state, "chassis-id"),
 					"port_id":              GetString(state, "port-id"),
 					"local_port_id":        NormalizeInterfaceName(localPort),
@@ -96,4 +108,22 @@ func (t *LldpNeighborTransformer) Transform(notifications []gnmi.Notification) (
 	return results, nil
 }
 
+// Removed emits a row for every LLDP neighbor deleted from a local port,
+// keyed by local_port_id and neighbor_id like the neighbor's live rows.
+func (t *LldpNeighborTransformer) Removed(notifications []gnmi.Notification) ([]CommonFields, error) {
+	var results []CommonFields
+	for _, n := range notifications {
+		for _, path := range n.Deletes {
+			if !deletedEntry(path, "neighbor") {
+				continue
+			}
+			results = append(results, NewRemovedFields(dataTypeLldpNeighbor, map[string]interface{}{
+				"local_port_id": NormalizeInterfaceName(ExtractInterfaceName(path)),
+				"neighbor_id":   extractKey(path, "[id"), // Bracket keeps it from matching e.g. "chassis-id="
+			}, n.Timestamp))
+		}
+	}
+	return results, nil
+}
+
 
@@ -8,6 +8,10 @@ const dataTypeMacTable = "mac_table"
 
 func init() {
 	Register("mac-table", func() Transformer { return &MacAddressTransformer{} })
+	RegisterMetrics(dataTypeMacTable, MetricSpec{
+		Labels: []string{"mac_address", "vlan", "port"},
+		Gauges: []string{"age"},
+	})
 }
 
 type MacAddressTransformer struct{}
@@ -68,3 +72,21 @@ func (t *MacAddressTransformer) Transform(notifications []gnmi.Notification) ([]
 
 	return results, nil
 }
+
+// Removed emits a row for every MAC table entry that aged out or was
+// cleared.
+func (t *MacAddressTransformer) Removed(notifications []gnmi.Notification) ([]CommonFields, error) {
+	var results []CommonFields
+	for _, n := range notifications {
+		for _, path := range n.Deletes {
+			if !deletedEntry(path, "entry") {
+				continue
+			}
+			results = append(results, NewRemovedFields(dataTypeMacTable, map[string]interface{}{
+				"mac_address": extractKey(path, "mac-address"),
+				"vlan":        extractKey(path, "vlan"),
+			}, n.Timestamp))
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,73 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MetricSpec describes how the rows of one data type are exposed as
+// Prometheus metrics. Each listed value field becomes a metric named
+// gnmi_<data_type>_<field>, labelled with the entity key fields, so a
+// row such as an interface counter entry maps to one sample per field.
+// Fields not listed are not exported; a spec with no value fields marks
+// a data type (e.g. inventory) that has nothing numeric to expose.
+type MetricSpec struct {
+	Labels   []string // Message fields identifying the entity, e.g. interface_name
+	Counters []string // Monotonically increasing fields
+	Gauges   []string // Point-in-time fields; bools export as 0/1
+}
+
+// metricSpecs holds the metric metadata of each data type. Declared via
+// RegisterMetrics in the same init() as the transformers producing it.
+var metricSpecs = map[string]MetricSpec{}
+
+// RegisterMetrics declares the metric mapping for a data type. Panics if
+// the data type already has one, as Register does for path names.
+func RegisterMetrics(dataType string, spec MetricSpec) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := metricSpecs[dataType]; exists {
+		panic(fmt.Sprintf("transform: duplicate metrics registration for %q", dataType))
+	}
+	metricSpecs[dataType] = spec
+}
+
+// MetricsFor returns the metric mapping declared for a data type.
+func MetricsFor(dataType string) (MetricSpec, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	spec, ok := metricSpecs[dataType]
+	return spec, ok
+}
+
+// MetricValue converts a message field to a sample value. Transformers
+// keep many numeric fields as strings to match the legacy parser schema
+// ("45.5", "1200"), so decimal strings are parsed; anything else that is
+// not a number or bool reports ok=false.
+func MetricValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, false
+		}
+		return f, true
+	}
+	return 0, false
+}
@@ -12,6 +12,10 @@ func init() {
 Register("nx-env-sensor", func() Transformer { return &NativeEnvTempTransformer{} })
 Register("nx-env-psu", func() Transformer { return &NativeEnvPowerTransformer{} })
 Register("nx-fan", func() Transformer { return &NativeEnvFanTransformer{} })
+RegisterMetrics("fan", MetricSpec{
+Labels: []string{"name"},
+Gauges: []string{"speed"},
+})
 }
 
 func (t *NativeEnvTempTransformer) DataType() string { return dataTypeEnvTemp }
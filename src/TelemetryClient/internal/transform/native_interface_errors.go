@@ -12,6 +12,15 @@ type NativeInterfaceErrorsTransformer struct{}
 
 func init() {
 	Register("nx-intf-errors", func() Transformer { return &NativeInterfaceErrorsTransformer{} })
+	RegisterMetrics(dataTypeInterfaceErrors, MetricSpec{
+		Labels: []string{"interface_name", "interface_type"},
+		Counters: []string{
+			"crc_align_errors", "collisions", "fragments", "jabbers", "overrun",
+			"pkts_64_octets", "pkts_65_to_127_octets", "pkts_128_to_255_octets",
+			"pkts_256_to_511_octets", "pkts_512_to_1023_octets", "pkts_1024_to_1518_octets",
+			"broadcast_pkts", "multicast_pkts",
+		},
+	})
 }
 
 func (t *NativeInterfaceErrorsTransformer) DataType() string { return dataTypeInterfaceErrors }
@@ -10,6 +10,10 @@ type NativeRouteSummaryTransformer struct{}
 
 func init() {
 	Register("nx-route-summary", func() Transformer { return &NativeRouteSummaryTransformer{} })
+	RegisterMetrics(dataTypeRouteSummary, MetricSpec{
+		Labels: []string{"vrf"},
+		Gauges: []string{"route_total", "path_total", "mpath_total"},
+	})
 }
 
 func (t *NativeRouteSummaryTransformer) DataType() string { return dataTypeRouteSummary }
@@ -134,6 +134,8 @@ func nativeIntVal(m map[string]interface{}, key string) int {
 		return int(n)
 	case int64:
 		return int(n)
+	case uint64:
+		return int(n)
 	default:
 		return 0
 	}
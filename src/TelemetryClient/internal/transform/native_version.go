@@ -12,6 +12,9 @@ type NativeVersionTransformer struct{}
 
 func init() {
 	Register("nx-version", func() Transformer { return &NativeVersionTransformer{} })
+	RegisterMetrics(dataTypeVersion, MetricSpec{
+		Gauges: []string{"memory_kb"},
+	})
 }
 
 func (t *NativeVersionTransformer) DataType() string { return dataTypeVersion }
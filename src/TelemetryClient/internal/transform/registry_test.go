@@ -100,3 +100,35 @@ func TestBuildMapReturnsFreshInstances(t *testing.T) {
 	// coalesce allocations of zero-size structs (all our transformers are
 	// stateless). This is expected behavior.
 }
+
+func TestEveryDataTypeHasMetrics(t *testing.T) {
+	// A transformer whose data type has no RegisterMetrics entry would be
+	// silently missing from /metrics.
+	for name, tr := range BuildMap() {
+		if _, ok := MetricsFor(tr.DataType()); !ok {
+			t.Errorf("%s: data type %q has no metric metadata", name, tr.DataType())
+		}
+	}
+}
+
+func TestMetricValue(t *testing.T) {
+	for _, tt := range []struct {
+		in   interface{}
+		want float64
+		ok   bool
+	}{
+		{int64(42), 42, true},
+		{3.5, 3.5, true},
+		{" 45.5 ", 45.5, true},
+		{true, 1, true},
+		{false, 0, true},
+		{"", 0, false},
+		{"up", 0, false},
+		{nil, 0, false},
+	} {
+		got, ok := MetricValue(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("MetricValue(%#v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package transform
+
+import (
+	"strings"
+
+	"gnmi-collector/internal/gnmi"
+)
+
+// StateRemoved is the "state" value of rows describing an entity that
+// the device reported as deleted.
+const StateRemoved = "removed"
+
+// Remover is implemented by transformers that can turn gNMI delete
+// notifications into rows. In subscribe mode, Removed receives the
+// notifications whose Deletes hold paths already routed to the
+// transformer's subscribed path, and returns one row per removed entity
+// (a neighbor that went away, a MAC that aged out). Deletes of single
+// leaves below an entity are not removals and are skipped.
+type Remover interface {
+	Removed(notifications []gnmi.Notification) ([]CommonFields, error)
+}
+
+// NewRemovedFields builds the row for a removed entity from its key
+// fields, marked with state "removed".
+func NewRemovedFields(dataType string, keys map[string]interface{}, gnmiTimestampNs int64) CommonFields {
+	keys["state"] = StateRemoved
+	return NewCommonFields(dataType, keys, gnmiTimestampNs)
+}
+
+// deletedEntry reports whether a delete path removes a whole element of
+// the named list: the path's last element of that list must carry its
+// keys and be followed by nothing or only its state container. Key
+// values may contain slashes (interface[name=Ethernet1/1]), so the keys
+// are skipped bracket by bracket rather than by splitting the path.
+func deletedEntry(path, list string) bool {
+	idx := strings.LastIndex(path, "/"+list+"[")
+	if idx == -1 {
+		return false
+	}
+	rest := path[idx+len(list)+1:]
+	for strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end == -1 {
+			return false
+		}
+		rest = rest[end+1:]
+	}
+	return rest == "" || rest == "/state"
+}
@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"testing"
+
+	"gnmi-collector/internal/gnmi"
+)
+
+func TestDeletedEntry(t *testing.T) {
+	tests := []struct {
+		path, list string
+		want       bool
+	}{
+		{"/lldp/interfaces/interface[name=Eth1/1]/neighbors/neighbor[id=7]", "neighbor", true},
+		{"/lldp/interfaces/interface[name=Eth1/1]/neighbors/neighbor[id=7]/state", "neighbor", true},
+		{"/lldp/interfaces/interface[name=Eth1/1]/neighbors/neighbor[id=7]/state/ttl", "neighbor", false},
+		{"/lldp/interfaces/interface[name=Eth1/1]/neighbors", "neighbor", false},
+		{"/network-instances/network-instance[name=default]/fdb/mac-table/entries/entry[mac-address=aa:bb:cc:dd:ee:ff][vlan=10]", "entry", true},
+		{"/bgp/neighbors/neighbor[neighbor-address=10.0.0.1]/state/description", "neighbor", false},
+	}
+	for _, tt := range tests {
+		if got := deletedEntry(tt.path, tt.list); got != tt.want {
+			t.Errorf("deletedEntry(%q, %q) = %v, want %v", tt.path, tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestRemovedRows(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Remover
+		path string
+		want map[string]string
+	}{
+		{
+			"lldp", &LldpNeighborTransformer{},
+			"/lldp/interfaces/interface[name=eth1/1]/neighbors/neighbor[id=7]",
+			map[string]string{"local_port_id": "Eth1/1", "neighbor_id": "7"},
+		},
+		{
+			"bgp", &BgpSummaryTransformer{},
+			"/network-instances/network-instance[name=default]/protocols/protocol[identifier=BGP][name=bgp]/bgp/neighbors/neighbor[neighbor-address=10.0.0.1]/state",
+			map[string]string{"neighbor_address": "10.0.0.1", "vrf_name": "default"},
+		},
+		{
+			"mac", &MacAddressTransformer{},
+			"/network-instances/network-instance[name=default]/fdb/mac-table/entries/entry[mac-address=aa:bb:cc:dd:ee:ff][vlan=10]",
+			map[string]string{"mac_address": "aa:bb:cc:dd:ee:ff", "vlan": "10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := tt.r.Removed([]gnmi.Notification{{Timestamp: 1, Deletes: []string{tt.path, tt.path + "/state/leaf"}}})
+			if err != nil || len(rows) != 1 {
+				t.Fatalf("Removed() = %v, %v; want one row", rows, err)
+			}
+			msg := rows[0].Message.(map[string]interface{})
+			if msg["state"] != StateRemoved {
+				t.Errorf("state = %v, want removed", msg["state"])
+			}
+			for k, v := range tt.want {
+				if msg[k] != v {
+					t.Errorf("%s = %v, want %v", k, msg[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestLldpRemovedMatchesLiveRow(t *testing.T) {
+	tr := &LldpNeighborTransformer{}
+	live, err := tr.Transform(loadTestData(t, "lldp-neighbors.json"))
+	if err != nil || len(live) == 0 {
+		t.Fatalf("Transform() = %d rows, %v", len(live), err)
+	}
+	liveMsg := live[0].Message.(map[string]interface{})
+
+	path := "/lldp/interfaces/interface[name=eth1/36/4]/neighbors/neighbor[id=1]"
+	removed, err := tr.Removed([]gnmi.Notification{{Timestamp: 2, Deletes: []string{path}}})
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("Removed() = %v, %v; want one row", removed, err)
+	}
+	for k, v := range removed[0].Message.(map[string]interface{}) {
+		if k == "state" {
+			continue
+		}
+		if liveMsg[k] != v {
+			t.Errorf("removed row %s = %v, live row has %v", k, v, liveMsg[k])
+		}
+	}
+}
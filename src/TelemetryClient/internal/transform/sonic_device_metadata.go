@@ -6,6 +6,7 @@ const dataTypeSonicDeviceMetadata = "device_metadata"
 
 func init() {
 	Register("sonic-device-metadata", func() Transformer { return &SonicDeviceMetadataTransformer{} })
+	RegisterMetrics(dataTypeSonicDeviceMetadata, MetricSpec{})
 }
 
 type SonicDeviceMetadataTransformer struct{}
@@ -14,6 +14,16 @@ func init() {
 	Register("system-cpus", func() Transformer { return &SystemResourcesTransformer{} })
 	Register("system-memory", func() Transformer { return &SystemResourcesTransformer{} })
 	Register("system-state", func() Transformer { return &SystemUptimeTransformer{} })
+	RegisterMetrics(dataTypeSystemResources, MetricSpec{
+		Gauges: []string{
+			"cpu_state_user", "cpu_state_kernel", "cpu_state_idle",
+			"load_avg_5sec", "load_avg_1min", "load_avg_5min", "load_avg_15min",
+			"processes_running", "processes_total",
+			"memory_usage_total", "memory_usage_used", "memory_usage_free",
+			"memory_usage_reserved", "kernel_buffers", "kernel_cached",
+		},
+	})
+	RegisterMetrics(dataTypeSystemUptime, MetricSpec{})
 }
 
 // SystemResourcesTransformer combines CPU and memory gNMI data into the
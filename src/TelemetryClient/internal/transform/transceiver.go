@@ -8,6 +8,10 @@ const dataTypeTransceiver = "transceiver"
 
 func init() {
 	Register("transceiver", func() Transformer { return &TransceiverTransformer{} })
+	RegisterMetrics(dataTypeTransceiver, MetricSpec{
+		Labels: []string{"interface_name"},
+		Gauges: []string{"transceiver_present", "dom_supported"},
+	})
 }
 
 type TransceiverTransformer struct{}
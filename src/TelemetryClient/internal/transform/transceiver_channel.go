@@ -8,6 +8,10 @@ const dataTypeTransceiverChannel = "transceiver_dom"
 
 func init() {
 	Register("transceiver-channel", func() Transformer { return &TransceiverChannelTransformer{} })
+	RegisterMetrics(dataTypeTransceiverChannel, MetricSpec{
+		Labels: []string{"interface_name", "channel_index"},
+		Gauges: []string{"input_power", "output_power", "laser_bias_current"},
+	})
 }
 
 // TransceiverChannelTransformer extracts per-channel DOM diagnostics from
@@ -0,0 +1,12 @@
+// Package gnmicollector embeds the example configurations shipped next
+// to the collector. Their path sets are the built-in device profiles
+// used when a config sets device_type to auto.
+package gnmicollector
+
+import _ "embed"
+
+//go:embed config.cisco.yaml
+var CiscoNXOSProfile []byte
+
+//go:embed config.sonic.yaml
+var SONiCProfile []byte